@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	_ "embed"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
@@ -11,7 +12,11 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/edalcin/smartlattes/internal/ai"
+	"github.com/edalcin/smartlattes/internal/dedup"
 	"github.com/edalcin/smartlattes/internal/handler"
+	"github.com/edalcin/smartlattes/internal/jobs"
+	"github.com/edalcin/smartlattes/internal/quota"
 	"github.com/edalcin/smartlattes/internal/static"
 	"github.com/edalcin/smartlattes/internal/store"
 )
@@ -25,17 +30,10 @@ var analisePrompt string
 //go:embed chatPrompt.md
 var chatPrompt string
 
-func main() {
-	mongoURI := os.Getenv("MONGODB_URI")
-	if mongoURI == "" {
-		log.Fatal("MONGODB_URI é obrigatório")
-	}
-
-	dbName := os.Getenv("MONGODB_DATABASE")
-	if dbName == "" {
-		dbName = "smartLattes"
-	}
+//go:embed chatToolsPrompt.md
+var chatToolsPrompt string
 
+func main() {
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
@@ -55,16 +53,78 @@ func main() {
 		}
 	}
 
-	var db *store.MongoDB
-	db, err := store.Connect(mongoURI, dbName)
+	maxBatchUploadSize := int64(104857600)
+	if v := os.Getenv("MAX_BATCH_UPLOAD_SIZE"); v != "" {
+		if parsed, err := strconv.ParseInt(v, 10, 64); err == nil {
+			maxBatchUploadSize = parsed
+		}
+	}
+
+	aiConfig := ai.Config{
+		OpenAIBaseURL:     os.Getenv("OPENAI_BASE_URL"),
+		AnthropicBaseURL:  os.Getenv("ANTHROPIC_BASE_URL"),
+		GeminiBaseURL:     os.Getenv("GEMINI_BASE_URL"),
+		CompatibleBaseURL: os.Getenv("OPENAI_COMPATIBLE_BASE_URL"),
+		CompatibleAPIKey:  os.Getenv("OPENAI_COMPATIBLE_API_KEY"),
+		CompatibleName:    os.Getenv("OPENAI_COMPATIBLE_NAME"),
+		OllamaBaseURL:     os.Getenv("OLLAMA_BASE_URL"),
+		OpenAIAPIKey:      os.Getenv("OPENAI_API_KEY"),
+		AnthropicAPIKey:   os.Getenv("ANTHROPIC_API_KEY"),
+		GeminiAPIKey:      os.Getenv("GEMINI_API_KEY"),
+	}
+	if v := os.Getenv("OLLAMA_NUM_CTX"); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil {
+			aiConfig.OllamaContextSize = parsed
+		}
+	}
+
+	pricing := ai.DefaultPricing
+	if path := os.Getenv("PRICING_FILE"); path != "" {
+		loaded, err := ai.LoadPricing(path)
+		if err != nil {
+			log.Fatalf("Erro ao carregar tabela de preços: %v", err)
+		}
+		pricing = loaded
+	}
+
+	var failover ai.FailoverChain
+	if path := os.Getenv("FAILOVER_FILE"); path != "" {
+		loaded, err := ai.LoadFailoverChain(path)
+		if err != nil {
+			log.Fatalf("Erro ao carregar cadeia de provedores reserva: %v", err)
+		}
+		failover = loaded
+	}
+
+	db, err := openStore()
 	if err != nil {
-		if db != nil {
-			log.Printf("AVISO: MongoDB não acessível no momento: %v", err)
-		} else {
-			log.Printf("AVISO: Falha ao conectar ao MongoDB: %v", err)
+		log.Fatal(err)
+	}
+
+	// Os agrupamentos de publicações são recalculados a cada envio de CV;
+	// recalcular na partida cobre bases anteriores a eles e mudanças nos
+	// critérios de agrupamento
+	go func() {
+		if _, err := dedup.Refresh(context.Background(), db); err != nil {
+			log.Printf("AVISO: não foi possível agrupar as publicações: %v", err)
+		}
+	}()
+
+	limiter := &quota.Limiter{Store: db, TrustProxy: os.Getenv("TRUST_PROXY") == "true"}
+	if v := os.Getenv("TRUST_PROXY_HOPS"); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil {
+			limiter.ProxyHops = parsed
+		}
+	}
+	if v := os.Getenv("QUOTA_REQUESTS_PER_DAY"); v != "" {
+		if parsed, err := strconv.ParseInt(v, 10, 64); err == nil {
+			limiter.Limits.RequestsPerDay = parsed
+		}
+	}
+	if v := os.Getenv("QUOTA_TOKENS_PER_DAY"); v != "" {
+		if parsed, err := strconv.ParseInt(v, 10, 64); err == nil {
+			limiter.Limits.TokensPerDay = parsed
 		}
-	} else {
-		log.Println("Conectado ao MongoDB com sucesso")
 	}
 
 	handler.InitStatic(static.Files)
@@ -79,45 +139,100 @@ func main() {
 	mux.HandleFunc("/visualizar-relacoes", handler.PageHandler("visualizar-relacoes.html"))
 	mux.HandleFunc("/chatlattes", handler.PageHandler("chatlattes.html"))
 	mux.HandleFunc("/admin", handler.PageHandler("admin.html"))
+	mux.HandleFunc("/comparar", handler.PageHandler("comparar.html"))
 	mux.Handle("/static/", http.StripPrefix("/static/", handler.StaticHandler()))
 
-	mux.Handle("/api/config", &handler.ConfigHandler{ShareBaseURL: urlBase})
+	mux.Handle("/api/config", &handler.ConfigHandler{ShareBaseURL: urlBase, Providers: aiConfig.Providers()})
 
-	mux.Handle("/api/upload", &handler.UploadHandler{
+	uploadHandler := &handler.UploadHandler{
 		Store:         db,
 		MaxUploadSize: maxUploadSize,
-	})
+		MaxBatchSize:  maxBatchUploadSize,
+	}
+	mux.Handle("/api/upload", uploadHandler)
+	mux.Handle("/api/upload/batch", uploadHandler)
 	mux.Handle("/api/health", &handler.HealthHandler{
 		Store: db,
 	})
 
 	summaryHandler := &handler.SummaryHandler{
-		Store:  db,
-		Prompt: resumoPrompt,
+		Store:       db,
+		Prompt:      resumoPrompt,
+		NewProvider: aiConfig.NewProvider,
+		Quota:       limiter,
+		Pricing:     pricing,
+		Failover:    failover,
 	}
 	mux.Handle("/api/stats", &handler.StatsHandler{Store: db})
 	mux.Handle("/api/search", &handler.SearchHandler{Store: db})
-	mux.Handle("/api/models", &handler.ModelsHandler{})
+	mux.Handle("/api/models", &handler.ModelsHandler{NewProvider: aiConfig.NewProvider})
 	mux.Handle("/api/summary", summaryHandler)
 	mux.Handle("/api/summary/save", summaryHandler)
+	mux.Handle("/api/summary/revisions/", &handler.RevisionsHandler{Store: db, Kind: store.RevisionSummary})
 	mux.Handle("/api/download/", &handler.DownloadHandler{Store: db})
+	mux.Handle("/api/publications/", &handler.PublicationsHandler{Store: db})
+	mux.Handle("/api/history/", &handler.HistoryHandler{Store: db})
+
+	networkHandler := &handler.NetworkHandler{Store: db}
+	mux.Handle("/api/network", networkHandler)
+	mux.Handle("/api/network/", networkHandler)
+	mux.Handle("/api/network/export", &handler.NetworkExportHandler{Store: db})
 
 	analysisHandler := &handler.AnalysisHandler{
-		Store:  db,
-		Prompt: analisePrompt,
+		Store:       db,
+		Prompt:      analisePrompt,
+		NewProvider: aiConfig.NewProvider,
+		Quota:       limiter,
+		Pricing:     pricing,
+		Failover:    failover,
 	}
 	mux.Handle("/api/analysis", analysisHandler)
 	mux.Handle("/api/analysis/save", analysisHandler)
+	mux.Handle("/api/analysis/revisions/", &handler.RevisionsHandler{Store: db, Kind: store.RevisionAnalysis})
 	mux.Handle("/api/analysis/download/", &handler.AnalysisDownloadHandler{Store: db})
 	mux.Handle("/api/summary/view/", &handler.SummaryViewHandler{Store: db})
 	mux.Handle("/api/analysis/view/", &handler.AnalysisViewHandler{Store: db})
 
 	mux.Handle("/api/admin/researchers", &handler.AdminResearchersHandler{Store: db, AdminPIN: adminPIN})
+	mux.Handle("/api/admin/usage", &handler.AdminUsageHandler{Store: db, AdminPIN: adminPIN, Quota: limiter})
+	mux.Handle("/api/admin/calls", &handler.AdminCallsHandler{Store: db, AdminPIN: adminPIN})
 
-	mux.Handle("/api/chat", &handler.ChatHandler{
-		Store:  db,
-		Prompt: chatPrompt,
-	})
+	chatHandler := &handler.ChatHandler{
+		Store:       db,
+		Prompt:      chatPrompt,
+		ToolsPrompt: chatToolsPrompt,
+		NewProvider: aiConfig.NewProvider,
+		Quota:       limiter,
+		Pricing:     pricing,
+		Failover:    failover,
+	}
+	jobQueue := &jobs.Queue{
+		Store: db,
+		Run: map[string]jobs.Func{
+			store.JobSummary:  summaryHandler.RunJob,
+			store.JobAnalysis: analysisHandler.RunJob,
+		},
+	}
+	if v := os.Getenv("JOB_WORKERS"); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil {
+			jobQueue.Workers = parsed
+		}
+	}
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	if err := jobQueue.Start(jobsCtx); err != nil {
+		log.Printf("AVISO: não foi possível retomar as tarefas pendentes: %v", err)
+	}
+	jobsHandler := &handler.JobsHandler{Store: db, Queue: jobQueue, NewProvider: aiConfig.NewProvider, Quota: limiter}
+	mux.Handle("/api/jobs", jobsHandler)
+	mux.Handle("/api/jobs/", jobsHandler)
+
+	mux.Handle("/api/chat", chatHandler)
+	mux.Handle("/api/chat/stream", chatHandler)
+
+	chatSessionsHandler := &handler.ChatSessionsHandler{Store: db}
+	mux.Handle("/api/chat/sessions", chatSessionsHandler)
+	mux.Handle("/api/chat/sessions/", chatSessionsHandler)
+	mux.Handle("/api/chat/view/", &handler.ChatViewHandler{Store: db})
 
 	srv := &http.Server{
 		Addr:         ":" + port,
@@ -147,11 +262,57 @@ func main() {
 		log.Printf("Erro ao encerrar servidor: %v", err)
 	}
 
-	if db != nil {
-		if err := db.Disconnect(ctx); err != nil {
-			log.Printf("Erro ao desconectar do MongoDB: %v", err)
-		}
+	// Tarefas interrompidas continuam "em execução" e são retomadas na
+	// próxima inicialização
+	stopJobs()
+	jobQueue.Wait()
+
+	if err := db.Disconnect(ctx); err != nil {
+		log.Printf("Erro ao encerrar o armazenamento: %v", err)
 	}
 
 	log.Println("Servidor encerrado")
 }
+
+// openStore opens the storage selected by STORE_BACKEND: "mongodb" (default)
+// or "file", which keeps the data as JSON files under DATA_DIR.
+func openStore() (store.Store, error) {
+	switch backend := os.Getenv("STORE_BACKEND"); backend {
+	case "", "mongodb":
+		mongoURI := os.Getenv("MONGODB_URI")
+		if mongoURI == "" {
+			return nil, fmt.Errorf("MONGODB_URI é obrigatório")
+		}
+
+		dbName := os.Getenv("MONGODB_DATABASE")
+		if dbName == "" {
+			dbName = "smartLattes"
+		}
+
+		db, err := store.Connect(mongoURI, dbName)
+		if db == nil {
+			return nil, fmt.Errorf("falha ao conectar ao MongoDB: %w", err)
+		}
+		if err != nil {
+			// The driver keeps reconnecting; /api/health reports the outage.
+			log.Printf("AVISO: MongoDB não acessível no momento: %v", err)
+		} else {
+			log.Println("Conectado ao MongoDB com sucesso")
+		}
+		return db, nil
+	case "file":
+		dataDir := os.Getenv("DATA_DIR")
+		if dataDir == "" {
+			dataDir = "data"
+		}
+
+		fileStore, err := store.OpenFileStore(dataDir)
+		if err != nil {
+			return nil, fmt.Errorf("falha ao abrir o armazenamento em %s: %w", dataDir, err)
+		}
+		log.Printf("Usando armazenamento em arquivos em %s", dataDir)
+		return fileStore, nil
+	default:
+		return nil, fmt.Errorf("STORE_BACKEND inválido: %q (use mongodb ou file)", backend)
+	}
+}
@@ -11,14 +11,14 @@ import (
 )
 
 func (p *AnthropicProvider) ListModels(ctx context.Context, apiKey string) ([]Model, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://api.anthropic.com/v1/models", nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url("/models"), nil)
 	if err != nil {
 		return nil, fmt.Errorf("erro ao criar requisição: %w", err)
 	}
-	req.Header.Set("x-api-key", apiKey)
+	req.Header.Set("x-api-key", p.key(apiKey))
 	req.Header.Set("anthropic-version", "2023-06-01")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, attempts, err := send(req)
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
 			return nil, ErrTimeout
@@ -32,10 +32,10 @@ func (p *AnthropicProvider) ListModels(ctx context.Context, apiKey string) ([]Mo
 	}
 	if resp.StatusCode == http.StatusTooManyRequests {
 		respBody, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("%w: %s", ErrRateLimited, extractAPIError(respBody, "Anthropic"))
+		return nil, withAttempts(fmt.Errorf("%w: %s", ErrRateLimited, extractAPIError(respBody, "Anthropic")), attempts)
 	}
 	if resp.StatusCode >= 500 {
-		return nil, fmt.Errorf("%w: status %d", ErrProviderUnavailable, resp.StatusCode)
+		return nil, withAttempts(fmt.Errorf("%w: status %d", ErrProviderUnavailable, resp.StatusCode), attempts)
 	}
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
@@ -59,7 +59,7 @@ func (p *AnthropicProvider) ListModels(ctx context.Context, apiKey string) ([]Mo
 	return models, nil
 }
 
-func (p *AnthropicProvider) Generate(ctx context.Context, req GenerateRequest) (string, error) {
+func (p *AnthropicProvider) Generate(ctx context.Context, req GenerateRequest) (Result, error) {
 	ctx, cancel := context.WithTimeout(ctx, 120*time.Second)
 	defer cancel()
 
@@ -79,57 +79,156 @@ func (p *AnthropicProvider) Generate(ctx context.Context, req GenerateRequest) (
 
 	jsonBody, err := json.Marshal(body)
 	if err != nil {
-		return "", fmt.Errorf("erro ao serializar requisição: %w", err)
+		return Result{}, fmt.Errorf("erro ao serializar requisição: %w", err)
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.anthropic.com/v1/messages", strings.NewReader(string(jsonBody)))
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url("/messages"), strings.NewReader(string(jsonBody)))
 	if err != nil {
-		return "", fmt.Errorf("erro ao criar requisição: %w", err)
+		return Result{}, fmt.Errorf("erro ao criar requisição: %w", err)
 	}
-	httpReq.Header.Set("x-api-key", req.APIKey)
+	httpReq.Header.Set("x-api-key", p.key(req.APIKey))
 	httpReq.Header.Set("anthropic-version", "2023-06-01")
 	httpReq.Header.Set("Content-Type", "application/json")
 
-	resp, err := http.DefaultClient.Do(httpReq)
+	resp, attempts, err := send(httpReq)
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
-			return "", ErrTimeout
+			return Result{}, ErrTimeout
 		}
-		return "", fmt.Errorf("erro ao chamar API Anthropic: %w", err)
+		return Result{}, fmt.Errorf("erro ao chamar API Anthropic: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
-		return "", ErrInvalidKey
+		return Result{}, ErrInvalidKey
 	}
 	if resp.StatusCode == http.StatusTooManyRequests {
 		respBody, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("%w: %s", ErrRateLimited, extractAPIError(respBody, "Anthropic"))
+		return Result{}, withAttempts(fmt.Errorf("%w: %s", ErrRateLimited, extractAPIError(respBody, "Anthropic")), attempts)
 	}
 	if resp.StatusCode >= 500 {
-		return "", fmt.Errorf("%w: status %d", ErrProviderUnavailable, resp.StatusCode)
+		return Result{}, withAttempts(fmt.Errorf("%w: status %d", ErrProviderUnavailable, resp.StatusCode), attempts)
 	}
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("erro da API Anthropic: status %d: %s", resp.StatusCode, string(respBody))
+		return Result{}, fmt.Errorf("erro da API Anthropic: status %d: %s", resp.StatusCode, string(respBody))
 	}
 
 	var result struct {
 		Content []struct {
 			Text string `json:"text"`
 		} `json:"content"`
+		StopReason string         `json:"stop_reason"`
+		Usage      anthropicUsage `json:"usage"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", fmt.Errorf("erro ao decodificar resposta: %w", err)
+		return Result{}, fmt.Errorf("erro ao decodificar resposta: %w", err)
 	}
 
 	if len(result.Content) == 0 {
-		return "", fmt.Errorf("resposta da API Anthropic sem conteúdo")
+		return Result{}, fmt.Errorf("resposta da API Anthropic sem conteúdo")
+	}
+	return Result{
+		Text:         result.Content[0].Text,
+		Usage:        result.Usage.toUsage(),
+		FinishReason: result.StopReason,
+		Attempts:     attempts,
+	}, nil
+}
+
+func (p *AnthropicProvider) Chat(ctx context.Context, req ChatRequest) (Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, 120*time.Second)
+	defer cancel()
+
+	maxTokens := req.MaxTokens
+	if maxTokens == 0 {
+		maxTokens = 4096
+	}
+
+	body := map[string]any{
+		"model":      req.Model,
+		"max_tokens": maxTokens,
+		"system":     cachedSystem(req),
+		"messages":   anthropicMessages(req.Messages),
+	}
+	if len(req.Tools) > 0 {
+		body["tools"] = anthropicTools(req.Tools)
+	}
+
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return Result{}, fmt.Errorf("erro ao serializar requisição: %w", err)
 	}
-	return result.Content[0].Text, nil
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url("/messages"), strings.NewReader(string(jsonBody)))
+	if err != nil {
+		return Result{}, fmt.Errorf("erro ao criar requisição: %w", err)
+	}
+	httpReq.Header.Set("x-api-key", p.key(req.APIKey))
+	httpReq.Header.Set("anthropic-version", "2023-06-01")
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, attempts, err := send(httpReq)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return Result{}, ErrTimeout
+		}
+		return Result{}, fmt.Errorf("erro ao chamar API Anthropic: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return Result{}, ErrInvalidKey
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		respBody, _ := io.ReadAll(resp.Body)
+		return Result{}, withAttempts(fmt.Errorf("%w: %s", ErrRateLimited, extractAPIError(respBody, "Anthropic")), attempts)
+	}
+	if resp.StatusCode >= 500 {
+		return Result{}, withAttempts(fmt.Errorf("%w: status %d", ErrProviderUnavailable, resp.StatusCode), attempts)
+	}
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return Result{}, fmt.Errorf("erro da API Anthropic: status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	var result struct {
+		Content []struct {
+			Type  string          `json:"type"`
+			Text  string          `json:"text"`
+			ID    string          `json:"id"`
+			Name  string          `json:"name"`
+			Input json.RawMessage `json:"input"`
+		} `json:"content"`
+		StopReason string         `json:"stop_reason"`
+		Usage      anthropicUsage `json:"usage"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return Result{}, fmt.Errorf("erro ao decodificar resposta: %w", err)
+	}
+
+	if len(result.Content) == 0 {
+		return Result{}, fmt.Errorf("resposta da API Anthropic sem conteúdo")
+	}
+	var text strings.Builder
+	var calls []ToolCall
+	for _, block := range result.Content {
+		if block.Type == "tool_use" {
+			calls = append(calls, ToolCall{ID: block.ID, Name: block.Name, Arguments: block.Input})
+			continue
+		}
+		text.WriteString(block.Text)
+	}
+	return Result{
+		Text:         text.String(),
+		Usage:        result.Usage.toUsage(),
+		FinishReason: result.StopReason,
+		Attempts:     attempts,
+		ToolCalls:    calls,
+	}, nil
 }
 
-func (p *AnthropicProvider) Chat(ctx context.Context, req ChatRequest) (string, error) {
+func (p *AnthropicProvider) ChatStream(ctx context.Context, req ChatRequest, onDelta func(string) error) (Result, error) {
 	ctx, cancel := context.WithTimeout(ctx, 120*time.Second)
 	defer cancel()
 
@@ -146,58 +245,122 @@ func (p *AnthropicProvider) Chat(ctx context.Context, req ChatRequest) (string,
 	body := map[string]any{
 		"model":      req.Model,
 		"max_tokens": maxTokens,
-		"system":     req.SystemPrompt,
+		"system":     cachedSystem(req),
 		"messages":   messages,
+		"stream":     true,
 	}
 
 	jsonBody, err := json.Marshal(body)
 	if err != nil {
-		return "", fmt.Errorf("erro ao serializar requisição: %w", err)
+		return Result{}, fmt.Errorf("erro ao serializar requisição: %w", err)
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.anthropic.com/v1/messages", strings.NewReader(string(jsonBody)))
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url("/messages"), strings.NewReader(string(jsonBody)))
 	if err != nil {
-		return "", fmt.Errorf("erro ao criar requisição: %w", err)
+		return Result{}, fmt.Errorf("erro ao criar requisição: %w", err)
 	}
-	httpReq.Header.Set("x-api-key", req.APIKey)
+	httpReq.Header.Set("x-api-key", p.key(req.APIKey))
 	httpReq.Header.Set("anthropic-version", "2023-06-01")
 	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "text/event-stream")
 
-	resp, err := http.DefaultClient.Do(httpReq)
+	resp, attempts, err := send(httpReq)
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
-			return "", ErrTimeout
+			return Result{}, ErrTimeout
 		}
-		return "", fmt.Errorf("erro ao chamar API Anthropic: %w", err)
+		return Result{}, fmt.Errorf("erro ao chamar API Anthropic: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
-		return "", ErrInvalidKey
+		return Result{}, ErrInvalidKey
 	}
 	if resp.StatusCode == http.StatusTooManyRequests {
 		respBody, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("%w: %s", ErrRateLimited, extractAPIError(respBody, "Anthropic"))
+		return Result{}, withAttempts(fmt.Errorf("%w: %s", ErrRateLimited, extractAPIError(respBody, "Anthropic")), attempts)
 	}
 	if resp.StatusCode >= 500 {
-		return "", fmt.Errorf("%w: status %d", ErrProviderUnavailable, resp.StatusCode)
+		return Result{}, withAttempts(fmt.Errorf("%w: status %d", ErrProviderUnavailable, resp.StatusCode), attempts)
 	}
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("erro da API Anthropic: status %d: %s", resp.StatusCode, string(respBody))
+		return Result{}, fmt.Errorf("erro da API Anthropic: status %d: %s", resp.StatusCode, string(respBody))
 	}
 
-	var result struct {
-		Content []struct {
-			Text string `json:"text"`
-		} `json:"content"`
+	var full strings.Builder
+	var usage anthropicUsage
+	var stopReason string
+	err = readSSE(resp.Body, func(_, data string) error {
+		var event struct {
+			Type    string `json:"type"`
+			Message struct {
+				Usage anthropicUsage `json:"usage"`
+			} `json:"message"`
+			Delta struct {
+				Type       string `json:"type"`
+				Text       string `json:"text"`
+				StopReason string `json:"stop_reason"`
+			} `json:"delta"`
+			Usage anthropicUsage `json:"usage"`
+			Error struct {
+				Type    string `json:"type"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return fmt.Errorf("erro ao decodificar resposta: %w", err)
+		}
+		switch event.Type {
+		case "message_start":
+			usage = event.Message.Usage
+		case "message_delta":
+			// The output count is cumulative.
+			usage.OutputTokens = event.Usage.OutputTokens
+			stopReason = event.Delta.StopReason
+		case "content_block_delta":
+			if event.Delta.Type != "text_delta" || event.Delta.Text == "" {
+				return nil
+			}
+			full.WriteString(event.Delta.Text)
+			return onDelta(event.Delta.Text)
+		case "error":
+			if event.Error.Type == "overloaded_error" || event.Error.Type == "api_error" {
+				return fmt.Errorf("%w: %s", ErrProviderUnavailable, event.Error.Message)
+			}
+			if event.Error.Type == "rate_limit_error" {
+				return fmt.Errorf("%w: %s", ErrRateLimited, event.Error.Message)
+			}
+			return fmt.Errorf("erro da API Anthropic: %s", event.Error.Message)
+		}
+		return nil
+	})
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return Result{}, ErrTimeout
+		}
+		return Result{}, err
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", fmt.Errorf("erro ao decodificar resposta: %w", err)
+
+	if full.Len() == 0 {
+		return Result{}, fmt.Errorf("resposta da API Anthropic sem conteúdo")
 	}
+	return Result{Text: full.String(), Usage: usage.toUsage(), FinishReason: stopReason, Attempts: attempts}, nil
+}
 
-	if len(result.Content) == 0 {
-		return "", fmt.Errorf("resposta da API Anthropic sem conteúdo")
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+	// Anthropic leaves the cached tokens out of input_tokens.
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+func (u anthropicUsage) toUsage() Usage {
+	return Usage{
+		InputTokens:      u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens,
+		OutputTokens:     u.OutputTokens,
+		CacheReadTokens:  u.CacheReadInputTokens,
+		CacheWriteTokens: u.CacheCreationInputTokens,
 	}
-	return result.Content[0].Text, nil
 }
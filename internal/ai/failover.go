@@ -0,0 +1,79 @@
+package ai
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Fallback is a provider that calls move to when the provider they asked for
+// is unavailable. Models maps the model of the original request to the one
+// to use with this provider; models not in it use Model.
+type Fallback struct {
+	Provider string            `json:"provider"`
+	Model    string            `json:"model"`
+	Models   map[string]string `json:"models,omitempty"`
+}
+
+// FailoverChain lists, in order of preference, the providers tried when the
+// one a request names is unavailable or times out.
+type FailoverChain []Fallback
+
+// LoadFailoverChain reads a JSON array of fallbacks from path, such as
+//
+//	[{"provider": "anthropic", "model": "claude-sonnet-4-5"},
+//	 {"provider": "openai", "model": "gpt-4o", "models": {"claude-3-5-haiku-latest": "gpt-4o-mini"}},
+//	 {"provider": "gemini", "model": "gemini-2.5-flash"}]
+func LoadFailoverChain(path string) (FailoverChain, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var chain FailoverChain
+	if err := json.Unmarshal(data, &chain); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i, fb := range chain {
+		if fb.Provider == "" || (fb.Model == "" && len(fb.Models) == 0) {
+			return nil, fmt.Errorf("%s: item %d precisa de provider e model", path, i+1)
+		}
+	}
+	return chain, nil
+}
+
+// Target is a provider and model a call can be made with.
+type Target struct {
+	Provider string
+	Model    string
+}
+
+// For returns where a call to provider and model goes when that provider is
+// unavailable: the other providers of the chain, in order, with the model
+// mapped from model. Fallbacks with no model for it are left out.
+func (c FailoverChain) For(provider, model string) []Target {
+	var targets []Target
+	for _, fb := range c {
+		if fb.Provider == provider {
+			continue
+		}
+		m, ok := fb.Models[model]
+		if !ok {
+			m, ok = fb.Models[strings.ToLower(model)]
+		}
+		if !ok {
+			m = fb.Model
+		}
+		if m != "" {
+			targets = append(targets, Target{Provider: fb.Provider, Model: m})
+		}
+	}
+	return targets
+}
+
+// ShouldFailOver reports whether a call that failed with err may succeed with
+// another provider: the provider was unavailable or did not answer in time.
+func ShouldFailOver(err error) bool {
+	return errors.Is(err, ErrProviderUnavailable) || errors.Is(err, ErrTimeout)
+}
@@ -0,0 +1,40 @@
+package ai
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFailoverChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "failover.json")
+	os.WriteFile(path, []byte(`[
+		{"provider": "anthropic", "model": "claude-sonnet-4-5"},
+		{"provider": "openai", "model": "gpt-4o", "models": {"claude-3-5-haiku-latest": "gpt-4o-mini"}},
+		{"provider": "gemini", "models": {"gpt-4o": "gemini-2.5-pro"}}
+	]`), 0o644)
+	chain, err := LoadFailoverChain(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		provider, model string
+		want            []Target
+	}{
+		{"gemini", "gemini-2.5-flash", []Target{{"anthropic", "claude-sonnet-4-5"}, {"openai", "gpt-4o"}}},
+		{"anthropic", "claude-3-5-haiku-latest", []Target{{"openai", "gpt-4o-mini"}}},
+		{"openai", "gpt-4o", []Target{{"anthropic", "claude-sonnet-4-5"}, {"gemini", "gemini-2.5-pro"}}},
+	}
+	for _, c := range cases {
+		if got := chain.For(c.provider, c.model); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("For(%s, %s) = %v, want %v", c.provider, c.model, got, c.want)
+		}
+	}
+
+	os.WriteFile(path, []byte(`[{"provider": "openai"}]`), 0o644)
+	if _, err := LoadFailoverChain(path); err == nil {
+		t.Error("loaded a fallback without a model")
+	}
+}
@@ -11,13 +11,13 @@ import (
 )
 
 func (p *GeminiProvider) ListModels(ctx context.Context, apiKey string) ([]Model, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://generativelanguage.googleapis.com/v1beta/models", nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url("/models"), nil)
 	if err != nil {
 		return nil, fmt.Errorf("erro ao criar requisição: %w", err)
 	}
-	req.Header.Set("x-goog-api-key", apiKey)
+	req.Header.Set("x-goog-api-key", p.key(apiKey))
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, attempts, err := send(req)
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
 			return nil, ErrTimeout
@@ -31,10 +31,10 @@ func (p *GeminiProvider) ListModels(ctx context.Context, apiKey string) ([]Model
 	}
 	if resp.StatusCode == http.StatusTooManyRequests {
 		respBody, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("%w: %s", ErrRateLimited, extractAPIError(respBody, "Gemini"))
+		return nil, withAttempts(fmt.Errorf("%w: %s", ErrRateLimited, extractAPIError(respBody, "Gemini")), attempts)
 	}
 	if resp.StatusCode >= 500 {
-		return nil, fmt.Errorf("%w: status %d", ErrProviderUnavailable, resp.StatusCode)
+		return nil, withAttempts(fmt.Errorf("%w: status %d", ErrProviderUnavailable, resp.StatusCode), attempts)
 	}
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
@@ -72,7 +72,7 @@ func supportsGenerateContent(methods []string) bool {
 	return false
 }
 
-func (p *GeminiProvider) Generate(ctx context.Context, req GenerateRequest) (string, error) {
+func (p *GeminiProvider) Generate(ctx context.Context, req GenerateRequest) (Result, error) {
 	ctx, cancel := context.WithTimeout(ctx, 120*time.Second)
 	defer cancel()
 
@@ -101,44 +101,44 @@ func (p *GeminiProvider) Generate(ctx context.Context, req GenerateRequest) (str
 
 	jsonBody, err := json.Marshal(body)
 	if err != nil {
-		return "", fmt.Errorf("erro ao serializar requisição: %w", err)
+		return Result{}, fmt.Errorf("erro ao serializar requisição: %w", err)
 	}
 
-	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:generateContent", req.Model)
+	url := p.url(fmt.Sprintf("/models/%s:generateContent", req.Model))
 	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(string(jsonBody)))
 	if err != nil {
-		return "", fmt.Errorf("erro ao criar requisição: %w", err)
+		return Result{}, fmt.Errorf("erro ao criar requisição: %w", err)
 	}
-	httpReq.Header.Set("x-goog-api-key", req.APIKey)
+	httpReq.Header.Set("x-goog-api-key", p.key(req.APIKey))
 	httpReq.Header.Set("Content-Type", "application/json")
 
-	resp, err := http.DefaultClient.Do(httpReq)
+	resp, attempts, err := send(httpReq)
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
-			return "", ErrTimeout
+			return Result{}, ErrTimeout
 		}
-		return "", fmt.Errorf("erro ao chamar API Gemini: %w", err)
+		return Result{}, fmt.Errorf("erro ao chamar API Gemini: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
-		return "", ErrInvalidKey
+		return Result{}, ErrInvalidKey
 	}
 	if resp.StatusCode == http.StatusTooManyRequests {
 		respBody, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("%w: %s", ErrRateLimited, extractAPIError(respBody, "Gemini"))
+		return Result{}, withAttempts(fmt.Errorf("%w: %s", ErrRateLimited, extractAPIError(respBody, "Gemini")), attempts)
 	}
 	if resp.StatusCode >= 500 {
-		return "", fmt.Errorf("%w: status %d", ErrProviderUnavailable, resp.StatusCode)
+		return Result{}, withAttempts(fmt.Errorf("%w: status %d", ErrProviderUnavailable, resp.StatusCode), attempts)
 	}
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("erro da API Gemini: status %d: %s", resp.StatusCode, string(respBody))
+		return Result{}, fmt.Errorf("erro da API Gemini: status %d: %s", resp.StatusCode, string(respBody))
 	}
 
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("erro ao ler resposta: %w", err)
+		return Result{}, fmt.Errorf("erro ao ler resposta: %w", err)
 	}
 
 	var result struct {
@@ -153,28 +153,133 @@ func (p *GeminiProvider) Generate(ctx context.Context, req GenerateRequest) (str
 		PromptFeedback struct {
 			BlockReason string `json:"blockReason"`
 		} `json:"promptFeedback"`
+		UsageMetadata geminiUsage `json:"usageMetadata"`
 	}
 	if err := json.NewDecoder(strings.NewReader(string(respBody))).Decode(&result); err != nil {
-		return "", fmt.Errorf("erro ao decodificar resposta: %w", err)
+		return Result{}, fmt.Errorf("erro ao decodificar resposta: %w", err)
 	}
 
 	if len(result.Candidates) == 0 || len(result.Candidates[0].Content.Parts) == 0 {
 		if result.PromptFeedback.BlockReason != "" {
-			return "", fmt.Errorf("conteúdo bloqueado pelo Gemini: %s", result.PromptFeedback.BlockReason)
+			return Result{}, fmt.Errorf("conteúdo bloqueado pelo Gemini: %s", result.PromptFeedback.BlockReason)
 		}
 		reason := ""
 		if len(result.Candidates) > 0 {
 			reason = result.Candidates[0].FinishReason
 		}
 		if reason != "" {
-			return "", fmt.Errorf("resposta da API Gemini sem conteúdo (motivo: %s)", reason)
+			return Result{}, fmt.Errorf("resposta da API Gemini sem conteúdo (motivo: %s)", reason)
 		}
-		return "", fmt.Errorf("resposta da API Gemini sem conteúdo. Resposta: %s", string(respBody))
+		return Result{}, fmt.Errorf("resposta da API Gemini sem conteúdo. Resposta: %s", string(respBody))
+	}
+	return Result{
+		Text:         result.Candidates[0].Content.Parts[0].Text,
+		Usage:        result.UsageMetadata.toUsage(),
+		FinishReason: result.Candidates[0].FinishReason,
+		Attempts:     attempts,
+	}, nil
+}
+
+func (p *GeminiProvider) Chat(ctx context.Context, req ChatRequest) (Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, 120*time.Second)
+	defer cancel()
+
+	maxTokens := req.MaxTokens
+	if maxTokens == 0 {
+		maxTokens = 4096
+	}
+
+	cached := p.cachedContent(ctx, req)
+	body := map[string]any{
+		"contents": geminiContents(req.Messages),
+		"generationConfig": map[string]any{
+			"maxOutputTokens": maxTokens,
+		},
+	}
+	geminiSystem(body, req, cached)
+	if len(req.Tools) > 0 {
+		body["tools"] = geminiTools(req.Tools)
+	}
+
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return Result{}, fmt.Errorf("erro ao serializar requisição: %w", err)
+	}
+
+	url := p.url(fmt.Sprintf("/models/%s:generateContent", req.Model))
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(string(jsonBody)))
+	if err != nil {
+		return Result{}, fmt.Errorf("erro ao criar requisição: %w", err)
+	}
+	httpReq.Header.Set("x-goog-api-key", p.key(req.APIKey))
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, attempts, err := send(httpReq)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return Result{}, ErrTimeout
+		}
+		return Result{}, fmt.Errorf("erro ao chamar API Gemini: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if cached != "" && cachedContentRejected(resp.StatusCode) {
+		p.forgetCachedContent(req)
+		return p.Chat(ctx, req)
+	}
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return Result{}, ErrInvalidKey
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		respBody, _ := io.ReadAll(resp.Body)
+		return Result{}, withAttempts(fmt.Errorf("%w: %s", ErrRateLimited, extractAPIError(respBody, "Gemini")), attempts)
+	}
+	if resp.StatusCode >= 500 {
+		return Result{}, withAttempts(fmt.Errorf("%w: status %d", ErrProviderUnavailable, resp.StatusCode), attempts)
+	}
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return Result{}, fmt.Errorf("erro da API Gemini: status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Result{}, fmt.Errorf("erro ao ler resposta: %w", err)
+	}
+
+	var result struct {
+		Candidates []struct {
+			Content struct {
+				Parts []geminiPart `json:"parts"`
+			} `json:"content"`
+			FinishReason string `json:"finishReason"`
+		} `json:"candidates"`
+		PromptFeedback struct {
+			BlockReason string `json:"blockReason"`
+		} `json:"promptFeedback"`
+		UsageMetadata geminiUsage `json:"usageMetadata"`
 	}
-	return result.Candidates[0].Content.Parts[0].Text, nil
+	if err := json.NewDecoder(strings.NewReader(string(respBody))).Decode(&result); err != nil {
+		return Result{}, fmt.Errorf("erro ao decodificar resposta: %w", err)
+	}
+
+	if len(result.Candidates) == 0 || len(result.Candidates[0].Content.Parts) == 0 {
+		if result.PromptFeedback.BlockReason != "" {
+			return Result{}, fmt.Errorf("conteúdo bloqueado pelo Gemini: %s", result.PromptFeedback.BlockReason)
+		}
+		return Result{}, fmt.Errorf("resposta da API Gemini sem conteúdo")
+	}
+	text, calls := fromGeminiParts(result.Candidates[0].Content.Parts, len(req.Messages))
+	return Result{
+		Text:         text,
+		Usage:        result.UsageMetadata.toUsage(),
+		FinishReason: result.Candidates[0].FinishReason,
+		Attempts:     attempts,
+		ToolCalls:    calls,
+	}, nil
 }
 
-func (p *GeminiProvider) Chat(ctx context.Context, req ChatRequest) (string, error) {
+func (p *GeminiProvider) ChatStream(ctx context.Context, req ChatRequest, onDelta func(string) error) (Result, error) {
 	ctx, cancel := context.WithTimeout(ctx, 120*time.Second)
 	defer cancel()
 
@@ -197,82 +302,130 @@ func (p *GeminiProvider) Chat(ctx context.Context, req ChatRequest) (string, err
 		})
 	}
 
+	cached := p.cachedContent(ctx, req)
 	body := map[string]any{
-		"system_instruction": map[string]any{
-			"parts": []map[string]string{
-				{"text": req.SystemPrompt},
-			},
-		},
 		"contents": contents,
 		"generationConfig": map[string]any{
 			"maxOutputTokens": maxTokens,
 		},
 	}
+	geminiSystem(body, req, cached)
 
 	jsonBody, err := json.Marshal(body)
 	if err != nil {
-		return "", fmt.Errorf("erro ao serializar requisição: %w", err)
+		return Result{}, fmt.Errorf("erro ao serializar requisição: %w", err)
 	}
 
-	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:generateContent", req.Model)
+	url := p.url(fmt.Sprintf("/models/%s:streamGenerateContent?alt=sse", req.Model))
 	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(string(jsonBody)))
 	if err != nil {
-		return "", fmt.Errorf("erro ao criar requisição: %w", err)
+		return Result{}, fmt.Errorf("erro ao criar requisição: %w", err)
 	}
-	httpReq.Header.Set("x-goog-api-key", req.APIKey)
+	httpReq.Header.Set("x-goog-api-key", p.key(req.APIKey))
 	httpReq.Header.Set("Content-Type", "application/json")
 
-	resp, err := http.DefaultClient.Do(httpReq)
+	resp, attempts, err := send(httpReq)
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
-			return "", ErrTimeout
+			return Result{}, ErrTimeout
 		}
-		return "", fmt.Errorf("erro ao chamar API Gemini: %w", err)
+		return Result{}, fmt.Errorf("erro ao chamar API Gemini: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if cached != "" && cachedContentRejected(resp.StatusCode) {
+		p.forgetCachedContent(req)
+		return p.ChatStream(ctx, req, onDelta)
+	}
 	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
-		return "", ErrInvalidKey
+		return Result{}, ErrInvalidKey
 	}
 	if resp.StatusCode == http.StatusTooManyRequests {
 		respBody, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("%w: %s", ErrRateLimited, extractAPIError(respBody, "Gemini"))
+		return Result{}, withAttempts(fmt.Errorf("%w: %s", ErrRateLimited, extractAPIError(respBody, "Gemini")), attempts)
 	}
 	if resp.StatusCode >= 500 {
-		return "", fmt.Errorf("%w: status %d", ErrProviderUnavailable, resp.StatusCode)
+		return Result{}, withAttempts(fmt.Errorf("%w: status %d", ErrProviderUnavailable, resp.StatusCode), attempts)
 	}
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("erro da API Gemini: status %d: %s", resp.StatusCode, string(respBody))
+		return Result{}, fmt.Errorf("erro da API Gemini: status %d: %s", resp.StatusCode, string(respBody))
 	}
 
-	respBody, err := io.ReadAll(resp.Body)
+	var full strings.Builder
+	var blockReason, finishReason string
+	var usage geminiUsage
+	err = readSSE(resp.Body, func(_, data string) error {
+		var chunk struct {
+			Candidates []struct {
+				Content struct {
+					Parts []struct {
+						Text string `json:"text"`
+					} `json:"parts"`
+				} `json:"content"`
+				FinishReason string `json:"finishReason"`
+			} `json:"candidates"`
+			PromptFeedback struct {
+				BlockReason string `json:"blockReason"`
+			} `json:"promptFeedback"`
+			UsageMetadata *geminiUsage `json:"usageMetadata"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("erro ao decodificar resposta: %w", err)
+		}
+		if chunk.PromptFeedback.BlockReason != "" {
+			blockReason = chunk.PromptFeedback.BlockReason
+		}
+		// Every chunk carries the running totals.
+		if chunk.UsageMetadata != nil {
+			usage = *chunk.UsageMetadata
+		}
+		if len(chunk.Candidates) == 0 {
+			return nil
+		}
+		if chunk.Candidates[0].FinishReason != "" {
+			finishReason = chunk.Candidates[0].FinishReason
+		}
+		for _, part := range chunk.Candidates[0].Content.Parts {
+			if part.Text == "" {
+				continue
+			}
+			full.WriteString(part.Text)
+			if err := onDelta(part.Text); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		return "", fmt.Errorf("erro ao ler resposta: %w", err)
+		if ctx.Err() == context.DeadlineExceeded {
+			return Result{}, ErrTimeout
+		}
+		return Result{}, err
 	}
 
-	var result struct {
-		Candidates []struct {
-			Content struct {
-				Parts []struct {
-					Text string `json:"text"`
-				} `json:"parts"`
-			} `json:"content"`
-			FinishReason string `json:"finishReason"`
-		} `json:"candidates"`
-		PromptFeedback struct {
-			BlockReason string `json:"blockReason"`
-		} `json:"promptFeedback"`
-	}
-	if err := json.NewDecoder(strings.NewReader(string(respBody))).Decode(&result); err != nil {
-		return "", fmt.Errorf("erro ao decodificar resposta: %w", err)
+	if full.Len() == 0 {
+		if blockReason != "" {
+			return Result{}, fmt.Errorf("conteúdo bloqueado pelo Gemini: %s", blockReason)
+		}
+		return Result{}, fmt.Errorf("resposta da API Gemini sem conteúdo")
 	}
+	return Result{Text: full.String(), Usage: usage.toUsage(), FinishReason: finishReason, Attempts: attempts}, nil
+}
 
-	if len(result.Candidates) == 0 || len(result.Candidates[0].Content.Parts) == 0 {
-		if result.PromptFeedback.BlockReason != "" {
-			return "", fmt.Errorf("conteúdo bloqueado pelo Gemini: %s", result.PromptFeedback.BlockReason)
-		}
-		return "", fmt.Errorf("resposta da API Gemini sem conteúdo")
+type geminiUsage struct {
+	PromptTokenCount     int `json:"promptTokenCount"`
+	CandidatesTokenCount int `json:"candidatesTokenCount"`
+	// ThoughtsTokenCount is billed as output by the thinking models.
+	ThoughtsTokenCount int `json:"thoughtsTokenCount"`
+	// CachedContentTokenCount is the part of the prompt read from the cache.
+	CachedContentTokenCount int `json:"cachedContentTokenCount"`
+}
+
+func (u geminiUsage) toUsage() Usage {
+	return Usage{
+		InputTokens:     u.PromptTokenCount,
+		OutputTokens:    u.CandidatesTokenCount + u.ThoughtsTokenCount,
+		CacheReadTokens: u.CachedContentTokenCount,
 	}
-	return result.Candidates[0].Content.Parts[0].Text, nil
 }
@@ -0,0 +1,291 @@
+package ai
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// OllamaBaseURL is where a local Ollama server listens by default.
+const OllamaBaseURL = "http://localhost:11434"
+
+// ollamaTimeout is longer than the hosted providers' because local models
+// running on modest hardware take minutes to read a full CV.
+const ollamaTimeout = 10 * time.Minute
+
+// ollamaDefaultContext is the context window Ollama gives models when num_ctx
+// is not set.
+const ollamaDefaultContext = 4096
+
+// OllamaProvider calls the native API of an Ollama server. No API key is
+// needed and the CV data never leaves the server running it.
+type OllamaProvider struct {
+	baseURL string
+	// contextSize overrides the model's context window (num_ctx). Ollama
+	// defaults to a few thousand tokens and silently drops the start of
+	// longer prompts, which would cut most of a CV.
+	contextSize int
+}
+
+func (p *OllamaProvider) url(path string) string {
+	return joinURL(p.baseURL, OllamaBaseURL, path)
+}
+
+func (p *OllamaProvider) KeyOptional() bool {
+	return true
+}
+
+// ContextWindow is the configured context size rather than the model's
+// nominal window, since Ollama drops whatever does not fit num_ctx.
+func (p *OllamaProvider) ContextWindow(model string) int {
+	if p.contextSize > 0 {
+		return p.contextSize
+	}
+	return ollamaDefaultContext
+}
+
+func (p *OllamaProvider) ListModels(ctx context.Context, apiKey string) ([]Model, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url("/api/tags"), nil)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao criar requisição: %w", err)
+	}
+	resp, err := p.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Models []struct {
+			Name    string `json:"name"`
+			Details struct {
+				ParameterSize string `json:"parameter_size"`
+			} `json:"details"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("erro ao decodificar resposta: %w", err)
+	}
+
+	var models []Model
+	for _, m := range result.Models {
+		name := m.Name
+		if m.Details.ParameterSize != "" {
+			name += " (" + m.Details.ParameterSize + ")"
+		}
+		models = append(models, Model{ID: m.Name, DisplayName: name})
+	}
+	return models, nil
+}
+
+func (p *OllamaProvider) Generate(ctx context.Context, req GenerateRequest) (Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, ollamaTimeout)
+	defer cancel()
+
+	body := map[string]any{
+		"model":  req.Model,
+		"system": req.SystemPrompt,
+		"prompt": req.UserData,
+		"stream": false,
+	}
+	if opts := p.options(req.MaxTokens); len(opts) > 0 {
+		body["options"] = opts
+	}
+
+	resp, err := p.post(ctx, "/api/generate", body)
+	if err != nil {
+		return Result{}, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Response string `json:"response"`
+		ollamaStats
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return Result{}, fmt.Errorf("erro ao decodificar resposta: %w", err)
+	}
+	if result.Response == "" {
+		return Result{}, fmt.Errorf("resposta do Ollama sem conteúdo")
+	}
+	return result.result(result.Response), nil
+}
+
+func (p *OllamaProvider) Chat(ctx context.Context, req ChatRequest) (Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, ollamaTimeout)
+	defer cancel()
+
+	resp, err := p.post(ctx, "/api/chat", p.chatBody(req, false))
+	if err != nil {
+		return Result{}, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Message ChatMessage `json:"message"`
+		ollamaStats
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return Result{}, fmt.Errorf("erro ao decodificar resposta: %w", err)
+	}
+	if result.Message.Content == "" {
+		return Result{}, fmt.Errorf("resposta do Ollama sem conteúdo")
+	}
+	return result.result(result.Message.Content), nil
+}
+
+// ChatStream reads Ollama's stream, which is one JSON object per line rather
+// than Server-Sent Events.
+func (p *OllamaProvider) ChatStream(ctx context.Context, req ChatRequest, onDelta func(string) error) (Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, ollamaTimeout)
+	defer cancel()
+
+	resp, err := p.post(ctx, "/api/chat", p.chatBody(req, true))
+	if err != nil {
+		return Result{}, err
+	}
+	defer resp.Body.Close()
+
+	var full strings.Builder
+	var stats ollamaStats
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxSSELineSize)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var chunk struct {
+			Message ChatMessage `json:"message"`
+			Done    bool        `json:"done"`
+			Error   string      `json:"error"`
+			ollamaStats
+		}
+		if err := json.Unmarshal([]byte(line), &chunk); err != nil {
+			return Result{}, fmt.Errorf("erro ao decodificar resposta: %w", err)
+		}
+		if chunk.Error != "" {
+			return Result{}, fmt.Errorf("erro do Ollama: %s", chunk.Error)
+		}
+		if chunk.Message.Content != "" {
+			full.WriteString(chunk.Message.Content)
+			if err := onDelta(chunk.Message.Content); err != nil {
+				return Result{}, err
+			}
+		}
+		if chunk.Done {
+			stats = chunk.ollamaStats
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return Result{}, ErrTimeout
+		}
+		return Result{}, fmt.Errorf("erro ao ler resposta do Ollama: %w", err)
+	}
+
+	if full.Len() == 0 {
+		return Result{}, fmt.Errorf("resposta do Ollama sem conteúdo")
+	}
+	return stats.result(full.String()), nil
+}
+
+// ollamaStats are the counters Ollama adds to its final response.
+type ollamaStats struct {
+	DoneReason      string `json:"done_reason"`
+	PromptEvalCount int    `json:"prompt_eval_count"`
+	EvalCount       int    `json:"eval_count"`
+}
+
+func (s ollamaStats) result(text string) Result {
+	return Result{
+		Text:         text,
+		Usage:        Usage{InputTokens: s.PromptEvalCount, OutputTokens: s.EvalCount},
+		FinishReason: s.DoneReason,
+	}
+}
+
+func (p *OllamaProvider) chatBody(req ChatRequest, stream bool) map[string]any {
+	messages := []ChatMessage{{Role: "system", Content: req.system()}}
+	messages = append(messages, req.Messages...)
+
+	body := map[string]any{
+		"model":    req.Model,
+		"messages": messages,
+		"stream":   stream,
+	}
+	if opts := p.options(req.MaxTokens); len(opts) > 0 {
+		body["options"] = opts
+	}
+	return body
+}
+
+func (p *OllamaProvider) options(maxTokens int) map[string]any {
+	opts := map[string]any{}
+	if maxTokens > 0 {
+		opts["num_predict"] = maxTokens
+	}
+	if p.contextSize > 0 {
+		opts["num_ctx"] = p.contextSize
+	}
+	return opts
+}
+
+func (p *OllamaProvider) post(ctx context.Context, path string, body map[string]any) (*http.Response, error) {
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao serializar requisição: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url(path), strings.NewReader(string(jsonBody)))
+	if err != nil {
+		return nil, fmt.Errorf("erro ao criar requisição: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return p.do(ctx, req)
+}
+
+// do sends req and turns failed responses into the package errors. An
+// unreachable server is reported as unavailable, since that is how a stopped
+// local Ollama shows up.
+func (p *OllamaProvider) do(ctx context.Context, req *http.Request) (*http.Response, error) {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, ErrTimeout
+		}
+		return nil, fmt.Errorf("%w: %v", ErrProviderUnavailable, err)
+	}
+	if resp.StatusCode == http.StatusOK {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return nil, ErrInvalidKey
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return nil, fmt.Errorf("%w: %s", ErrRateLimited, ollamaError(respBody))
+	}
+	if resp.StatusCode >= 500 {
+		return nil, fmt.Errorf("%w: status %d: %s", ErrProviderUnavailable, resp.StatusCode, ollamaError(respBody))
+	}
+	return nil, fmt.Errorf("erro do Ollama: status %d: %s", resp.StatusCode, ollamaError(respBody))
+}
+
+// ollamaError extracts the message of Ollama's {"error": "..."} responses.
+func ollamaError(body []byte) string {
+	var errResp struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(body, &errResp) == nil && errResp.Error != "" {
+		return errResp.Error
+	}
+	return extractAPIError(body, "Ollama")
+}
@@ -0,0 +1,90 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOllamaProvider(t *testing.T) {
+	var sent map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent = nil
+		if r.Body != nil {
+			json.NewDecoder(r.Body).Decode(&sent)
+		}
+		switch r.URL.Path {
+		case "/api/tags":
+			w.Write([]byte(`{"models":[{"name":"llama3.1:8b","details":{"parameter_size":"8.0B"}},{"name":"qwen2.5:latest"}]}`))
+		case "/api/generate":
+			if sent["model"] == "ausente" {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"error":"model \"ausente\" not found, try pulling it first"}`))
+				return
+			}
+			w.Write([]byte(`{"response":"Resumo gerado.","done":true,"done_reason":"stop","prompt_eval_count":1200,"eval_count":300}`))
+		case "/api/chat":
+			if sent["stream"] == true {
+				w.Write([]byte("{\"message\":{\"role\":\"assistant\",\"content\":\"Olá\"},\"done\":false}\n" +
+					"{\"message\":{\"role\":\"assistant\",\"content\":\", mundo\"},\"done\":false}\n" +
+					"{\"message\":{\"role\":\"assistant\",\"content\":\"\"},\"done\":true,\"done_reason\":\"length\",\"prompt_eval_count\":40,\"eval_count\":2}\n"))
+				return
+			}
+			w.Write([]byte(`{"message":{"role":"assistant","content":"Olá"},"done":true}`))
+		}
+	}))
+	defer srv.Close()
+
+	p, err := Config{OllamaBaseURL: srv.URL, OllamaContextSize: 32768}.NewProvider("ollama")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if RequiresKey(p) {
+		t.Error("Ollama requires a key")
+	}
+
+	models, err := p.ListModels(ctx, "")
+	if err != nil || len(models) != 2 || models[0].ID != "llama3.1:8b" || models[0].DisplayName != "llama3.1:8b (8.0B)" {
+		t.Errorf("models = %+v, %v", models, err)
+	}
+
+	res, err := p.Generate(ctx, GenerateRequest{Model: "llama3.1:8b", SystemPrompt: "resuma", UserData: "cv", MaxTokens: 4096})
+	if err != nil || res.Text != "Resumo gerado." || res.Usage != (Usage{InputTokens: 1200, OutputTokens: 300}) || res.FinishReason != "stop" {
+		t.Errorf("generate = %+v, %v", res, err)
+	}
+	opts, _ := sent["options"].(map[string]any)
+	if sent["system"] != "resuma" || sent["prompt"] != "cv" || opts["num_ctx"] != float64(32768) || opts["num_predict"] != float64(4096) {
+		t.Errorf("generate request = %v", sent)
+	}
+
+	if _, err := p.Generate(ctx, GenerateRequest{Model: "ausente"}); err == nil || err.Error() != `erro do Ollama: status 404: model "ausente" not found, try pulling it first` {
+		t.Errorf("missing model error = %v", err)
+	}
+
+	chat := ChatRequest{Model: "llama3.1:8b", SystemPrompt: "base", Messages: []ChatMessage{{Role: "user", Content: "oi"}}}
+	if res, err := p.Chat(ctx, chat); err != nil || res.Text != "Olá" {
+		t.Errorf("chat = %+v, %v", res, err)
+	}
+	if msgs, _ := sent["messages"].([]any); len(msgs) != 2 {
+		t.Errorf("chat messages = %v", sent["messages"])
+	}
+
+	var deltas []string
+	res, err = p.ChatStream(ctx, chat, func(d string) error {
+		deltas = append(deltas, d)
+		return nil
+	})
+	if err != nil || res.Text != "Olá, mundo" || len(deltas) != 2 || res.Usage != (Usage{InputTokens: 40, OutputTokens: 2}) || res.FinishReason != "length" {
+		t.Errorf("stream = %+v, %v, deltas %q", res, err, deltas)
+	}
+
+	srv.Close()
+	if _, err := p.ListModels(ctx, ""); !errors.Is(err, ErrProviderUnavailable) {
+		t.Errorf("stopped server error = %v", err)
+	}
+}
@@ -11,13 +11,13 @@ import (
 )
 
 func (p *OpenAIProvider) ListModels(ctx context.Context, apiKey string) ([]Model, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://api.openai.com/v1/models", nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url("/models"), nil)
 	if err != nil {
 		return nil, fmt.Errorf("erro ao criar requisição: %w", err)
 	}
-	req.Header.Set("Authorization", "Bearer "+apiKey)
+	p.authorize(req, apiKey)
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, attempts, err := send(req)
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
 			return nil, ErrTimeout
@@ -31,14 +31,14 @@ func (p *OpenAIProvider) ListModels(ctx context.Context, apiKey string) ([]Model
 	}
 	if resp.StatusCode == http.StatusTooManyRequests {
 		respBody, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("%w: %s", ErrRateLimited, extractAPIError(respBody, "OpenAI"))
+		return nil, withAttempts(fmt.Errorf("%w: %s", ErrRateLimited, extractAPIError(respBody, p.label())), attempts)
 	}
 	if resp.StatusCode >= 500 {
-		return nil, fmt.Errorf("%w: status %d", ErrProviderUnavailable, resp.StatusCode)
+		return nil, withAttempts(fmt.Errorf("%w: status %d", ErrProviderUnavailable, resp.StatusCode), attempts)
 	}
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("erro da API OpenAI: status %d: %s", resp.StatusCode, string(respBody))
+		return nil, fmt.Errorf("erro da API %s: status %d: %s", p.label(), resp.StatusCode, string(respBody))
 	}
 
 	var result struct {
@@ -53,14 +53,14 @@ func (p *OpenAIProvider) ListModels(ctx context.Context, apiKey string) ([]Model
 
 	var models []Model
 	for _, m := range result.Data {
-		if (m.OwnedBy == "openai" || m.OwnedBy == "system") && strings.Contains(m.ID, "gpt") {
+		if p.compatible || (m.OwnedBy == "openai" || m.OwnedBy == "system") && strings.Contains(m.ID, "gpt") {
 			models = append(models, Model{ID: m.ID, DisplayName: m.ID})
 		}
 	}
 	return models, nil
 }
 
-func (p *OpenAIProvider) Generate(ctx context.Context, req GenerateRequest) (string, error) {
+func (p *OpenAIProvider) Generate(ctx context.Context, req GenerateRequest) (Result, error) {
 	ctx, cancel := context.WithTimeout(ctx, 120*time.Second)
 	defer cancel()
 
@@ -77,38 +77,38 @@ func (p *OpenAIProvider) Generate(ctx context.Context, req GenerateRequest) (str
 
 	jsonBody, err := json.Marshal(body)
 	if err != nil {
-		return "", fmt.Errorf("erro ao serializar requisição: %w", err)
+		return Result{}, fmt.Errorf("erro ao serializar requisição: %w", err)
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.openai.com/v1/chat/completions", strings.NewReader(string(jsonBody)))
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url("/chat/completions"), strings.NewReader(string(jsonBody)))
 	if err != nil {
-		return "", fmt.Errorf("erro ao criar requisição: %w", err)
+		return Result{}, fmt.Errorf("erro ao criar requisição: %w", err)
 	}
-	httpReq.Header.Set("Authorization", "Bearer "+req.APIKey)
+	p.authorize(httpReq, req.APIKey)
 	httpReq.Header.Set("Content-Type", "application/json")
 
-	resp, err := http.DefaultClient.Do(httpReq)
+	resp, attempts, err := send(httpReq)
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
-			return "", ErrTimeout
+			return Result{}, ErrTimeout
 		}
-		return "", fmt.Errorf("erro ao chamar API OpenAI: %w", err)
+		return Result{}, fmt.Errorf("erro ao chamar API %s: %w", p.label(), err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
-		return "", ErrInvalidKey
+		return Result{}, ErrInvalidKey
 	}
 	if resp.StatusCode == http.StatusTooManyRequests {
 		respBody, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("%w: %s", ErrRateLimited, extractAPIError(respBody, "OpenAI"))
+		return Result{}, withAttempts(fmt.Errorf("%w: %s", ErrRateLimited, extractAPIError(respBody, p.label())), attempts)
 	}
 	if resp.StatusCode >= 500 {
-		return "", fmt.Errorf("%w: status %d", ErrProviderUnavailable, resp.StatusCode)
+		return Result{}, withAttempts(fmt.Errorf("%w: status %d", ErrProviderUnavailable, resp.StatusCode), attempts)
 	}
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("erro da API OpenAI: status %d: %s", resp.StatusCode, string(respBody))
+		return Result{}, fmt.Errorf("erro da API %s: status %d: %s", p.label(), resp.StatusCode, string(respBody))
 	}
 
 	var result struct {
@@ -116,32 +116,35 @@ func (p *OpenAIProvider) Generate(ctx context.Context, req GenerateRequest) (str
 			Message struct {
 				Content string `json:"content"`
 			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
 		} `json:"choices"`
+		Usage openAIUsage `json:"usage"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", fmt.Errorf("erro ao decodificar resposta: %w", err)
+		return Result{}, fmt.Errorf("erro ao decodificar resposta: %w", err)
 	}
 
 	if len(result.Choices) == 0 {
-		return "", fmt.Errorf("resposta da API OpenAI sem conteúdo")
-	}
-	return result.Choices[0].Message.Content, nil
+		return Result{}, fmt.Errorf("resposta da API %s sem conteúdo", p.label())
+	}
+	return Result{
+		Text:         result.Choices[0].Message.Content,
+		Usage:        result.Usage.toUsage(),
+		FinishReason: result.Choices[0].FinishReason,
+		Attempts:     attempts,
+	}, nil
 }
 
-func (p *OpenAIProvider) Chat(ctx context.Context, req ChatRequest) (string, error) {
+func (p *OpenAIProvider) Chat(ctx context.Context, req ChatRequest) (Result, error) {
 	ctx, cancel := context.WithTimeout(ctx, 120*time.Second)
 	defer cancel()
 
-	messages := []map[string]string{
-		{"role": "system", "content": req.SystemPrompt},
-	}
-	for _, m := range req.Messages {
-		messages = append(messages, map[string]string{"role": m.Role, "content": m.Content})
-	}
-
 	body := map[string]any{
 		"model":    req.Model,
-		"messages": messages,
+		"messages": openAIMessages(req),
+	}
+	if len(req.Tools) > 0 {
+		body["tools"] = openAITools(req.Tools)
 	}
 	if req.MaxTokens > 0 {
 		body["max_tokens"] = req.MaxTokens
@@ -149,53 +152,180 @@ func (p *OpenAIProvider) Chat(ctx context.Context, req ChatRequest) (string, err
 
 	jsonBody, err := json.Marshal(body)
 	if err != nil {
-		return "", fmt.Errorf("erro ao serializar requisição: %w", err)
+		return Result{}, fmt.Errorf("erro ao serializar requisição: %w", err)
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.openai.com/v1/chat/completions", strings.NewReader(string(jsonBody)))
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url("/chat/completions"), strings.NewReader(string(jsonBody)))
 	if err != nil {
-		return "", fmt.Errorf("erro ao criar requisição: %w", err)
+		return Result{}, fmt.Errorf("erro ao criar requisição: %w", err)
 	}
-	httpReq.Header.Set("Authorization", "Bearer "+req.APIKey)
+	p.authorize(httpReq, req.APIKey)
 	httpReq.Header.Set("Content-Type", "application/json")
 
-	resp, err := http.DefaultClient.Do(httpReq)
+	resp, attempts, err := send(httpReq)
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
-			return "", ErrTimeout
+			return Result{}, ErrTimeout
 		}
-		return "", fmt.Errorf("erro ao chamar API OpenAI: %w", err)
+		return Result{}, fmt.Errorf("erro ao chamar API %s: %w", p.label(), err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
-		return "", ErrInvalidKey
+		return Result{}, ErrInvalidKey
 	}
 	if resp.StatusCode == http.StatusTooManyRequests {
 		respBody, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("%w: %s", ErrRateLimited, extractAPIError(respBody, "OpenAI"))
+		return Result{}, withAttempts(fmt.Errorf("%w: %s", ErrRateLimited, extractAPIError(respBody, p.label())), attempts)
 	}
 	if resp.StatusCode >= 500 {
-		return "", fmt.Errorf("%w: status %d", ErrProviderUnavailable, resp.StatusCode)
+		return Result{}, withAttempts(fmt.Errorf("%w: status %d", ErrProviderUnavailable, resp.StatusCode), attempts)
 	}
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("erro da API OpenAI: status %d: %s", resp.StatusCode, string(respBody))
+		return Result{}, fmt.Errorf("erro da API %s: status %d: %s", p.label(), resp.StatusCode, string(respBody))
 	}
 
 	var result struct {
 		Choices []struct {
 			Message struct {
-				Content string `json:"content"`
+				Content   string           `json:"content"`
+				ToolCalls []openAIToolCall `json:"tool_calls"`
 			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
 		} `json:"choices"`
+		Usage openAIUsage `json:"usage"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", fmt.Errorf("erro ao decodificar resposta: %w", err)
+		return Result{}, fmt.Errorf("erro ao decodificar resposta: %w", err)
 	}
 
 	if len(result.Choices) == 0 {
-		return "", fmt.Errorf("resposta da API OpenAI sem conteúdo")
+		return Result{}, fmt.Errorf("resposta da API %s sem conteúdo", p.label())
+	}
+	return Result{
+		Text:         result.Choices[0].Message.Content,
+		Usage:        result.Usage.toUsage(),
+		FinishReason: result.Choices[0].FinishReason,
+		Attempts:     attempts,
+		ToolCalls:    fromOpenAIToolCalls(result.Choices[0].Message.ToolCalls),
+	}, nil
+}
+
+func (p *OpenAIProvider) ChatStream(ctx context.Context, req ChatRequest, onDelta func(string) error) (Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, 120*time.Second)
+	defer cancel()
+
+	messages := []map[string]string{
+		{"role": "system", "content": req.system()},
+	}
+	for _, m := range req.Messages {
+		messages = append(messages, map[string]string{"role": m.Role, "content": m.Content})
+	}
+
+	body := map[string]any{
+		"model":    req.Model,
+		"messages": messages,
+		"stream":   true,
+		// Ask for a last chunk with the token usage.
+		"stream_options": map[string]any{"include_usage": true},
+	}
+	if req.MaxTokens > 0 {
+		body["max_tokens"] = req.MaxTokens
+	}
+
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return Result{}, fmt.Errorf("erro ao serializar requisição: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url("/chat/completions"), strings.NewReader(string(jsonBody)))
+	if err != nil {
+		return Result{}, fmt.Errorf("erro ao criar requisição: %w", err)
+	}
+	p.authorize(httpReq, req.APIKey)
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "text/event-stream")
+
+	resp, attempts, err := send(httpReq)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return Result{}, ErrTimeout
+		}
+		return Result{}, fmt.Errorf("erro ao chamar API %s: %w", p.label(), err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return Result{}, ErrInvalidKey
 	}
-	return result.Choices[0].Message.Content, nil
+	if resp.StatusCode == http.StatusTooManyRequests {
+		respBody, _ := io.ReadAll(resp.Body)
+		return Result{}, withAttempts(fmt.Errorf("%w: %s", ErrRateLimited, extractAPIError(respBody, p.label())), attempts)
+	}
+	if resp.StatusCode >= 500 {
+		return Result{}, withAttempts(fmt.Errorf("%w: status %d", ErrProviderUnavailable, resp.StatusCode), attempts)
+	}
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return Result{}, fmt.Errorf("erro da API %s: status %d: %s", p.label(), resp.StatusCode, string(respBody))
+	}
+
+	var full strings.Builder
+	var usage openAIUsage
+	var finishReason string
+	err = readSSE(resp.Body, func(_, data string) error {
+		if data == "[DONE]" {
+			return nil
+		}
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+				FinishReason string `json:"finish_reason"`
+			} `json:"choices"`
+			Usage *openAIUsage `json:"usage"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("erro ao decodificar resposta: %w", err)
+		}
+		if chunk.Error != nil {
+			return fmt.Errorf("erro da API %s: %s", p.label(), chunk.Error.Message)
+		}
+		if chunk.Usage != nil {
+			usage = *chunk.Usage
+		}
+		if len(chunk.Choices) > 0 && chunk.Choices[0].FinishReason != "" {
+			finishReason = chunk.Choices[0].FinishReason
+		}
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			return nil
+		}
+		full.WriteString(chunk.Choices[0].Delta.Content)
+		return onDelta(chunk.Choices[0].Delta.Content)
+	})
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return Result{}, ErrTimeout
+		}
+		return Result{}, err
+	}
+
+	if full.Len() == 0 {
+		return Result{}, fmt.Errorf("resposta da API %s sem conteúdo", p.label())
+	}
+	return Result{Text: full.String(), Usage: usage.toUsage(), FinishReason: finishReason, Attempts: attempts}, nil
+}
+
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+func (u openAIUsage) toUsage() Usage {
+	return Usage{InputTokens: u.PromptTokens, OutputTokens: u.CompletionTokens}
 }
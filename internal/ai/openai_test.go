@@ -0,0 +1,80 @@
+package ai
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCompatibleProvider(t *testing.T) {
+	var auth, path string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth, path = r.Header.Get("Authorization"), r.URL.Path
+		switch r.URL.Path {
+		case "/v1/models":
+			w.Write([]byte(`{"data":[{"id":"llama3","owned_by":"library"},{"id":"gpt-4o","owned_by":"openai"}]}`))
+		case "/v1/chat/completions":
+			w.Write([]byte(`{"choices":[{"message":{"content":"olá"},"finish_reason":"stop"}],"usage":{"prompt_tokens":12,"completion_tokens":3}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	t.Run("without key", func(t *testing.T) {
+		p, err := Config{CompatibleBaseURL: srv.URL + "/v1/"}.NewProvider("openai-compatible")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if RequiresKey(p) {
+			t.Error("compatible provider requires a key")
+		}
+		models, err := p.ListModels(context.Background(), "")
+		if err != nil || len(models) != 2 {
+			t.Fatalf("models = %+v, %v", models, err)
+		}
+		if path != "/v1/models" || auth != "" {
+			t.Errorf("path %q, authorization %q", path, auth)
+		}
+		res, err := p.Generate(context.Background(), GenerateRequest{Model: "llama3", UserData: "cv"})
+		if err != nil || res.Text != "olá" || path != "/v1/chat/completions" {
+			t.Errorf("generate = %+v, %v (path %q)", res, err, path)
+		}
+		if res.Usage != (Usage{InputTokens: 12, OutputTokens: 3}) || res.FinishReason != "stop" {
+			t.Errorf("usage %+v, finish reason %q", res.Usage, res.FinishReason)
+		}
+	})
+
+	t.Run("server key", func(t *testing.T) {
+		p, _ := Config{CompatibleBaseURL: srv.URL + "/v1", CompatibleAPIKey: "segredo"}.NewProvider("openai-compatible")
+		p.ListModels(context.Background(), "")
+		if auth != "Bearer segredo" {
+			t.Errorf("authorization = %q", auth)
+		}
+		p.ListModels(context.Background(), "do-usuario")
+		if auth != "Bearer do-usuario" {
+			t.Errorf("authorization = %q", auth)
+		}
+	})
+
+	t.Run("hosted OpenAI filters models", func(t *testing.T) {
+		p, _ := Config{OpenAIBaseURL: srv.URL + "/v1"}.NewProvider("openai")
+		if !RequiresKey(p) {
+			t.Error("OpenAI provider does not require a key")
+		}
+		models, err := p.ListModels(context.Background(), "k")
+		if err != nil || len(models) != 1 || models[0].ID != "gpt-4o" {
+			t.Errorf("models = %+v, %v", models, err)
+		}
+	})
+
+	t.Run("not configured", func(t *testing.T) {
+		if _, err := (Config{}).NewProvider("openai-compatible"); err == nil {
+			t.Error("created a compatible provider without a base URL")
+		}
+		if got := len(Config{}.Providers()); got != 3 {
+			t.Errorf("listed %d providers, want 3", got)
+		}
+	})
+}
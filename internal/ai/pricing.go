@@ -0,0 +1,100 @@
+package ai
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Price is what a model costs, in US dollars per million tokens.
+type Price struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+// Pricing maps model IDs, or prefixes of them, to their prices.
+type Pricing map[string]Price
+
+// DefaultPricing holds the list prices of the hosted models when this table
+// was last reviewed. Deployments can correct or extend it with
+// LoadPricing.
+var DefaultPricing = Pricing{
+	"gpt-5":         {1.25, 10},
+	"gpt-5-mini":    {0.25, 2},
+	"gpt-5-nano":    {0.05, 0.40},
+	"gpt-4.1":       {2, 8},
+	"gpt-4.1-mini":  {0.40, 1.60},
+	"gpt-4.1-nano":  {0.10, 0.40},
+	"gpt-4o":        {2.50, 10},
+	"gpt-4o-mini":   {0.15, 0.60},
+	"gpt-4-turbo":   {10, 30},
+	"gpt-3.5-turbo": {0.50, 1.50},
+	"o1":            {15, 60},
+	"o3":            {2, 8},
+	"o3-mini":       {1.10, 4.40},
+	"o4-mini":       {1.10, 4.40},
+
+	"claude-opus-4-5":   {5, 25},
+	"claude-opus-4":     {15, 75},
+	"claude-sonnet-4":   {3, 15},
+	"claude-haiku-4-5":  {1, 5},
+	"claude-3-7-sonnet": {3, 15},
+	"claude-3-5-sonnet": {3, 15},
+	"claude-3-5-haiku":  {0.80, 4},
+	"claude-3-opus":     {15, 75},
+	"claude-3-haiku":    {0.25, 1.25},
+
+	"gemini-2.5-pro":        {1.25, 10},
+	"gemini-2.5-flash":      {0.30, 2.50},
+	"gemini-2.5-flash-lite": {0.10, 0.40},
+	"gemini-2.0-flash":      {0.10, 0.40},
+	"gemini-2.0-flash-lite": {0.075, 0.30},
+	"gemini-1.5-pro":        {1.25, 5},
+	"gemini-1.5-flash":      {0.075, 0.30},
+}
+
+// LoadPricing reads a JSON object of model prefixes to prices from path and
+// returns DefaultPricing with those entries added or replaced.
+func LoadPricing(path string) (Pricing, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var extra Pricing
+	if err := json.Unmarshal(data, &extra); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	pricing := make(Pricing, len(DefaultPricing)+len(extra))
+	for model, price := range DefaultPricing {
+		pricing[model] = price
+	}
+	for model, price := range extra {
+		pricing[strings.ToLower(model)] = price
+	}
+	return pricing, nil
+}
+
+// Cost estimates what a call cost in US dollars, using the price of the
+// longest entry the model ID starts with, so dated versions such as
+// "claude-3-5-sonnet-20241022" use the family's price. Calls to Ollama are
+// free; ok is false when the model has no known price. Input tokens read from
+// the prompt cache cost a tenth of the input price (a quarter on Gemini) and
+// those written to it a quarter more, as the providers charge.
+func (p Pricing) Cost(provider, model string, u Usage) (cost float64, ok bool) {
+	if provider == "ollama" {
+		return 0, true
+	}
+	price, ok := lookupModel(p, model)
+	if !ok {
+		return 0, false
+	}
+	read, write := price.Input*0.1, price.Input*1.25
+	if provider == "gemini" {
+		read = price.Input * 0.25
+	}
+	uncached := u.InputTokens - u.CacheReadTokens - u.CacheWriteTokens
+	cost = float64(uncached)*price.Input + float64(u.CacheReadTokens)*read +
+		float64(u.CacheWriteTokens)*write + float64(u.OutputTokens)*price.Output
+	return cost / 1e6, true
+}
@@ -0,0 +1,64 @@
+package ai
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPricingCost(t *testing.T) {
+	usage := Usage{InputTokens: 1_000_000, OutputTokens: 100_000}
+	tests := []struct {
+		provider, model string
+		cost            float64
+		ok              bool
+	}{
+		{"openai", "gpt-4o-mini-2024-07-18", 0.15 + 0.06, true},
+		{"openai", "gpt-4o", 2.50 + 1, true},
+		{"anthropic", "claude-3-5-sonnet-20241022", 3 + 1.5, true},
+		{"gemini", "models/gemini-2.5-flash-lite", 0.10 + 0.04, true},
+		{"ollama", "llama3.1:8b", 0, true},
+		{"openai-compatible", "llama3", 0, false},
+	}
+	for _, tt := range tests {
+		cost, ok := DefaultPricing.Cost(tt.provider, tt.model, usage)
+		if ok != tt.ok || math.Abs(cost-tt.cost) > 1e-9 {
+			t.Errorf("Cost(%s, %s) = %v, %v; want %v, %v", tt.provider, tt.model, cost, ok, tt.cost, tt.ok)
+		}
+	}
+}
+
+func TestPricingCostCached(t *testing.T) {
+	// 600k of the 1M input tokens read from the cache and 200k written to it.
+	usage := Usage{InputTokens: 1_000_000, OutputTokens: 100_000, CacheReadTokens: 600_000, CacheWriteTokens: 200_000}
+	tests := []struct {
+		provider, model string
+		cost            float64
+	}{
+		{"anthropic", "claude-sonnet-4-5", 0.2*3 + 0.6*0.3 + 0.2*3.75 + 1.5},
+		{"gemini", "gemini-2.5-pro", 0.2*1.25 + 0.6*0.3125 + 0.2*1.5625 + 1},
+	}
+	for _, tt := range tests {
+		cost, _ := DefaultPricing.Cost(tt.provider, tt.model, usage)
+		if math.Abs(cost-tt.cost) > 1e-9 {
+			t.Errorf("Cost(%s, %s) = %v, want %v", tt.provider, tt.model, cost, tt.cost)
+		}
+	}
+}
+
+func TestLoadPricing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "precos.json")
+	os.WriteFile(path, []byte(`{"Llama3": {"input": 0.2, "output": 0.2}, "gpt-4o": {"input": 2, "output": 8}}`), 0o644)
+
+	pricing, err := LoadPricing(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pricing["llama3"] != (Price{0.2, 0.2}) || pricing["gpt-4o"] != (Price{2, 8}) || pricing["o3"] != DefaultPricing["o3"] {
+		t.Errorf("pricing = %v", pricing)
+	}
+	if DefaultPricing["gpt-4o"] != (Price{2.50, 10}) {
+		t.Error("LoadPricing changed DefaultPricing")
+	}
+}
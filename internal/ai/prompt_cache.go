@@ -0,0 +1,211 @@
+package ai
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// system returns the whole system prompt of req, for providers that take it
+// as one text.
+func (req ChatRequest) system() string {
+	return joinPrompt(req.stablePrompt(), req.SystemContext)
+}
+
+// stablePrompt is the part of the system prompt that providers may cache.
+func (req ChatRequest) stablePrompt() string {
+	return joinPrompt(req.SystemPrompt, req.SystemData)
+}
+
+func joinPrompt(parts ...string) string {
+	var nonEmpty []string
+	for _, p := range parts {
+		if p != "" {
+			nonEmpty = append(nonEmpty, p)
+		}
+	}
+	return strings.Join(nonEmpty, "\n\n")
+}
+
+// cachedSystem sends the system prompt of req to Anthropic in blocks: the
+// instructions and the data, each marked for the prompt cache, then the
+// SystemContext unmarked. Later rounds, turns and other users read the
+// instructions from the cache and, while the same researchers are selected,
+// the data too, and the part that changes with each question never
+// invalidates them. Blocks shorter than the model's minimum are simply not
+// cached.
+func cachedSystem(req ChatRequest) []map[string]any {
+	var system []map[string]any
+	for _, cached := range []string{req.SystemPrompt, req.SystemData} {
+		if cached != "" {
+			system = append(system, map[string]any{
+				"type":          "text",
+				"text":          cached,
+				"cache_control": map[string]string{"type": "ephemeral"},
+			})
+		}
+	}
+	if req.SystemContext != "" {
+		system = append(system, map[string]any{"type": "text", "text": req.SystemContext})
+	}
+	if len(system) == 0 {
+		system = append(system, map[string]any{"type": "text", "text": ""})
+	}
+	return system
+}
+
+// Gemini caches content explicitly: the system prompt is uploaded once to
+// /cachedContents and chat requests refer to it by name.
+const (
+	geminiCacheTTL = 10 * time.Minute
+	// geminiCacheMinChars skips prompts below the smallest cache Gemini
+	// accepts (4,096 tokens on the pro models).
+	geminiCacheMinChars = 4 * 4096
+)
+
+// geminiCacheEntry is a cached content created for a key, model and system
+// prompt. An empty name records that creating it failed, so it is not tried
+// again on every turn.
+type geminiCacheEntry struct {
+	name    string
+	expires time.Time
+}
+
+type geminiCacheRegistry struct {
+	mu      sync.Mutex
+	entries map[string]geminiCacheEntry
+}
+
+// geminiCaches is shared by every GeminiProvider, since handlers create a
+// provider per request.
+var geminiCaches = &geminiCacheRegistry{entries: map[string]geminiCacheEntry{}}
+
+func geminiCacheKey(apiKey, model, prompt string) string {
+	sum := sha256.Sum256([]byte(apiKey + "\x00" + model + "\x00" + prompt))
+	return hex.EncodeToString(sum[:])
+}
+
+func (r *geminiCacheRegistry) get(key string, now time.Time) (geminiCacheEntry, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.entries[key]
+	if ok && !now.Before(e.expires) {
+		delete(r.entries, key)
+		return geminiCacheEntry{}, false
+	}
+	return e, ok
+}
+
+func (r *geminiCacheRegistry) put(key string, e geminiCacheEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	for k, old := range r.entries {
+		if !now.Before(old.expires) {
+			delete(r.entries, k)
+		}
+	}
+	r.entries[key] = e
+}
+
+// cachedContent returns the name of the cached content holding the stable
+// part of the system prompt of req, its SystemPrompt and SystemData, creating
+// it when needed, or "" when the prompt is sent uncached.
+func (p *GeminiProvider) cachedContent(ctx context.Context, req ChatRequest) string {
+	prompt := req.stablePrompt()
+	if len(prompt) < geminiCacheMinChars {
+		return ""
+	}
+	key := geminiCacheKey(p.key(req.APIKey), req.Model, prompt)
+	if e, ok := geminiCaches.get(key, time.Now()); ok {
+		return e.name
+	}
+
+	// Expire the entry a little before Gemini does, so no request refers to
+	// content that is gone.
+	expires := time.Now().Add(geminiCacheTTL - 30*time.Second)
+	name, err := p.createCachedContent(ctx, req)
+	if err != nil {
+		name = ""
+	}
+	geminiCaches.put(key, geminiCacheEntry{name: name, expires: expires})
+	return name
+}
+
+func (p *GeminiProvider) createCachedContent(ctx context.Context, req ChatRequest) (string, error) {
+	body, err := json.Marshal(map[string]any{
+		"model": "models/" + req.Model,
+		"systemInstruction": map[string]any{
+			"parts": []map[string]string{{"text": req.stablePrompt()}},
+		},
+		"ttl": fmt.Sprintf("%ds", int(geminiCacheTTL.Seconds())),
+	})
+	if err != nil {
+		return "", err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url("/cachedContents"), strings.NewReader(string(body)))
+	if err != nil {
+		return "", err
+	}
+	httpReq.Header.Set("x-goog-api-key", p.key(req.APIKey))
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("status %d", resp.StatusCode)
+	}
+	var created struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return "", err
+	}
+	return created.Name, nil
+}
+
+// forgetCachedContent drops the cached content of req after Gemini rejected
+// it, typically because it expired early, and keeps the prompt uncached until
+// the entry would have expired.
+func (p *GeminiProvider) forgetCachedContent(req ChatRequest) {
+	key := geminiCacheKey(p.key(req.APIKey), req.Model, req.stablePrompt())
+	geminiCaches.put(key, geminiCacheEntry{expires: time.Now().Add(geminiCacheTTL)})
+}
+
+// geminiSystem sets the system prompt of req in a chat request body: the
+// cached content holding its stable part when there is one, the whole prompt
+// otherwise. Gemini does not take a system instruction next to a cached
+// content, so the SystemContext then opens the conversation.
+func geminiSystem(body map[string]any, req ChatRequest, cached string) {
+	if cached == "" {
+		body["system_instruction"] = map[string]any{
+			"parts": []map[string]string{
+				{"text": req.system()},
+			},
+		}
+		return
+	}
+	body["cachedContent"] = cached
+	if req.SystemContext != "" {
+		contents, _ := body["contents"].([]map[string]any)
+		body["contents"] = append([]map[string]any{{
+			"role":  "user",
+			"parts": []map[string]string{{"text": req.SystemContext}},
+		}}, contents...)
+	}
+}
+
+// cachedContentRejected reports whether a request referring to cached content
+// failed because the content is no longer available.
+func cachedContentRejected(status int) bool {
+	return status == http.StatusBadRequest || status == http.StatusForbidden || status == http.StatusNotFound
+}
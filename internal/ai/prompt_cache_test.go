@@ -0,0 +1,132 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAnthropicCachedSystem(t *testing.T) {
+	var body struct {
+		System []struct {
+			Text         string            `json:"text"`
+			CacheControl map[string]string `json:"cache_control"`
+		} `json:"system"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Write([]byte(`{"content":[{"type":"text","text":"olá"}],"stop_reason":"end_turn",
+			"usage":{"input_tokens":10,"cache_read_input_tokens":2000,"cache_creation_input_tokens":0,"output_tokens":5}}`))
+	}))
+	defer srv.Close()
+
+	p, _ := Config{AnthropicBaseURL: srv.URL}.NewProvider("anthropic")
+	req := ChatRequest{APIKey: "k", Model: "claude-sonnet-4-5", SystemPrompt: "instruções", Messages: []ChatMessage{{Role: "user", Content: "oi"}}}
+	res, err := p.Chat(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(body.System) != 1 || body.System[0].Text != "instruções" || body.System[0].CacheControl["type"] != "ephemeral" {
+		t.Errorf("system = %+v", body.System)
+	}
+	if want := (Usage{InputTokens: 2010, OutputTokens: 5, CacheReadTokens: 2000}); res.Usage != want {
+		t.Errorf("usage = %+v, want %+v", res.Usage, want)
+	}
+
+	// The data gets a breakpoint of its own and the counts of the question
+	// come after it.
+	req.SystemData, req.SystemContext = "dados", "contagens"
+	body.System = nil
+	if _, err := p.Chat(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.System) != 3 || body.System[0].CacheControl["type"] != "ephemeral" {
+		t.Fatalf("system with data = %+v", body.System)
+	}
+	if data := body.System[1]; data.Text != "dados" || data.CacheControl["type"] != "ephemeral" {
+		t.Errorf("data block = %+v", data)
+	}
+	if context := body.System[2]; context.Text != "contagens" || context.CacheControl != nil {
+		t.Errorf("per-question block = %+v", context)
+	}
+}
+
+func TestGeminiCachedContent(t *testing.T) {
+	prompt := strings.Repeat("Pesquisador de ecologia. ", geminiCacheMinChars/20)
+	var created, rejected int
+	var requests []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		var body map[string]any
+		json.Unmarshal(raw, &body)
+		if r.URL.Path == "/cachedContents" {
+			created++
+			w.Write([]byte(`{"name":"cachedContents/abc"}`))
+			return
+		}
+		requests = append(requests, body)
+		if body["cachedContent"] != nil && rejected < 1 && len(requests) == 3 {
+			rejected++
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"error":{"message":"CachedContent not found"}}`))
+			return
+		}
+		w.Write([]byte(`{"candidates":[{"content":{"parts":[{"text":"olá"}]},"finishReason":"STOP"}],
+			"usageMetadata":{"promptTokenCount":5000,"cachedContentTokenCount":4900,"candidatesTokenCount":3}}`))
+	}))
+	defer srv.Close()
+	defer func() { geminiCaches = &geminiCacheRegistry{entries: map[string]geminiCacheEntry{}} }()
+
+	p, _ := Config{GeminiBaseURL: srv.URL}.NewProvider("gemini")
+	req := ChatRequest{APIKey: "k", Model: "gemini-2.5-flash", SystemPrompt: prompt, Messages: []ChatMessage{{Role: "user", Content: "oi"}}}
+	for turn := 0; turn < 2; turn++ {
+		res, err := p.Chat(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Usage.CacheReadTokens != 4900 {
+			t.Errorf("usage = %+v", res.Usage)
+		}
+	}
+	if created != 1 {
+		t.Errorf("created %d cached contents, want 1", created)
+	}
+	for _, body := range requests {
+		if body["cachedContent"] != "cachedContents/abc" || body["system_instruction"] != nil {
+			t.Errorf("request = %v", body["cachedContent"])
+		}
+	}
+
+	// Content Gemini no longer has is dropped and the prompt sent inline.
+	if _, err := p.Chat(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 4 || requests[3]["system_instruction"] == nil || requests[3]["cachedContent"] != nil {
+		t.Errorf("after rejection sent %d requests, last %v", len(requests), requests[len(requests)-1]["cachedContent"])
+	}
+
+	// The part that changes with each question keeps the cache and opens the
+	// conversation; the data is cached with the instructions.
+	geminiCaches = &geminiCacheRegistry{entries: map[string]geminiCacheEntry{}}
+	req.SystemContext = "contagens da pergunta"
+	if _, err := p.Chat(context.Background(), req); err != nil || created != 2 {
+		t.Errorf("prompt with context: err = %v, created = %d", err, created)
+	}
+	last := requests[len(requests)-1]
+	if first := fmt.Sprint(last["contents"]); last["cachedContent"] != "cachedContents/abc" || !strings.Contains(first, "contagens da pergunta") || strings.Index(first, "contagens") > strings.Index(first, "oi") {
+		t.Errorf("request with context: cachedContent = %v, contents = %v", last["cachedContent"], last["contents"])
+	}
+	req.SystemData = "dados"
+	if _, err := p.Chat(context.Background(), req); err != nil || created != 3 {
+		t.Errorf("prompt with data: err = %v, created = %d", err, created)
+	}
+	req.SystemPrompt, req.SystemData, req.SystemContext = "curto", "", ""
+	if _, err := p.Chat(context.Background(), req); err != nil || created != 3 {
+		t.Errorf("short prompt: err = %v, created = %d", err, created)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"strings"
 )
 
 var (
@@ -30,25 +32,177 @@ type GenerateRequest struct {
 type ChatMessage struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
+	// ToolCalls are the tools an assistant message called. A message with
+	// role "tool" carries the result of the call ToolCallID.
+	ToolCalls  []ToolCall `json:"toolCalls,omitempty"`
+	ToolCallID string     `json:"toolCallId,omitempty"`
 }
 
 type ChatRequest struct {
 	APIKey       string
 	Model        string
 	SystemPrompt string
-	Messages     []ChatMessage
-	MaxTokens    int
+	// SystemData is a large block of the system instructions that repeats
+	// across turns and users, such as the CV data in canonical order. It
+	// follows SystemPrompt and is cached on its own, so a change in it keeps
+	// the cache of SystemPrompt.
+	SystemData string
+	// SystemContext is the part of the system instructions that changes with
+	// each question, such as how many researchers were selected for it. It
+	// comes last, outside the provider's prompt cache.
+	SystemContext string
+	Messages      []ChatMessage
+	MaxTokens     int
+	// Tools are offered to the model by Chat on providers for which
+	// SupportsTools is true.
+	Tools []Tool
+}
+
+// Usage is the token count a provider reports for a call. Zero means the
+// provider did not report it.
+type Usage struct {
+	InputTokens  int `json:"inputTokens"`
+	OutputTokens int `json:"outputTokens"`
+	// CacheReadTokens and CacheWriteTokens are the part of InputTokens read
+	// from and written to the provider's prompt cache.
+	CacheReadTokens  int `json:"cacheReadTokens,omitempty"`
+	CacheWriteTokens int `json:"cacheWriteTokens,omitempty"`
+}
+
+// Result is the answer to a Generate or Chat call.
+type Result struct {
+	Text  string
+	Usage Usage
+	// FinishReason is why the model stopped, as the provider names it
+	// ("stop", "end_turn", "MAX_TOKENS", "length"...).
+	FinishReason string
+	// Attempts is how many requests the call took, retries included; zero
+	// for providers that do not retry.
+	Attempts int
+	// ToolCalls are the tools the model called instead of, or before,
+	// answering. The caller runs them and continues the chat.
+	ToolCalls []ToolCall
 }
 
 type AIProvider interface {
 	ListModels(ctx context.Context, apiKey string) ([]Model, error)
-	Generate(ctx context.Context, req GenerateRequest) (string, error)
-	Chat(ctx context.Context, req ChatRequest) (string, error)
+	Generate(ctx context.Context, req GenerateRequest) (Result, error)
+	Chat(ctx context.Context, req ChatRequest) (Result, error)
+	// ChatStream behaves like Chat but calls onDelta with each text fragment
+	// as soon as the provider emits it. The full response is also returned.
+	// Returning an error from onDelta aborts the stream.
+	ChatStream(ctx context.Context, req ChatRequest, onDelta func(string) error) (Result, error)
+}
+
+// Default API roots of the hosted providers.
+const (
+	OpenAIBaseURL    = "https://api.openai.com/v1"
+	AnthropicBaseURL = "https://api.anthropic.com/v1"
+	GeminiBaseURL    = "https://generativelanguage.googleapis.com/v1beta"
+)
+
+// OpenAIProvider calls the OpenAI chat completions API, or any server that
+// implements it (vLLM, Ollama, LiteLLM...) when compatible is set.
+type OpenAIProvider struct {
+	baseURL string
+	// apiKey is sent when a request brings no key of its own.
+	apiKey     string
+	compatible bool
+}
+
+type AnthropicProvider struct {
+	baseURL string
+	apiKey  string
+}
+
+type GeminiProvider struct {
+	baseURL string
+	apiKey  string
+}
+
+func (p *OpenAIProvider) url(path string) string {
+	return joinURL(p.baseURL, OpenAIBaseURL, path)
+}
+
+func (p *AnthropicProvider) url(path string) string {
+	return joinURL(p.baseURL, AnthropicBaseURL, path)
+}
+
+func (p *GeminiProvider) url(path string) string {
+	return joinURL(p.baseURL, GeminiBaseURL, path)
+}
+
+func joinURL(base, fallback, path string) string {
+	if base == "" {
+		base = fallback
+	}
+	return strings.TrimRight(base, "/") + path
+}
+
+// authorize sets the bearer token, falling back to the provider's own key.
+// Self-hosted servers often need none, in which case no header is sent.
+func (p *OpenAIProvider) authorize(req *http.Request, apiKey string) {
+	if apiKey == "" {
+		apiKey = p.apiKey
+	}
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+}
+
+// key returns the request's API key or, when it brings none, the key managed
+// by the server.
+func (p *AnthropicProvider) key(apiKey string) string {
+	if apiKey == "" {
+		return p.apiKey
+	}
+	return apiKey
+}
+
+func (p *GeminiProvider) key(apiKey string) string {
+	if apiKey == "" {
+		return p.apiKey
+	}
+	return apiKey
+}
+
+// label names the provider in error messages.
+func (p *OpenAIProvider) label() string {
+	if p.compatible {
+		return "compatível com OpenAI"
+	}
+	return "OpenAI"
+}
+
+// KeyOptional reports whether the provider can be called without an API key
+// in the request.
+func (p *OpenAIProvider) KeyOptional() bool {
+	return p.compatible || p.apiKey != ""
+}
+
+func (p *AnthropicProvider) KeyOptional() bool {
+	return p.apiKey != ""
 }
 
-type OpenAIProvider struct{}
-type AnthropicProvider struct{}
-type GeminiProvider struct{}
+func (p *GeminiProvider) KeyOptional() bool {
+	return p.apiKey != ""
+}
+
+// RequiresKey reports whether requests to p must carry the user's API key.
+func RequiresKey(p AIProvider) bool {
+	k, ok := p.(interface{ KeyOptional() bool })
+	return !ok || !k.KeyOptional()
+}
+
+// ServedByServer reports whether a request carrying apiKey is paid for by
+// the server, with a key it manages or with its own hardware, rather than by
+// the user's key. Those are the requests subject to quotas.
+func ServedByServer(p AIProvider, apiKey string) bool {
+	if _, ok := p.(*OllamaProvider); ok {
+		return true
+	}
+	return apiKey == ""
+}
 
 // extractAPIError attempts to parse the provider's JSON error response body
 // and return a human-readable message. Falls back to raw body if parsing fails.
@@ -73,15 +227,85 @@ func extractAPIError(body []byte, provider string) string {
 	return s
 }
 
-func NewProvider(name string) (AIProvider, error) {
+// Config sets where each provider is reached. Empty base URLs use the public
+// APIs; the "openai-compatible" and "ollama" providers are only offered when
+// their base URL is set.
+type Config struct {
+	OpenAIBaseURL    string
+	AnthropicBaseURL string
+	GeminiBaseURL    string
+
+	// Keys managed by the server, used for requests that bring no key of
+	// their own, so users can generate summaries without one.
+	OpenAIAPIKey    string
+	AnthropicAPIKey string
+	GeminiAPIKey    string
+
+	// CompatibleBaseURL is the API root, usually ending in /v1, of a server
+	// implementing the OpenAI chat completions API. CompatibleAPIKey, when
+	// set, is used for requests that bring no key, so users need none.
+	CompatibleBaseURL string
+	CompatibleAPIKey  string
+	CompatibleName    string
+
+	// OllamaBaseURL is the root of an Ollama server, such as
+	// http://localhost:11434. OllamaContextSize, when positive, sets the
+	// context window of its models.
+	OllamaBaseURL     string
+	OllamaContextSize int
+}
+
+// ProviderInfo describes a provider offered to the user.
+type ProviderInfo struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	KeyRequired bool   `json:"keyRequired"`
+}
+
+// Providers lists the providers available with this configuration.
+func (c Config) Providers() []ProviderInfo {
+	providers := []ProviderInfo{
+		{ID: "openai", Name: "OpenAI", KeyRequired: c.OpenAIAPIKey == ""},
+		{ID: "anthropic", Name: "Anthropic", KeyRequired: c.AnthropicAPIKey == ""},
+		{ID: "gemini", Name: "Google Gemini", KeyRequired: c.GeminiAPIKey == ""},
+	}
+	if c.CompatibleBaseURL != "" {
+		name := c.CompatibleName
+		if name == "" {
+			name = "Servidor compatível com OpenAI"
+		}
+		providers = append(providers, ProviderInfo{ID: "openai-compatible", Name: name, KeyRequired: false})
+	}
+	if c.OllamaBaseURL != "" {
+		providers = append(providers, ProviderInfo{ID: "ollama", Name: "Ollama (local)", KeyRequired: false})
+	}
+	return providers
+}
+
+func (c Config) NewProvider(name string) (AIProvider, error) {
 	switch name {
 	case "openai":
-		return &OpenAIProvider{}, nil
+		return &OpenAIProvider{baseURL: c.OpenAIBaseURL, apiKey: c.OpenAIAPIKey}, nil
 	case "anthropic":
-		return &AnthropicProvider{}, nil
+		return &AnthropicProvider{baseURL: c.AnthropicBaseURL, apiKey: c.AnthropicAPIKey}, nil
 	case "gemini":
-		return &GeminiProvider{}, nil
+		return &GeminiProvider{baseURL: c.GeminiBaseURL, apiKey: c.GeminiAPIKey}, nil
+	case "openai-compatible":
+		if c.CompatibleBaseURL == "" {
+			return nil, fmt.Errorf("provedor compatível com OpenAI não configurado no servidor")
+		}
+		return &OpenAIProvider{baseURL: c.CompatibleBaseURL, apiKey: c.CompatibleAPIKey, compatible: true}, nil
+	case "ollama":
+		if c.OllamaBaseURL == "" {
+			return nil, fmt.Errorf("provedor Ollama não configurado no servidor")
+		}
+		return &OllamaProvider{baseURL: c.OllamaBaseURL, contextSize: c.OllamaContextSize}, nil
 	default:
 		return nil, fmt.Errorf("provedor desconhecido: %s", name)
 	}
 }
+
+// NewProvider returns a provider using the public APIs.
+func NewProvider(name string) (AIProvider, error) {
+	return Config{}.NewProvider(name)
+}
@@ -0,0 +1,252 @@
+package ai
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/edalcin/smartlattes/internal/textnorm"
+)
+
+// BM25 parameters (standard values from the Okapi literature).
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Field weights applied as term-frequency multipliers: a match in the
+// researcher's name or areas counts more than a match in a publication title.
+const (
+	nameWeight  = 3
+	areaWeight  = 2
+	titleWeight = 1
+)
+
+// queryWords are words of chat questions that say nothing about the subject
+// asked about; textnorm drops the function words.
+var queryWords = map[string]bool{
+	"base": true, "pesquisador": true, "pesquisadores": true, "pesquisadora": true, "pesquisadoras": true,
+	"trabalha": true, "trabalham": true, "liste": true, "listar": true, "mostre": true, "quantos": true,
+	"quantas": true, "existe": true, "algum": true, "alguma": true,
+}
+
+// tokenize splits text into normalized index terms, dropping stopwords, short
+// tokens and numbers other than four-digit years.
+func tokenize(s string) []string {
+	fields := strings.Fields(textnorm.Fold(s))
+	terms := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if textnorm.IsStopword(f) || queryWords[f] {
+			continue
+		}
+		if isNumeric(f) {
+			if len(f) == 4 {
+				terms = append(terms, f)
+			}
+			continue
+		}
+		if len(f) < 3 {
+			continue
+		}
+		terms = append(terms, textnorm.Singular(f))
+	}
+	return terms
+}
+
+func isNumeric(s string) bool {
+	for _, r := range s {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// RetrievalIndex is a BM25 index over the researchers of the base. Each
+// researcher is a document made of their name, areas-de-atuacao and compacted
+// publication titles.
+type RetrievalIndex struct {
+	docs  []indexedCV
+	df    map[string]int
+	avgDL float64
+}
+
+type indexedCV struct {
+	cv     map[string]interface{}
+	tf     map[string]int
+	length int
+}
+
+// RetrievalHit is a researcher matched by a query, with its BM25 score.
+type RetrievalHit struct {
+	CV    map[string]interface{}
+	Score float64
+}
+
+// NewRetrievalIndex builds the index. The CVs are normalized to plain maps
+// first, so documents read straight from MongoDB (with bson.D values) work.
+func NewRetrievalIndex(cvs []map[string]interface{}) *RetrievalIndex {
+	idx := &RetrievalIndex{df: make(map[string]int)}
+	total := 0
+	for _, raw := range cvs {
+		cv, ok := deepCopyAny(raw).(map[string]interface{})
+		if !ok {
+			continue
+		}
+		doc := indexedCV{cv: cv, tf: make(map[string]int)}
+		addTerms := func(text string, weight int) {
+			for _, t := range tokenize(text) {
+				doc.tf[t] += weight
+				doc.length += weight
+			}
+		}
+
+		if inner, ok := getInnerMap(cv, "curriculo-vitae"); ok {
+			if dg, ok := getInnerMap(inner, "dados-gerais"); ok {
+				if name, ok := dg["nome-completo"].(string); ok {
+					addTerms(name, nameWeight)
+				}
+				for _, area := range collectStrings(dg["areas-de-atuacao"]) {
+					addTerms(area, areaWeight)
+				}
+			}
+			for _, pub := range collectPublications(cv, inner) {
+				addTerms(pub["titulo"], titleWeight)
+			}
+		}
+
+		for t := range doc.tf {
+			idx.df[t]++
+		}
+		total += doc.length
+		idx.docs = append(idx.docs, doc)
+	}
+	if len(idx.docs) > 0 {
+		idx.avgDL = float64(total) / float64(len(idx.docs))
+	}
+	return idx
+}
+
+// Search returns up to limit researchers ranked by BM25 score. Researchers
+// that share no term with the query are never returned.
+func (idx *RetrievalIndex) Search(query string, limit int) []RetrievalHit {
+	terms := uniqueTerms(tokenize(query))
+	if len(terms) == 0 || len(idx.docs) == 0 {
+		return nil
+	}
+
+	n := float64(len(idx.docs))
+	var hits []RetrievalHit
+	for _, doc := range idx.docs {
+		score := 0.0
+		for _, t := range terms {
+			tf := float64(doc.tf[t])
+			if tf == 0 {
+				continue
+			}
+			df := float64(idx.df[t])
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			denom := tf + bm25K1*(1-bm25B+bm25B*float64(doc.length)/idx.avgDL)
+			score += idf * tf * (bm25K1 + 1) / denom
+		}
+		if score > 0 {
+			hits = append(hits, RetrievalHit{CV: doc.cv, Score: score})
+		}
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits
+}
+
+// SelectRelevantCVs picks the researchers most relevant to query and compacts
+// their producao-bibliografica to title+year, putting the publications that
+// match the query first so later truncation keeps them. It returns nil when
+// no researcher matches, letting the caller fall back to the whole base.
+func SelectRelevantCVs(cvs []map[string]interface{}, query string, limit int) []map[string]interface{} {
+	hits := NewRetrievalIndex(cvs).Search(query, limit)
+	if len(hits) == 0 {
+		return nil
+	}
+
+	terms := uniqueTerms(tokenize(query))
+	selected := make([]map[string]interface{}, 0, len(hits))
+	for _, hit := range hits {
+		inner, ok := getInnerMap(hit.CV, "curriculo-vitae")
+		if ok {
+			if _, hasPB := inner["producao-bibliografica"]; hasPB {
+				pubs := collectPublications(hit.CV, inner)
+				sortPublications(pubs)
+				sort.SliceStable(pubs, func(i, j int) bool {
+					return termOverlap(pubs[i]["titulo"], terms) > termOverlap(pubs[j]["titulo"], terms)
+				})
+				inner["producao-bibliografica"] = pubs
+			}
+		}
+		selected = append(selected, hit.CV)
+	}
+	return selected
+}
+
+// RetrievalQuery builds the search query for a conversation from the latest
+// user messages; the previous question is included so follow-ups such as
+// "e quais os artigos dela?" still retrieve the researcher being discussed.
+func RetrievalQuery(messages []ChatMessage) string {
+	var parts []string
+	for i := len(messages) - 1; i >= 0 && len(parts) < 2; i-- {
+		if messages[i].Role == "user" {
+			parts = append(parts, messages[i].Content)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func uniqueTerms(terms []string) []string {
+	seen := make(map[string]bool, len(terms))
+	out := terms[:0]
+	for _, t := range terms {
+		if !seen[t] {
+			seen[t] = true
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+func termOverlap(text string, terms []string) int {
+	if len(terms) == 0 {
+		return 0
+	}
+	present := make(map[string]bool)
+	for _, t := range tokenize(text) {
+		present[t] = true
+	}
+	count := 0
+	for _, t := range terms {
+		if present[t] {
+			count++
+		}
+	}
+	return count
+}
+
+// collectStrings returns every string value found under v.
+func collectStrings(v interface{}) []string {
+	var out []string
+	switch val := v.(type) {
+	case string:
+		out = append(out, val)
+	case map[string]interface{}:
+		for _, child := range val {
+			out = append(out, collectStrings(child)...)
+		}
+	case []interface{}:
+		for _, child := range val {
+			out = append(out, collectStrings(child)...)
+		}
+	}
+	return out
+}
@@ -0,0 +1,31 @@
+package ai
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestRetrievalConcurrent runs searches the way concurrent chat requests do;
+// run it with go test -race.
+func TestRetrievalConcurrent(t *testing.T) {
+	cvs := []map[string]interface{}{testCV("Ana Conceição", 3), testCV("Bruno Simões", 3), testCV("Carla Gonçalves", 3)}
+	queries := map[string]string{"conceicao": "id-Ana Conceição", "SIMÕES": "id-Bruno Simões", "gonçalves": "id-Carla Gonçalves"}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 6; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				for query, want := range queries {
+					hits := NewRetrievalIndex(cvs).Search(query, 1)
+					if len(hits) != 1 || hits[0].CV["_id"] != want {
+						t.Errorf("Search(%q) = %v, want %s", query, hits, want)
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
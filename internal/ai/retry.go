@@ -0,0 +1,227 @@
+package ai
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// retryPolicy controls how calls to the hosted providers are retried when
+// they answer 429 or a transient 5xx.
+type retryPolicy struct {
+	// Attempts is the total number of requests made, the first included.
+	Attempts int
+	// BaseDelay is the backoff before the second attempt; it doubles on each
+	// retry up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// MaxWait is the longest wait accepted from Retry-After or a reset
+	// header. Longer waits are not worth holding the request for.
+	MaxWait time.Duration
+}
+
+var defaultRetry = retryPolicy{
+	Attempts:  4,
+	BaseDelay: time.Second,
+	MaxDelay:  20 * time.Second,
+	MaxWait:   60 * time.Second,
+}
+
+// retryableStatus reports whether a response with code may succeed if sent
+// again. 529 is Anthropic's "overloaded".
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout, 529:
+		return true
+	}
+	return false
+}
+
+// send performs req, sending it again while the provider answers 429 or a
+// transient 5xx. Waits follow Retry-After or the provider's reset headers
+// when present and a jittered exponential backoff otherwise. It gives up,
+// returning the last response, when the attempts run out or the wait would
+// pass the deadline of the request context. The number of requests made is
+// returned with the response.
+func send(req *http.Request) (*http.Response, int, error) {
+	ctx := req.Context()
+	for attempt := 1; ; attempt++ {
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, attempt, err
+		}
+		if !retryableStatus(resp.StatusCode) || attempt >= defaultRetry.Attempts {
+			return resp, attempt, nil
+		}
+
+		wait, ok := defaultRetry.wait(resp, attempt, time.Now())
+		if !ok {
+			return resp, attempt, nil
+		}
+		if deadline, has := ctx.Deadline(); has && time.Until(deadline) <= wait {
+			return resp, attempt, nil
+		}
+		next := req
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return resp, attempt, nil
+			}
+			next = req.Clone(ctx)
+			next.Body = body
+		}
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+		resp.Body.Close()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, attempt, ctx.Err()
+		case <-timer.C:
+		}
+		req = next
+	}
+}
+
+// wait returns how long to wait before retrying after resp, the answer to the
+// given attempt, or false if it should not be retried.
+func (p retryPolicy) wait(resp *http.Response, attempt int, now time.Time) (time.Duration, bool) {
+	var body []byte
+	if resp.StatusCode == http.StatusTooManyRequests {
+		body = peekBody(resp)
+		// OpenAI answers 429 when the account has no credit left, which
+		// waiting does not fix.
+		if bytes.Contains(body, []byte("insufficient_quota")) {
+			return 0, false
+		}
+	}
+
+	if hint, ok := retryHint(resp.Header, body, now); ok {
+		if hint > p.MaxWait {
+			return 0, false
+		}
+		return hint, true
+	}
+
+	backoff := p.BaseDelay << (attempt - 1)
+	if backoff > p.MaxDelay || backoff <= 0 {
+		backoff = p.MaxDelay
+	}
+	// Full jitter over the upper half keeps concurrent jobs from retrying in
+	// lockstep.
+	half := backoff / 2
+	return half + rand.N(half+1), true
+}
+
+// peekBody reads the start of resp's body and puts it back so the caller can
+// still read the whole of it.
+func peekBody(resp *http.Response) []byte {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+	return body
+}
+
+// retryHint returns the wait the provider asked for, if any: the standard
+// Retry-After (seconds or HTTP date) and retry-after-ms headers, OpenAI's
+// x-ratelimit-reset-* durations and Anthropic's anthropic-ratelimit-*-reset
+// timestamps for the exhausted limits, or the RetryInfo Gemini puts in the
+// error body.
+func retryHint(h http.Header, body []byte, now time.Time) (time.Duration, bool) {
+	if v := h.Get("Retry-After-Ms"); v != "" {
+		if ms, err := strconv.ParseFloat(v, 64); err == nil && ms >= 0 {
+			return time.Duration(ms * float64(time.Millisecond)), true
+		}
+	}
+	if v := h.Get("Retry-After"); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+			return time.Duration(secs) * time.Second, true
+		}
+		if at, err := http.ParseTime(v); err == nil {
+			return max(at.Sub(now), 0), true
+		}
+	}
+
+	var wait time.Duration
+	found := false
+	for _, limit := range []string{"requests", "tokens"} {
+		if h.Get("X-Ratelimit-Remaining-"+limit) != "0" {
+			continue
+		}
+		if d, err := time.ParseDuration(h.Get("X-Ratelimit-Reset-" + limit)); err == nil {
+			wait, found = max(wait, d), true
+		}
+	}
+	for _, limit := range []string{"requests", "tokens", "input-tokens", "output-tokens"} {
+		if h.Get("Anthropic-Ratelimit-"+limit+"-Remaining") != "0" {
+			continue
+		}
+		if at, err := time.Parse(time.RFC3339, h.Get("Anthropic-Ratelimit-"+limit+"-Reset")); err == nil {
+			wait, found = max(wait, at.Sub(now)), true
+		}
+	}
+	if found {
+		return wait, true
+	}
+
+	var gemini struct {
+		Error struct {
+			Details []struct {
+				Type       string `json:"@type"`
+				RetryDelay string `json:"retryDelay"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	if len(body) > 0 && json.Unmarshal(body, &gemini) == nil {
+		for _, d := range gemini.Error.Details {
+			if !strings.HasSuffix(d.Type, "google.rpc.RetryInfo") {
+				continue
+			}
+			if delay, err := time.ParseDuration(d.RetryDelay); err == nil {
+				return delay, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// retriedError is the error of a call that still failed after being retried.
+type retriedError struct {
+	err      error
+	attempts int
+}
+
+func (e *retriedError) Error() string {
+	return fmt.Sprintf("%v (após %d tentativas)", e.err, e.attempts)
+}
+
+func (e *retriedError) Unwrap() error { return e.err }
+
+// withAttempts records in err that the call was made attempts times.
+func withAttempts(err error, attempts int) error {
+	if attempts <= 1 {
+		return err
+	}
+	return &retriedError{err: err, attempts: attempts}
+}
+
+// Attempts returns how many requests were made before a call failed with err,
+// or 0 if it was not retried.
+func Attempts(err error) int {
+	var retried *retriedError
+	if errors.As(err, &retried) {
+		return retried.attempts
+	}
+	return 0
+}
@@ -0,0 +1,154 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryHint(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name    string
+		headers map[string]string
+		body    string
+		want    time.Duration
+		ok      bool
+	}{
+		{"retry-after seconds", map[string]string{"Retry-After": "7"}, "", 7 * time.Second, true},
+		{"retry-after date", map[string]string{"Retry-After": now.Add(90 * time.Second).Format(http.TimeFormat)}, "", 90 * time.Second, true},
+		{"retry-after-ms", map[string]string{"Retry-After-Ms": "250", "Retry-After": "1"}, "", 250 * time.Millisecond, true},
+		{"openai exhausted limit", map[string]string{
+			"X-Ratelimit-Remaining-Requests": "12", "X-Ratelimit-Reset-Requests": "6m0s",
+			"X-Ratelimit-Remaining-Tokens": "0", "X-Ratelimit-Reset-Tokens": "1.5s",
+		}, "", 1500 * time.Millisecond, true},
+		{"openai limits not exhausted", map[string]string{"X-Ratelimit-Remaining-Tokens": "10", "X-Ratelimit-Reset-Tokens": "3s"}, "", 0, false},
+		{"anthropic reset", map[string]string{
+			"Anthropic-Ratelimit-Input-Tokens-Remaining": "0",
+			"Anthropic-Ratelimit-Input-Tokens-Reset":     now.Add(20 * time.Second).Format(time.RFC3339),
+		}, "", 20 * time.Second, true},
+		{"gemini retry info", nil, `{"error":{"code":429,"details":[{"@type":"type.googleapis.com/google.rpc.RetryInfo","retryDelay":"37s"}]}}`, 37 * time.Second, true},
+		{"no hint", nil, `{"error":{"message":"slow down"}}`, 0, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			h := http.Header{}
+			for k, v := range c.headers {
+				h.Set(k, v)
+			}
+			got, ok := retryHint(h, []byte(c.body), now)
+			if got != c.want || ok != c.ok {
+				t.Errorf("retryHint = %v, %v; want %v, %v", got, ok, c.want, c.ok)
+			}
+		})
+	}
+}
+
+func TestSendRetries(t *testing.T) {
+	saved := defaultRetry
+	defaultRetry = retryPolicy{Attempts: 4, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond, MaxWait: time.Second}
+	defer func() { defaultRetry = saved }()
+
+	// serve answers each request with the next of responses, repeating the
+	// last one, and records the bodies it received.
+	serve := func(responses ...func(w http.ResponseWriter)) (*httptest.Server, *[]string) {
+		var bodies []string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			bodies = append(bodies, string(body))
+			responses[min(len(bodies), len(responses))-1](w)
+		}))
+		return srv, &bodies
+	}
+	status := func(code int, headers ...string) func(w http.ResponseWriter) {
+		return func(w http.ResponseWriter) {
+			for i := 0; i+1 < len(headers); i += 2 {
+				w.Header().Set(headers[i], headers[i+1])
+			}
+			w.WriteHeader(code)
+			w.Write([]byte(`{"error":{"message":"tente mais tarde","code":"rate_limit_exceeded"}}`))
+		}
+	}
+	ok := func(w http.ResponseWriter) {
+		w.Write([]byte(`{"choices":[{"message":{"content":"olá"},"finish_reason":"stop"}]}`))
+	}
+	generate := func(srv *httptest.Server, ctx context.Context) (Result, error) {
+		p, _ := Config{OpenAIBaseURL: srv.URL}.NewProvider("openai")
+		return p.Generate(ctx, GenerateRequest{APIKey: "k", Model: "gpt-4o", UserData: "cv"})
+	}
+
+	t.Run("recovers", func(t *testing.T) {
+		srv, bodies := serve(status(503), status(429, "Retry-After", "0"), ok)
+		defer srv.Close()
+		res, err := generate(srv, context.Background())
+		if err != nil || res.Text != "olá" || res.Attempts != 3 {
+			t.Fatalf("generate = %+v, %v", res, err)
+		}
+		for _, b := range *bodies {
+			if !strings.Contains(b, `"gpt-4o"`) {
+				t.Errorf("retried request with body %q", b)
+			}
+		}
+	})
+
+	t.Run("gives up", func(t *testing.T) {
+		srv, bodies := serve(status(429))
+		defer srv.Close()
+		_, err := generate(srv, context.Background())
+		if !errors.Is(err, ErrRateLimited) || Attempts(err) != 4 || len(*bodies) != 4 {
+			t.Fatalf("err = %v after %d requests", err, len(*bodies))
+		}
+		if !strings.Contains(err.Error(), "tente mais tarde (após 4 tentativas)") {
+			t.Errorf("message = %q", err)
+		}
+	})
+
+	t.Run("client errors are not retried", func(t *testing.T) {
+		srv, bodies := serve(status(400))
+		defer srv.Close()
+		if _, err := generate(srv, context.Background()); err == nil || len(*bodies) != 1 {
+			t.Errorf("err = %v after %d requests", err, len(*bodies))
+		}
+	})
+
+	t.Run("insufficient quota", func(t *testing.T) {
+		srv, bodies := serve(func(w http.ResponseWriter) {
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error":{"message":"sem créditos","code":"insufficient_quota"}}`))
+		})
+		defer srv.Close()
+		_, err := generate(srv, context.Background())
+		if !errors.Is(err, ErrRateLimited) || Attempts(err) != 0 || len(*bodies) != 1 {
+			t.Errorf("err = %v after %d requests", err, len(*bodies))
+		}
+	})
+
+	t.Run("wait longer than allowed", func(t *testing.T) {
+		srv, bodies := serve(status(503, "Retry-After", "120"))
+		defer srv.Close()
+		if _, err := generate(srv, context.Background()); !errors.Is(err, ErrProviderUnavailable) || len(*bodies) != 1 {
+			t.Errorf("err = %v after %d requests", err, len(*bodies))
+		}
+	})
+
+	t.Run("wait past the deadline", func(t *testing.T) {
+		defaultRetry.MaxWait = time.Minute
+		defer func() { defaultRetry.MaxWait = time.Second }()
+		srv, bodies := serve(status(503, "Retry-After", "30"))
+		defer srv.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		start := time.Now()
+		if _, err := generate(srv, ctx); !errors.Is(err, ErrProviderUnavailable) || len(*bodies) != 1 {
+			t.Errorf("err = %v after %d requests", err, len(*bodies))
+		}
+		if waited := time.Since(start); waited > time.Second {
+			t.Errorf("waited %v for a retry that could not finish in time", waited)
+		}
+	})
+}
@@ -0,0 +1,52 @@
+package ai
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// maxSSELineSize bounds a single line of a Server-Sent Events stream. Providers
+// send one JSON chunk per line, which is well below this limit.
+const maxSSELineSize = 1024 * 1024
+
+// readSSE reads a Server-Sent Events stream and calls fn for every event with
+// its name (empty when the provider omits the "event:" field) and the
+// concatenated "data:" lines. Reading stops at EOF or when fn returns an error.
+func readSSE(r io.Reader, fn func(event, data string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxSSELineSize)
+
+	var event string
+	var data []string
+	dispatch := func() error {
+		if len(data) == 0 {
+			event = ""
+			return nil
+		}
+		err := fn(event, strings.Join(data, "\n"))
+		event = ""
+		data = data[:0]
+		return err
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if err := dispatch(); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, ":"):
+			// comment / keep-alive
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return dispatch()
+}
@@ -0,0 +1,194 @@
+package ai
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+// Tokenizer counts tokens the way a model does, or as closely as the BPE
+// vocabularies bundled with the server allow. Only OpenAI publishes its
+// vocabularies; other models are counted with the closest one and the count
+// is scaled up so budgets err on the safe side.
+type Tokenizer struct {
+	encoding string
+	scale    float64
+}
+
+// tokenizers maps model ID prefixes to the vocabulary that counts them.
+// Unknown models use cl100k_base with a 10% margin.
+var tokenizers = map[string]Tokenizer{
+	"gpt-5":         {tiktoken.MODEL_O200K_BASE, 1},
+	"gpt-4.5":       {tiktoken.MODEL_O200K_BASE, 1},
+	"gpt-4.1":       {tiktoken.MODEL_O200K_BASE, 1},
+	"gpt-4o":        {tiktoken.MODEL_O200K_BASE, 1},
+	"chatgpt-4o":    {tiktoken.MODEL_O200K_BASE, 1},
+	"o1":            {tiktoken.MODEL_O200K_BASE, 1},
+	"o3":            {tiktoken.MODEL_O200K_BASE, 1},
+	"o4":            {tiktoken.MODEL_O200K_BASE, 1},
+	"gpt-4":         {tiktoken.MODEL_CL100K_BASE, 1},
+	"gpt-3.5-turbo": {tiktoken.MODEL_CL100K_BASE, 1},
+	// Claude's tokenizer splits text into roughly a fifth more tokens than
+	// cl100k_base.
+	"claude": {tiktoken.MODEL_CL100K_BASE, 1.2},
+	"gemini": {tiktoken.MODEL_CL100K_BASE, 1},
+}
+
+var defaultTokenizer = Tokenizer{tiktoken.MODEL_CL100K_BASE, 1.1}
+
+// TokenizerFor returns the tokenizer that counts model's tokens.
+func TokenizerFor(model string) *Tokenizer {
+	t, ok := lookupModel(tokenizers, model)
+	if !ok {
+		t = defaultTokenizer
+	}
+	return &t
+}
+
+var (
+	loaderOnce sync.Once
+	encodings  sync.Map // encoding name -> func() (*tiktoken.Tiktoken, error)
+)
+
+func encoding(name string) (*tiktoken.Tiktoken, error) {
+	loaderOnce.Do(func() {
+		tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+	})
+	load, _ := encodings.LoadOrStore(name, sync.OnceValues(func() (*tiktoken.Tiktoken, error) {
+		return tiktoken.GetEncoding(name)
+	}))
+	return load.(func() (*tiktoken.Tiktoken, error))()
+}
+
+// Count returns how many tokens text takes. A nil Tokenizer, or one whose
+// vocabulary fails to load, estimates 2 tokens every 5 bytes, which is close
+// for the JSON of a CV.
+func (t *Tokenizer) Count(text string) int {
+	if t == nil {
+		return len(text) * 2 / 5
+	}
+	enc, err := encoding(t.encoding)
+	if err != nil {
+		return len(text) * 2 / 5
+	}
+	n := len(enc.EncodeOrdinary(text))
+	if t.scale > 1 {
+		n = int(float64(n)*t.scale + 0.5)
+	}
+	return n
+}
+
+// contextWindows maps model ID prefixes to the number of tokens, prompt and
+// answer together, the model accepts.
+var contextWindows = map[string]int{
+	"gpt-5":         400000,
+	"gpt-4.1":       1047576,
+	"gpt-4o":        128000,
+	"chatgpt-4o":    128000,
+	"gpt-4-turbo":   128000,
+	"gpt-4":         8192,
+	"gpt-3.5-turbo": 16385,
+	"gpt-":          128000,
+	"o1":            200000,
+	"o3":            200000,
+	"o4":            200000,
+
+	"claude": 200000,
+
+	"gemini-1.5-pro": 2097152,
+	"gemini":         1048576,
+
+	"llama3.1": 131072,
+	"llama3.2": 131072,
+	"llama3.3": 131072,
+	"llama3":   8192,
+	"qwen2.5":  32768,
+	"qwen3":    40960,
+	"mistral":  32768,
+	"gemma3":   131072,
+	"gemma2":   8192,
+	"phi4":     16384,
+}
+
+// DefaultContextWindow is assumed for models missing from the table, most
+// likely open models on a self-hosted server.
+const DefaultContextWindow = 32768
+
+// ContextWindow returns how many tokens model accepts when called through p.
+// Providers that know better, such as an Ollama server with a configured
+// context size, take precedence over the table.
+func ContextWindow(p AIProvider, model string) int {
+	if c, ok := p.(interface{ ContextWindow(model string) int }); ok {
+		if n := c.ContextWindow(model); n > 0 {
+			return n
+		}
+	}
+	if n, ok := lookupModel(contextWindows, model); ok {
+		return n
+	}
+	return DefaultContextWindow
+}
+
+// minDataBudget keeps some CV data in prompts to models whose window is
+// too small for the rest of the request.
+const minDataBudget = 1000
+
+// Budget is how much data fits in a prompt, counted with the tokenizer of
+// the model that will read it.
+type Budget struct {
+	Tokens    int
+	Tokenizer *Tokenizer
+}
+
+// NewBudget returns the room left for data in a request to model through p
+// after the prompt texts and an answer of up to maxOutput tokens. A twentieth
+// of the window is kept as a margin for message framing and counting errors.
+func NewBudget(p AIProvider, model string, maxOutput int, prompt ...string) Budget {
+	window := ContextWindow(p, model)
+	tokenizer := TokenizerFor(model)
+
+	used := min(maxOutput, window/4) + window/20
+	for _, text := range prompt {
+		used += tokenizer.Count(text)
+	}
+	return Budget{Tokens: max(window-used, minDataBudget), Tokenizer: tokenizer}
+}
+
+// fraction returns a budget with num/den of b's tokens.
+func (b Budget) fraction(num, den int) Budget {
+	return Budget{Tokens: b.Tokens * num / den, Tokenizer: b.Tokenizer}
+}
+
+// fits reports whether the JSON encoding of data fits in the budget.
+func (b Budget) fits(data any) bool {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return true
+	}
+	// No BPE token is shorter than a byte, so small data needs no counting.
+	scale := 1.0
+	if b.Tokenizer != nil {
+		scale = max(b.Tokenizer.scale, 1)
+	}
+	if float64(len(raw))*scale <= float64(b.Tokens) {
+		return true
+	}
+	return b.Tokenizer.Count(string(raw)) <= b.Tokens
+}
+
+// lookupModel returns the value of the longest key of table that model
+// starts with, ignoring case and Gemini's "models/" prefix.
+func lookupModel[V any](table map[string]V, model string) (V, bool) {
+	model = strings.ToLower(strings.TrimPrefix(model, "models/"))
+	var match string
+	for prefix := range table {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(match) {
+			match = prefix
+		}
+	}
+	v, ok := table[match]
+	return v, ok && match != ""
+}
@@ -0,0 +1,103 @@
+package ai
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTokenizer(t *testing.T) {
+	if got := TokenizerFor("gpt-4o-2024-08-06").Count("hello world"); got != 2 {
+		t.Errorf("gpt-4o counted %d tokens, want 2", got)
+	}
+	if got := TokenizerFor("gpt-4-0613").Count("hello world"); got != 2 {
+		t.Errorf("gpt-4 counted %d tokens, want 2", got)
+	}
+
+	text := strings.Repeat("Análise da produção científica em ecologia. ", 50)
+	base := TokenizerFor("gpt-4").Count(text)
+	if got := TokenizerFor("claude-sonnet-4-20250514").Count(text); got != int(float64(base)*1.2+0.5) {
+		t.Errorf("claude counted %d tokens, want %d scaled by 1.2", got, base)
+	}
+	var nilTokenizer *Tokenizer
+	if got := nilTokenizer.Count("12345"); got != 2 {
+		t.Errorf("nil tokenizer counted %d tokens, want 2", got)
+	}
+}
+
+func TestContextWindow(t *testing.T) {
+	hosted := &OpenAIProvider{}
+	tests := []struct {
+		model string
+		want  int
+	}{
+		{"gpt-4o-mini", 128000},
+		{"gpt-4-0613", 8192},
+		{"gpt-4-turbo-2024-04-09", 128000},
+		{"claude-3-5-haiku-20241022", 200000},
+		{"models/gemini-1.5-pro-002", 2097152},
+		{"gemini-2.5-flash", 1048576},
+		{"llama3.1:8b", 131072},
+		{"modelo-desconhecido", DefaultContextWindow},
+	}
+	for _, tt := range tests {
+		if got := ContextWindow(hosted, tt.model); got != tt.want {
+			t.Errorf("ContextWindow(%q) = %d, want %d", tt.model, got, tt.want)
+		}
+	}
+
+	if got := ContextWindow(&OllamaProvider{}, "llama3.1:8b"); got != ollamaDefaultContext {
+		t.Errorf("Ollama without num_ctx = %d, want %d", got, ollamaDefaultContext)
+	}
+	if got := ContextWindow(&OllamaProvider{contextSize: 32768}, "llama3.1:8b"); got != 32768 {
+		t.Errorf("Ollama with num_ctx = %d, want 32768", got)
+	}
+}
+
+func TestNewBudget(t *testing.T) {
+	b := NewBudget(&OpenAIProvider{}, "gpt-4", 4096, "hello world")
+	// 8192 - min(4096, 2048) - 8192/20 - 2
+	if b.Tokens != 5733 {
+		t.Errorf("budget = %d, want 5733", b.Tokens)
+	}
+	if b := NewBudget(&OllamaProvider{}, "llama3", 4096, strings.Repeat("prompt ", 5000)); b.Tokens != minDataBudget {
+		t.Errorf("budget of a crowded window = %d, want %d", b.Tokens, minDataBudget)
+	}
+}
+
+func TestTruncateChatDataBudget(t *testing.T) {
+	var cvs []map[string]interface{}
+	for i := 0; i < 40; i++ {
+		cvs = append(cvs, map[string]interface{}{
+			"curriculo-vitae": map[string]interface{}{
+				"dados-gerais": map[string]interface{}{
+					"nome-completo":                   fmt.Sprintf("Pesquisador %d", i),
+					"resumo-cv":                       strings.Repeat("Pesquisa em biodiversidade e conservação. ", 20),
+					"nome-em-citacoes-bibliograficas": fmt.Sprintf("P%d", i),
+				},
+			},
+		})
+	}
+	tokenizer := TokenizerFor("gpt-4o")
+
+	data, report := TruncateChatData(cvs, Budget{Tokens: 1000000, Tokenizer: tokenizer})
+	if report.Truncated {
+		t.Error("data truncated with room to spare")
+	}
+
+	data, report = TruncateChatData(cvs, Budget{Tokens: 2000, Tokenizer: tokenizer})
+	var kept []interface{}
+	if err := json.Unmarshal([]byte(data), &kept); err != nil {
+		t.Fatal(err)
+	}
+	if !report.Truncated || len(kept) == 0 || len(kept) == len(cvs) {
+		t.Fatalf("kept %d of %d CVs (report %+v)", len(kept), len(cvs), report)
+	}
+	if len(report.DroppedResearchers) != len(cvs)-len(kept) || report.DroppedResearchers[0] != fmt.Sprintf("Pesquisador %d", len(kept)) {
+		t.Errorf("dropped researchers = %v", report.DroppedResearchers)
+	}
+	if got := tokenizer.Count(`{"curriculos":` + data + `}`); got > 2000 {
+		t.Errorf("truncated data has %d tokens, budget is 2000", got)
+	}
+}
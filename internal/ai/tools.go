@@ -0,0 +1,245 @@
+package ai
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Tool is a function the model may call during a chat instead of answering
+// right away. Its result goes back to the model in a message with role
+// "tool", and the model continues from there.
+type Tool struct {
+	Name        string
+	Description string
+	// Parameters is the JSON Schema of the arguments object. Gemini accepts
+	// only a subset of it: types, descriptions, enums and required.
+	Parameters map[string]any
+}
+
+// ToolCall is a call the model asked for. Arguments is a JSON object.
+type ToolCall struct {
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// SupportsTools reports whether p honors ChatRequest.Tools in Chat. Streaming
+// never offers tools.
+func SupportsTools(p AIProvider) bool {
+	t, ok := p.(interface{ SupportsTools() bool })
+	return ok && t.SupportsTools()
+}
+
+// SupportsTools is false for OpenAI-compatible servers, since many of them
+// (or the models they serve) ignore or reject tool definitions.
+func (p *OpenAIProvider) SupportsTools() bool {
+	return !p.compatible
+}
+
+func (p *AnthropicProvider) SupportsTools() bool {
+	return true
+}
+
+func (p *GeminiProvider) SupportsTools() bool {
+	return true
+}
+
+// arguments returns the arguments of c, an empty object when the model sent
+// none or malformed JSON, which would not encode in the next request.
+func (c ToolCall) arguments() json.RawMessage {
+	if !json.Valid(c.Arguments) {
+		return json.RawMessage("{}")
+	}
+	return c.Arguments
+}
+
+func openAIMessages(req ChatRequest) []map[string]any {
+	messages := []map[string]any{
+		{"role": "system", "content": req.system()},
+	}
+	for _, m := range req.Messages {
+		switch {
+		case m.Role == "tool":
+			messages = append(messages, map[string]any{"role": "tool", "tool_call_id": m.ToolCallID, "content": m.Content})
+		case len(m.ToolCalls) > 0:
+			calls := make([]map[string]any, 0, len(m.ToolCalls))
+			for _, c := range m.ToolCalls {
+				calls = append(calls, map[string]any{
+					"id":       c.ID,
+					"type":     "function",
+					"function": map[string]any{"name": c.Name, "arguments": string(c.arguments())},
+				})
+			}
+			msg := map[string]any{"role": m.Role, "tool_calls": calls}
+			if m.Content != "" {
+				msg["content"] = m.Content
+			}
+			messages = append(messages, msg)
+		default:
+			messages = append(messages, map[string]any{"role": m.Role, "content": m.Content})
+		}
+	}
+	return messages
+}
+
+func openAITools(tools []Tool) []map[string]any {
+	out := make([]map[string]any, 0, len(tools))
+	for _, t := range tools {
+		out = append(out, map[string]any{
+			"type": "function",
+			"function": map[string]any{
+				"name":        t.Name,
+				"description": t.Description,
+				"parameters":  t.Parameters,
+			},
+		})
+	}
+	return out
+}
+
+type openAIToolCall struct {
+	ID       string `json:"id"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+func fromOpenAIToolCalls(calls []openAIToolCall) []ToolCall {
+	var out []ToolCall
+	for _, c := range calls {
+		out = append(out, ToolCall{ID: c.ID, Name: c.Function.Name, Arguments: json.RawMessage(c.Function.Arguments)})
+	}
+	return out
+}
+
+// anthropicMessages converts the chat history, grouping the results of the
+// tools called in one turn into a single user message, as Anthropic expects.
+func anthropicMessages(msgs []ChatMessage) []map[string]any {
+	messages := make([]map[string]any, 0, len(msgs))
+	for _, m := range msgs {
+		switch {
+		case m.Role == "tool":
+			result := map[string]any{"type": "tool_result", "tool_use_id": m.ToolCallID, "content": m.Content}
+			if n := len(messages); n > 0 && messages[n-1]["role"] == "user" {
+				if blocks, ok := messages[n-1]["content"].([]map[string]any); ok {
+					messages[n-1]["content"] = append(blocks, result)
+					continue
+				}
+			}
+			messages = append(messages, map[string]any{"role": "user", "content": []map[string]any{result}})
+		case len(m.ToolCalls) > 0:
+			var blocks []map[string]any
+			if m.Content != "" {
+				blocks = append(blocks, map[string]any{"type": "text", "text": m.Content})
+			}
+			for _, c := range m.ToolCalls {
+				blocks = append(blocks, map[string]any{"type": "tool_use", "id": c.ID, "name": c.Name, "input": c.arguments()})
+			}
+			messages = append(messages, map[string]any{"role": m.Role, "content": blocks})
+		default:
+			messages = append(messages, map[string]any{"role": m.Role, "content": m.Content})
+		}
+	}
+	return messages
+}
+
+func anthropicTools(tools []Tool) []map[string]any {
+	out := make([]map[string]any, 0, len(tools))
+	for _, t := range tools {
+		out = append(out, map[string]any{
+			"name":         t.Name,
+			"description":  t.Description,
+			"input_schema": t.Parameters,
+		})
+	}
+	return out
+}
+
+// geminiContents converts the chat history. Gemini identifies function
+// responses by name, so the name of each result is looked up from the call
+// it answers.
+func geminiContents(msgs []ChatMessage) []map[string]any {
+	names := map[string]string{}
+	contents := make([]map[string]any, 0, len(msgs))
+	for _, m := range msgs {
+		switch {
+		case m.Role == "tool":
+			var response any = map[string]any{"content": m.Content}
+			var decoded map[string]any
+			if json.Unmarshal([]byte(m.Content), &decoded) == nil {
+				response = decoded
+			}
+			part := map[string]any{"functionResponse": map[string]any{"name": names[m.ToolCallID], "response": response}}
+			if n := len(contents); n > 0 && contents[n-1]["role"] == "user" {
+				if parts, ok := contents[n-1]["parts"].([]map[string]any); ok && len(parts) > 0 && parts[0]["functionResponse"] != nil {
+					contents[n-1]["parts"] = append(parts, part)
+					continue
+				}
+			}
+			contents = append(contents, map[string]any{"role": "user", "parts": []map[string]any{part}})
+		case len(m.ToolCalls) > 0:
+			var parts []map[string]any
+			if m.Content != "" {
+				parts = append(parts, map[string]any{"text": m.Content})
+			}
+			for _, c := range m.ToolCalls {
+				names[c.ID] = c.Name
+				parts = append(parts, map[string]any{"functionCall": map[string]any{"name": c.Name, "args": c.arguments()}})
+			}
+			contents = append(contents, map[string]any{"role": "model", "parts": parts})
+		default:
+			role := m.Role
+			if role == "assistant" {
+				role = "model"
+			}
+			contents = append(contents, map[string]any{
+				"role":  role,
+				"parts": []map[string]any{{"text": m.Content}},
+			})
+		}
+	}
+	return contents
+}
+
+func geminiTools(tools []Tool) []map[string]any {
+	declarations := make([]map[string]any, 0, len(tools))
+	for _, t := range tools {
+		declarations = append(declarations, map[string]any{
+			"name":        t.Name,
+			"description": t.Description,
+			"parameters":  t.Parameters,
+		})
+	}
+	return []map[string]any{{"functionDeclarations": declarations}}
+}
+
+type geminiPart struct {
+	Text         string `json:"text"`
+	FunctionCall *struct {
+		ID   string          `json:"id"`
+		Name string          `json:"name"`
+		Args json.RawMessage `json:"args"`
+	} `json:"functionCall"`
+}
+
+// fromGeminiParts splits the parts of a candidate into its text and the
+// functions it calls. Gemini may leave calls without an ID, so those get one
+// unique within the conversation, based on its length.
+func fromGeminiParts(parts []geminiPart, turn int) (string, []ToolCall) {
+	var text strings.Builder
+	var calls []ToolCall
+	for _, p := range parts {
+		if p.FunctionCall == nil {
+			text.WriteString(p.Text)
+			continue
+		}
+		id := p.FunctionCall.ID
+		if id == "" {
+			id = fmt.Sprintf("call-%d-%d", turn, len(calls))
+		}
+		calls = append(calls, ToolCall{ID: id, Name: p.FunctionCall.Name, Arguments: p.FunctionCall.Args})
+	}
+	return text.String(), calls
+}
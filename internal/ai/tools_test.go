@@ -0,0 +1,140 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// toolHistory is a conversation in which the assistant called two tools in
+// one turn and got their results.
+var toolHistory = []ChatMessage{
+	{Role: "user", Content: "Quem trabalha com etnobotânica?"},
+	{Role: "assistant", ToolCalls: []ToolCall{
+		{ID: "c1", Name: "buscar_pesquisadores", Arguments: json.RawMessage(`{"consulta":"etnobotanica"}`)},
+		{ID: "c2", Name: "contar_producao"},
+	}},
+	{Role: "tool", ToolCallID: "c1", Content: `{"total":1}`},
+	{Role: "tool", ToolCallID: "c2", Content: `{"total":7}`},
+}
+
+var testTools = []Tool{{Name: "buscar_pesquisadores", Description: "Busca", Parameters: map[string]any{"type": "object"}}}
+
+func TestToolCalling(t *testing.T) {
+	tests := []struct {
+		provider string
+		config   func(url string) Config
+		reply    string
+		// check inspects the request body sent with toolHistory.
+		check func(t *testing.T, body map[string]any)
+	}{
+		{
+			provider: "openai",
+			config:   func(url string) Config { return Config{OpenAIBaseURL: url} },
+			reply: `{"choices":[{"message":{"content":null,"tool_calls":[{"id":"x1","type":"function",
+				"function":{"name":"buscar_pesquisadores","arguments":"{\"consulta\":\"ecologia\"}"}}]},"finish_reason":"tool_calls"}]}`,
+			check: func(t *testing.T, body map[string]any) {
+				msgs := body["messages"].([]any)
+				if len(msgs) != 5 {
+					t.Fatalf("messages = %v", msgs)
+				}
+				call := msgs[2].(map[string]any)["tool_calls"].([]any)[1].(map[string]any)["function"].(map[string]any)
+				if call["arguments"] != "{}" {
+					t.Errorf("empty arguments sent as %v", call["arguments"])
+				}
+				if result := msgs[4].(map[string]any); result["role"] != "tool" || result["tool_call_id"] != "c2" {
+					t.Errorf("tool result = %v", result)
+				}
+				if tool := body["tools"].([]any)[0].(map[string]any); tool["type"] != "function" {
+					t.Errorf("tools = %v", body["tools"])
+				}
+			},
+		},
+		{
+			provider: "anthropic",
+			config:   func(url string) Config { return Config{AnthropicBaseURL: url} },
+			reply: `{"content":[{"type":"text","text":"Vou buscar."},{"type":"tool_use","id":"x1","name":"buscar_pesquisadores",
+				"input":{"consulta":"ecologia"}}],"stop_reason":"tool_use","usage":{"input_tokens":10,"output_tokens":5}}`,
+			check: func(t *testing.T, body map[string]any) {
+				msgs := body["messages"].([]any)
+				if len(msgs) != 3 {
+					t.Fatalf("messages = %v", msgs)
+				}
+				if blocks := msgs[2].(map[string]any)["content"].([]any); len(blocks) != 2 || blocks[1].(map[string]any)["tool_use_id"] != "c2" {
+					t.Errorf("tool results = %v", blocks)
+				}
+				if tool := body["tools"].([]any)[0].(map[string]any); tool["input_schema"] == nil {
+					t.Errorf("tools = %v", body["tools"])
+				}
+			},
+		},
+		{
+			provider: "gemini",
+			config:   func(url string) Config { return Config{GeminiBaseURL: url} },
+			reply: `{"candidates":[{"content":{"parts":[{"functionCall":{"name":"buscar_pesquisadores","args":{"consulta":"ecologia"}}}]},
+				"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":5}}`,
+			check: func(t *testing.T, body map[string]any) {
+				contents := body["contents"].([]any)
+				if len(contents) != 3 {
+					t.Fatalf("contents = %v", contents)
+				}
+				parts := contents[2].(map[string]any)["parts"].([]any)
+				response := parts[1].(map[string]any)["functionResponse"].(map[string]any)
+				if len(parts) != 2 || response["name"] != "contar_producao" || response["response"].(map[string]any)["total"] != float64(7) {
+					t.Errorf("function responses = %v", parts)
+				}
+				if decl := body["tools"].([]any)[0].(map[string]any)["functionDeclarations"]; decl == nil {
+					t.Errorf("tools = %v", body["tools"])
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.provider, func(t *testing.T) {
+			var body map[string]any
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				json.NewDecoder(r.Body).Decode(&body)
+				w.Write([]byte(tt.reply))
+			}))
+			defer srv.Close()
+
+			p, _ := tt.config(srv.URL).NewProvider(tt.provider)
+			if !SupportsTools(p) {
+				t.Fatal("SupportsTools = false")
+			}
+			req := ChatRequest{APIKey: "k", Model: "m", SystemPrompt: "s", Messages: toolHistory[:1], Tools: testTools}
+			res, err := p.Chat(context.Background(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(res.ToolCalls) != 1 || res.ToolCalls[0].ID == "" || res.ToolCalls[0].Name != "buscar_pesquisadores" {
+				t.Fatalf("tool calls = %+v", res.ToolCalls)
+			}
+			var args map[string]string
+			if err := json.Unmarshal(res.ToolCalls[0].Arguments, &args); err != nil || args["consulta"] != "ecologia" {
+				t.Errorf("arguments = %s", res.ToolCalls[0].Arguments)
+			}
+
+			req.Messages = toolHistory
+			if _, err := p.Chat(context.Background(), req); err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, body)
+		})
+	}
+}
+
+func TestSelfHostedWithoutTools(t *testing.T) {
+	config := Config{CompatibleBaseURL: "http://localhost:1/v1", OllamaBaseURL: "http://localhost:1"}
+	for _, name := range []string{"openai-compatible", "ollama"} {
+		p, err := config.NewProvider(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if SupportsTools(p) {
+			t.Errorf("SupportsTools(%s) = true", name)
+		}
+	}
+}
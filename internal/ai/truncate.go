@@ -1,32 +1,82 @@
 package ai
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"slices"
+	"sort"
+	"strconv"
+
+	"github.com/edalcin/smartlattes/internal/parser"
+)
+
+// TruncationReport tells what the truncation engine left out of the data
+// sent to a model. Steps and fields are described in Portuguese, ready to be
+// shown to the user.
+type TruncationReport struct {
+	Truncated bool `json:"truncated"`
+	// Steps are the reductions applied, in order.
+	Steps []string `json:"steps,omitempty"`
+	// RemovedFields are the Lattes sections removed from one or more CVs.
+	RemovedFields []string `json:"removedFields,omitempty"`
+	// PublicationsTrimmed counts the publications cut from the researchers
+	// still present in the data.
+	PublicationsTrimmed int `json:"publicationsTrimmed,omitempty"`
+	// DroppedResearchers are the researchers left out entirely.
+	DroppedResearchers []string `json:"droppedResearchers,omitempty"`
+}
+
+// step records that a reduction ran and the fields it removed.
+func (r *TruncationReport) step(description string, fields ...string) {
+	r.Truncated = true
+	if len(r.Steps) == 0 || r.Steps[len(r.Steps)-1] != description {
+		r.Steps = append(r.Steps, description)
+	}
+	for _, f := range fields {
+		if !slices.Contains(r.RemovedFields, f) {
+			r.RemovedFields = append(r.RemovedFields, f)
+		}
+	}
+}
+
+func TruncateCV(cvData map[string]interface{}, budget Budget) (map[string]interface{}, bool) {
+	var report TruncationReport
+	copied := truncateCV(cvData, budget, &report)
+	return copied, report.Truncated
+}
 
-func TruncateCV(cvData map[string]interface{}, maxTokens int) (map[string]interface{}, bool) {
+func truncateCV(cvData map[string]interface{}, budget Budget, report *TruncationReport) map[string]interface{} {
 	copied := deepCopy(cvData)
 	if copied == nil {
-		return cvData, false
+		return cvData
 	}
 
-	if estimateTokens(copied) <= maxTokens {
-		return copied, false
+	if budget.fits(copied) {
+		return copied
 	}
 
 	cv, ok := getInnerMap(copied, "curriculo-vitae")
 	if !ok {
-		return copied, true
+		return copied
 	}
 
 	removals := []string{"dados-complementares", "outra-producao", "producao-tecnica"}
 	for _, key := range removals {
-		delete(cv, key)
-		if estimateTokens(copied) <= maxTokens {
-			return copied, true
+		if _, ok := cv[key]; ok {
+			delete(cv, key)
+			report.step("seções de menor relevância removidas do currículo do pesquisador", key)
+		}
+		if budget.fits(copied) {
+			return copied
 		}
 	}
 
-	truncateProdBibliografica(copied, cv, maxTokens)
-	return copied, true
+	before := countPublications(copied)
+	truncateProdBibliografica(copied, cv, budget)
+	if trimmed := before - countPublications(copied); trimmed > 0 {
+		report.step("publicações do pesquisador encurtadas")
+		report.PublicationsTrimmed += trimmed
+	}
+	return copied
 }
 
 func deepCopy(src map[string]interface{}) map[string]interface{} {
@@ -41,14 +91,6 @@ func deepCopy(src map[string]interface{}) map[string]interface{} {
 	return dst
 }
 
-func estimateTokens(data map[string]interface{}) int {
-	b, err := json.Marshal(data)
-	if err != nil {
-		return 0
-	}
-	return len(b) * 2 / 5
-}
-
 func getInnerMap(data map[string]interface{}, key string) (map[string]interface{}, bool) {
 	val, exists := data[key]
 	if !exists {
@@ -58,7 +100,7 @@ func getInnerMap(data map[string]interface{}, key string) (map[string]interface{
 	return m, ok
 }
 
-func truncateProdBibliografica(root, cv map[string]interface{}, maxTokens int) {
+func truncateProdBibliografica(root, cv map[string]interface{}, budget Budget) {
 	pb, ok := getInnerMap(cv, "producao-bibliografica")
 	if !ok {
 		return
@@ -70,7 +112,7 @@ func truncateProdBibliografica(root, cv map[string]interface{}, maxTokens int) {
 	}
 
 	maxLen := maxArrayLen(arrays)
-	for n := maxLen / 2; n >= 0 && estimateTokens(root) > maxTokens; n /= 2 {
+	for n := maxLen / 2; n >= 0 && !budget.fits(root); n /= 2 {
 		for _, entry := range arrays {
 			arr := entry.slice
 			if len(arr) > n {
@@ -116,14 +158,6 @@ func maxArrayLen(refs []arrayRef) int {
 	return m
 }
 
-func estimateTokensAny(data interface{}) int {
-	b, err := json.Marshal(data)
-	if err != nil {
-		return 0
-	}
-	return len(b) * 2 / 5
-}
-
 func deepCopyAny(src interface{}) interface{} {
 	b, err := json.Marshal(src)
 	if err != nil {
@@ -136,31 +170,40 @@ func deepCopyAny(src interface{}) interface{} {
 	return dst
 }
 
-func removeFieldFromCV(cv map[string]interface{}, field string) {
+// removeFieldFromCV removes field from the CV and from its dados-gerais and
+// reports whether it was present.
+func removeFieldFromCV(cv map[string]interface{}, field string) bool {
 	inner, ok := cv["curriculo-vitae"]
 	if !ok {
-		return
+		return false
 	}
 	cvMap, ok := inner.(map[string]interface{})
 	if !ok {
-		return
+		return false
 	}
+	_, removed := cvMap[field]
 	delete(cvMap, field)
 
 	dg, ok := cvMap["dados-gerais"]
 	if !ok {
-		return
+		return removed
 	}
 	dgMap, ok := dg.(map[string]interface{})
 	if !ok {
-		return
+		return removed
 	}
-	delete(dgMap, field)
+	if _, ok := dgMap[field]; ok {
+		delete(dgMap, field)
+		removed = true
+	}
+	return removed
 }
 
-func TruncateAnalysisData(currentCV map[string]interface{}, otherCVs []map[string]interface{}, maxTokens int) (string, bool) {
+func TruncateAnalysisData(currentCV map[string]interface{}, otherCVs []map[string]interface{}, budget Budget) (string, TruncationReport) {
+	var report TruncationReport
+
 	// Allocate 1/3 of budget for main CV, leaving 2/3 for others (others are the point of analysis)
-	currentCopy, mainTruncated := TruncateCV(currentCV, maxTokens/3)
+	currentCopy := truncateCV(currentCV, budget.fraction(1, 3), &report)
 
 	othersCopy := make([]interface{}, len(otherCVs))
 	for i, cv := range otherCVs {
@@ -178,170 +221,249 @@ func TruncateAnalysisData(currentCV map[string]interface{}, otherCVs []map[strin
 		"outros_pesquisadores": othersCopy,
 	}
 
-	if estimateTokensAny(combined) <= maxTokens {
+	mainPublications := countPublications(currentCopy)
+	otherPublications := make([]int, len(othersCopy))
+	for i, cv := range othersCopy {
+		otherPublications[i] = countPublications(cv)
+	}
+	// done encodes the data with the first kept researchers and completes the
+	// report with what was cut from them and who was left out.
+	done := func(kept int) (string, TruncationReport) {
+		combined["outros_pesquisadores"] = othersCopy[:kept]
+		report.PublicationsTrimmed += mainPublications - countPublications(combined["pesquisador_alvo"])
+		for i, cv := range othersCopy[:kept] {
+			report.PublicationsTrimmed += otherPublications[i] - countPublications(cv)
+		}
+		for _, cv := range othersCopy[kept:] {
+			report.DroppedResearchers = append(report.DroppedResearchers, researcherName(cv))
+		}
 		b, _ := json.Marshal(combined)
-		return string(b), mainTruncated
+		return string(b), report
+	}
+
+	if budget.fits(combined) {
+		return done(len(othersCopy))
 	}
 
 	// Step 1: remove low-value fields from others (NOT producao-bibliografica)
 	lowValueFields := []string{"dados-complementares", "outra-producao", "producao-tecnica"}
 	for _, field := range lowValueFields {
-		removeFieldFromAll(othersCopy, field)
+		if removeFieldFromAll(othersCopy, field) > 0 {
+			report.step("seções de menor relevância removidas dos demais pesquisadores", field)
+		}
 	}
-	combined["outros_pesquisadores"] = othersCopy
 
-	if estimateTokensAny(combined) <= maxTokens {
-		b, _ := json.Marshal(combined)
-		return string(b), true
+	if budget.fits(combined) {
+		return done(len(othersCopy))
 	}
 
 	// Step 2: remove atuacoes-profissionais from others
-	removeFieldFromAll(othersCopy, "atuacoes-profissionais")
-	combined["outros_pesquisadores"] = othersCopy
+	if removeFieldFromAll(othersCopy, "atuacoes-profissionais") > 0 {
+		report.step("atuações profissionais removidas dos demais pesquisadores", "atuacoes-profissionais")
+	}
 
-	if estimateTokensAny(combined) <= maxTokens {
-		b, _ := json.Marshal(combined)
-		return string(b), true
+	if budget.fits(combined) {
+		return done(len(othersCopy))
 	}
 
 	// Step 3: remove formacao-academica-titulacao from others
-	removeFieldFromAll(othersCopy, "formacao-academica-titulacao")
-	combined["outros_pesquisadores"] = othersCopy
+	if removeFieldFromAll(othersCopy, "formacao-academica-titulacao") > 0 {
+		report.step("formação acadêmica removida dos demais pesquisadores", "formacao-academica-titulacao")
+	}
 
-	if estimateTokensAny(combined) <= maxTokens {
-		b, _ := json.Marshal(combined)
-		return string(b), true
+	if budget.fits(combined) {
+		return done(len(othersCopy))
 	}
 
 	// Step 4: trim producao-bibliografica arrays in others (keep fewer items)
 	for fraction := 2; fraction <= 8; fraction *= 2 {
+		trimmed := false
 		for _, cv := range othersCopy {
 			cvMap, ok := cv.(map[string]interface{})
 			if !ok {
 				continue
 			}
-			trimProdBibliograficaInCV(cvMap, fraction)
+			if trimProdBibliograficaInCV(cvMap, fraction) {
+				trimmed = true
+			}
+		}
+		if trimmed {
+			report.step("listas de publicações dos demais pesquisadores encurtadas")
 		}
-		combined["outros_pesquisadores"] = othersCopy
-		if estimateTokensAny(combined) <= maxTokens {
-			b, _ := json.Marshal(combined)
-			return string(b), true
+		if budget.fits(combined) {
+			return done(len(othersCopy))
 		}
 	}
 
 	// Step 5: remove producao-bibliografica from others entirely
-	removeFieldFromAll(othersCopy, "producao-bibliografica")
-	combined["outros_pesquisadores"] = othersCopy
+	if removeFieldFromAll(othersCopy, "producao-bibliografica") > 0 {
+		report.step("publicações removidas dos demais pesquisadores", "producao-bibliografica")
+	}
 
-	if estimateTokensAny(combined) <= maxTokens {
-		b, _ := json.Marshal(combined)
-		return string(b), true
+	if budget.fits(combined) {
+		return done(len(othersCopy))
 	}
 
 	// Step 6: truncate main CV before dropping researchers
-	truncateMainCVProdBib(combined, maxTokens)
-	if estimateTokensAny(combined) <= maxTokens {
-		b, _ := json.Marshal(combined)
-		return string(b), true
+	if truncateMainCVProdBib(combined, budget) {
+		report.step("publicações do pesquisador encurtadas")
+	}
+	if budget.fits(combined) {
+		return done(len(othersCopy))
 	}
 
 	// Step 7: remove low-value fields from main CV too
 	for _, field := range []string{"dados-complementares", "outra-producao", "producao-tecnica", "atuacoes-profissionais"} {
-		if mainMap, ok := combined["pesquisador_alvo"].(map[string]interface{}); ok {
-			removeFieldFromCV(mainMap, field)
+		if mainMap, ok := combined["pesquisador_alvo"].(map[string]interface{}); ok && removeFieldFromCV(mainMap, field) {
+			report.step("seções de menor relevância removidas do currículo do pesquisador", field)
 		}
 	}
-	if estimateTokensAny(combined) <= maxTokens {
-		b, _ := json.Marshal(combined)
-		return string(b), true
+	if budget.fits(combined) {
+		return done(len(othersCopy))
 	}
 
-	// Step 8: remove others one by one, but ALWAYS keep at least 1
-	for n := len(othersCopy); n >= 1; n-- {
-		combined["outros_pesquisadores"] = othersCopy[:n]
-		if estimateTokensAny(combined) <= maxTokens {
-			b, _ := json.Marshal(combined)
-			return string(b), true
+	// Step 8: remove others from the end, but ALWAYS keep at least 1. The
+	// size grows with the number kept, so search for the most that fit.
+	if len(othersCopy) > 1 {
+		tooMany := sort.Search(len(othersCopy), func(i int) bool {
+			combined["outros_pesquisadores"] = othersCopy[:i+1]
+			return !budget.fits(combined)
+		})
+		if tooMany > 0 {
+			report.step("pesquisadores excluídos da comparação")
+			return done(tooMany)
 		}
 	}
 
 	// Step 9: still too large with 1 researcher — strip areas-de-atuacao from remaining other
-	combined["outros_pesquisadores"] = othersCopy[:1]
-	removeFieldFromAll(othersCopy[:1], "areas-de-atuacao")
-
-	b, _ := json.Marshal(combined)
-	return string(b), true
+	if len(othersCopy) > 1 {
+		report.step("pesquisadores excluídos da comparação")
+	}
+	kept := min(1, len(othersCopy))
+	if removeFieldFromAll(othersCopy[:kept], "areas-de-atuacao") > 0 {
+		report.step("áreas de atuação removidas do pesquisador restante", "areas-de-atuacao")
+	}
+	return done(kept)
 }
 
-// removeFieldFromAll removes a field from all CVs in the slice.
-func removeFieldFromAll(cvs []interface{}, field string) {
+// removeFieldFromAll removes a field from all CVs in the slice and returns
+// how many of them had it.
+func removeFieldFromAll(cvs []interface{}, field string) int {
+	removed := 0
 	for _, cv := range cvs {
 		cvMap, ok := cv.(map[string]interface{})
 		if !ok {
 			continue
 		}
-		removeFieldFromCV(cvMap, field)
+		if removeFieldFromCV(cvMap, field) {
+			removed++
+		}
 	}
+	return removed
 }
 
-// trimProdBibliograficaInCV reduces producao-bibliografica arrays by the given fraction.
-func trimProdBibliograficaInCV(cvMap map[string]interface{}, fraction int) {
+// trimProdBibliograficaInCV reduces producao-bibliografica arrays, or the
+// compact publication list, by the given fraction and reports whether any
+// publication was cut.
+func trimProdBibliograficaInCV(cvMap map[string]interface{}, fraction int) bool {
 	inner, ok := cvMap["curriculo-vitae"]
 	if !ok {
-		return
+		return false
 	}
 	cv, ok := inner.(map[string]interface{})
 	if !ok {
-		return
+		return false
 	}
-	pb, ok := getInnerMap(cv, "producao-bibliografica")
-	if !ok {
-		return
+	keep := func(n int) int {
+		return max(n/fraction, 1)
 	}
-	for _, v := range pb {
-		section, ok := v.(map[string]interface{})
-		if !ok {
-			continue
+	trimmed := false
+	switch pb := cv["producao-bibliografica"].(type) {
+	case []map[string]string:
+		if k := keep(len(pb)); k < len(pb) {
+			cv["producao-bibliografica"] = pb[:k]
+			trimmed = true
 		}
-		for k, iv := range section {
-			arr, ok := iv.([]interface{})
-			if !ok || len(arr) == 0 {
+	case map[string]interface{}:
+		for _, v := range pb {
+			section, ok := v.(map[string]interface{})
+			if !ok {
 				continue
 			}
-			keep := len(arr) / fraction
-			if keep < 1 {
-				keep = 1
+			for k, iv := range section {
+				arr, ok := iv.([]interface{})
+				if !ok || len(arr) == 0 {
+					continue
+				}
+				if n := keep(len(arr)); n < len(arr) {
+					section[k] = arr[:n]
+					trimmed = true
+				}
 			}
-			section[k] = arr[:keep]
 		}
 	}
+	return trimmed
+}
+
+// countPublications counts the publications of a CV, in the compact list or
+// in the producao-bibliografica sections.
+func countPublications(data interface{}) int {
+	cvMap, ok := data.(map[string]interface{})
+	if !ok {
+		return 0
+	}
+	cv, ok := getInnerMap(cvMap, "curriculo-vitae")
+	if !ok {
+		return 0
+	}
+	switch pb := cv["producao-bibliografica"].(type) {
+	case []map[string]string:
+		return len(pb)
+	case []interface{}:
+		return len(pb)
+	case map[string]interface{}:
+		n := 0
+		for _, sectionVal := range pb {
+			section, ok := sectionVal.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			for _, pubs := range section {
+				n += len(toSlice(pubs))
+			}
+		}
+		return n
+	}
+	return 0
+}
+
+// researcherName returns the full name in a CV, or its Lattes ID when the
+// name is missing.
+func researcherName(data interface{}) string {
+	cvMap, ok := data.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	if cv, ok := getInnerMap(cvMap, "curriculo-vitae"); ok {
+		if dg, ok := getInnerMap(cv, "dados-gerais"); ok {
+			if name, ok := dg["nome-completo"].(string); ok && name != "" {
+				return name
+			}
+		}
+	}
+	id, _ := cvMap["_id"].(string)
+	return id
 }
 
 // compactPublications replaces the full producao-bibliografica with a lightweight
 // list of publication titles and years only, removing co-authors, DOIs, journal details, etc.
 func compactPublications(cvs []interface{}) {
-	// Known title field names in Lattes XML (lowercased)
-	titleFields := map[string]string{
-		"dados-basicos-do-artigo":                    "titulo-do-artigo",
-		"dados-basicos-do-livro":                     "titulo-do-livro",
-		"dados-basicos-do-capitulo":                  "titulo-do-capitulo-do-livro",
-		"dados-basicos-do-trabalho":                  "titulo-do-trabalho",
-		"dados-basicos-do-texto":                     "titulo-do-texto",
-		"dados-basicos-de-outra-producao":            "titulo",
-		"dados-basicos-da-traducao":                  "titulo",
-		"dados-basicos-de-artigo-aceito-para-publicacao": "titulo-do-artigo-aceito-para-publicacao",
-	}
-
 	for _, cv := range cvs {
 		cvMap, ok := cv.(map[string]interface{})
 		if !ok {
 			continue
 		}
-		inner, ok := cvMap["curriculo-vitae"]
-		if !ok {
-			continue
-		}
-		cvInner, ok := inner.(map[string]interface{})
+		cvInner, ok := getInnerMap(cvMap, "curriculo-vitae")
 		if !ok {
 			continue
 		}
@@ -349,65 +471,112 @@ func compactPublications(cvs []interface{}) {
 		if !ok {
 			continue
 		}
-		pbMap, ok := pb.(map[string]interface{})
-		if !ok {
-			continue
+
+		// Replace heavy producao-bibliografica with compact list. A list
+		// compacted by SelectRelevantCVs keeps its order, so trimming it
+		// keeps the publications related to the question; the others start
+		// with the most recent.
+		pubs := collectPublications(cvMap, cvInner)
+		if _, raw := pb.(map[string]interface{}); raw {
+			sortPublications(pubs)
 		}
+		cvInner["producao-bibliografica"] = pubs
+		delete(cvMap, "publicacoes")
+	}
+}
 
-		// Build a compact list: [{tipo, titulo, ano}, ...]
-		var publications []map[string]string
+// collectPublications builds the compact [{tipo, titulo, ano}, ...] list for a
+// CV from its typed publications. A list that has already been compacted is
+// returned as is, in the same order.
+func collectPublications(cvMap, cvInner map[string]interface{}) []map[string]string {
+	var publications []map[string]string
 
-		for sectionName, sectionVal := range pbMap {
-			sectionMap, ok := sectionVal.(map[string]interface{})
+	switch pb := cvInner["producao-bibliografica"].(type) {
+	case []map[string]string:
+		return pb
+	case []interface{}:
+		for _, item := range pb {
+			itemMap, ok := item.(map[string]interface{})
 			if !ok {
 				continue
 			}
-			for pubType, pubVal := range sectionMap {
-				extractPubs(pubVal, pubType, titleFields, &publications)
+			pub := make(map[string]string, len(itemMap))
+			for k, v := range itemMap {
+				if s, ok := v.(string); ok {
+					pub[k] = s
+				}
+			}
+			publications = append(publications, pub)
+		}
+	default:
+		for _, p := range typedPublications(cvMap, cvInner).All() {
+			if p.Title == "" {
+				continue
+			}
+			pub := map[string]string{"tipo": p.Type, "titulo": p.Title}
+			if p.Year > 0 {
+				pub["ano"] = strconv.Itoa(p.Year)
 			}
-			_ = sectionName
+			publications = append(publications, pub)
 		}
+	}
+	return publications
+}
 
-		// Replace heavy producao-bibliografica with compact list
-		cvInner["producao-bibliografica"] = publications
+// typedPublications returns the publications stored with the CV in its
+// "publicacoes" field or, for CVs uploaded before it existed, extracts them
+// from producao-bibliografica.
+func typedPublications(cvMap, cvInner map[string]interface{}) parser.Publications {
+	switch stored := cvMap["publicacoes"].(type) {
+	case parser.Publications:
+		stored.Backfill(cvInner)
+		return stored
+	case map[string]interface{}:
+		var pubs parser.Publications
+		if b, err := json.Marshal(stored); err == nil && json.Unmarshal(b, &pubs) == nil {
+			pubs.Backfill(cvInner)
+			return pubs
+		}
 	}
+	return parser.ExtractPublications(cvInner)
+}
+
+// sortPublications puts compact publications in a fixed order, most recent
+// first, so the same CV always encodes to the same text.
+func sortPublications(pubs []map[string]string) {
+	sort.SliceStable(pubs, func(i, j int) bool {
+		a, b := pubs[i], pubs[j]
+		if a["ano"] != b["ano"] {
+			return a["ano"] > b["ano"]
+		}
+		if a["titulo"] != b["titulo"] {
+			return a["titulo"] < b["titulo"]
+		}
+		return a["tipo"] < b["tipo"]
+	})
 }
 
-// extractPubs extracts title and year from publication items (single or array).
-func extractPubs(val interface{}, pubType string, titleFields map[string]string, out *[]map[string]string) {
-	items := toSlice(val)
-	for _, item := range items {
-		itemMap, ok := item.(map[string]interface{})
+// canonicalOrder sorts cvs by Lattes ID and their compact publications with
+// sortPublications, once truncation has chosen what to keep. The chat data
+// then depends only on which researchers and publications it holds, not on
+// the order retrieval ranked them, so providers can reuse the cached prompt
+// across turns and users.
+func canonicalOrder(cvs []interface{}) {
+	id := func(cv interface{}) string {
+		m, _ := cv.(map[string]interface{})
+		s, _ := m["_id"].(string)
+		return s
+	}
+	sort.SliceStable(cvs, func(i, j int) bool { return id(cvs[i]) < id(cvs[j]) })
+	for _, cv := range cvs {
+		cvMap, ok := cv.(map[string]interface{})
 		if !ok {
 			continue
 		}
-		pub := map[string]string{"tipo": pubType}
-		// Search for dados-basicos-* fields to find title and year
-		for dbKey, titleKey := range titleFields {
-			db, ok := itemMap[dbKey]
-			if !ok {
-				continue
-			}
-			dbMap, ok := db.(map[string]interface{})
-			if !ok {
-				continue
+		if inner, ok := getInnerMap(cvMap, "curriculo-vitae"); ok {
+			if pubs, ok := inner["producao-bibliografica"].([]map[string]string); ok {
+				sortPublications(pubs)
 			}
-			if t, ok := dbMap[titleKey].(string); ok && t != "" {
-				pub["titulo"] = t
-			}
-			// Year fields vary: ano-do-artigo, ano, ano-do-trabalho, etc.
-			for k, v := range dbMap {
-				if len(k) >= 3 && k[:3] == "ano" {
-					if s, ok := v.(string); ok && s != "" {
-						pub["ano"] = s
-						break
-					}
-				}
-			}
-			break
-		}
-		if pub["titulo"] != "" {
-			*out = append(*out, pub)
 		}
 	}
 }
@@ -426,7 +595,8 @@ func toSlice(val interface{}) []interface{} {
 
 // TruncateChatData compacts and truncates multiple CVs to fit within a token budget for chat.
 // First it compacts publications to title+year only, then progressively removes fields.
-func TruncateChatData(cvs []map[string]interface{}, maxTokens int) (string, bool) {
+func TruncateChatData(cvs []map[string]interface{}, budget Budget) (string, TruncationReport) {
+	var report TruncationReport
 	copies := make([]interface{}, len(cvs))
 	for i, cv := range cvs {
 		copies[i] = deepCopyAny(cv)
@@ -435,39 +605,56 @@ func TruncateChatData(cvs []map[string]interface{}, maxTokens int) (string, bool
 	// Step 0: compact producao-bibliografica to titles+years only (massive size reduction)
 	compactPublications(copies)
 
+	publications := make([]int, len(copies))
+	for i, cv := range copies {
+		publications[i] = countPublications(cv)
+	}
+	// done encodes the first kept CVs and completes the report with what was
+	// cut from them and who was left out.
+	done := func(kept int) (string, TruncationReport) {
+		for i, cv := range copies[:kept] {
+			report.PublicationsTrimmed += publications[i] - countPublications(cv)
+		}
+		for _, cv := range copies[kept:] {
+			report.DroppedResearchers = append(report.DroppedResearchers, researcherName(cv))
+		}
+		canonicalOrder(copies[:kept])
+		b, _ := json.Marshal(copies[:kept])
+		return string(b), report
+	}
+
 	wrapper := map[string]interface{}{"curriculos": copies}
-	if estimateTokensAny(wrapper) <= maxTokens {
-		b, _ := json.Marshal(copies)
-		return string(b), false
+	if budget.fits(wrapper) {
+		return done(len(copies))
 	}
 
 	// Step 1: remove low-value fields
 	for _, field := range []string{"dados-complementares", "outra-producao", "producao-tecnica"} {
-		removeFieldFromAll(copies, field)
+		if removeFieldFromAll(copies, field) > 0 {
+			report.step("seções de menor relevância removidas dos currículos", field)
+		}
 	}
-	wrapper["curriculos"] = copies
-	if estimateTokensAny(wrapper) <= maxTokens {
-		b, _ := json.Marshal(copies)
-		return string(b), true
+	if budget.fits(wrapper) {
+		return done(len(copies))
 	}
 
 	// Step 2: remove atuacoes-profissionais
-	removeFieldFromAll(copies, "atuacoes-profissionais")
-	wrapper["curriculos"] = copies
-	if estimateTokensAny(wrapper) <= maxTokens {
-		b, _ := json.Marshal(copies)
-		return string(b), true
+	if removeFieldFromAll(copies, "atuacoes-profissionais") > 0 {
+		report.step("atuações profissionais removidas dos currículos", "atuacoes-profissionais")
+	}
+	if budget.fits(wrapper) {
+		return done(len(copies))
 	}
 
 	// Step 3: remove formacao-academica-titulacao
-	removeFieldFromAll(copies, "formacao-academica-titulacao")
-	wrapper["curriculos"] = copies
-	if estimateTokensAny(wrapper) <= maxTokens {
-		b, _ := json.Marshal(copies)
-		return string(b), true
+	if removeFieldFromAll(copies, "formacao-academica-titulacao") > 0 {
+		report.step("formação acadêmica removida dos currículos", "formacao-academica-titulacao")
+	}
+	if budget.fits(wrapper) {
+		return done(len(copies))
 	}
 
-	// Step 4: trim publication lists (keep recent ones)
+	// Step 4: trim publication lists (keep the first ones: those related to the question, or the most recent)
 	for _, cv := range copies {
 		cvMap, ok := cv.(map[string]interface{})
 		if !ok {
@@ -485,70 +672,81 @@ func TruncateChatData(cvs []map[string]interface{}, maxTokens int) (string, bool
 		if !ok {
 			continue
 		}
-		pubList, ok := pubs.([]map[string]string)
-		if !ok {
-			continue
-		}
 		// Keep only first 30 publications per researcher
-		if len(pubList) > 30 {
-			cvInner["producao-bibliografica"] = pubList[:30]
+		switch pubList := pubs.(type) {
+		case []map[string]string:
+			if len(pubList) > 30 {
+				cvInner["producao-bibliografica"] = pubList[:30]
+				report.step("listas de publicações limitadas a 30 por pesquisador")
+			}
+		case []interface{}:
+			if len(pubList) > 30 {
+				cvInner["producao-bibliografica"] = pubList[:30]
+				report.step("listas de publicações limitadas a 30 por pesquisador")
+			}
 		}
 	}
-	wrapper["curriculos"] = copies
-	if estimateTokensAny(wrapper) <= maxTokens {
-		b, _ := json.Marshal(copies)
-		return string(b), true
+	if budget.fits(wrapper) {
+		return done(len(copies))
 	}
 
 	// Step 5: remove producao-bibliografica entirely (last resort before removing CVs)
-	removeFieldFromAll(copies, "producao-bibliografica")
-	wrapper["curriculos"] = copies
-	if estimateTokensAny(wrapper) <= maxTokens {
-		b, _ := json.Marshal(copies)
-		return string(b), true
+	if removeFieldFromAll(copies, "producao-bibliografica") > 0 {
+		report.step("publicações removidas dos currículos", "producao-bibliografica")
 	}
-
-	// Step 6: remove CVs from the end
-	for n := len(copies); n >= 0; n-- {
-		wrapper["curriculos"] = copies[:n]
-		if estimateTokensAny(wrapper) <= maxTokens {
-			b, _ := json.Marshal(copies[:n])
-			return string(b), true
-		}
+	if budget.fits(wrapper) {
+		return done(len(copies))
 	}
 
-	b, _ := json.Marshal(copies)
-	return string(b), true
+	// Step 6: remove CVs from the end, keeping as many as fit
+	n := sort.Search(len(copies), func(i int) bool {
+		wrapper["curriculos"] = copies[:i+1]
+		return !budget.fits(wrapper)
+	})
+	report.step("pesquisadores excluídos do contexto")
+	return done(n)
 }
 
-// truncateMainCVProdBib progressively trims the main CV's producao-bibliografica.
-func truncateMainCVProdBib(combined map[string]interface{}, maxTokens int) {
+// truncateMainCVProdBib progressively trims the main CV's producao-bibliografica,
+// raw or already compacted, and reports whether any publication was cut.
+func truncateMainCVProdBib(combined map[string]interface{}, budget Budget) bool {
 	main, ok := combined["pesquisador_alvo"]
 	if !ok {
-		return
+		return false
 	}
 	mainMap, ok := main.(map[string]interface{})
 	if !ok {
-		return
+		return false
 	}
 	cv, ok := getInnerMap(mainMap, "curriculo-vitae")
 	if !ok {
-		return
+		return false
+	}
+	if pubs, ok := cv["producao-bibliografica"].([]map[string]string); ok {
+		trimmed := false
+		for n := len(pubs) / 2; n >= 1 && !budget.fits(combined); n /= 2 {
+			cv["producao-bibliografica"] = pubs[:n]
+			trimmed = true
+		}
+		return trimmed
 	}
 	pb, ok := getInnerMap(cv, "producao-bibliografica")
 	if !ok {
-		return
+		return false
 	}
 	arrays := collectArrays(pb)
 	if len(arrays) == 0 {
-		return
+		return false
 	}
+	trimmed := false
 	maxLen := maxArrayLen(arrays)
-	for n := maxLen / 2; n >= 1 && estimateTokensAny(combined) > maxTokens; n /= 2 {
+	for n := maxLen / 2; n >= 1 && !budget.fits(combined); n /= 2 {
 		for _, entry := range arrays {
 			if len(entry.slice) > n {
 				entry.parent[entry.key] = entry.slice[:n]
+				trimmed = true
 			}
 		}
 	}
+	return trimmed
 }
@@ -0,0 +1,149 @@
+package ai
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/edalcin/smartlattes/internal/parser"
+)
+
+// testCV builds a CV with the given number of articles and a long
+// dados-complementares section.
+func testCV(name string, articles int) map[string]interface{} {
+	var list []interface{}
+	for i := 0; i < articles; i++ {
+		list = append(list, map[string]interface{}{
+			"dados-basicos-do-artigo": map[string]interface{}{
+				"titulo-do-artigo": fmt.Sprintf("Artigo %d de %s sobre ecologia de florestas tropicais", i, name),
+				"ano-do-artigo":    "2020",
+			},
+		})
+	}
+	return map[string]interface{}{
+		"_id": "id-" + name,
+		"curriculo-vitae": map[string]interface{}{
+			"dados-gerais": map[string]interface{}{
+				"nome-completo":          name,
+				"atuacoes-profissionais": strings.Repeat("Professor e pesquisador. ", 40),
+			},
+			"dados-complementares": strings.Repeat("Bancas e eventos. ", 100),
+			"producao-bibliografica": map[string]interface{}{
+				"artigos-publicados": map[string]interface{}{"artigo-publicado": list},
+			},
+		},
+	}
+}
+
+func TestTruncateAnalysisDataReport(t *testing.T) {
+	current := testCV("Alvo", 10)
+	var others []map[string]interface{}
+	for i := 0; i < 20; i++ {
+		others = append(others, testCV(fmt.Sprintf("Outro %d", i), 40))
+	}
+
+	if _, report := TruncateAnalysisData(current, others, Budget{Tokens: 1000000}); report.Truncated || len(report.Steps) != 0 {
+		t.Errorf("report with room to spare = %+v", report)
+	}
+
+	data, report := TruncateAnalysisData(current, others, Budget{Tokens: 500})
+	if !report.Truncated || report.PublicationsTrimmed == 0 || len(report.DroppedResearchers) == 0 {
+		t.Fatalf("report = %+v", report)
+	}
+	for _, field := range []string{"dados-complementares", "atuacoes-profissionais"} {
+		if !strings.Contains(strings.Join(report.RemovedFields, ","), field) {
+			t.Errorf("removed fields %v miss %s", report.RemovedFields, field)
+		}
+	}
+
+	var combined struct {
+		Others []interface{} `json:"outros_pesquisadores"`
+	}
+	if err := json.Unmarshal([]byte(data), &combined); err != nil {
+		t.Fatal(err)
+	}
+	if len(combined.Others)+len(report.DroppedResearchers) != len(others) {
+		t.Errorf("kept %d researchers and dropped %d of %d", len(combined.Others), len(report.DroppedResearchers), len(others))
+	}
+	if last := report.DroppedResearchers[len(report.DroppedResearchers)-1]; last != "Outro 19" {
+		t.Errorf("last dropped researcher = %q", last)
+	}
+}
+
+func TestTruncateChatDataDeterministic(t *testing.T) {
+	a, b, c := testCV("Ana", 30), testCV("Bruno", 5), testCV("Carla", 12)
+	first, _ := TruncateChatData([]map[string]interface{}{a, b, c}, Budget{Tokens: 1000000})
+	for i := 0; i < 5; i++ {
+		again, _ := TruncateChatData([]map[string]interface{}{c, a, b}, Budget{Tokens: 1000000})
+		if again != first {
+			t.Fatal("the same researchers in another order produced different data")
+		}
+	}
+	if strings.Index(first, "id-Ana") > strings.Index(first, "id-Bruno") || strings.Index(first, "id-Bruno") > strings.Index(first, "id-Carla") {
+		t.Error("researchers are not ordered by ID")
+	}
+}
+
+func TestCompactPublicationsTyped(t *testing.T) {
+	stored := testCV("Tipada", 1)
+	stored["publicacoes"] = parser.Publications{Books: []parser.Book{
+		{Publication: parser.Publication{Type: parser.TypeBook, Title: "Flora do cerrado", Year: 2019}},
+	}}
+	legacy := testCV("Antiga", 1)
+
+	cvs := []interface{}{deepCopyAny(stored), deepCopyAny(legacy)}
+	compactPublications(cvs)
+
+	want := map[string]string{"tipo": parser.TypeBook, "titulo": "Flora do cerrado", "ano": "2019"}
+	cv := cvs[0].(map[string]interface{})
+	pubs := cv["curriculo-vitae"].(map[string]interface{})["producao-bibliografica"].([]map[string]string)
+	if len(pubs) != 1 || fmt.Sprint(pubs[0]) != fmt.Sprint(want) {
+		t.Errorf("publications from the stored field = %v", pubs)
+	}
+	if _, ok := cv["publicacoes"]; ok {
+		t.Error("stored publications left in the compacted CV")
+	}
+
+	cv = cvs[1].(map[string]interface{})
+	pubs = cv["curriculo-vitae"].(map[string]interface{})["producao-bibliografica"].([]map[string]string)
+	if len(pubs) != 1 || pubs[0]["tipo"] != parser.TypeArticle || pubs[0]["ano"] != "2020" {
+		t.Errorf("publications extracted from producao-bibliografica = %v", pubs)
+	}
+}
+
+func TestTruncateChatDataKeepsRelevant(t *testing.T) {
+	var list []interface{}
+	for i := 0; i < 40; i++ {
+		title := fmt.Sprintf("Artigo %d sobre dinâmica de florestas tropicais úmidas e ciclagem de nutrientes no solo", i)
+		year := "2020"
+		if i%8 == 0 {
+			title, year = fmt.Sprintf("Artigo %d sobre conservação de quelônios amazônicos em várzeas", i), "2001"
+		}
+		list = append(list, map[string]interface{}{
+			"dados-basicos-do-artigo": map[string]interface{}{"titulo-do-artigo": title, "ano-do-artigo": year},
+		})
+	}
+	cv := map[string]interface{}{
+		"_id": "id-Ana",
+		"curriculo-vitae": map[string]interface{}{
+			"dados-gerais": map[string]interface{}{"nome-completo": "Ana"},
+			"producao-bibliografica": map[string]interface{}{
+				"artigos-publicados": map[string]interface{}{"artigo-publicado": list},
+			},
+		},
+	}
+
+	selected := SelectRelevantCVs([]map[string]interface{}{cv}, "quelônios", 5)
+	data, report := TruncateChatData(selected, Budget{Tokens: 1800})
+	if report.PublicationsTrimmed != 10 {
+		t.Fatalf("report = %+v", report)
+	}
+	if got := strings.Count(data, "quelônios"); got != 5 {
+		t.Errorf("kept %d of the 5 publications related to the question", got)
+	}
+	// What is kept is still sent in canonical order.
+	if strings.Index(data, "2001") < strings.Index(data, "2020") {
+		t.Error("publications are not ordered most recent first")
+	}
+}
@@ -0,0 +1,427 @@
+// Package chattools holds the tools the chatLattes agent calls to query the
+// researcher database, so that a question only brings into the conversation
+// the researchers and publications it needs instead of the whole base.
+package chattools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/edalcin/smartlattes/internal/ai"
+	"github.com/edalcin/smartlattes/internal/dedup"
+	"github.com/edalcin/smartlattes/internal/parser"
+	"github.com/edalcin/smartlattes/internal/store"
+	"github.com/edalcin/smartlattes/internal/textnorm"
+)
+
+// Names of the tools.
+const (
+	SearchResearchers = "buscar_pesquisadores"
+	GetCV             = "obter_curriculo"
+	ListPublications  = "listar_publicacoes"
+	CountProduction   = "contar_producao"
+	GetSummary        = "obter_resumo"
+)
+
+const (
+	defaultLimit = 20
+	maxLimit     = 100
+)
+
+var lattesIDParam = map[string]any{
+	"type":        "string",
+	"description": "ID Lattes do pesquisador, como retornado por " + SearchResearchers + ".",
+}
+
+var yearParams = map[string]any{
+	"ano_inicio": map[string]any{"type": "integer", "description": "Primeiro ano considerado."},
+	"ano_fim":    map[string]any{"type": "integer", "description": "Último ano considerado."},
+}
+
+var limitParam = map[string]any{
+	"type":        "integer",
+	"description": fmt.Sprintf("Máximo de itens retornados (padrão %d, no máximo %d).", defaultLimit, maxLimit),
+}
+
+// Definitions returns the tools offered to the model.
+func Definitions() []ai.Tool {
+	return []ai.Tool{
+		{
+			Name:        SearchResearchers,
+			Description: "Busca pesquisadores da base pelo nome, nome em citações, ID Lattes ou área de atuação. Sem consulta, lista todos os pesquisadores. Retorna ID Lattes, nome, áreas e número de publicações de cada um.",
+			Parameters: object(map[string]any{
+				"consulta": map[string]any{"type": "string", "description": "Termos buscados no nome e nas áreas de atuação, ou o início de um ID Lattes."},
+				"limite":   limitParam,
+			}),
+		},
+		{
+			Name:        GetCV,
+			Description: "Retorna o currículo Lattes de um pesquisador, resumido quando muito extenso.",
+			Parameters:  object(map[string]any{"lattesId": lattesIDParam}, "lattesId"),
+		},
+		{
+			Name:        ListPublications,
+			Description: "Lista publicações da base ou de um pesquisador, das mais recentes para as mais antigas, filtrando por período, palavra-chave no título e tipo. Obras em coautoria entre pesquisadores da base aparecem uma única vez.",
+			Parameters: object(merge(yearParams, map[string]any{
+				"lattesId":      lattesIDParam,
+				"palavra_chave": map[string]any{"type": "string", "description": "Termos que devem aparecer no título."},
+				"tipo":          typeParam(),
+				"limite":        limitParam,
+			})),
+		},
+		{
+			Name:        CountProduction,
+			Description: "Conta as publicações da base ou de um pesquisador, por tipo e por ano, no período informado. Obras em coautoria entre pesquisadores da base contam uma única vez.",
+			Parameters: object(merge(yearParams, map[string]any{
+				"lattesId": lattesIDParam,
+				"tipo":     typeParam(),
+			})),
+		},
+		{
+			Name:        GetSummary,
+			Description: "Retorna o resumo do pesquisador já gerado e salvo no smartLattes, se houver.",
+			Parameters:  object(map[string]any{"lattesId": lattesIDParam}, "lattesId"),
+		},
+	}
+}
+
+func object(properties map[string]any, required ...string) map[string]any {
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func merge(a, b map[string]any) map[string]any {
+	out := make(map[string]any, len(a)+len(b))
+	for k, v := range a {
+		out[k] = v
+	}
+	for k, v := range b {
+		out[k] = v
+	}
+	return out
+}
+
+func typeParam() map[string]any {
+	return map[string]any{
+		"type":        "string",
+		"description": "Tipo de publicação: artigo (article), livro (book), capítulo (chapter), trabalho em evento (conferencePaper), artigo aceito para publicação (acceptedArticle), texto em jornal ou revista (newspaperText), tradução (translation), partitura musical (musicScore), prefácio ou posfácio (preface) ou outra produção bibliográfica (other).",
+		"enum": []string{parser.TypeArticle, parser.TypeBook, parser.TypeChapter, parser.TypeConferencePaper,
+			parser.TypeAcceptedArticle, parser.TypeNewspaperText, parser.TypeTranslation, parser.TypeMusicScore, parser.TypePreface, parser.TypeOther},
+	}
+}
+
+// Executor runs the tool calls of one chat request against Store.
+type Executor struct {
+	Store store.Store
+	// Budget is the room in the model's context for the results of every
+	// call. A CV takes at most a quarter of it, and a result larger than what
+	// is left is refused.
+	Budget ai.Budget
+
+	used        int
+	researchers []store.ResearcherPublications
+	grouped     *dedup.Result
+}
+
+// args are the arguments of every tool; each uses a subset.
+type args struct {
+	Query    string `json:"consulta"`
+	LattesID string `json:"lattesId"`
+	YearFrom number `json:"ano_inicio"`
+	YearTo   number `json:"ano_fim"`
+	Keyword  string `json:"palavra_chave"`
+	Type     string `json:"tipo"`
+	Limit    number `json:"limite"`
+}
+
+// number accepts integers sent as JSON strings, which some models do.
+type number int
+
+func (n *number) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "" || s == "null" {
+		*n = 0
+		return nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return fmt.Errorf("número inválido: %s", data)
+	}
+	*n = number(v)
+	return nil
+}
+
+func (a args) limit() int {
+	if a.Limit <= 0 {
+		return defaultLimit
+	}
+	return min(int(a.Limit), maxLimit)
+}
+
+// Run executes call and returns its result as JSON. Failures are reported to
+// the model in the result, as {"erro": "..."}, so it can recover from them.
+func (e *Executor) Run(ctx context.Context, call ai.ToolCall) string {
+	var a args
+	if len(call.Arguments) > 0 {
+		if err := json.Unmarshal(call.Arguments, &a); err != nil {
+			return failure("argumentos inválidos: " + err.Error())
+		}
+	}
+
+	var (
+		result any
+		err    error
+	)
+	switch call.Name {
+	case SearchResearchers:
+		result, err = e.search(ctx, a)
+	case GetCV:
+		result, err = e.cv(ctx, a)
+	case ListPublications:
+		result, err = e.publications(ctx, a)
+	case CountProduction:
+		result, err = e.count(ctx, a)
+	case GetSummary:
+		result, err = e.summary(ctx, a)
+	default:
+		err = fmt.Errorf("ferramenta desconhecida: %s", call.Name)
+	}
+	if err != nil {
+		return failure(err.Error())
+	}
+	var out strings.Builder
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(result); err != nil {
+		return failure("erro ao codificar o resultado")
+	}
+	text := strings.TrimSuffix(out.String(), "\n")
+	tokens := e.Budget.Tokenizer.Count(text)
+	if tokens > e.remaining() {
+		return failure("os resultados das consultas já ocupam todo o espaço disponível no contexto; responda com os dados já obtidos ou faça uma consulta mais restrita")
+	}
+	e.used += tokens
+	return text
+}
+
+// remaining is the room left in Budget for tool results.
+func (e *Executor) remaining() int {
+	return max(e.Budget.Tokens-e.used, 0)
+}
+
+func failure(message string) string {
+	out, _ := json.Marshal(map[string]string{"erro": message})
+	return string(out)
+}
+
+var errDatabase = fmt.Errorf("erro ao acessar banco de dados")
+
+// load returns the publications of the researcher lattesID, or of the whole
+// base when it is empty. The base is read once per Executor.
+func (e *Executor) load(ctx context.Context, lattesID string) ([]store.ResearcherPublications, error) {
+	if lattesID != "" {
+		r, err := e.Store.GetPublications(ctx, lattesID)
+		if err != nil {
+			if err.Error() == "CV não encontrado" {
+				return nil, fmt.Errorf("nenhum pesquisador com o ID Lattes %s", lattesID)
+			}
+			return nil, errDatabase
+		}
+		return []store.ResearcherPublications{*r}, nil
+	}
+	if e.researchers == nil {
+		all, err := e.Store.GetAllPublications(ctx)
+		if err != nil {
+			return nil, errDatabase
+		}
+		e.researchers = all
+	}
+	return e.researchers, nil
+}
+
+type researcher struct {
+	LattesID     string   `json:"lattesId"`
+	Name         string   `json:"nome"`
+	Areas        []string `json:"areas,omitempty"`
+	Publications int      `json:"publicacoes"`
+}
+
+func (e *Executor) search(ctx context.Context, a args) (any, error) {
+	all, err := e.load(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	query := strings.TrimSpace(a.Query)
+	digits := query != "" && strings.IndexFunc(query, func(r rune) bool { return !unicode.IsDigit(r) }) < 0
+	terms := strings.Fields(textnorm.Fold(query))
+
+	var found []researcher
+	total := 0
+	for _, r := range all {
+		areas := make([]string, 0, len(r.Areas))
+		for _, area := range r.Areas {
+			areas = append(areas, areaPath(area))
+		}
+		if digits {
+			if !strings.HasPrefix(r.LattesID, query) {
+				continue
+			}
+		} else if !containsAll(textnorm.Fold(r.Name+" "+r.CitationNames+" "+strings.Join(areas, " ")), terms) {
+			continue
+		}
+		total++
+		if len(found) < a.limit() {
+			found = append(found, researcher{LattesID: r.LattesID, Name: r.Name, Areas: areas, Publications: r.Publications.Len()})
+		}
+	}
+	return map[string]any{"total": total, "pesquisadores": found}, nil
+}
+
+// areaPath writes an area as its path from the grande área down.
+func areaPath(a parser.Area) string {
+	var parts []string
+	for _, p := range []string{a.GrandeArea, a.Area, a.SubArea, a.Especialidade} {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, " > ")
+}
+
+func (e *Executor) cv(ctx context.Context, a args) (any, error) {
+	if a.LattesID == "" {
+		return nil, fmt.Errorf("lattesId é obrigatório")
+	}
+	doc, err := e.Store.GetCV(ctx, a.LattesID)
+	if err != nil {
+		if err.Error() == "CV não encontrado" {
+			return nil, fmt.Errorf("nenhum pesquisador com o ID Lattes %s", a.LattesID)
+		}
+		return nil, errDatabase
+	}
+	delete(doc, "_metadata")
+	budget := e.Budget
+	budget.Tokens = min(budget.Tokens/4, e.remaining())
+	cv, truncated := ai.TruncateCV(doc, budget)
+	if truncated {
+		cv["_aviso"] = "Currículo resumido para caber no contexto; use " + ListPublications + " para a produção completa."
+	}
+	return cv, nil
+}
+
+type publication struct {
+	Title       string   `json:"titulo"`
+	Year        int      `json:"ano,omitempty"`
+	Type        string   `json:"tipo"`
+	DOI         string   `json:"doi,omitempty"`
+	Researchers []string `json:"pesquisadores"`
+}
+
+// clusters returns the distinct works of the researchers selected by a that
+// pass its filters, the most recent first. The works come from the grouping
+// saved when the CVs were uploaded, read once per Executor.
+func (e *Executor) clusters(ctx context.Context, a args) ([]dedup.Cluster, error) {
+	if a.LattesID != "" {
+		if _, err := e.load(ctx, a.LattesID); err != nil {
+			return nil, err
+		}
+	}
+	if e.grouped == nil {
+		grouped, err := dedup.Load(ctx, e.Store)
+		if err != nil {
+			return nil, errDatabase
+		}
+		e.grouped = grouped
+	}
+	keywords := strings.Fields(textnorm.Fold(a.Keyword))
+	var out []dedup.Cluster
+	for _, c := range e.grouped.Clusters {
+		if a.LattesID != "" && !slices.ContainsFunc(c.Occurrences, func(o dedup.Occurrence) bool { return o.LattesID == a.LattesID }) {
+			continue
+		}
+		if a.YearFrom > 0 && c.Year < int(a.YearFrom) || a.YearTo > 0 && c.Year > int(a.YearTo) {
+			continue
+		}
+		if a.Type != "" && c.Type != a.Type {
+			continue
+		}
+		if !containsAll(textnorm.Fold(c.Title), keywords) {
+			continue
+		}
+		out = append(out, c)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Year > out[j].Year })
+	return out, nil
+}
+
+func (e *Executor) publications(ctx context.Context, a args) (any, error) {
+	clusters, err := e.clusters(ctx, a)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]publication, 0, min(len(clusters), a.limit()))
+	for _, c := range clusters[:min(len(clusters), a.limit())] {
+		p := publication{Title: c.Title, Year: c.Year, Type: c.Type, DOI: c.DOI}
+		for _, o := range c.Occurrences {
+			if !slices.Contains(p.Researchers, o.Name) {
+				p.Researchers = append(p.Researchers, o.Name)
+			}
+		}
+		list = append(list, p)
+	}
+	return map[string]any{"total": len(clusters), "publicacoes": list}, nil
+}
+
+func (e *Executor) count(ctx context.Context, a args) (any, error) {
+	clusters, err := e.clusters(ctx, a)
+	if err != nil {
+		return nil, err
+	}
+	byType := map[string]int{}
+	byYear := map[string]int{}
+	for _, c := range clusters {
+		byType[c.Type]++
+		year := "sem ano"
+		if c.Year > 0 {
+			year = strconv.Itoa(c.Year)
+		}
+		byYear[year]++
+	}
+	return map[string]any{"total": len(clusters), "porTipo": byType, "porAno": byYear}, nil
+}
+
+func (e *Executor) summary(ctx context.Context, a args) (any, error) {
+	if a.LattesID == "" {
+		return nil, fmt.Errorf("lattesId é obrigatório")
+	}
+	doc, err := e.Store.GetSummary(ctx, a.LattesID)
+	if err != nil {
+		if err.Error() == "resumo não encontrado" {
+			return nil, fmt.Errorf("não há resumo salvo para o ID Lattes %s", a.LattesID)
+		}
+		return nil, errDatabase
+	}
+	return map[string]any{
+		"lattesId": a.LattesID,
+		"resumo":   doc.Resumo,
+		"geradoEm": doc.Metadata.GeneratedAt,
+	}, nil
+}
+
+func containsAll(text string, terms []string) bool {
+	for _, t := range terms {
+		if !strings.Contains(text, t) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,175 @@
+package chattools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/edalcin/smartlattes/internal/ai"
+	"github.com/edalcin/smartlattes/internal/dedup"
+	"github.com/edalcin/smartlattes/internal/parser"
+	"github.com/edalcin/smartlattes/internal/store"
+)
+
+// cvXML is a CV with an article shared by every researcher (same DOI) and
+// one of its own.
+func cvXML(lattesID, name, area, title string, year int) []byte {
+	return []byte(fmt.Sprintf(`<?xml version="1.0" encoding="ISO-8859-1"?>
+<CURRICULO-VITAE NUMERO-IDENTIFICADOR="%[1]s" DATA-ATUALIZACAO="15032024">
+<DADOS-GERAIS NOME-COMPLETO="%[2]s" NOME-EM-CITACOES-BIBLIOGRAFICAS="%[2]s">
+<AREAS-DE-ATUACAO><AREA-DE-ATUACAO SEQUENCIA-AREA="1" NOME-GRANDE-AREA-DO-CONHECIMENTO="CIENCIAS_BIOLOGICAS" NOME-DA-AREA-DO-CONHECIMENTO="%[3]s"/></AREAS-DE-ATUACAO>
+</DADOS-GERAIS>
+<PRODUCAO-BIBLIOGRAFICA><ARTIGOS-PUBLICADOS>
+<ARTIGO-PUBLICADO SEQUENCIA-PRODUCAO="1">
+<DADOS-BASICOS-DO-ARTIGO TITULO-DO-ARTIGO="Plantas medicinais do cerrado brasileiro" ANO-DO-ARTIGO="2020" DOI="10.1000/compartilhado"/>
+<AUTORES NOME-COMPLETO-DO-AUTOR="%[2]s" ORDEM-DE-AUTORIA="1"/>
+</ARTIGO-PUBLICADO>
+<ARTIGO-PUBLICADO SEQUENCIA-PRODUCAO="2">
+<DADOS-BASICOS-DO-ARTIGO TITULO-DO-ARTIGO="%[4]s" ANO-DO-ARTIGO="%[5]d" DOI="10.1000/%[1]s"/>
+<AUTORES NOME-COMPLETO-DO-AUTOR="%[2]s" ORDEM-DE-AUTORIA="1"/>
+</ARTIGO-PUBLICADO>
+</ARTIGOS-PUBLICADOS></PRODUCAO-BIBLIOGRAFICA>
+</CURRICULO-VITAE>`, lattesID, name, area, title, year))
+}
+
+func testExecutor(t *testing.T) *Executor {
+	t.Helper()
+	s := store.NewMemoryStore()
+	for id, cv := range map[string][]byte{
+		"111": cvXML("111", "Ana Souza", "Etnobotanica", "Uso tradicional de plantas na Amazonia", 2022),
+		"222": cvXML("222", "Bruno Lima", "Ecologia", "Dinamica de florestas tropicais", 2018),
+	} {
+		result, err := parser.Parse(cv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.UpsertCV(context.Background(), result.Document, id, id+".xml", 100); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.UpsertSummary(context.Background(), "111", "Ana estuda plantas.", store.GenerationMetadata{Provider: "fake"}); err != nil {
+		t.Fatal(err)
+	}
+	return &Executor{Store: s, Budget: ai.Budget{Tokens: 100000}}
+}
+
+// run calls the tool name with args and decodes its result.
+func run(t *testing.T, e *Executor, name, args string) map[string]any {
+	t.Helper()
+	var out map[string]any
+	result := e.Run(context.Background(), ai.ToolCall{ID: "c", Name: name, Arguments: json.RawMessage(args)})
+	if err := json.Unmarshal([]byte(result), &out); err != nil {
+		t.Fatalf("%s returned %q: %v", name, result, err)
+	}
+	return out
+}
+
+func TestRun(t *testing.T) {
+	e := testExecutor(t)
+
+	found := run(t, e, SearchResearchers, `{"consulta":"Etnobotânica"}`)
+	list := found["pesquisadores"].([]any)
+	if found["total"] != float64(1) || list[0].(map[string]any)["lattesId"] != "111" {
+		t.Errorf("search by area = %v", found)
+	}
+	if all := run(t, e, SearchResearchers, `{"limite":"1"}`); all["total"] != float64(2) || len(all["pesquisadores"].([]any)) != 1 {
+		t.Errorf("search with limit = %v", all)
+	}
+	if byID := run(t, e, SearchResearchers, `{"consulta":"22"}`); byID["total"] != float64(1) {
+		t.Errorf("search by ID = %v", byID)
+	}
+
+	pubs := run(t, e, ListPublications, `{"ano_inicio":2019}`)
+	items := pubs["publicacoes"].([]any)
+	if pubs["total"] != float64(2) || items[0].(map[string]any)["ano"] != float64(2022) {
+		t.Errorf("publications since 2019 = %v", pubs)
+	}
+	if shared := items[1].(map[string]any)["pesquisadores"].([]any); len(shared) != 2 {
+		t.Errorf("co-authored work lists %v", shared)
+	}
+	if kw := run(t, e, ListPublications, `{"lattesId":"222","palavra_chave":"florestas"}`); kw["total"] != float64(1) {
+		t.Errorf("publications by keyword = %v", kw)
+	}
+
+	count := run(t, e, CountProduction, `{}`)
+	if count["total"] != float64(3) || count["porAno"].(map[string]any)["2020"] != float64(1) {
+		t.Errorf("count = %v", count)
+	}
+
+	if cv := run(t, e, GetCV, `{"lattesId":"222"}`); cv["curriculo-vitae"] == nil {
+		t.Errorf("cv = %v", cv)
+	}
+	if summary := run(t, e, GetSummary, `{"lattesId":"111"}`); summary["resumo"] != "Ana estuda plantas." {
+		t.Errorf("summary = %v", summary)
+	}
+
+	for _, tc := range []struct{ name, args, want string }{
+		{GetCV, `{"lattesId":"999"}`, "nenhum pesquisador com o ID Lattes 999"},
+		{GetSummary, `{"lattesId":"222"}`, "não há resumo salvo para o ID Lattes 222"},
+		{GetSummary, `{}`, "lattesId é obrigatório"},
+		{"apagar_tudo", `{}`, "ferramenta desconhecida: apagar_tudo"},
+	} {
+		if got := run(t, e, tc.name, tc.args); got["erro"] != tc.want {
+			t.Errorf("%s(%s) = %v, want erro %q", tc.name, tc.args, got, tc.want)
+		}
+	}
+}
+
+// countingStore counts the reads of the whole base.
+type countingStore struct {
+	store.Store
+	reads int
+}
+
+func (s *countingStore) GetAllPublications(ctx context.Context) ([]store.ResearcherPublications, error) {
+	s.reads++
+	return s.Store.GetAllPublications(ctx)
+}
+
+func (s *countingStore) GetPublicationClusters(ctx context.Context) ([]store.PublicationCluster, error) {
+	s.reads++
+	return s.Store.GetPublicationClusters(ctx)
+}
+
+func TestClustersReadOnce(t *testing.T) {
+	s := &countingStore{Store: testExecutor(t).Store}
+	if _, err := dedup.Refresh(context.Background(), s.Store); err != nil {
+		t.Fatal(err)
+	}
+	e := &Executor{Store: s, Budget: ai.Budget{Tokens: 100000}}
+
+	own := run(t, e, ListPublications, `{"lattesId":"222","ano_fim":2020}`)
+	if own["total"] != float64(2) || len(own["publicacoes"].([]any)[0].(map[string]any)["pesquisadores"].([]any)) != 2 {
+		t.Errorf("publications of 222 = %v", own)
+	}
+	run(t, e, CountProduction, `{}`)
+	run(t, e, ListPublications, `{"palavra_chave":"plantas"}`)
+	if s.reads != 1 {
+		t.Errorf("base read %d times, want 1", s.reads)
+	}
+}
+
+func TestBudget(t *testing.T) {
+	e := testExecutor(t)
+	e.Budget = ai.Budget{Tokens: 400}
+
+	first := run(t, e, GetCV, `{"lattesId":"111"}`)
+	if first["curriculo-vitae"] == nil {
+		t.Fatalf("first cv = %v", first)
+	}
+	// The CVs returned so far used up the room for tool results.
+	var refused map[string]any
+	for range 4 {
+		if refused = run(t, e, GetCV, `{"lattesId":"222"}`); refused["erro"] != nil {
+			break
+		}
+	}
+	if msg, _ := refused["erro"].(string); !strings.Contains(msg, "espaço disponível no contexto") {
+		t.Errorf("result past the budget = %v", refused)
+	}
+	if e.used > e.Budget.Tokens {
+		t.Errorf("results took %d tokens, budget %d", e.used, e.Budget.Tokens)
+	}
+}
@@ -0,0 +1,311 @@
+// Package dedup groups the publications of the researchers in the base that
+// describe the same work, so that a paper co-authored by two researchers of
+// the base is counted once in aggregate figures.
+package dedup
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/edalcin/smartlattes/internal/parser"
+	"github.com/edalcin/smartlattes/internal/store"
+	"github.com/edalcin/smartlattes/internal/textnorm"
+)
+
+// Match methods reported in Cluster.MatchedBy.
+const (
+	MatchDOI   = "doi"
+	MatchTitle = "titulo"
+)
+
+const (
+	// titleThreshold is the minimum similarity between two normalized titles
+	// of the same type and year for them to be considered the same work.
+	titleThreshold = 0.9
+	// minTitleWords keeps short, generic titles ("Editorial", "Apresentação")
+	// from being merged by title; they are only merged by DOI.
+	minTitleWords = 4
+)
+
+// Occurrence is one publication as listed in one CV. Index is its position in
+// the researcher's Publications.All().
+type Occurrence = store.PublicationOccurrence
+
+// Cluster is one distinct work. ID is the canonical publication ID; Type,
+// Title, Year and DOI come from a representative occurrence, the one with the
+// smallest Key, so one with DOI when there is any. MatchedBy is empty for
+// works listed only once.
+type Cluster = store.PublicationCluster
+
+// Stats counts the publications of the base with and without duplicates.
+type Stats = store.PublicationStats
+
+type occurrenceKey struct {
+	lattesID string
+	index    int
+}
+
+// Result holds the clusters of the whole base, ordered by canonical ID.
+type Result struct {
+	Clusters []Cluster
+
+	byOccurrence map[occurrenceKey]int
+}
+
+// Group clusters the publications of all researchers. Occurrences sharing a
+// DOI are merged first; the remaining ones are merged when they have the same
+// type and year and their normalized titles are at least 90% similar, unless
+// both sides carry different DOIs.
+func Group(researchers []store.ResearcherPublications) *Result {
+	var occs []Occurrence
+	var titles []string
+	for _, r := range researchers {
+		for i, p := range r.Publications.All() {
+			occs = append(occs, Occurrence{
+				LattesID: r.LattesID,
+				Name:     r.Name,
+				Index:    i,
+				Type:     p.Type,
+				Title:    p.Title,
+				Year:     p.Year,
+				DOI:      p.DOI,
+			})
+			titles = append(titles, textnorm.Fold(p.Title))
+		}
+	}
+
+	u := newUnionFind(len(occs))
+	matchedBy := make([]string, len(occs))
+
+	byDOI := make(map[string]int)
+	for i, o := range occs {
+		d := normalizeDOI(o.DOI)
+		if d == "" {
+			continue
+		}
+		u.doi[i] = d
+		if first, ok := byDOI[d]; ok {
+			u.union(first, i)
+			matchedBy[u.find(i)] = MatchDOI
+			continue
+		}
+		byDOI[d] = i
+	}
+
+	// Title matching only compares publications of the same type and year.
+	buckets := make(map[string][]int)
+	var bucketKeys []string
+	for i, o := range occs {
+		if len(strings.Fields(titles[i])) < minTitleWords {
+			continue
+		}
+		key := o.Type + "|" + strconv.Itoa(o.Year)
+		if buckets[key] == nil {
+			bucketKeys = append(bucketKeys, key)
+		}
+		buckets[key] = append(buckets[key], i)
+	}
+	for _, key := range bucketKeys {
+		members := buckets[key]
+		for a := 0; a < len(members); a++ {
+			for b := a + 1; b < len(members); b++ {
+				i, j := members[a], members[b]
+				if u.find(i) == u.find(j) {
+					continue
+				}
+				if titles[i] != titles[j] && similarity(titles[i], titles[j], titleThreshold) < titleThreshold {
+					continue
+				}
+				if !u.union(i, j) {
+					continue
+				}
+				if root := u.find(i); matchedBy[root] == "" {
+					matchedBy[root] = MatchTitle
+				}
+			}
+		}
+	}
+
+	groups := make(map[int][]int)
+	var roots []int
+	for i := range occs {
+		root := u.find(i)
+		if groups[root] == nil {
+			roots = append(roots, root)
+		}
+		groups[root] = append(groups[root], i)
+	}
+
+	keys := make([]string, len(occs))
+	for i, o := range occs {
+		keys[i] = Key(parser.Publication{Type: o.Type, Title: o.Title, Year: o.Year, DOI: o.DOI})
+	}
+	// before orders occurrences by key, then by researcher and position, so
+	// that representatives and IDs do not depend on the order of the CVs.
+	before := func(i, j int) bool {
+		if keys[i] != keys[j] {
+			return keys[i] < keys[j]
+		}
+		if occs[i].LattesID != occs[j].LattesID {
+			return occs[i].LattesID < occs[j].LattesID
+		}
+		return occs[i].Index < occs[j].Index
+	}
+
+	reps := make([]int, 0, len(roots))
+	for _, root := range roots {
+		members := groups[root]
+		sort.Slice(members, func(a, b int) bool { return before(members[a], members[b]) })
+		reps = append(reps, members[0])
+	}
+	sort.Slice(reps, func(a, b int) bool { return before(reps[a], reps[b]) })
+
+	res := &Result{}
+	usedIDs := make(map[string]bool)
+	for _, r := range reps {
+		members := groups[u.find(r)]
+		rep := occs[r]
+		c := Cluster{
+			ID:    canonicalID(keys[r], rep.LattesID, usedIDs),
+			Type:  rep.Type,
+			Title: rep.Title,
+			Year:  rep.Year,
+			DOI:   rep.DOI,
+		}
+		researchersSeen := make(map[string]bool)
+		for _, m := range members {
+			c.Occurrences = append(c.Occurrences, occs[m])
+			researchersSeen[occs[m].LattesID] = true
+		}
+		c.Researchers = len(researchersSeen)
+		if len(members) > 1 {
+			c.MatchedBy = matchedBy[u.find(r)]
+		}
+		res.Clusters = append(res.Clusters, c)
+	}
+
+	res.index()
+	return res
+}
+
+// index sorts the clusters by canonical ID and maps each occurrence to its
+// cluster.
+func (r *Result) index() {
+	sort.Slice(r.Clusters, func(i, j int) bool { return r.Clusters[i].ID < r.Clusters[j].ID })
+	r.byOccurrence = make(map[occurrenceKey]int)
+	for ci, c := range r.Clusters {
+		for _, o := range c.Occurrences {
+			r.byOccurrence[occurrenceKey{o.LattesID, o.Index}] = ci
+		}
+	}
+}
+
+// CanonicalID returns the canonical ID of the index-th publication (in
+// Publications.All() order) of a researcher, or "" when it is unknown.
+func (r *Result) CanonicalID(lattesID string, index int) string {
+	ci, ok := r.byOccurrence[occurrenceKey{lattesID, index}]
+	if !ok {
+		return ""
+	}
+	return r.Clusters[ci].ID
+}
+
+// Duplicated returns the clusters listed more than once.
+func (r *Result) Duplicated() []Cluster {
+	out := []Cluster{}
+	for _, c := range r.Clusters {
+		if len(c.Occurrences) > 1 {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func (r *Result) Stats() Stats {
+	s := Stats{Unique: len(r.Clusters), UniqueByType: make(map[string]int)}
+	for _, c := range r.Clusters {
+		s.Total += len(c.Occurrences)
+		s.UniqueByType[c.Type]++
+	}
+	s.Duplicates = s.Total - s.Unique
+	return s
+}
+
+// Key identifies a publication without fuzzy matching: its normalized DOI or,
+// without one, its type, normalized title and year.
+func Key(p parser.Publication) string {
+	if d := normalizeDOI(p.DOI); d != "" {
+		return "doi:" + d
+	}
+	return "titulo:" + p.Type + "|" + textnorm.Fold(p.Title) + "|" + strconv.Itoa(p.Year)
+}
+
+// canonicalID derives the ID of a work from the Key of its representative:
+// the normalized DOI or, without one, type, normalized title and year. Works
+// that share the key without having been merged (short titles) are told apart
+// by the researcher listing them and then by a numeric suffix.
+func canonicalID(key, lattesID string, used map[string]bool) string {
+	id := hashID(key)
+	if !used[id] {
+		used[id] = true
+		return id
+	}
+	key += "#" + lattesID
+	id = hashID(key)
+	for n := 2; used[id]; n++ {
+		id = hashID(key + "#" + strconv.Itoa(n))
+	}
+	used[id] = true
+	return id
+}
+
+func hashID(key string) string {
+	sum := sha1.Sum([]byte(key))
+	return "pub-" + hex.EncodeToString(sum[:6])
+}
+
+// unionFind tracks the DOI of each set so that two sets with different DOIs
+// are never merged by title.
+type unionFind struct {
+	parent []int
+	doi    []string
+}
+
+func newUnionFind(n int) *unionFind {
+	u := &unionFind{parent: make([]int, n), doi: make([]string, n)}
+	for i := range u.parent {
+		u.parent[i] = i
+	}
+	return u
+}
+
+func (u *unionFind) find(i int) int {
+	for u.parent[i] != i {
+		u.parent[i] = u.parent[u.parent[i]]
+		i = u.parent[i]
+	}
+	return i
+}
+
+// union merges the sets of i and j, keeping the smaller index as root. It
+// reports false when the sets carry conflicting DOIs.
+func (u *unionFind) union(i, j int) bool {
+	ri, rj := u.find(i), u.find(j)
+	if ri == rj {
+		return true
+	}
+	if u.doi[ri] != "" && u.doi[rj] != "" && u.doi[ri] != u.doi[rj] {
+		return false
+	}
+	if rj < ri {
+		ri, rj = rj, ri
+	}
+	u.parent[rj] = ri
+	if u.doi[ri] == "" {
+		u.doi[ri] = u.doi[rj]
+	}
+	return true
+}
@@ -0,0 +1,156 @@
+package dedup
+
+import (
+	"context"
+	"testing"
+
+	"github.com/edalcin/smartlattes/internal/parser"
+	"github.com/edalcin/smartlattes/internal/store"
+)
+
+func article(title string, year int, doi string) parser.Article {
+	return parser.Article{Publication: parser.Publication{Type: parser.TypeArticle, Title: title, Year: year, DOI: doi}}
+}
+
+func researcher(lattesID string, articles ...parser.Article) store.ResearcherPublications {
+	return store.ResearcherPublications{LattesID: lattesID, Name: "Pesquisador " + lattesID, Publications: parser.Publications{Articles: articles}}
+}
+
+func TestGroup(t *testing.T) {
+	tests := []struct {
+		name      string
+		a, b      parser.Article
+		merged    bool
+		matchedBy string
+	}{
+		{
+			name:      "same DOI",
+			a:         article("Plantas medicinais do cerrado", 2020, "10.1000/xyz"),
+			b:         article("Medicinal plants of the cerrado", 2021, "https://doi.org/10.1000/XYZ"),
+			merged:    true,
+			matchedBy: MatchDOI,
+		},
+		{
+			name:      "similar title",
+			a:         article("Plantas medicinais do cerrado brasileiro", 2020, ""),
+			b:         article("Plantas medicinais do Cerrado brasileiro.", 2020, "10.1000/xyz"),
+			merged:    true,
+			matchedBy: MatchTitle,
+		},
+		{
+			name:      "typo in title",
+			a:         article("Levantamento etnobotânico de plantas medicinais", 2019, ""),
+			b:         article("Levantamento etnobotanico de plantas medicinas", 2019, ""),
+			merged:    true,
+			matchedBy: MatchTitle,
+		},
+		{
+			name: "different year",
+			a:    article("Plantas medicinais do cerrado brasileiro", 2020, ""),
+			b:    article("Plantas medicinais do cerrado brasileiro", 2021, ""),
+		},
+		{
+			name: "different DOIs",
+			a:    article("Plantas medicinais do cerrado brasileiro", 2020, "10.1000/a"),
+			b:    article("Plantas medicinais do cerrado brasileiro", 2020, "10.1000/b"),
+		},
+		{
+			name: "short title",
+			a:    article("Editorial", 2020, ""),
+			b:    article("Editorial", 2020, ""),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := Group([]store.ResearcherPublications{researcher("111", tt.a), researcher("222", tt.b)})
+			idA, idB := res.CanonicalID("111", 0), res.CanonicalID("222", 0)
+			if idA == "" || idB == "" {
+				t.Fatalf("IDs = %q, %q", idA, idB)
+			}
+			if (idA == idB) != tt.merged {
+				t.Fatalf("merged = %v, want %v", idA == idB, tt.merged)
+			}
+			stats := res.Stats()
+			if want := map[bool]int{true: 1, false: 0}[tt.merged]; stats.Total != 2 || stats.Duplicates != want {
+				t.Errorf("stats = %+v", stats)
+			}
+			if tt.merged {
+				if c := res.Duplicated(); len(c) != 1 || c[0].MatchedBy != tt.matchedBy || c[0].Researchers != 2 {
+					t.Errorf("clusters = %+v", c)
+				}
+			}
+		})
+	}
+}
+
+func TestCanonicalIDStable(t *testing.T) {
+	a := researcher("111",
+		article("Editorial", 2020, ""),
+		article("Plantas medicinais do cerrado brasileiro", 2020, ""),
+	)
+	b := researcher("222",
+		article("Editorial", 2020, ""),
+		article("Plantas medicinais do Cerrado brasileiro", 2020, "10.1000/xyz"),
+	)
+	first := Group([]store.ResearcherPublications{a, b})
+	second := Group([]store.ResearcherPublications{b, a})
+	for _, occ := range []occurrenceKey{{"111", 0}, {"111", 1}, {"222", 0}, {"222", 1}} {
+		if x, y := first.CanonicalID(occ.lattesID, occ.index), second.CanonicalID(occ.lattesID, occ.index); x != y {
+			t.Errorf("ID of %v changed with the order of the CVs: %q, %q", occ, x, y)
+		}
+	}
+
+	// A work with DOI is identified by it, whatever titles its occurrences carry.
+	want := hashID(Key(parser.Publication{DOI: "10.1000/xyz"}))
+	if got := first.CanonicalID("111", 1); got != want {
+		t.Errorf("ID = %q, want %q", got, want)
+	}
+	// Adding a CV that lists the work without DOI keeps its ID.
+	c := researcher("000", article("Plantas medicinais do cerrado brasileiro.", 2020, ""))
+	if got := Group([]store.ResearcherPublications{c, a, b}).CanonicalID("000", 0); got != want {
+		t.Errorf("ID after a new CV = %q, want %q", got, want)
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemoryStore()
+	for id, own := range map[string]string{"111": "Uso tradicional de plantas na Amazônia", "222": "Dinâmica de florestas tropicais úmidas"} {
+		cv := map[string]interface{}{
+			"curriculo-vitae": map[string]interface{}{"dados-gerais": map[string]interface{}{"nome-completo": "Pesquisador " + id}},
+			"publicacoes": parser.Publications{Articles: []parser.Article{
+				article("Plantas medicinais do cerrado brasileiro", 2020, "10.1000/xyz"),
+				article(own, 2021, ""),
+			}},
+		}
+		if _, err := s.UpsertCV(ctx, cv, id, id+".xml", 10); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Without a saved grouping, Load groups the base and saves it.
+	loaded, err := Load(ctx, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := s.GetPublicationStats(ctx)
+	if err != nil || stats.Total != 4 || stats.Unique != 3 {
+		t.Fatalf("saved stats = %+v, %v", stats, err)
+	}
+	if got := loaded.CanonicalID("222", 0); got != loaded.CanonicalID("111", 0) || got == "" {
+		t.Errorf("shared work IDs = %q, %q", loaded.CanonicalID("111", 0), got)
+	}
+
+	refreshed, err := Refresh(ctx, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range refreshed.Clusters {
+		if got := loaded.CanonicalID(c.Occurrences[0].LattesID, c.Occurrences[0].Index); got != c.ID {
+			t.Errorf("ID of %q changed from %q to %q", c.Title, got, c.ID)
+		}
+	}
+	if got, err := LoadStats(ctx, s); err != nil || got.Duplicates != 1 {
+		t.Errorf("LoadStats = %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,55 @@
+package dedup
+
+import "strings"
+
+// normalizeDOI strips resolver prefixes and lowercases a DOI.
+func normalizeDOI(s string) string {
+	d := strings.ToLower(strings.TrimSpace(s))
+	for _, prefix := range []string{"https://doi.org/", "http://doi.org/", "https://dx.doi.org/", "http://dx.doi.org/", "doi:"} {
+		d = strings.TrimPrefix(d, prefix)
+	}
+	return strings.TrimSpace(d)
+}
+
+// similarity returns 1 minus the Levenshtein distance of a and b divided by
+// the length of the longer one. It gives up early, returning 0, when the
+// strings cannot reach threshold.
+func similarity(a, b string, threshold float64) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	if longest == 0 {
+		return 1
+	}
+	maxDist := int(float64(longest) * (1 - threshold))
+	if diff := len(ra) - len(rb); diff > maxDist || -diff > maxDist {
+		return 0
+	}
+
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if cur[j] < rowMin {
+				rowMin = cur[j]
+			}
+		}
+		if rowMin > maxDist {
+			return 0
+		}
+		prev, cur = cur, prev
+	}
+	return 1 - float64(prev[len(rb)])/float64(longest)
+}
@@ -0,0 +1,67 @@
+package dedup
+
+import (
+	"context"
+	"sync"
+
+	"github.com/edalcin/smartlattes/internal/store"
+)
+
+// refreshMu serializes the regroupings, so that the last one saved is the one
+// that read the latest CVs.
+var refreshMu sync.Mutex
+
+// Refresh groups the publications of the whole base and saves the clusters
+// and stats in s. It runs when CVs change, so readers never group on their
+// own.
+func Refresh(ctx context.Context, s store.Store) (*Result, error) {
+	refreshMu.Lock()
+	defer refreshMu.Unlock()
+
+	researchers, err := s.GetAllPublications(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := Group(researchers)
+	if err := s.SavePublicationClusters(ctx, res.Clusters, res.Stats()); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Load returns the clusters saved by the last Refresh, grouping the base
+// first when there are none yet.
+func Load(ctx context.Context, s store.Store) (*Result, error) {
+	if _, err := s.GetPublicationStats(ctx); err != nil {
+		if err.Error() != errNoStats {
+			return nil, err
+		}
+		return Refresh(ctx, s)
+	}
+	clusters, err := s.GetPublicationClusters(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := &Result{Clusters: clusters}
+	res.index()
+	return res, nil
+}
+
+// LoadStats returns the stats saved by the last Refresh, grouping the base
+// first when there are none yet.
+func LoadStats(ctx context.Context, s store.Store) (Stats, error) {
+	stats, err := s.GetPublicationStats(ctx)
+	if err == nil {
+		return *stats, nil
+	}
+	if err.Error() != errNoStats {
+		return Stats{}, err
+	}
+	res, err := Refresh(ctx, s)
+	if err != nil {
+		return Stats{}, err
+	}
+	return res.Stats(), nil
+}
+
+const errNoStats = "estatísticas de publicações não encontradas"
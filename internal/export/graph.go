@@ -0,0 +1,267 @@
+package export
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"strconv"
+	"time"
+
+	"github.com/edalcin/smartlattes/internal/network"
+)
+
+// nodeAttribute describes one node attribute written by the graph formats.
+type nodeAttribute struct {
+	id    string
+	typ   string // GraphML/GEXF type: "string" or "int"
+	value func(n network.Node) string
+}
+
+var nodeAttributes = []nodeAttribute{
+	{"label", "string", func(n network.Node) string { return n.Label }},
+	{"kind", "string", func(n network.Node) string { return n.Kind }},
+	{"lattesId", "string", func(n network.Node) string { return n.LattesID }},
+	{"mainArea", "string", func(n network.Node) string { return n.MainArea }},
+	{"publications", "int", func(n network.Node) string { return strconv.Itoa(n.Publications) }},
+	{"articles", "int", func(n network.Node) string { return strconv.Itoa(n.Articles) }},
+	{"books", "int", func(n network.Node) string { return strconv.Itoa(n.Books) }},
+	{"chapters", "int", func(n network.Node) string { return strconv.Itoa(n.Chapters) }},
+	{"conferencePapers", "int", func(n network.Node) string { return strconv.Itoa(n.ConferencePapers) }},
+	{"researchers", "int", func(n network.Node) string { return strconv.Itoa(n.Researchers) }},
+}
+
+type graphMLDoc struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	AttrName string `xml:"attr.name,attr"`
+	AttrType string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	ID     string        `xml:"id,attr"`
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// ToGraphML serializes the graph as GraphML, readable by Gephi, Cytoscape,
+// yEd and NetworkX.
+func ToGraphML(g *network.Graph) ([]byte, error) {
+	doc := graphMLDoc{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Graph: graphMLGraph{ID: "smartlattes", EdgeDefault: "undirected"},
+	}
+	for _, a := range nodeAttributes {
+		doc.Keys = append(doc.Keys, graphMLKey{ID: a.id, For: "node", AttrName: a.id, AttrType: a.typ})
+	}
+	doc.Keys = append(doc.Keys,
+		graphMLKey{ID: "edgeKind", For: "edge", AttrName: "kind", AttrType: "string"},
+		graphMLKey{ID: "weight", For: "edge", AttrName: "weight", AttrType: "int"},
+	)
+
+	for _, n := range g.Nodes {
+		node := graphMLNode{ID: n.ID}
+		for _, a := range nodeAttributes {
+			node.Data = append(node.Data, graphMLData{Key: a.id, Value: a.value(n)})
+		}
+		doc.Graph.Nodes = append(doc.Graph.Nodes, node)
+	}
+	for i, e := range g.Edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{
+			ID:     "e" + strconv.Itoa(i),
+			Source: e.Source,
+			Target: e.Target,
+			Data: []graphMLData{
+				{Key: "edgeKind", Value: e.Kind},
+				{Key: "weight", Value: strconv.Itoa(e.Weight)},
+			},
+		})
+	}
+
+	return marshalXML(doc)
+}
+
+type gexfDoc struct {
+	XMLName xml.Name  `xml:"gexf"`
+	XMLNS   string    `xml:"xmlns,attr"`
+	Version string    `xml:"version,attr"`
+	Meta    gexfMeta  `xml:"meta"`
+	Graph   gexfGraph `xml:"graph"`
+}
+
+type gexfMeta struct {
+	LastModified string `xml:"lastmodifieddate,attr"`
+	Creator      string `xml:"creator"`
+	Description  string `xml:"description"`
+}
+
+type gexfGraph struct {
+	Mode            string           `xml:"mode,attr"`
+	DefaultEdgeType string           `xml:"defaultedgetype,attr"`
+	Attributes      []gexfAttributes `xml:"attributes"`
+	Nodes           []gexfNode       `xml:"nodes>node"`
+	Edges           []gexfEdge       `xml:"edges>edge"`
+}
+
+type gexfAttributes struct {
+	Class      string          `xml:"class,attr"`
+	Attributes []gexfAttribute `xml:"attribute"`
+}
+
+type gexfAttribute struct {
+	ID    string `xml:"id,attr"`
+	Title string `xml:"title,attr"`
+	Type  string `xml:"type,attr"`
+}
+
+type gexfNode struct {
+	ID        string         `xml:"id,attr"`
+	Label     string         `xml:"label,attr"`
+	AttValues []gexfAttValue `xml:"attvalues>attvalue"`
+}
+
+type gexfEdge struct {
+	ID        string         `xml:"id,attr"`
+	Source    string         `xml:"source,attr"`
+	Target    string         `xml:"target,attr"`
+	Weight    int            `xml:"weight,attr"`
+	AttValues []gexfAttValue `xml:"attvalues>attvalue"`
+}
+
+type gexfAttValue struct {
+	For   string `xml:"for,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// ToGEXF serializes the graph as GEXF 1.3, Gephi's native format.
+func ToGEXF(g *network.Graph) ([]byte, error) {
+	nodeAttrs := gexfAttributes{Class: "node"}
+	for _, a := range nodeAttributes[1:] { // label is the node's own attribute in GEXF
+		typ := "string"
+		if a.typ == "int" {
+			typ = "integer"
+		}
+		nodeAttrs.Attributes = append(nodeAttrs.Attributes, gexfAttribute{ID: a.id, Title: a.id, Type: typ})
+	}
+	edgeAttrs := gexfAttributes{Class: "edge", Attributes: []gexfAttribute{{ID: "kind", Title: "kind", Type: "string"}}}
+
+	doc := gexfDoc{
+		XMLNS:   "http://gexf.net/1.3",
+		Version: "1.3",
+		Meta: gexfMeta{
+			LastModified: time.Now().UTC().Format("2006-01-02"),
+			Creator:      "smartLattes",
+			Description:  "Rede de coautoria e áreas de atuação dos pesquisadores",
+		},
+		Graph: gexfGraph{
+			Mode:            "static",
+			DefaultEdgeType: "undirected",
+			Attributes:      []gexfAttributes{nodeAttrs, edgeAttrs},
+		},
+	}
+
+	for _, n := range g.Nodes {
+		node := gexfNode{ID: n.ID, Label: n.Label}
+		for _, a := range nodeAttributes[1:] {
+			node.AttValues = append(node.AttValues, gexfAttValue{For: a.id, Value: a.value(n)})
+		}
+		doc.Graph.Nodes = append(doc.Graph.Nodes, node)
+	}
+	for i, e := range g.Edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, gexfEdge{
+			ID:        strconv.Itoa(i),
+			Source:    e.Source,
+			Target:    e.Target,
+			Weight:    e.Weight,
+			AttValues: []gexfAttValue{{For: "kind", Value: e.Kind}},
+		})
+	}
+
+	return marshalXML(doc)
+}
+
+// ToCytoscapeJSON serializes the graph in the Cytoscape.js elements format,
+// which Cytoscape desktop imports as a .cyjs network.
+func ToCytoscapeJSON(g *network.Graph) ([]byte, error) {
+	type element struct {
+		Data map[string]any `json:"data"`
+	}
+	doc := struct {
+		Data     map[string]any `json:"data"`
+		Elements struct {
+			Nodes []element `json:"nodes"`
+			Edges []element `json:"edges"`
+		} `json:"elements"`
+	}{
+		Data: map[string]any{"name": "smartLattes"},
+	}
+	doc.Elements.Nodes = []element{}
+	doc.Elements.Edges = []element{}
+
+	for _, n := range g.Nodes {
+		data := map[string]any{
+			"id":           n.ID,
+			"name":         n.Label,
+			"kind":         n.Kind,
+			"publications": n.Publications,
+		}
+		if n.LattesID != "" {
+			data["lattesId"] = n.LattesID
+		}
+		if n.MainArea != "" {
+			data["mainArea"] = n.MainArea
+		}
+		if n.Kind == network.KindResearcher {
+			data["articles"] = n.Articles
+			data["books"] = n.Books
+			data["chapters"] = n.Chapters
+			data["conferencePapers"] = n.ConferencePapers
+		}
+		if n.Kind == network.KindArea {
+			data["researchers"] = n.Researchers
+		}
+		doc.Elements.Nodes = append(doc.Elements.Nodes, element{Data: data})
+	}
+	for i, e := range g.Edges {
+		doc.Elements.Edges = append(doc.Elements.Edges, element{Data: map[string]any{
+			"id":     "e" + strconv.Itoa(i),
+			"source": e.Source,
+			"target": e.Target,
+			"kind":   e.Kind,
+			"weight": e.Weight,
+		}})
+	}
+
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+func marshalXML(v any) ([]byte, error) {
+	body, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
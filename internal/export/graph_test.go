@@ -0,0 +1,175 @@
+package export
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"strconv"
+	"testing"
+
+	"github.com/edalcin/smartlattes/internal/network"
+)
+
+var testGraph = &network.Graph{
+	Nodes: []network.Node{
+		{ID: "1111", Label: "Ana Souza", Kind: network.KindResearcher, LattesID: "1111", MainArea: "Ecologia",
+			Publications: 4, Articles: 2, Books: 1, Chapters: 1},
+		{ID: "area:ecologia", Label: "Ecologia", Kind: network.KindArea, Researchers: 1},
+		{ID: "nome:silva d", Label: `Silva & "Conceição" <D.>`, Kind: network.KindCoauthor, Publications: 1},
+	},
+	Edges: []network.Edge{
+		{Source: "1111", Target: "nome:silva d", Kind: network.EdgeCoauthorship, Weight: 3},
+		{Source: "1111", Target: "area:ecologia", Kind: network.EdgeArea, Weight: 1},
+	},
+}
+
+// nodeFromAttributes rebuilds a node from the attribute values written for
+// nodeAttributes.
+func nodeFromAttributes(t *testing.T, id string, values map[string]string) network.Node {
+	t.Helper()
+	atoi := func(key string) int {
+		n, err := strconv.Atoi(values[key])
+		if err != nil {
+			t.Errorf("node %s: %s = %q", id, key, values[key])
+		}
+		return n
+	}
+	return network.Node{
+		ID:               id,
+		Label:            values["label"],
+		Kind:             values["kind"],
+		LattesID:         values["lattesId"],
+		MainArea:         values["mainArea"],
+		Publications:     atoi("publications"),
+		Articles:         atoi("articles"),
+		Books:            atoi("books"),
+		Chapters:         atoi("chapters"),
+		ConferencePapers: atoi("conferencePapers"),
+		Researchers:      atoi("researchers"),
+	}
+}
+
+func TestGraphRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		encode func(*network.Graph) ([]byte, error)
+		decode func(t *testing.T, data []byte) *network.Graph
+	}{
+		{"GraphML", ToGraphML, func(t *testing.T, data []byte) *network.Graph {
+			var doc graphMLDoc
+			if err := xml.Unmarshal(data, &doc); err != nil {
+				t.Fatal(err)
+			}
+			if len(doc.Keys) != len(nodeAttributes)+2 || doc.Graph.EdgeDefault != "undirected" {
+				t.Errorf("keys = %+v, edgedefault = %q", doc.Keys, doc.Graph.EdgeDefault)
+			}
+			g := &network.Graph{}
+			for _, n := range doc.Graph.Nodes {
+				values := make(map[string]string)
+				for _, d := range n.Data {
+					values[d.Key] = d.Value
+				}
+				g.Nodes = append(g.Nodes, nodeFromAttributes(t, n.ID, values))
+			}
+			for _, e := range doc.Graph.Edges {
+				values := make(map[string]string)
+				for _, d := range e.Data {
+					values[d.Key] = d.Value
+				}
+				weight, _ := strconv.Atoi(values["weight"])
+				g.Edges = append(g.Edges, network.Edge{Source: e.Source, Target: e.Target, Kind: values["edgeKind"], Weight: weight})
+			}
+			return g
+		}},
+		{"GEXF", ToGEXF, func(t *testing.T, data []byte) *network.Graph {
+			var doc gexfDoc
+			if err := xml.Unmarshal(data, &doc); err != nil {
+				t.Fatal(err)
+			}
+			if doc.Version != "1.3" || len(doc.Graph.Attributes) != 2 {
+				t.Errorf("version = %q, attributes = %+v", doc.Version, doc.Graph.Attributes)
+			}
+			g := &network.Graph{}
+			for _, n := range doc.Graph.Nodes {
+				values := map[string]string{"label": n.Label}
+				for _, v := range n.AttValues {
+					values[v.For] = v.Value
+				}
+				g.Nodes = append(g.Nodes, nodeFromAttributes(t, n.ID, values))
+			}
+			for _, e := range doc.Graph.Edges {
+				kind := ""
+				for _, v := range e.AttValues {
+					if v.For == "kind" {
+						kind = v.Value
+					}
+				}
+				g.Edges = append(g.Edges, network.Edge{Source: e.Source, Target: e.Target, Kind: kind, Weight: e.Weight})
+			}
+			return g
+		}},
+		{"Cytoscape", ToCytoscapeJSON, func(t *testing.T, data []byte) *network.Graph {
+			type element struct {
+				Data struct {
+					ID               string `json:"id"`
+					Name             string `json:"name"`
+					Kind             string `json:"kind"`
+					LattesID         string `json:"lattesId"`
+					MainArea         string `json:"mainArea"`
+					Publications     int    `json:"publications"`
+					Articles         int    `json:"articles"`
+					Books            int    `json:"books"`
+					Chapters         int    `json:"chapters"`
+					ConferencePapers int    `json:"conferencePapers"`
+					Researchers      int    `json:"researchers"`
+					Source           string `json:"source"`
+					Target           string `json:"target"`
+					Weight           int    `json:"weight"`
+				} `json:"data"`
+			}
+			var doc struct {
+				Elements struct {
+					Nodes []element `json:"nodes"`
+					Edges []element `json:"edges"`
+				} `json:"elements"`
+			}
+			if err := json.Unmarshal(data, &doc); err != nil {
+				t.Fatal(err)
+			}
+			g := &network.Graph{}
+			for _, n := range doc.Elements.Nodes {
+				d := n.Data
+				g.Nodes = append(g.Nodes, network.Node{
+					ID: d.ID, Label: d.Name, Kind: d.Kind, LattesID: d.LattesID, MainArea: d.MainArea,
+					Publications: d.Publications, Articles: d.Articles, Books: d.Books, Chapters: d.Chapters,
+					ConferencePapers: d.ConferencePapers, Researchers: d.Researchers,
+				})
+			}
+			for _, e := range doc.Elements.Edges {
+				g.Edges = append(g.Edges, network.Edge{Source: e.Data.Source, Target: e.Data.Target, Kind: e.Data.Kind, Weight: e.Data.Weight})
+			}
+			return g
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := tt.encode(testGraph)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := tt.decode(t, data)
+			if len(got.Nodes) != len(testGraph.Nodes) || len(got.Edges) != len(testGraph.Edges) {
+				t.Fatalf("decoded %d nodes and %d edges", len(got.Nodes), len(got.Edges))
+			}
+			for i, want := range testGraph.Nodes {
+				if got.Nodes[i] != want {
+					t.Errorf("node %d = %+v, want %+v", i, got.Nodes[i], want)
+				}
+			}
+			for i, want := range testGraph.Edges {
+				if got.Edges[i] != want {
+					t.Errorf("edge %d = %+v, want %+v", i, got.Edges[i], want)
+				}
+			}
+		})
+	}
+}
@@ -3,37 +3,120 @@ package handler
 import (
 	"crypto/subtle"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/edalcin/smartlattes/internal/quota"
 	"github.com/edalcin/smartlattes/internal/store"
 )
 
 type AdminResearchersHandler struct {
-	Store    *store.MongoDB
+	Store    store.Store
 	AdminPIN string
 }
 
 func (h *AdminResearchersHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"success": false, "error": "método não permitido"})
+	if !checkAdmin(w, r, h.AdminPIN) {
 		return
 	}
 
-	if h.AdminPIN == "" {
-		writeJSON(w, http.StatusForbidden, map[string]any{"success": false, "error": "Admin desabilitado"})
+	researchers, err := h.Store.GetAllResearchersAdmin(r.Context())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"success": false, "error": "erro ao buscar pesquisadores"})
 		return
 	}
 
-	pin := r.Header.Get("X-Admin-PIN")
-	if subtle.ConstantTimeCompare([]byte(pin), []byte(h.AdminPIN)) != 1 {
-		writeJSON(w, http.StatusUnauthorized, map[string]any{"success": false, "error": "PIN inválido"})
+	writeJSON(w, http.StatusOK, map[string]any{"success": true, "researchers": researchers})
+}
+
+// AdminUsageHandler lists each client's use of the AI providers at the
+// server's expense on a day (?day=YYYY-MM-DD, today by default).
+type AdminUsageHandler struct {
+	Store    store.Store
+	AdminPIN string
+	Quota    *quota.Limiter
+}
+
+func (h *AdminUsageHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !checkAdmin(w, r, h.AdminPIN) {
 		return
 	}
 
-	researchers, err := h.Store.GetAllResearchersAdmin(r.Context())
+	day := r.URL.Query().Get("day")
+	if day == "" {
+		day = h.Quota.Day()
+	} else if _, err := time.Parse("2006-01-02", day); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"success": false, "error": "dia inválido, use o formato AAAA-MM-DD"})
+		return
+	}
+
+	usage, err := h.Store.ListUsage(r.Context(), day)
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]any{"success": false, "error": "erro ao buscar pesquisadores"})
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"success": false, "error": "erro ao buscar uso"})
 		return
 	}
 
-	writeJSON(w, http.StatusOK, map[string]any{"success": true, "researchers": researchers})
+	var limits quota.Limits
+	if h.Quota != nil {
+		limits = h.Quota.Limits
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"success": true, "day": day, "limits": limits, "usage": usage})
+}
+
+// AdminCallsHandler lists the latest AI calls (?limit=N, 100 by default) with
+// their token usage and estimated cost.
+type AdminCallsHandler struct {
+	Store    store.Store
+	AdminPIN string
+}
+
+func (h *AdminCallsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !checkAdmin(w, r, h.AdminPIN) {
+		return
+	}
+
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 1000 {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"success": false, "error": "limit deve ser um número entre 1 e 1000"})
+			return
+		}
+		limit = n
+	}
+
+	calls, err := h.Store.ListAICalls(r.Context(), limit)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"success": false, "error": "erro ao buscar chamadas"})
+		return
+	}
+
+	var totalCost float64
+	for _, c := range calls {
+		if c.CostUSD != nil {
+			totalCost += *c.CostUSD
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"success": true, "calls": calls, "totalCostUsd": totalCost})
+}
+
+// checkAdmin accepts GET requests carrying the admin PIN in X-Admin-PIN. When
+// it returns false the error response has already been written.
+func checkAdmin(w http.ResponseWriter, r *http.Request, adminPIN string) bool {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"success": false, "error": "método não permitido"})
+		return false
+	}
+
+	if adminPIN == "" {
+		writeJSON(w, http.StatusForbidden, map[string]any{"success": false, "error": "Admin desabilitado"})
+		return false
+	}
+
+	pin := r.Header.Get("X-Admin-PIN")
+	if subtle.ConstantTimeCompare([]byte(pin), []byte(adminPIN)) != 1 {
+		writeJSON(w, http.StatusUnauthorized, map[string]any{"success": false, "error": "PIN inválido"})
+		return false
+	}
+	return true
 }
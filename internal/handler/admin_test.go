@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/edalcin/smartlattes/internal/quota"
+	"github.com/edalcin/smartlattes/internal/store"
+)
+
+func TestAdminResearchers(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		pin     string
+		sent    string
+		failOps []string
+		status  int
+		want    string
+	}{
+		{name: "wrong method", method: http.MethodPost, pin: "1234", sent: "1234", status: http.StatusMethodNotAllowed, want: "método não permitido"},
+		{name: "admin disabled", pin: "", sent: "", status: http.StatusForbidden, want: "Admin desabilitado"},
+		{name: "missing PIN", pin: "1234", sent: "", status: http.StatusUnauthorized, want: "PIN inválido"},
+		{name: "wrong PIN", pin: "1234", sent: "4321", status: http.StatusUnauthorized, want: "PIN inválido"},
+		{name: "store error", pin: "1234", sent: "1234", failOps: []string{"GetAllResearchersAdmin"}, status: http.StatusInternalServerError, want: "erro ao buscar pesquisadores"},
+		{name: "listed", pin: "1234", sent: "1234", status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &AdminResearchersHandler{Store: failing(seedStore(t, "111"), tt.failOps...), AdminPIN: tt.pin}
+			if tt.method == http.MethodPost {
+				checkResponse(t, postJSON(t, h, "/api/admin/researchers", "{}"), tt.status, tt.want)
+				return
+			}
+			checkResponse(t, get(h, "/api/admin/researchers", "X-Admin-PIN", tt.sent), tt.status, tt.want)
+		})
+	}
+}
+
+func TestAdminResearchersList(t *testing.T) {
+	s := seedStore(t, "333", "111", "222")
+	ctx := context.Background()
+	s.UpsertSummary(ctx, "222", "resumo", store.GenerationMetadata{Provider: "fake", Model: "m"})
+	s.UpsertAnalysis(ctx, "333", "análise", store.GenerationMetadata{Provider: "fake", Model: "m"}, 2)
+
+	rec := get(&AdminResearchersHandler{Store: s, AdminPIN: "1234"}, "/api/admin/researchers", "X-Admin-PIN", "1234")
+	body := checkResponse(t, rec, http.StatusOK, "")
+
+	researchers, _ := body["researchers"].([]any)
+	want := []struct {
+		id                    string
+		hasResumo, hasAnalise bool
+	}{
+		{"111", false, false},
+		{"222", true, false},
+		{"333", false, true},
+	}
+	if len(researchers) != len(want) {
+		t.Fatalf("got %d researchers, want %d", len(researchers), len(want))
+	}
+	for i, w := range want {
+		r := researchers[i].(map[string]any)
+		if r["lattesId"] != w.id || r["name"] != "Pesquisador "+w.id || r["hasResumo"] != w.hasResumo || r["hasAnalise"] != w.hasAnalise {
+			t.Errorf("researcher %d = %v, want %+v", i, r, w)
+		}
+	}
+}
+
+func TestAdminUsage(t *testing.T) {
+	s := seedStore(t)
+	ctx := context.Background()
+	s.AddUsage(ctx, "10.0.0.1", "2024-03-15", 2, 900)
+	limiter := &quota.Limiter{Store: s, Limits: quota.Limits{RequestsPerDay: 50}}
+	h := &AdminUsageHandler{Store: s, AdminPIN: "1234", Quota: limiter}
+
+	checkResponse(t, get(h, "/api/admin/usage", "X-Admin-PIN", "0000"), http.StatusUnauthorized, "PIN inválido")
+	checkResponse(t, get(h, "/api/admin/usage?day=15/03/2024", "X-Admin-PIN", "1234"), http.StatusBadRequest, "dia inválido")
+
+	body := checkResponse(t, get(h, "/api/admin/usage?day=2024-03-15", "X-Admin-PIN", "1234"), http.StatusOK, "")
+	usage, _ := body["usage"].([]any)
+	limits, _ := body["limits"].(map[string]any)
+	if len(usage) != 1 || usage[0].(map[string]any)["tokens"] != float64(900) || limits["requestsPerDay"] != float64(50) {
+		t.Errorf("body = %v", body)
+	}
+
+	body = checkResponse(t, get(h, "/api/admin/usage", "X-Admin-PIN", "1234"), http.StatusOK, "")
+	if body["day"] != limiter.Day() || len(body["usage"].([]any)) != 0 {
+		t.Errorf("today's usage = %v", body)
+	}
+}
+
+func TestAdminCalls(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemoryStore()
+	cost := 0.25
+	s.LogAICall(ctx, store.AICall{Kind: store.CallSummary, Model: "a", TokenUsage: store.TokenUsage{CostUSD: &cost}})
+	s.LogAICall(ctx, store.AICall{Kind: store.CallChat, Model: "b"})
+	s.LogAICall(ctx, store.AICall{Kind: store.CallAnalysis, Model: "c", TokenUsage: store.TokenUsage{CostUSD: &cost}})
+	h := &AdminCallsHandler{Store: s, AdminPIN: "1234"}
+
+	checkResponse(t, get(h, "/api/admin/calls?limit=0", "X-Admin-PIN", "1234"), http.StatusBadRequest, "limit deve ser")
+
+	body := checkResponse(t, get(h, "/api/admin/calls?limit=2", "X-Admin-PIN", "1234"), http.StatusOK, "")
+	calls, _ := body["calls"].([]any)
+	if len(calls) != 2 || calls[0].(map[string]any)["model"] != "c" || body["totalCostUsd"] != 0.25 {
+		t.Errorf("body = %v", body)
+	}
+}
@@ -1,18 +1,31 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
+	"fmt"
 	"net/http"
-	"strings"
 
 	"github.com/edalcin/smartlattes/internal/ai"
+	"github.com/edalcin/smartlattes/internal/dedup"
+	"github.com/edalcin/smartlattes/internal/peers"
+	"github.com/edalcin/smartlattes/internal/quota"
 	"github.com/edalcin/smartlattes/internal/store"
 )
 
+// maxAnalysisPeers is how many of the most related researchers are sent in
+// full to a relationship analysis.
+const maxAnalysisPeers = 20
+
 type AnalysisHandler struct {
-	Store  *store.MongoDB
-	Prompt string
+	Store       store.Store
+	Prompt      string
+	NewProvider ProviderFactory
+	Quota       *quota.Limiter
+	Pricing     ai.Pricing
+	// Failover lists the providers tried when the requested one is
+	// unavailable.
+	Failover ai.FailoverChain
 }
 
 func (h *AnalysisHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -28,119 +41,216 @@ func (h *AnalysisHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *AnalysisHandler) handleGenerate(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		LattesID string `json:"lattesId"`
-		Provider string `json:"provider"`
-		APIKey   string `json:"apiKey"`
-		Model    string `json:"model"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.LattesID == "" || req.Provider == "" || req.APIKey == "" || req.Model == "" {
+	var req generationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !req.valid() {
 		writeJSON(w, http.StatusBadRequest, map[string]any{"success": false, "error": "lattesId, provider, apiKey e model são obrigatórios"})
 		return
 	}
 
-	ctx := r.Context()
+	response, err := h.generate(r.Context(), req, h.Quota.Client(r), func(string) {})
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// RunJob generates a relationship analysis for a background job.
+func (h *AnalysisHandler) RunJob(ctx context.Context, job store.Job, apiKey string, progress func(stage string)) (any, error) {
+	req := generationRequest{LattesID: job.LattesID, Provider: job.Provider, APIKey: apiKey, Model: job.Model}
+	return h.generate(ctx, req, job.Client, progress)
+}
+
+// generate produces and saves the relationship analysis of a researcher and
+// returns the response body. Errors are *requestError.
+func (h *AnalysisHandler) generate(ctx context.Context, req generationRequest, client string, progress func(stage string)) (map[string]any, error) {
+	targets, err := h.NewProvider.targets(h.Failover, req.Provider, req.Model, req.APIKey)
+	if err != nil {
+		return nil, err
+	}
 
+	progress("Selecionando os pesquisadores relacionados")
 	cvData, err := h.Store.GetCV(ctx, req.LattesID)
 	if err != nil {
 		if err.Error() == "CV não encontrado" {
-			writeJSON(w, http.StatusNotFound, map[string]any{"success": false, "error": "CV não encontrado para o ID informado"})
-			return
+			return nil, &requestError{http.StatusNotFound, "CV não encontrado para o ID informado"}
 		}
-		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"success": false, "error": "erro ao acessar banco de dados"})
-		return
+		return nil, &requestError{http.StatusServiceUnavailable, "erro ao acessar banco de dados"}
 	}
 
 	count, err := h.Store.CountCVs(ctx)
 	if err != nil {
-		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"success": false, "error": "erro ao acessar banco de dados"})
-		return
+		return nil, &requestError{http.StatusServiceUnavailable, "erro ao acessar banco de dados"}
 	}
 	if count <= 1 {
-		writeJSON(w, http.StatusConflict, map[string]any{"success": false, "error": "Não há outros pesquisadores na base para comparação"})
-		return
+		return nil, &requestError{http.StatusConflict, "Não há outros pesquisadores na base para comparação"}
 	}
 
 	otherCVs, err := h.Store.GetAllCVSummaries(ctx, req.LattesID)
 	if err != nil {
-		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"success": false, "error": "erro ao acessar banco de dados"})
-		return
+		return nil, &requestError{http.StatusServiceUnavailable, "erro ao acessar banco de dados"}
 	}
 
-	userData, wasTruncated := ai.TruncateAnalysisData(cvData, otherCVs, 80000)
-
-	provider, err := ai.NewProvider(req.Provider)
+	researchers, err := h.Store.GetAllPublications(ctx)
 	if err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]any{"success": false, "error": err.Error()})
-		return
+		return nil, &requestError{http.StatusServiceUnavailable, "erro ao acessar banco de dados"}
 	}
-
-	analysis, err := provider.Generate(ctx, ai.GenerateRequest{
-		APIKey:       req.APIKey,
-		Model:        req.Model,
-		SystemPrompt: h.Prompt,
-		UserData:     userData,
-		MaxTokens:    4096,
-	})
+	clusters, err := dedup.Load(ctx, h.Store)
 	if err != nil {
-		if errors.Is(err, ai.ErrInvalidKey) {
-			writeJSON(w, http.StatusUnauthorized, map[string]any{"success": false, "error": "Chave de API inválida ou sem permissão para este provedor"})
-			return
+		return nil, &requestError{http.StatusServiceUnavailable, "erro ao acessar banco de dados"}
+	}
+
+	// Enviar apenas os pesquisadores mais relacionados ao alvo, do mais ao
+	// menos relevante, para que o truncamento descarte primeiro os menos
+	// relevantes
+	ranked := peers.Rank(researchers, clusters, req.LattesID)
+	candidates, selected := selectPeers(otherCVs, ranked, maxAnalysisPeers)
+
+	// Cada provedor da cadeia tem sua própria janela de contexto, então o
+	// truncamento e a reserva de cota são refeitos a cada tentativa
+	var (
+		result     ai.Result
+		usage      store.TokenUsage
+		truncation ai.TruncationReport
+	)
+	used, err := failover(ctx, targets, func(t target) error {
+		if t.name != req.Provider {
+			progress(fmt.Sprintf("Provedor %s indisponível; tentando %s", req.Provider, t.name))
 		}
-		if errors.Is(err, ai.ErrTimeout) {
-			writeJSON(w, http.StatusGatewayTimeout, map[string]any{"success": false, "error": "Tempo limite excedido (120s). Tente um modelo menor ou tente novamente."})
-			return
+		userData, report := ai.TruncateAnalysisData(cvData, candidates, ai.NewBudget(t.provider, t.model, 4096, h.Prompt))
+
+		inputTokens := quota.EstimateTokens(h.Prompt, userData)
+		reservation, err := reserve(ctx, h.Quota, client, t.provider, t.apiKey, inputTokens+4096)
+		if err != nil {
+			return err
 		}
-		if errors.Is(err, ai.ErrRateLimited) {
-			detail := strings.TrimPrefix(err.Error(), ai.ErrRateLimited.Error()+": ")
-			writeJSON(w, 429, map[string]any{"success": false, "error": "Limite de requisições atingido: " + detail})
-			return
+
+		if t.name == req.Provider {
+			progress("Aguardando a resposta do provedor de IA")
 		}
-		if errors.Is(err, ai.ErrProviderUnavailable) {
-			writeJSON(w, http.StatusServiceUnavailable, map[string]any{"success": false, "error": "Provedor de IA indisponível. Tente novamente mais tarde."})
-			return
+		res, err := t.provider.Generate(ctx, ai.GenerateRequest{
+			APIKey:       t.apiKey,
+			Model:        t.model,
+			SystemPrompt: h.Prompt,
+			UserData:     userData,
+			MaxTokens:    4096,
+		})
+		if err != nil {
+			reservation.Settle(ctx, 0)
+			return err
 		}
-		writeJSON(w, http.StatusInternalServerError, map[string]any{"success": false, "error": err.Error()})
-		return
+
+		call := store.AICall{
+			Kind:      store.CallAnalysis,
+			LattesID:  req.LattesID,
+			Client:    client,
+			Provider:  t.name,
+			Model:     t.model,
+			ServerKey: ai.ServedByServer(t.provider, t.apiKey),
+		}
+		result, truncation = res, report
+		usage = recordCall(ctx, h.Store, h.Pricing, reservation, call, res, inputTokens)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	header := buildSummaryHeader(cvData, req.LattesID, req.Provider, req.Model)
-	analysis = header + analysis
+	header := buildSummaryHeader(cvData, req.LattesID, used.name, used.model)
+	analysis := header + result.Text
+
+	// Contar apenas os pesquisadores enviados ao provedor: o truncamento pode
+	// ter descartado os menos relevantes
+	analyzed := len(candidates) - len(truncation.DroppedResearchers)
 
 	// Salvar automaticamente no banco de dados
-	if err := h.Store.UpsertAnalysis(r.Context(), req.LattesID, analysis, req.Provider, req.Model, len(otherCVs)); err != nil {
-		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"success": false, "error": "análise gerada mas erro ao salvar no banco de dados"})
-		return
+	progress("Salvando o resultado")
+	meta := store.GenerationMetadata{
+		Provider:   used.name,
+		Model:      used.model,
+		PromptHash: promptHash(h.Prompt),
+		TokenUsage: usage,
+		Failover:   used.failoverFrom(req.Provider, req.Model),
+	}
+	if err := h.Store.UpsertAnalysis(ctx, req.LattesID, analysis, meta, analyzed); err != nil {
+		return nil, &requestError{http.StatusServiceUnavailable, "análise gerada mas erro ao salvar no banco de dados"}
 	}
 
 	response := map[string]any{
 		"success":             true,
 		"analysis":            analysis,
-		"provider":            req.Provider,
-		"model":               req.Model,
-		"researchersAnalyzed": len(otherCVs),
+		"provider":            used.name,
+		"model":               used.model,
+		"promptHash":          meta.PromptHash,
+		"usage":               usage,
+		"attempts":            result.Attempts,
+		"researchersAnalyzed": analyzed,
+		"researchersInBase":   len(otherCVs),
+		"peers":               selected,
+	}
+	if meta.RequestedProvider != "" {
+		response["failover"] = meta.Failover
 	}
-	if wasTruncated {
+	if truncation.Truncated {
 		response["truncated"] = true
+		response["truncation"] = truncation
 		response["truncationWarning"] = "Os dados dos pesquisadores foram truncados para caber no limite do modelo. Algumas informações podem estar ausentes na análise."
 	}
-	writeJSON(w, http.StatusOK, response)
+	return response, nil
+}
+
+// selectPeers returns the CVs of up to limit researchers in ranking order,
+// along with their ranking entries. CVs missing from the ranking are kept
+// after the ranked ones, in their original order.
+func selectPeers(cvs []map[string]interface{}, ranked []peers.Peer, limit int) ([]map[string]interface{}, []peers.Peer) {
+	byID := make(map[string]map[string]interface{}, len(cvs))
+	for _, cv := range cvs {
+		if id, ok := cv["_id"].(string); ok {
+			byID[id] = cv
+		}
+	}
+
+	var selected []map[string]interface{}
+	var entries []peers.Peer
+	used := make(map[string]bool)
+	for _, p := range ranked {
+		if len(selected) == limit {
+			break
+		}
+		if cv, ok := byID[p.LattesID]; ok && !used[p.LattesID] {
+			used[p.LattesID] = true
+			selected = append(selected, cv)
+			entries = append(entries, p)
+		}
+	}
+	for _, cv := range cvs {
+		if len(selected) == limit {
+			break
+		}
+		if id, _ := cv["_id"].(string); !used[id] {
+			selected = append(selected, cv)
+		}
+	}
+	return selected, entries
 }
 
 func (h *AnalysisHandler) handleSave(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		LattesID            string `json:"lattesId"`
-		Analysis            string `json:"analysis"`
-		Provider            string `json:"provider"`
-		Model               string `json:"model"`
-		ResearchersAnalyzed int    `json:"researchersAnalyzed"`
+		LattesID            string           `json:"lattesId"`
+		Analysis            string           `json:"analysis"`
+		Provider            string           `json:"provider"`
+		Model               string           `json:"model"`
+		PromptHash          string           `json:"promptHash"`
+		ResearchersAnalyzed int              `json:"researchersAnalyzed"`
+		Usage               store.TokenUsage `json:"usage"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.LattesID == "" || req.Analysis == "" || req.Provider == "" || req.Model == "" {
 		writeJSON(w, http.StatusBadRequest, map[string]any{"success": false, "error": "lattesId, analysis, provider e model são obrigatórios"})
 		return
 	}
 
-	if err := h.Store.UpsertAnalysis(r.Context(), req.LattesID, req.Analysis, req.Provider, req.Model, req.ResearchersAnalyzed); err != nil {
+	meta := store.GenerationMetadata{Provider: req.Provider, Model: req.Model, PromptHash: req.PromptHash, TokenUsage: savedUsage(h.Pricing, req.Provider, req.Model, req.Usage)}
+	if err := h.Store.UpsertAnalysis(r.Context(), req.LattesID, req.Analysis, meta, req.ResearchersAnalyzed); err != nil {
 		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"success": false, "error": "erro ao salvar análise"})
 		return
 	}
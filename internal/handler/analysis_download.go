@@ -10,7 +10,7 @@ import (
 )
 
 type AnalysisDownloadHandler struct {
-	Store *store.MongoDB
+	Store store.Store
 }
 
 func (h *AnalysisDownloadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
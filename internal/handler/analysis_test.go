@@ -0,0 +1,173 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestAnalysisGenerate(t *testing.T) {
+	valid := map[string]any{"lattesId": "111", "provider": "fake", "apiKey": "k", "model": "m"}
+	with := func(key string, value any) map[string]any {
+		req := map[string]any{}
+		for k, v := range valid {
+			req[k] = v
+		}
+		req[key] = value
+		return req
+	}
+
+	type testCase struct {
+		name     string
+		ids      []string
+		body     any
+		failOps  []string
+		provider *fakeProvider
+		status   int
+		want     string
+	}
+	tests := []testCase{
+		{name: "invalid JSON", body: "nada", status: http.StatusBadRequest, want: "são obrigatórios"},
+		{name: "missing model", body: with("model", ""), status: http.StatusBadRequest, want: "são obrigatórios"},
+		{name: "unknown CV", body: with("lattesId", "999"), status: http.StatusNotFound, want: "CV não encontrado"},
+		{name: "CV store error", body: valid, failOps: []string{"GetCV"}, status: http.StatusServiceUnavailable, want: "erro ao acessar banco de dados"},
+		{name: "count store error", body: valid, failOps: []string{"CountCVs"}, status: http.StatusServiceUnavailable, want: "erro ao acessar banco de dados"},
+		{name: "only researcher", ids: []string{"111"}, body: valid, status: http.StatusConflict, want: "Não há outros pesquisadores"},
+		{name: "others store error", body: valid, failOps: []string{"GetAllCVSummaries"}, status: http.StatusServiceUnavailable, want: "erro ao acessar banco de dados"},
+		{name: "publications store error", body: valid, failOps: []string{"GetAllPublications"}, status: http.StatusServiceUnavailable, want: "erro ao acessar banco de dados"},
+		{name: "unknown provider", body: with("provider", "outro"), status: http.StatusBadRequest, want: "provedor desconhecido"},
+		{name: "save error", body: valid, failOps: []string{"UpsertAnalysis"}, status: http.StatusServiceUnavailable, want: "análise gerada mas erro ao salvar"},
+	}
+	for _, tc := range aiErrorCases {
+		tests = append(tests, testCase{name: "provider " + tc.name, body: valid, provider: &fakeProvider{Err: tc.err}, status: tc.status, want: tc.want})
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids := tt.ids
+			if ids == nil {
+				ids = []string{"111", "222", "333"}
+			}
+			provider := tt.provider
+			if provider == nil {
+				provider = &fakeProvider{Response: "análise"}
+			}
+			h := &AnalysisHandler{
+				Store:       failing(seedStore(t, ids...), tt.failOps...),
+				Prompt:      "prompt",
+				NewProvider: providers(provider),
+			}
+			checkResponse(t, postJSON(t, h, "/api/analysis", tt.body), tt.status, tt.want)
+		})
+	}
+}
+
+func TestAnalysisGenerateSuccess(t *testing.T) {
+	s := seedStore(t, "111", "222", "333")
+	provider := &fakeProvider{Response: "## Sinergias\n\nColaborar."}
+	h := &AnalysisHandler{Store: s, Prompt: "prompt da análise", NewProvider: providers(provider)}
+
+	rec := postJSON(t, h, "/api/analysis", map[string]any{"lattesId": "222", "provider": "fake", "apiKey": "k", "model": "m"})
+	body := checkResponse(t, rec, http.StatusOK, "")
+
+	analysis, _ := body["analysis"].(string)
+	if !strings.HasPrefix(analysis, "# Pesquisador 222\n") || !strings.HasSuffix(analysis, "Colaborar.") {
+		t.Errorf("analysis = %q", analysis)
+	}
+	if body["researchersAnalyzed"] != float64(2) {
+		t.Errorf("researchersAnalyzed = %v, want 2", body["researchersAnalyzed"])
+	}
+	if ranked, _ := body["peers"].([]any); len(ranked) != 2 || body["researchersInBase"] != float64(2) {
+		t.Errorf("peers = %v, researchersInBase = %v", body["peers"], body["researchersInBase"])
+	}
+	for _, name := range []string{"Pesquisador 111", "Pesquisador 222", "Pesquisador 333"} {
+		if !strings.Contains(provider.generated.UserData, name) {
+			t.Errorf("data sent to the provider lacks %s", name)
+		}
+	}
+
+	doc, err := s.GetAnalysis(context.Background(), "222")
+	if err != nil || doc.Analise != analysis || doc.Metadata.ResearchersAnalyzed != 2 {
+		t.Fatalf("stored analysis = %+v, %v", doc, err)
+	}
+}
+
+// smallWindowProvider is a fakeProvider for a model with a tiny context
+// window, so the analysis data is truncated.
+type smallWindowProvider struct {
+	*fakeProvider
+}
+
+func (p smallWindowProvider) ContextWindow(model string) int { return 1 }
+
+func TestAnalysisGenerateTruncated(t *testing.T) {
+	ids := []string{"100"}
+	for i := 101; i <= 120; i++ {
+		ids = append(ids, strconv.Itoa(i))
+	}
+	s := seedStore(t, ids...)
+	provider := &fakeProvider{Response: "Análise."}
+	h := &AnalysisHandler{Store: s, Prompt: "prompt da análise", NewProvider: providers(smallWindowProvider{provider})}
+
+	rec := postJSON(t, h, "/api/analysis", map[string]any{"lattesId": "100", "provider": "fake", "apiKey": "k", "model": "m"})
+	body := checkResponse(t, rec, http.StatusOK, "")
+
+	truncation, _ := body["truncation"].(map[string]any)
+	dropped, _ := truncation["droppedResearchers"].([]any)
+	if len(dropped) == 0 {
+		t.Fatalf("no researcher dropped: %v", body["truncation"])
+	}
+	want := 20 - len(dropped)
+	if body["researchersAnalyzed"] != float64(want) {
+		t.Errorf("researchersAnalyzed = %v, want %d", body["researchersAnalyzed"], want)
+	}
+	for _, name := range dropped {
+		if strings.Contains(provider.generated.UserData, `"`+name.(string)+`"`) {
+			t.Errorf("dropped researcher %s was sent", name)
+		}
+	}
+
+	doc, err := s.GetAnalysis(context.Background(), "100")
+	if err != nil || doc.Metadata.ResearchersAnalyzed != want {
+		t.Fatalf("stored analysis = %+v, %v", doc, err)
+	}
+}
+
+func TestAnalysisSave(t *testing.T) {
+	valid := map[string]any{"lattesId": "111", "analysis": "texto", "provider": "fake", "model": "m", "researchersAnalyzed": 4}
+
+	tests := []struct {
+		name    string
+		body    any
+		failOps []string
+		status  int
+		want    string
+	}{
+		{name: "invalid JSON", body: "{", status: http.StatusBadRequest, want: "são obrigatórios"},
+		{name: "missing analysis", body: map[string]any{"lattesId": "111", "provider": "fake", "model": "m"}, status: http.StatusBadRequest, want: "são obrigatórios"},
+		{name: "store error", body: valid, failOps: []string{"UpsertAnalysis"}, status: http.StatusServiceUnavailable, want: "erro ao salvar análise"},
+		{name: "saved", body: valid, status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := seedStore(t, "111")
+			h := &AnalysisHandler{Store: failing(s, tt.failOps...)}
+			checkResponse(t, postJSON(t, h, "/api/analysis/save", tt.body), tt.status, tt.want)
+
+			if tt.status == http.StatusOK {
+				doc, err := s.GetAnalysis(context.Background(), "111")
+				if err != nil || doc.Analise != "texto" || doc.Metadata.ResearchersAnalyzed != 4 {
+					t.Fatalf("stored analysis = %+v, %v", doc, err)
+				}
+			}
+		})
+	}
+}
+
+func TestAnalysisMethodNotAllowed(t *testing.T) {
+	h := &AnalysisHandler{Store: seedStore(t)}
+	checkResponse(t, get(h, "/api/analysis"), http.StatusMethodNotAllowed, "método não permitido")
+}
@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// zipMagic opens every ZIP local file header, including the .zip the Lattes
+// platform delivers.
+var zipMagic = []byte("PK\x03\x04")
+
+// maxArchiveEntries bounds how many entries are read from one archive.
+const maxArchiveEntries = 2000
+
+var (
+	errInvalidArchive  = errors.New("arquivo ZIP inválido")
+	errArchiveTooLarge = errors.New("o conteúdo descompactado do arquivo ZIP excede o limite permitido")
+	errTooManyEntries  = errors.New("o arquivo ZIP contém arquivos demais")
+	errNoXML           = errors.New("o arquivo ZIP não contém arquivos XML")
+	errMultipleXML     = errors.New("o arquivo ZIP contém mais de um currículo; use o envio em lote")
+)
+
+func isZip(data []byte) bool {
+	return bytes.HasPrefix(data, zipMagic)
+}
+
+// archiveFile is one XML file found in an archive. Err is set when this entry
+// alone could not be read; the other entries are still usable.
+type archiveFile struct {
+	Name string
+	Data []byte
+	Err  error
+}
+
+// extractXML returns the .xml files of a ZIP archive, descending one level
+// into ZIP files stored inside it (a folder of Lattes downloads zipped
+// together). Each entry is limited to maxFileSize once decompressed and the
+// whole archive to maxTotalSize, counting the bytes actually inflated rather
+// than the sizes declared in the headers, so a zip bomb is rejected before it
+// is expanded in memory.
+func extractXML(data []byte, maxFileSize, maxTotalSize int64) ([]archiveFile, error) {
+	budget := maxTotalSize
+	return extractXMLLevel(data, "", maxFileSize, &budget, 1)
+}
+
+func extractXMLLevel(data []byte, prefix string, maxFileSize int64, budget *int64, depth int) ([]archiveFile, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, errInvalidArchive
+	}
+	if len(zr.File) > maxArchiveEntries {
+		return nil, errTooManyEntries
+	}
+
+	var files []archiveFile
+	for _, f := range zr.File {
+		name := f.Name
+		base := path.Base(name)
+		if f.FileInfo().IsDir() || strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(base, ".") {
+			continue
+		}
+		ext := strings.ToLower(path.Ext(base))
+		if ext != ".xml" && (ext != ".zip" || depth == 0) {
+			continue
+		}
+
+		content, err := readEntry(f, maxFileSize, budget)
+		if err == errArchiveTooLarge {
+			return nil, err
+		}
+		if err != nil {
+			files = append(files, archiveFile{Name: prefix + name, Err: err})
+			continue
+		}
+
+		if ext == ".zip" {
+			inner, err := extractXMLLevel(content, prefix+name+"/", maxFileSize, budget, depth-1)
+			if err == errArchiveTooLarge {
+				return nil, err
+			}
+			if err != nil {
+				files = append(files, archiveFile{Name: prefix + name, Err: err})
+				continue
+			}
+			files = append(files, inner...)
+			continue
+		}
+		files = append(files, archiveFile{Name: prefix + name, Data: content})
+	}
+	return files, nil
+}
+
+// readEntry inflates one entry, charging the bytes read against the shared
+// budget.
+func readEntry(f *zip.File, maxFileSize int64, budget *int64) ([]byte, error) {
+	if f.UncompressedSize64 > uint64(maxFileSize) {
+		return nil, fmt.Errorf("arquivo excede o tamanho máximo permitido de %s", formatSize(maxFileSize))
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, errInvalidArchive
+	}
+	defer rc.Close()
+
+	limit := maxFileSize
+	if *budget < limit {
+		limit = *budget
+	}
+	content, err := io.ReadAll(io.LimitReader(rc, limit+1))
+	if err != nil {
+		return nil, errInvalidArchive
+	}
+	if int64(len(content)) > limit {
+		if limit == maxFileSize {
+			return nil, fmt.Errorf("arquivo excede o tamanho máximo permitido de %s", formatSize(maxFileSize))
+		}
+		return nil, errArchiveTooLarge
+	}
+	*budget -= int64(len(content))
+	return content, nil
+}
+
+// formatSize renders a byte count in whole megabytes, as shown to the user.
+func formatSize(n int64) string {
+	return fmt.Sprintf("%dMB", n/(1<<20))
+}
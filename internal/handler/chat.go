@@ -1,18 +1,66 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/edalcin/smartlattes/internal/ai"
+	"github.com/edalcin/smartlattes/internal/chattools"
+	"github.com/edalcin/smartlattes/internal/dedup"
+	"github.com/edalcin/smartlattes/internal/quota"
 	"github.com/edalcin/smartlattes/internal/store"
 )
 
+// maxRetrievedCVs is how many researchers the retrieval step injects into the
+// chat prompt for a question.
+const maxRetrievedCVs = 15
+
 type ChatHandler struct {
-	Store  *store.MongoDB
-	Prompt string
+	Store       store.Store
+	Prompt      string
+	NewProvider ProviderFactory
+	Quota       *quota.Limiter
+	Pricing     ai.Pricing
+	// Failover lists the providers tried when the requested one is
+	// unavailable.
+	Failover ai.FailoverChain
+	// ToolsPrompt, when set, is the system prompt for providers that support
+	// tools: instead of receiving the researchers' data in the prompt, the
+	// model queries the base through the tools of package chattools.
+	ToolsPrompt string
+}
+
+// chatCall is a validated chat request. use prepares it for one of its
+// targets, filling the fields below targets.
+type chatCall struct {
+	targets  []target
+	client   string
+	messages []ai.ChatMessage
+	selected []map[string]interface{}
+	// total and publications are the number of researchers and distinct
+	// publications in the base.
+	total, publications int
+	// session is the stored conversation the request continues, if any, and
+	// asked the messages the request added to it.
+	session *store.ChatSession
+	asked   []ai.ChatMessage
+
+	provider    ai.AIProvider
+	req         ai.ChatRequest
+	reservation *quota.Reservation
+	entry       store.AICall
+	// truncation tells what was cut from the researchers' data to fit the
+	// model's context.
+	truncation ai.TruncationReport
+	// tools runs the tool calls of the model; nil when the researchers' data
+	// goes in the prompt.
+	tools *chattools.Executor
 }
 
 func (h *ChatHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -21,78 +69,435 @@ func (h *ChatHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if r.URL.Path == "/api/chat/stream" {
+		h.handleStream(w, r)
+		return
+	}
+	h.handleChat(w, r)
+}
+
+func (h *ChatHandler) handleChat(w http.ResponseWriter, r *http.Request) {
+	call, ok := h.prepare(w, r)
+	if !ok {
+		return
+	}
+
+	var (
+		result ai.Result
+		calls  []ai.ToolCall
+	)
+	used, err := failover(r.Context(), call.targets, func(t target) error {
+		if err := h.use(r.Context(), call, t); err != nil {
+			return err
+		}
+		calls = nil
+		res, err := h.converse(r.Context(), call, func(c ai.ToolCall) error {
+			calls = append(calls, c)
+			return nil
+		})
+		if err != nil {
+			call.reservation.Settle(r.Context(), spentTokens(res))
+			return err
+		}
+		result = res
+		return nil
+	})
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+	usage := recordCall(r.Context(), h.Store, h.Pricing, call.reservation, call.entry, result, promptTokens(call.req))
+
+	response := map[string]any{
+		"success":  true,
+		"response": result.Text,
+		"usage":    usage,
+		"attempts": result.Attempts,
+	}
+	if len(calls) > 0 {
+		response["toolCalls"] = calls
+	}
+	call.reportFailover(response, used)
+	if call.truncation.Truncated {
+		response["truncation"] = call.truncation
+	}
+	h.saveTurn(r.Context(), call, used, result.Text, usage, response)
+	writeJSON(w, http.StatusOK, response)
+}
+
+// handleStream relays the provider's answer as Server-Sent Events. Errors that
+// happen before the first token are answered with the usual JSON error body so
+// the client can tell them apart from a stream that broke midway.
+func (h *ChatHandler) handleStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"success": false, "error": "streaming não suportado pelo servidor"})
+		return
+	}
+
+	call, ok := h.prepare(w, r)
+	if !ok {
+		return
+	}
+
+	started := false
+	var streamed strings.Builder
+	start := func() {
+		if started {
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		started = true
+	}
+
+	var (
+		result    ai.Result
+		streamErr error
+	)
+	used, err := failover(r.Context(), call.targets, func(t target) error {
+		if err := h.use(r.Context(), call, t); err != nil {
+			return err
+		}
+		onDelta := func(delta string) error {
+			start()
+			streamed.WriteString(delta)
+			if err := writeSSE(w, "delta", map[string]any{"text": delta}); err != nil {
+				return err
+			}
+			flusher.Flush()
+			return r.Context().Err()
+		}
+		var (
+			res ai.Result
+			err error
+		)
+		if call.tools != nil {
+			// As ferramentas só são oferecidas fora do streaming: cada
+			// consulta à base é relatada como evento e a resposta final é
+			// enviada de uma vez
+			res, err = h.converse(r.Context(), call, func(c ai.ToolCall) error {
+				start()
+				if err := writeSSE(w, "tool", c); err != nil {
+					return err
+				}
+				flusher.Flush()
+				return r.Context().Err()
+			})
+			if err == nil {
+				err = onDelta(res.Text)
+			}
+		} else {
+			res, err = call.provider.ChatStream(r.Context(), call.req, onDelta)
+		}
+		if err != nil && started {
+			// Parte da resposta já foi enviada, então não há como passar
+			// a outro provedor
+			streamErr = err
+			return nil
+		}
+		if err != nil {
+			call.reservation.Settle(r.Context(), spentTokens(res))
+			return err
+		}
+		result = res
+		return nil
+	})
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+	if streamErr != nil {
+		call.reservation.Settle(r.Context(), promptTokens(call.req)+quota.EstimateTokens(streamed.String()))
+		_, message := aiErrorResponse(streamErr)
+		writeSSE(w, "error", map[string]any{"success": false, "error": message})
+		flusher.Flush()
+		return
+	}
+
+	usage := recordCall(r.Context(), h.Store, h.Pricing, call.reservation, call.entry, result, promptTokens(call.req))
+
+	done := map[string]any{"success": true, "response": result.Text, "usage": usage, "attempts": result.Attempts}
+	call.reportFailover(done, used)
+	if call.truncation.Truncated {
+		done["truncation"] = call.truncation
+	}
+	h.saveTurn(r.Context(), call, used, result.Text, usage, done)
+	start()
+	writeSSE(w, "done", done)
+	flusher.Flush()
+}
+
+// prepare validates the chat request and loads the researchers' data. When it
+// returns ok=false the error response has already been written.
+func (h *ChatHandler) prepare(w http.ResponseWriter, r *http.Request) (*chatCall, bool) {
 	var req struct {
 		Provider string           `json:"provider"`
 		APIKey   string           `json:"apiKey"`
 		Model    string           `json:"model"`
 		Messages []ai.ChatMessage `json:"messages"`
+		// SessionID continues a stored conversation, whose history is
+		// loaded from the store; Messages then brings only the new question.
+		SessionID string `json:"sessionId"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Provider == "" || req.APIKey == "" || req.Model == "" || len(req.Messages) == 0 {
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Provider == "" || req.Model == "" || len(req.Messages) == 0 {
 		writeJSON(w, http.StatusBadRequest, map[string]any{"success": false, "error": "provider, apiKey, model e messages são obrigatórios"})
-		return
+		return nil, false
 	}
 
-	ctx := r.Context()
+	targets, err := h.NewProvider.targets(h.Failover, req.Provider, req.Model, req.APIKey)
+	if err != nil {
+		writeRequestError(w, err)
+		return nil, false
+	}
 
-	cvs, err := h.Store.GetAllCVsForChat(ctx)
+	// Chamadas de ferramentas só existem dentro de uma requisição; o
+	// navegador envia apenas perguntas e respostas
+	asked := make([]ai.ChatMessage, 0, len(req.Messages))
+	for _, m := range req.Messages {
+		if m.Role == "tool" {
+			continue
+		}
+		asked = append(asked, ai.ChatMessage{Role: m.Role, Content: m.Content})
+	}
+	if len(asked) == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"success": false, "error": "provider, apiKey, model e messages são obrigatórios"})
+		return nil, false
+	}
+	req.Messages = asked
+
+	history := req.Messages
+	var session *store.ChatSession
+	if req.SessionID != "" {
+		session, err = ownedSession(h.Store, r, req.SessionID)
+		if err != nil {
+			writeRequestError(w, err)
+			return nil, false
+		}
+		if len(session.Messages)+len(req.Messages) >= maxSessionMessages {
+			writeJSON(w, http.StatusConflict, map[string]any{"success": false, "error": "Esta conversa atingiu o limite de mensagens. Inicie uma nova conversa."})
+			return nil, false
+		}
+		history = make([]ai.ChatMessage, 0, len(session.Messages)+len(req.Messages))
+		for _, m := range session.Messages {
+			history = append(history, ai.ChatMessage{Role: m.Role, Content: m.Content})
+		}
+		history = append(history, req.Messages...)
+	}
+
+	// Limitar histórico de mensagens para evitar exceder limites de tokens
+	messages := history
+	if len(messages) > 20 {
+		messages = messages[len(messages)-20:]
+	}
+
+	call := &chatCall{
+		targets:  targets,
+		client:   h.Quota.Client(r),
+		messages: messages,
+		session:  session,
+		asked:    req.Messages,
+	}
+	if h.agentOnly(targets) {
+		// Os dados ficam no banco e o modelo os consulta por ferramentas
+		total, err := h.Store.CountCVs(r.Context())
+		if err != nil {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]any{"success": false, "error": "erro ao acessar banco de dados"})
+			return nil, false
+		}
+		if total == 0 {
+			writeJSON(w, http.StatusConflict, map[string]any{"success": false, "error": "Não há currículos na base de dados. Envie pelo menos um CV antes de usar o chat."})
+			return nil, false
+		}
+		call.total = int(total)
+		return call, true
+	}
+
+	cvs, err := h.Store.GetAllCVsForChat(r.Context())
 	if err != nil {
 		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"success": false, "error": "erro ao acessar banco de dados"})
-		return
+		return nil, false
 	}
 
 	if len(cvs) == 0 {
 		writeJSON(w, http.StatusConflict, map[string]any{"success": false, "error": "Não há currículos na base de dados. Envie pelo menos um CV antes de usar o chat."})
-		return
+		return nil, false
 	}
 
-	// Truncar dados para caber no limite de tokens
-	cvData, _ := ai.TruncateChatData(cvs, 80000)
+	// Total de publicações distintas da base, contando uma única vez as obras
+	// presentes em mais de um currículo, como salvo no último envio de CV
+	pubStats, err := dedup.LoadStats(r.Context(), h.Store)
+	if err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"success": false, "error": "erro ao acessar banco de dados"})
+		return nil, false
+	}
 
-	systemPrompt := strings.Replace(h.Prompt, "{{DATA}}", cvData, 1)
+	// Selecionar apenas os currículos relevantes para a pergunta atual; perguntas
+	// gerais (sem termos que casem com a base) recebem a base inteira.
+	selected := ai.SelectRelevantCVs(cvs, ai.RetrievalQuery(history), maxRetrievedCVs)
+	if len(selected) == 0 {
+		selected = cvs
+	}
+
+	call.selected = selected
+	call.total = len(cvs)
+	call.publications = pubStats.Unique
+	return call, true
+}
+
+// use builds the request of call for t and reserves its quota. Errors are
+// *requestError.
+func (h *ChatHandler) use(ctx context.Context, call *chatCall, t target) error {
+	var (
+		chatReq    ai.ChatRequest
+		truncation ai.TruncationReport
+		tools      *chattools.Executor
+	)
+	if h.agent(t) {
+		chatReq, tools = h.toolsRequest(call, t)
+	} else {
+		// Truncar dados para caber na janela de contexto do modelo,
+		// descontados o prompt e o histórico
+		prompt := []string{h.Prompt}
+		for _, m := range call.messages {
+			prompt = append(prompt, m.Content)
+		}
+		var cvData string
+		cvData, truncation = ai.TruncateChatData(call.selected, ai.NewBudget(t.provider, t.model, 4096, prompt...))
+
+		// As instruções e os currículos, em ordem canônica, ficam em blocos
+		// que o provedor pode manter em cache; só as contagens da pergunta
+		// vão depois deles
+		fill := strings.NewReplacer(
+			"{{TOTAL}}", strconv.Itoa(call.total),
+			"{{SELECTED}}", strconv.Itoa(len(call.selected)),
+			"{{PUBLICATIONS}}", strconv.Itoa(call.publications),
+			"{{DATA}}", cvData,
+		)
+		instructions, data, perQuestion := splitPrompt(h.Prompt)
 
-	provider, err := ai.NewProvider(req.Provider)
+		chatReq = ai.ChatRequest{
+			APIKey:        t.apiKey,
+			Model:         t.model,
+			SystemPrompt:  fill.Replace(instructions),
+			SystemData:    fill.Replace(data),
+			SystemContext: fill.Replace(perQuestion),
+			Messages:      call.messages,
+			MaxTokens:     4096,
+		}
+	}
+	reservation, err := reserve(ctx, h.Quota, call.client, t.provider, t.apiKey, promptTokens(chatReq)+4096)
 	if err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]any{"success": false, "error": err.Error()})
-		return
+		return err
+	}
+	call.provider, call.req, call.reservation, call.truncation, call.tools = t.provider, chatReq, reservation, truncation, tools
+	call.entry = store.AICall{
+		Kind:      store.CallChat,
+		Client:    call.client,
+		Provider:  t.name,
+		Model:     t.model,
+		ServerKey: ai.ServedByServer(t.provider, t.apiKey),
 	}
+	return nil
+}
 
-	// Limitar histórico de mensagens para evitar exceder limites de tokens
-	messages := req.Messages
-	if len(messages) > 20 {
-		messages = messages[len(messages)-20:]
+// reportFailover tells in response which provider answered when it was not
+// the requested one.
+func (c *chatCall) reportFailover(response map[string]any, used target) {
+	if f := used.failoverFrom(c.targets[0].name, c.targets[0].model); f.RequestedProvider != "" {
+		response["provider"] = used.name
+		response["model"] = used.model
+		response["failover"] = f
 	}
+}
 
-	response, err := provider.Chat(ctx, ai.ChatRequest{
-		APIKey:       req.APIKey,
-		Model:        req.Model,
-		SystemPrompt: systemPrompt,
-		Messages:     messages,
-		MaxTokens:    4096,
-	})
-	if err != nil {
-		if errors.Is(err, ai.ErrInvalidKey) {
-			writeJSON(w, http.StatusUnauthorized, map[string]any{"success": false, "error": "Chave de API inválida ou sem permissão para este provedor"})
-			return
-		}
-		if errors.Is(err, ai.ErrTimeout) {
-			writeJSON(w, http.StatusGatewayTimeout, map[string]any{"success": false, "error": "Tempo limite excedido (120s). Tente um modelo menor ou tente novamente."})
-			return
+// saveTurn appends the new messages of call and the answer to its stored
+// conversation, when it continues one, and reports the session in response.
+// The answer has already been paid for, so a failed save only adds a warning.
+func (h *ChatHandler) saveTurn(ctx context.Context, call *chatCall, used target, answer string, usage store.TokenUsage, response map[string]any) {
+	s := call.session
+	if s == nil {
+		return
+	}
+	now := time.Now()
+	for _, m := range call.asked {
+		if s.Title == "" && m.Role == "user" {
+			s.Title = sessionTitle(m.Content)
 		}
-		if errors.Is(err, ai.ErrRateLimited) {
-			detail := strings.TrimPrefix(err.Error(), ai.ErrRateLimited.Error()+": ")
-			writeJSON(w, 429, map[string]any{"success": false, "error": "Limite de requisições atingido: " + detail})
-			return
+		s.Messages = append(s.Messages, store.ChatRecord{Role: m.Role, Content: m.Content, At: now})
+	}
+	s.Messages = append(s.Messages, store.ChatRecord{
+		Role:     "assistant",
+		Content:  answer,
+		At:       now,
+		Provider: used.name,
+		Model:    used.model,
+		Usage:    &usage,
+	})
+	s.Provider, s.Model = call.targets[0].name, call.targets[0].model
+	s.UpdatedAt = now
+
+	response["sessionId"] = s.ID
+	if err := h.Store.SaveChatSession(ctx, *s); err != nil {
+		log.Printf("Erro ao salvar conversa %s: %v", s.ID, err)
+		response["sessionWarning"] = "A resposta foi gerada, mas não pôde ser salva na conversa."
+	}
+}
+
+// splitPrompt splits the chat prompt template into the instructions, the
+// block with the researchers' data, from the line where {{SELECTED}} or
+// {{DATA}} first appears (or the code fence opening it), and the counts of
+// the question, from the line with a {{SELECTED}} that follows {{DATA}}.
+func splitPrompt(template string) (instructions, data, perQuestion string) {
+	cut := len(template)
+	for _, placeholder := range []string{"{{SELECTED}}", "{{DATA}}"} {
+		if i := strings.Index(template, placeholder); i >= 0 && i < cut {
+			cut = i
 		}
-		if errors.Is(err, ai.ErrProviderUnavailable) {
-			writeJSON(w, http.StatusServiceUnavailable, map[string]any{"success": false, "error": "Provedor de IA indisponível. Tente novamente mais tarde."})
-			return
+	}
+	if cut == len(template) {
+		return template, "", ""
+	}
+	cut = lineStart(template, cut)
+	if prev := lineStart(template, max(cut-1, 0)); strings.HasPrefix(template[prev:], "```") {
+		cut = prev
+	}
+	instructions, rest := strings.TrimRight(template[:cut], "\n"), template[cut:]
+
+	dataAt := strings.Index(rest, "{{DATA}}")
+	if i := strings.Index(rest[max(dataAt, 0):], "{{SELECTED}}"); dataAt >= 0 && i >= 0 {
+		cut = lineStart(rest, dataAt+i)
+		return instructions, strings.TrimRight(rest[:cut], "\n"), rest[cut:]
+	}
+	return instructions, rest, ""
+}
+
+// lineStart returns the index where the line holding s[i] begins.
+func lineStart(s string, i int) int {
+	return strings.LastIndex(s[:i], "\n") + 1
+}
+
+// promptTokens estimates the tokens of everything sent in req.
+func promptTokens(req ai.ChatRequest) int64 {
+	texts := []string{req.SystemPrompt, req.SystemData, req.SystemContext}
+	for _, m := range req.Messages {
+		texts = append(texts, m.Content)
+		for _, c := range m.ToolCalls {
+			texts = append(texts, string(c.Arguments))
 		}
-		writeJSON(w, http.StatusInternalServerError, map[string]any{"success": false, "error": err.Error()})
-		return
 	}
+	return quota.EstimateTokens(texts...)
+}
 
-	writeJSON(w, http.StatusOK, map[string]any{
-		"success":  true,
-		"response": response,
-	})
+// writeSSE writes a single Server-Sent Event with a JSON payload.
+func writeSSE(w http.ResponseWriter, event string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+	return err
 }
@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/edalcin/smartlattes/internal/ai"
+	"github.com/edalcin/smartlattes/internal/chattools"
+)
+
+// maxToolRounds is how many times the model may call tools before answering
+// a question.
+const maxToolRounds = 8
+
+// agent reports whether the chat through t queries the base with tools.
+func (h *ChatHandler) agent(t target) bool {
+	return h.ToolsPrompt != "" && ai.SupportsTools(t.provider)
+}
+
+// agentOnly reports whether every target queries the base with tools, so the
+// researchers' data need not be loaded for the prompt.
+func (h *ChatHandler) agentOnly(targets []target) bool {
+	for _, t := range targets {
+		if !h.agent(t) {
+			return false
+		}
+	}
+	return true
+}
+
+// toolsRequest builds the request of call for t in agent mode, with the
+// executor of its tools. The results of all tool calls of the question share
+// the room left in the model's context.
+func (h *ChatHandler) toolsRequest(call *chatCall, t target) (ai.ChatRequest, *chattools.Executor) {
+	systemPrompt := strings.Replace(h.ToolsPrompt, "{{TOTAL}}", strconv.Itoa(call.total), 1)
+	prompt := []string{systemPrompt}
+	for _, m := range call.messages {
+		prompt = append(prompt, m.Content)
+	}
+	budget := ai.NewBudget(t.provider, t.model, 4096, prompt...)
+
+	req := ai.ChatRequest{
+		APIKey:       t.apiKey,
+		Model:        t.model,
+		SystemPrompt: systemPrompt,
+		Messages:     call.messages,
+		MaxTokens:    4096,
+		Tools:        chattools.Definitions(),
+	}
+	return req, &chattools.Executor{Store: h.Store, Budget: budget}
+}
+
+// converse sends the request of call and, in agent mode, runs the tools the
+// model calls, reporting each to onCall, and sends back their results until
+// the model answers. Every round after the first is counted against the quota
+// reserved for call before it is sent. The result adds up the usage and
+// attempts of every round, also when an error ends the conversation.
+func (h *ChatHandler) converse(ctx context.Context, call *chatCall, onCall func(ai.ToolCall) error) (ai.Result, error) {
+	if call.tools == nil {
+		return call.provider.Chat(ctx, call.req)
+	}
+
+	req := call.req
+	req.Messages = slices.Clone(req.Messages)
+	var total ai.Result
+	for round := range maxToolRounds {
+		if round > 0 {
+			if err := extend(ctx, call.reservation, promptTokens(req)+int64(req.MaxTokens)); err != nil {
+				return total, err
+			}
+		}
+		res, err := call.provider.Chat(ctx, req)
+		total.Usage.InputTokens += res.Usage.InputTokens
+		total.Usage.OutputTokens += res.Usage.OutputTokens
+		total.Usage.CacheReadTokens += res.Usage.CacheReadTokens
+		total.Usage.CacheWriteTokens += res.Usage.CacheWriteTokens
+		total.Attempts += res.Attempts
+		if err != nil {
+			return total, err
+		}
+		total.Text, total.FinishReason = res.Text, res.FinishReason
+		if len(res.ToolCalls) == 0 {
+			return total, nil
+		}
+
+		req.Messages = append(req.Messages, ai.ChatMessage{Role: "assistant", Content: res.Text, ToolCalls: res.ToolCalls})
+		for _, c := range res.ToolCalls {
+			reported := c
+			if !json.Valid(c.Arguments) {
+				reported.Arguments = nil
+			}
+			if err := onCall(reported); err != nil {
+				return total, err
+			}
+			req.Messages = append(req.Messages, ai.ChatMessage{Role: "tool", ToolCallID: c.ID, Content: call.tools.Run(ctx, c)})
+		}
+	}
+	return total, &requestError{http.StatusBadGateway, "O modelo consultou a base muitas vezes sem chegar a uma resposta. Tente reformular a pergunta."}
+}
+
+// spentTokens is what the rounds in res consumed, for settling the quota of
+// a chat that failed midway.
+func spentTokens(res ai.Result) int64 {
+	return int64(res.Usage.InputTokens + res.Usage.OutputTokens)
+}
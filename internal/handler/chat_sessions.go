@@ -0,0 +1,255 @@
+package handler
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/edalcin/smartlattes/internal/store"
+)
+
+// chatOwnerCookie holds the random token that identifies the browser owning
+// chat sessions. The store keeps only its hash.
+const chatOwnerCookie = "smartlattes_chat"
+
+// maxSessionMessages caps how long a stored conversation may grow.
+const maxSessionMessages = 200
+
+// chatOwner returns the owner of the sessions of the browser making r, or ""
+// when it never created one.
+func chatOwner(r *http.Request) string {
+	c, err := r.Cookie(chatOwnerCookie)
+	if err != nil || c.Value == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(c.Value))
+	return hex.EncodeToString(sum[:])
+}
+
+// ensureChatOwner is chatOwner for requests that create a session: a browser
+// without a token receives a new one.
+func ensureChatOwner(w http.ResponseWriter, r *http.Request) (string, error) {
+	if owner := chatOwner(r); owner != "" {
+		return owner, nil
+	}
+	token, err := randomID()
+	if err != nil {
+		return "", err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     chatOwnerCookie,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   365 * 24 * 60 * 60,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	r.AddCookie(&http.Cookie{Name: chatOwnerCookie, Value: token})
+	return chatOwner(r), nil
+}
+
+func randomID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// ownedSession loads the session id if the browser making r owns it. Errors
+// are *requestError; sessions of other browsers are reported as missing.
+func ownedSession(s store.Store, r *http.Request, id string) (*store.ChatSession, error) {
+	session, err := s.GetChatSession(r.Context(), id)
+	if err != nil {
+		if err.Error() == "conversa não encontrada" {
+			return nil, &requestError{http.StatusNotFound, "conversa não encontrada"}
+		}
+		return nil, &requestError{http.StatusServiceUnavailable, "erro ao acessar banco de dados"}
+	}
+	if owner := chatOwner(r); owner == "" || session.Owner != owner {
+		return nil, &requestError{http.StatusNotFound, "conversa não encontrada"}
+	}
+	return session, nil
+}
+
+// sessionTitle names a conversation after its first question.
+func sessionTitle(question string) string {
+	title := strings.Join(strings.Fields(question), " ")
+	if runes := []rune(title); len(runes) > 80 {
+		title = string(runes[:77]) + "..."
+	}
+	return title
+}
+
+// ChatSessionsHandler manages the chatLattes conversations of the browser
+// making the request: POST /api/chat/sessions creates one, GET lists them,
+// GET and DELETE /api/chat/sessions/{id} resume and remove one, and POST
+// /api/chat/sessions/{id}/share turns its read-only link on or off.
+type ChatSessionsHandler struct {
+	Store store.Store
+}
+
+func (h *ChatSessionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/chat/sessions"), "/")
+	id, action, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+
+	switch {
+	case id == "" && r.Method == http.MethodPost:
+		h.handleCreate(w, r)
+	case id == "" && r.Method == http.MethodGet:
+		h.handleList(w, r)
+	case id != "" && action == "" && r.Method == http.MethodGet:
+		h.handleGet(w, r, id)
+	case id != "" && action == "" && r.Method == http.MethodDelete:
+		h.handleDelete(w, r, id)
+	case id != "" && action == "share" && r.Method == http.MethodPost:
+		h.handleShare(w, r, id)
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"success": false, "error": "método não permitido"})
+	}
+}
+
+func (h *ChatSessionsHandler) handleCreate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Provider string `json:"provider"`
+		Model    string `json:"model"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Provider == "" || req.Model == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"success": false, "error": "provider e model são obrigatórios"})
+		return
+	}
+
+	owner, err := ensureChatOwner(w, r)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"success": false, "error": "erro ao criar conversa"})
+		return
+	}
+	id, err := randomID()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"success": false, "error": "erro ao criar conversa"})
+		return
+	}
+	now := time.Now()
+	session := store.ChatSession{
+		ID:        id,
+		Owner:     owner,
+		Provider:  req.Provider,
+		Model:     req.Model,
+		Messages:  []store.ChatRecord{},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := h.Store.SaveChatSession(r.Context(), session); err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"success": false, "error": "erro ao salvar conversa"})
+		return
+	}
+
+	session.Owner = ""
+	writeJSON(w, http.StatusCreated, map[string]any{"success": true, "session": session})
+}
+
+func (h *ChatSessionsHandler) handleList(w http.ResponseWriter, r *http.Request) {
+	sessions := []store.ChatSession{}
+	if owner := chatOwner(r); owner != "" {
+		var err error
+		sessions, err = h.Store.ListChatSessions(r.Context(), owner)
+		if err != nil {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]any{"success": false, "error": "erro ao acessar banco de dados"})
+			return
+		}
+	}
+	for i := range sessions {
+		sessions[i].Owner = ""
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"success": true, "sessions": sessions})
+}
+
+func (h *ChatSessionsHandler) handleGet(w http.ResponseWriter, r *http.Request, id string) {
+	session, err := ownedSession(h.Store, r, id)
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+	session.Owner = ""
+	writeJSON(w, http.StatusOK, map[string]any{"success": true, "session": session})
+}
+
+func (h *ChatSessionsHandler) handleDelete(w http.ResponseWriter, r *http.Request, id string) {
+	if _, err := ownedSession(h.Store, r, id); err != nil {
+		writeRequestError(w, err)
+		return
+	}
+	if err := h.Store.DeleteChatSession(r.Context(), id); err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"success": false, "error": "erro ao excluir conversa"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"success": true, "message": "Conversa excluída"})
+}
+
+func (h *ChatSessionsHandler) handleShare(w http.ResponseWriter, r *http.Request, id string) {
+	var req struct {
+		Shared bool `json:"shared"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"success": false, "error": "shared é obrigatório"})
+		return
+	}
+	session, err := ownedSession(h.Store, r, id)
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+	session.Shared = req.Shared
+	if err := h.Store.SaveChatSession(r.Context(), *session); err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"success": false, "error": "erro ao salvar conversa"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"success": true, "shared": session.Shared})
+}
+
+// ChatViewHandler serves the read-only transcript of a shared conversation
+// (GET /api/chat/view/{id}), shown by the share page at /?conversa={id}.
+type ChatViewHandler struct {
+	Store store.Store
+}
+
+func (h *ChatViewHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"success": false, "error": "método não permitido"})
+		return
+	}
+
+	id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/chat/view/"), "/")
+	if id == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"success": false, "error": "ID da conversa é obrigatório"})
+		return
+	}
+
+	session, err := h.Store.GetChatSession(r.Context(), id)
+	if err != nil && err.Error() != "conversa não encontrada" {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"success": false, "error": "erro ao acessar banco de dados"})
+		return
+	}
+	if err != nil || !session.Shared {
+		writeJSON(w, http.StatusNotFound, map[string]any{"success": false, "error": "Conversa não encontrada ou não compartilhada"})
+		return
+	}
+
+	messages := make([]store.ChatRecord, len(session.Messages))
+	for i, m := range session.Messages {
+		m.Usage = nil
+		messages[i] = m
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"success":     true,
+		"title":       session.Title,
+		"provider":    session.Provider,
+		"model":       session.Model,
+		"generatedAt": session.UpdatedAt,
+		"messages":    messages,
+	})
+}
@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// sessionRequest sends a request to h as the browser holding cookie.
+func sessionRequest(t *testing.T, h http.Handler, method, path, cookie string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	var payload string
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		payload = string(data)
+	}
+	req := httptest.NewRequest(method, path, strings.NewReader(payload))
+	if cookie != "" {
+		req.Header.Set("Cookie", cookie)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestChatSessions(t *testing.T) {
+	db := seedStore(t, "111", "222")
+	provider := &fakeProvider{Response: "Há dois pesquisadores."}
+	sessions := &ChatSessionsHandler{Store: db}
+	chat := &ChatHandler{Store: db, Prompt: testChatPrompt, NewProvider: providers(provider)}
+	view := &ChatViewHandler{Store: db}
+
+	rec := sessionRequest(t, sessions, http.MethodPost, "/api/chat/sessions", "", map[string]any{"provider": "fake", "model": "m"})
+	created := checkResponse(t, rec, http.StatusCreated, "")
+	id := created["session"].(map[string]any)["id"].(string)
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != chatOwnerCookie || !cookies[0].HttpOnly {
+		t.Fatalf("cookies = %v", cookies)
+	}
+	owner := cookies[0].Name + "=" + cookies[0].Value
+	stranger := chatOwnerCookie + "=outro"
+
+	// Each turn sends only the new question; the history comes from the store.
+	for _, question := range []string{"Quantos pesquisadores?", "E quais publicações?"} {
+		body := map[string]any{"provider": "fake", "apiKey": "k", "model": "m", "sessionId": id, "messages": []map[string]string{{"role": "user", "content": question}}}
+		answer := checkResponse(t, sessionRequest(t, chat, http.MethodPost, "/api/chat", owner, body), http.StatusOK, "")
+		if answer["sessionId"] != id {
+			t.Errorf("sessionId = %v", answer["sessionId"])
+		}
+	}
+	if sent := provider.chatted.Messages; len(sent) != 3 || sent[0].Content != "Quantos pesquisadores?" || sent[1].Role != "assistant" {
+		t.Errorf("second turn sent %+v", sent)
+	}
+
+	body := map[string]any{"provider": "fake", "apiKey": "k", "model": "m", "sessionId": id, "messages": []map[string]string{{"role": "user", "content": "oi"}}}
+	checkResponse(t, sessionRequest(t, chat, http.MethodPost, "/api/chat", stranger, body), http.StatusNotFound, "conversa não encontrada")
+
+	list := checkResponse(t, sessionRequest(t, sessions, http.MethodGet, "/api/chat/sessions", owner, nil), http.StatusOK, "")
+	items := list["sessions"].([]any)
+	if len(items) != 1 || items[0].(map[string]any)["title"] != "Quantos pesquisadores?" || items[0].(map[string]any)["owner"] != nil {
+		t.Errorf("sessions = %v", items)
+	}
+	if list := checkResponse(t, sessionRequest(t, sessions, http.MethodGet, "/api/chat/sessions", stranger, nil), http.StatusOK, ""); len(list["sessions"].([]any)) != 0 {
+		t.Errorf("another browser lists %v", list["sessions"])
+	}
+
+	resumed := checkResponse(t, sessionRequest(t, sessions, http.MethodGet, "/api/chat/sessions/"+id, owner, nil), http.StatusOK, "")
+	if msgs := resumed["session"].(map[string]any)["messages"].([]any); len(msgs) != 4 {
+		t.Errorf("resumed %d messages, want 4", len(msgs))
+	}
+	checkResponse(t, sessionRequest(t, sessions, http.MethodGet, "/api/chat/sessions/"+id, stranger, nil), http.StatusNotFound, "conversa não encontrada")
+
+	// The transcript is private until its owner shares it.
+	checkResponse(t, get(view, "/api/chat/view/"+id), http.StatusNotFound, "não compartilhada")
+	checkResponse(t, sessionRequest(t, sessions, http.MethodPost, "/api/chat/sessions/"+id+"/share", stranger, map[string]any{"shared": true}), http.StatusNotFound, "")
+	checkResponse(t, sessionRequest(t, sessions, http.MethodPost, "/api/chat/sessions/"+id+"/share", owner, map[string]any{"shared": true}), http.StatusOK, "")
+	shared := checkResponse(t, get(view, "/api/chat/view/"+id), http.StatusOK, "")
+	msgs := shared["messages"].([]any)
+	if len(msgs) != 4 || msgs[1].(map[string]any)["content"] != "Há dois pesquisadores." || msgs[1].(map[string]any)["usage"] != nil {
+		t.Errorf("shared transcript = %v", msgs)
+	}
+
+	checkResponse(t, sessionRequest(t, sessions, http.MethodDelete, "/api/chat/sessions/"+id, stranger, nil), http.StatusNotFound, "")
+	checkResponse(t, sessionRequest(t, sessions, http.MethodDelete, "/api/chat/sessions/"+id, owner, nil), http.StatusOK, "")
+	checkResponse(t, get(view, "/api/chat/view/"+id), http.StatusNotFound, "")
+}
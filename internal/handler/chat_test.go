@@ -0,0 +1,305 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/edalcin/smartlattes/internal/ai"
+	"github.com/edalcin/smartlattes/internal/chattools"
+	"github.com/edalcin/smartlattes/internal/quota"
+)
+
+const testChatPrompt = "Base com {{TOTAL}} pesquisadores e {{PUBLICATIONS}} publicações.\n\n{{DATA}}\n\nForam selecionados {{SELECTED}}."
+
+func chatBody(provider string, messages ...string) map[string]any {
+	var msgs []ai.ChatMessage
+	for i, m := range messages {
+		role := "user"
+		if i%2 == 1 {
+			role = "assistant"
+		}
+		msgs = append(msgs, ai.ChatMessage{Role: role, Content: m})
+	}
+	return map[string]any{"provider": provider, "apiKey": "k", "model": "m", "messages": msgs}
+}
+
+func TestChat(t *testing.T) {
+	type testCase struct {
+		name     string
+		ids      []string
+		body     any
+		failOps  []string
+		provider *fakeProvider
+		status   int
+		want     string
+	}
+	tests := []testCase{
+		{name: "invalid JSON", body: "{", status: http.StatusBadRequest, want: "são obrigatórios"},
+		{name: "no messages", body: chatBody("fake"), status: http.StatusBadRequest, want: "são obrigatórios"},
+		{name: "no apiKey", body: map[string]any{"provider": "fake", "model": "m", "messages": []ai.ChatMessage{{Role: "user", Content: "oi"}}}, status: http.StatusBadRequest, want: "apiKey é obrigatória"},
+		{name: "store error", body: chatBody("fake", "oi"), failOps: []string{"GetAllCVsForChat"}, status: http.StatusServiceUnavailable, want: "erro ao acessar banco de dados"},
+		{name: "empty base", ids: []string{}, body: chatBody("fake", "oi"), status: http.StatusConflict, want: "Não há currículos"},
+		{name: "publications store error", body: chatBody("fake", "oi"), failOps: []string{"GetAllPublications"}, status: http.StatusServiceUnavailable, want: "erro ao acessar banco de dados"},
+		{name: "unknown provider", body: chatBody("outro", "oi"), status: http.StatusBadRequest, want: "provedor desconhecido"},
+	}
+	for _, tc := range aiErrorCases {
+		tests = append(tests, testCase{name: "provider " + tc.name, body: chatBody("fake", "oi"), provider: &fakeProvider{Err: tc.err}, status: tc.status, want: tc.want})
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids := tt.ids
+			if ids == nil {
+				ids = []string{"111", "222"}
+			}
+			provider := tt.provider
+			if provider == nil {
+				provider = &fakeProvider{Response: "resposta"}
+			}
+			h := &ChatHandler{
+				Store:       failing(seedStore(t, ids...), tt.failOps...),
+				Prompt:      testChatPrompt,
+				NewProvider: providers(provider),
+			}
+			checkResponse(t, postJSON(t, h, "/api/chat", tt.body), tt.status, tt.want)
+		})
+	}
+}
+
+func TestChatSuccess(t *testing.T) {
+	provider := &fakeProvider{Response: "Há dois pesquisadores."}
+	h := &ChatHandler{Store: seedStore(t, "111", "222"), Prompt: testChatPrompt, NewProvider: providers(provider)}
+
+	var messages []string
+	for i := 0; i < 25; i++ {
+		messages = append(messages, fmt.Sprintf("mensagem %d", i))
+	}
+	body := checkResponse(t, postJSON(t, h, "/api/chat", chatBody("fake", messages...)), http.StatusOK, "")
+
+	if body["response"] != "Há dois pesquisadores." {
+		t.Errorf("response = %v", body["response"])
+	}
+	// The instructions and the researchers' data go in blocks providers may
+	// cache, followed by the counts of the question.
+	if prompt := provider.chatted.SystemPrompt; prompt != "Base com 2 pesquisadores e 2 publicações." {
+		t.Errorf("instructions = %q", prompt)
+	}
+	data := provider.chatted.SystemData
+	if !strings.Contains(data, "Pesquisador 111") || !strings.Contains(data, "Pesquisador 222") {
+		t.Errorf("prompt lacks the researchers' data: %q", data)
+	}
+	if selected := provider.chatted.SystemContext; selected != "Foram selecionados 2." {
+		t.Errorf("per-question part = %q", selected)
+	}
+	if got := len(provider.chatted.Messages); got != 20 {
+		t.Errorf("sent %d messages, want the last 20", got)
+	}
+	if first := provider.chatted.Messages[0].Content; first != "mensagem 5" {
+		t.Errorf("first message sent = %q, want mensagem 5", first)
+	}
+}
+
+// noFlushWriter hides the recorder's Flush method.
+type noFlushWriter struct {
+	http.ResponseWriter
+}
+
+func TestChatStream(t *testing.T) {
+	newHandler := func(p *fakeProvider) *ChatHandler {
+		return &ChatHandler{Store: seedStore(t, "111"), Prompt: testChatPrompt, NewProvider: providers(p)}
+	}
+
+	t.Run("streaming unsupported", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/chat/stream", strings.NewReader("{}"))
+		newHandler(&fakeProvider{}).ServeHTTP(noFlushWriter{rec}, req)
+		checkResponse(t, rec, http.StatusInternalServerError, "streaming não suportado")
+	})
+
+	t.Run("invalid request", func(t *testing.T) {
+		rec := postJSON(t, newHandler(&fakeProvider{}), "/api/chat/stream", chatBody("fake"))
+		checkResponse(t, rec, http.StatusBadRequest, "são obrigatórios")
+	})
+
+	t.Run("error before the first token", func(t *testing.T) {
+		rec := postJSON(t, newHandler(&fakeProvider{Err: ai.ErrInvalidKey}), "/api/chat/stream", chatBody("fake", "oi"))
+		checkResponse(t, rec, http.StatusUnauthorized, "Chave de API inválida")
+	})
+
+	t.Run("error midway", func(t *testing.T) {
+		p := &fakeProvider{Response: "abcdef", StreamErr: ai.ErrProviderUnavailable}
+		rec := postJSON(t, newHandler(p), "/api/chat/stream", chatBody("fake", "oi"))
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/event-stream" {
+			t.Fatalf("status %d, content type %q", rec.Code, rec.Header().Get("Content-Type"))
+		}
+		want := "event: delta\ndata: {\"text\":\"abc\"}\n\n" +
+			"event: error\ndata: {\"error\":\"Provedor de IA indisponível. Tente novamente mais tarde.\",\"success\":false}\n\n"
+		if rec.Body.String() != want {
+			t.Errorf("body = %q, want %q", rec.Body.String(), want)
+		}
+	})
+
+	t.Run("failover before the first token", func(t *testing.T) {
+		backup := &fakeProvider{Response: "abcdef", NoKey: true}
+		h := newHandler(nil)
+		h.NewProvider = namedProviders(map[string]ai.AIProvider{"fake": &fakeProvider{Err: ai.ErrTimeout}, "reserva": backup})
+		h.Failover = ai.FailoverChain{{Provider: "reserva", Model: "r"}}
+		rec := postJSON(t, h, "/api/chat/stream", chatBody("fake", "oi"))
+		body := rec.Body.String()
+		if rec.Code != http.StatusOK || !strings.Contains(body, `"provider":"reserva"`) || !strings.Contains(body, `"requestedProvider":"fake"`) {
+			t.Errorf("status %d, body = %q", rec.Code, body)
+		}
+		if backup.chatted == nil || backup.chatted.Model != "r" {
+			t.Errorf("backup got %+v", backup.chatted)
+		}
+	})
+
+	t.Run("success", func(t *testing.T) {
+		p := &fakeProvider{Response: "abcdef", Usage: ai.Usage{InputTokens: 10, OutputTokens: 5}}
+		rec := postJSON(t, newHandler(p), "/api/chat/stream", chatBody("fake", "oi"))
+		want := "event: delta\ndata: {\"text\":\"abc\"}\n\n" +
+			"event: delta\ndata: {\"text\":\"def\"}\n\n" +
+			"event: done\ndata: {\"attempts\":0,\"response\":\"abcdef\",\"success\":true,\"usage\":{\"inputTokens\":10,\"outputTokens\":5,\"finishReason\":\"stop\"}}\n\n"
+		if rec.Code != http.StatusOK || rec.Body.String() != want {
+			t.Errorf("status %d, body = %q, want %q", rec.Code, rec.Body.String(), want)
+		}
+	})
+}
+
+// toolProvider is a fakeProvider that supports tools and answers each Chat
+// with the next result of Script, repeating the last one when it runs out.
+type toolProvider struct {
+	*fakeProvider
+	Script   []ai.Result
+	requests []ai.ChatRequest
+}
+
+func (p *toolProvider) SupportsTools() bool {
+	return true
+}
+
+func (p *toolProvider) Chat(ctx context.Context, req ai.ChatRequest) (ai.Result, error) {
+	req.Messages = slices.Clone(req.Messages)
+	p.requests = append(p.requests, req)
+	return p.Script[min(len(p.requests), len(p.Script))-1], nil
+}
+
+func TestChatAgent(t *testing.T) {
+	search := ai.Result{
+		Usage:     ai.Usage{InputTokens: 10, OutputTokens: 2},
+		ToolCalls: []ai.ToolCall{{ID: "c1", Name: chattools.SearchResearchers, Arguments: json.RawMessage(`{"consulta":"111"}`)}},
+	}
+	answer := ai.Result{Text: "Há um pesquisador.", Usage: ai.Usage{InputTokens: 30, OutputTokens: 5}, FinishReason: "stop"}
+	newHandler := func(p ai.AIProvider) *ChatHandler {
+		// The data for the prompt is never loaded in agent mode
+		db := failing(seedStore(t, "111", "222"), "GetAllCVsForChat")
+		return &ChatHandler{Store: db, Prompt: testChatPrompt, ToolsPrompt: "Base com {{TOTAL}} pesquisadores.", NewProvider: providers(p)}
+	}
+
+	t.Run("answer after tool calls", func(t *testing.T) {
+		p := &toolProvider{Script: []ai.Result{search, answer}}
+		body := chatBody("fake", "Quem é o 111?")
+		body["messages"] = []map[string]any{{"role": "user", "content": "Quem é o 111?", "toolCalls": []map[string]any{{"id": "x", "name": "obter_curriculo"}}}}
+		got := checkResponse(t, postJSON(t, newHandler(p), "/api/chat", body), http.StatusOK, "")
+		if got["response"] != "Há um pesquisador." || len(got["toolCalls"].([]any)) != 1 {
+			t.Errorf("response = %v", got)
+		}
+		if usage := got["usage"].(map[string]any); usage["inputTokens"] != float64(40) || usage["outputTokens"] != float64(7) {
+			t.Errorf("usage = %v", usage)
+		}
+
+		if len(p.requests) != 2 {
+			t.Fatalf("%d rounds, want 2", len(p.requests))
+		}
+		first := p.requests[0]
+		if first.SystemPrompt != "Base com 2 pesquisadores." || len(first.Tools) != len(chattools.Definitions()) || first.Messages[0].ToolCalls != nil {
+			t.Errorf("first round = %+v", first)
+		}
+		msgs := p.requests[1].Messages
+		if len(msgs) != 3 || len(msgs[1].ToolCalls) != 1 || msgs[2].Role != "tool" || msgs[2].ToolCallID != "c1" || !strings.Contains(msgs[2].Content, "Pesquisador 111") {
+			t.Errorf("second round messages = %+v", msgs)
+		}
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		p := &toolProvider{Script: []ai.Result{search, answer}}
+		rec := postJSON(t, newHandler(p), "/api/chat/stream", chatBody("fake", "Quem é o 111?"))
+		body := rec.Body.String()
+		tool := strings.Index(body, "event: tool\ndata: {\"id\":\"c1\",\"name\":\"buscar_pesquisadores\"")
+		delta := strings.Index(body, "event: delta\ndata: {\"text\":\"Há um pesquisador.\"}")
+		if rec.Code != http.StatusOK || tool < 0 || delta < tool || !strings.Contains(body, "event: done") {
+			t.Errorf("status %d, body = %q", rec.Code, body)
+		}
+	})
+
+	t.Run("too many rounds", func(t *testing.T) {
+		p := &toolProvider{Script: []ai.Result{search}}
+		checkResponse(t, postJSON(t, newHandler(p), "/api/chat", chatBody("fake", "oi")), http.StatusBadGateway, "muitas vezes")
+		if len(p.requests) != maxToolRounds {
+			t.Errorf("%d rounds, want %d", len(p.requests), maxToolRounds)
+		}
+	})
+
+	t.Run("quota counted on every round", func(t *testing.T) {
+		p := &toolProvider{fakeProvider: &fakeProvider{NoKey: true}, Script: []ai.Result{search, answer}}
+		h := newHandler(p)
+		h.Quota = &quota.Limiter{Store: h.Store, Limits: quota.Limits{TokensPerDay: 6000}}
+		body := chatBody("fake", "Quem é o 111?")
+		delete(body, "apiKey")
+		checkResponse(t, postJSON(t, h, "/api/chat", body), http.StatusTooManyRequests, "limite de 6000 tokens por dia")
+		if len(p.requests) != 1 {
+			t.Errorf("%d rounds sent past the quota, want 1", len(p.requests))
+		}
+		if usage, _ := h.Store.ListUsage(context.Background(), h.Quota.Day()); len(usage) != 1 || usage[0].Tokens != 12 {
+			t.Errorf("usage = %+v", usage)
+		}
+	})
+
+	t.Run("provider without tools", func(t *testing.T) {
+		p := &fakeProvider{Response: "ok"}
+		h := newHandler(p)
+		h.Store = seedStore(t, "111")
+		checkResponse(t, postJSON(t, h, "/api/chat", chatBody("fake", "oi")), http.StatusOK, "")
+		if p.chatted.Tools != nil || !strings.Contains(p.chatted.SystemData, "Pesquisador 111") {
+			t.Errorf("request = %+v", p.chatted)
+		}
+	})
+}
+
+func TestSplitPrompt(t *testing.T) {
+	shipped, err := os.ReadFile("../../cmd/smartlattes/chatPrompt.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		template string
+		data     string
+		question string
+	}{
+		{"shipped prompt", string(shipped), "```json\n{{DATA}}\n```", "{{SELECTED}}"},
+		{"counts before the data", "Base.\n\nForam selecionados {{SELECTED}}:\n{{DATA}}", "Foram selecionados {{SELECTED}}:\n{{DATA}}", ""},
+		{"no data", "Base com {{TOTAL}} pesquisadores.", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instructions, data, question := splitPrompt(tt.template)
+			if strings.Contains(instructions, "{{DATA}}") || strings.Contains(instructions, "{{SELECTED}}") || strings.HasSuffix(instructions, "```json") {
+				t.Errorf("instructions = %q", instructions)
+			}
+			if !strings.HasPrefix(strings.TrimSpace(data), tt.data) || strings.Contains(data, "{{SELECTED}}") != strings.Contains(tt.data, "{{SELECTED}}") {
+				t.Errorf("data = %q", data)
+			}
+			if !strings.Contains(question, tt.question) || (tt.question == "") != (question == "") {
+				t.Errorf("per-question part = %q", question)
+			}
+		})
+	}
+}
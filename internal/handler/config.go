@@ -1,9 +1,15 @@
 package handler
 
-import "net/http"
+import (
+	"net/http"
+
+	"github.com/edalcin/smartlattes/internal/ai"
+)
 
 type ConfigHandler struct {
 	ShareBaseURL string
+	// Providers are the AI providers offered in the pages' provider select.
+	Providers []ai.ProviderInfo
 }
 
 func (h *ConfigHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -11,5 +17,5 @@ func (h *ConfigHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"success": false, "error": "método não permitido"})
 		return
 	}
-	writeJSON(w, http.StatusOK, map[string]any{"shareBaseUrl": h.ShareBaseURL})
+	writeJSON(w, http.StatusOK, map[string]any{"shareBaseUrl": h.ShareBaseURL, "providers": h.Providers})
 }
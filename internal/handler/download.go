@@ -10,7 +10,7 @@ import (
 )
 
 type DownloadHandler struct {
-	Store *store.MongoDB
+	Store store.Store
 }
 
 func (h *DownloadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/edalcin/smartlattes/internal/store"
+)
+
+func TestDownload(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		failOps []string
+		status  int
+		want    string
+	}{
+		{name: "wrong method", method: http.MethodPost, path: "/api/download/111?format=md", status: http.StatusMethodNotAllowed, want: "método não permitido"},
+		{name: "missing ID", path: "/api/download/?format=md", status: http.StatusBadRequest, want: "lattesID é obrigatório"},
+		{name: "unsupported format", path: "/api/download/111?format=pdf", status: http.StatusBadRequest, want: "formato deve ser md"},
+		{name: "no summary", path: "/api/download/222?format=md", status: http.StatusNotFound, want: "resumo não encontrado"},
+		{name: "store error", path: "/api/download/111?format=md", failOps: []string{"GetSummary"}, status: http.StatusServiceUnavailable, want: "erro ao acessar banco de dados"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := seedStore(t, "111", "222")
+			s.UpsertSummary(context.Background(), "111", "# Resumo", store.GenerationMetadata{Provider: "fake", Model: "m"})
+			h := &DownloadHandler{Store: failing(s, tt.failOps...)}
+			if tt.method == http.MethodPost {
+				checkResponse(t, postJSON(t, h, tt.path, "{}"), tt.status, tt.want)
+				return
+			}
+			checkResponse(t, get(h, tt.path), tt.status, tt.want)
+		})
+	}
+}
+
+func TestDownloadMarkdown(t *testing.T) {
+	s := seedStore(t, "111")
+	s.UpsertSummary(context.Background(), "111", "# Resumo\n\nTexto.", store.GenerationMetadata{Provider: "fake", Model: "m"})
+
+	rec := get(&DownloadHandler{Store: s}, "/api/download/111/?format=md")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d (%s)", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Disposition"); got != "attachment; filename=resumo-111.md" {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "text/markdown; charset=utf-8" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if rec.Body.String() != "# Resumo\n\nTexto." {
+		t.Errorf("body = %q", rec.Body.String())
+	}
+}
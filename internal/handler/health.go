@@ -10,23 +10,27 @@ import (
 )
 
 type HealthHandler struct {
-	Store *store.MongoDB
+	Store store.Store
 }
 
+// healthResponse reports the storage state in store and, for monitors set
+// up when MongoDB was the only backend, also in mongodb.
 type healthResponse struct {
 	Status  string `json:"status"`
+	Store   string `json:"store"`
 	MongoDB string `json:"mongodb"`
 }
 
+func newHealthResponse(status, storeState string) healthResponse {
+	return healthResponse{Status: status, Store: storeState, MongoDB: storeState}
+}
+
 func (h *HealthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	if h.Store == nil {
 		w.WriteHeader(http.StatusServiceUnavailable)
-		json.NewEncoder(w).Encode(healthResponse{
-			Status:  "unhealthy",
-			MongoDB: "disconnected",
-		})
+		json.NewEncoder(w).Encode(newHealthResponse("unhealthy", "disconnected"))
 		return
 	}
 
@@ -35,16 +39,10 @@ func (h *HealthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	if err := h.Store.Ping(ctx); err != nil {
 		w.WriteHeader(http.StatusServiceUnavailable)
-		json.NewEncoder(w).Encode(healthResponse{
-			Status:  "unhealthy",
-			MongoDB: "disconnected",
-		})
+		json.NewEncoder(w).Encode(newHealthResponse("unhealthy", "disconnected"))
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(healthResponse{
-		Status:  "healthy",
-		MongoDB: "connected",
-	})
+	json.NewEncoder(w).Encode(newHealthResponse("healthy", "connected"))
 }
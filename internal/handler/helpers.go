@@ -1,8 +1,20 @@
 package handler
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"strings"
+	"time"
+
+	"github.com/edalcin/smartlattes/internal/ai"
+	"github.com/edalcin/smartlattes/internal/quota"
+	"github.com/edalcin/smartlattes/internal/store"
 )
 
 func writeJSON(w http.ResponseWriter, status int, data any) {
@@ -10,3 +22,261 @@ func writeJSON(w http.ResponseWriter, status int, data any) {
 	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(data)
 }
+
+// generationRequest is the body of a summary or analysis request.
+type generationRequest struct {
+	LattesID string `json:"lattesId"`
+	Provider string `json:"provider"`
+	APIKey   string `json:"apiKey"`
+	Model    string `json:"model"`
+}
+
+func (g generationRequest) valid() bool {
+	return g.LattesID != "" && g.Provider != "" && g.Model != ""
+}
+
+// ProviderFactory builds the AIProvider a request names. Handlers with a nil
+// factory use ai.NewProvider; tests set one to answer without calling a real
+// API.
+type ProviderFactory func(name string) (ai.AIProvider, error)
+
+func (f ProviderFactory) create(name string) (ai.AIProvider, error) {
+	if f == nil {
+		return ai.NewProvider(name)
+	}
+	return f(name)
+}
+
+// requestError is a failed request, with the HTTP status and user-facing
+// message to answer it with.
+type requestError struct {
+	status  int
+	message string
+}
+
+func (e *requestError) Error() string { return e.message }
+
+// HTTPStatus lets the job queue store the status of a failed job.
+func (e *requestError) HTTPStatus() int { return e.status }
+
+func writeRequestError(w http.ResponseWriter, err error) {
+	var re *requestError
+	if errors.As(err, &re) {
+		writeJSON(w, re.status, map[string]any{"success": false, "error": re.message})
+		return
+	}
+	writeJSON(w, http.StatusInternalServerError, map[string]any{"success": false, "error": err.Error()})
+}
+
+// provider creates the provider a request names and checks that the request
+// brings an API key when the provider needs one.
+func (f ProviderFactory) provider(name, apiKey string) (ai.AIProvider, error) {
+	provider, err := f.create(name)
+	if err != nil {
+		return nil, &requestError{http.StatusBadRequest, err.Error()}
+	}
+	if apiKey == "" && ai.RequiresKey(provider) {
+		return nil, &requestError{http.StatusBadRequest, "apiKey é obrigatória para este provedor"}
+	}
+	return provider, nil
+}
+
+// providerFor is provider for handlers that answer directly. When it returns
+// ok=false the error response has already been written.
+func (f ProviderFactory) providerFor(w http.ResponseWriter, name, apiKey string) (ai.AIProvider, bool) {
+	provider, err := f.provider(name, apiKey)
+	if err != nil {
+		writeRequestError(w, err)
+		return nil, false
+	}
+	return provider, true
+}
+
+// target is a provider a generation can be made with: the one the request
+// names or, when it is unavailable, a fallback of the failover chain.
+type target struct {
+	name     string
+	provider ai.AIProvider
+	model    string
+	apiKey   string
+}
+
+// targets returns the provider the request names followed by the fallbacks
+// chain offers for it. Fallbacks are called with the keys managed by the
+// server, since the user's key belongs to another provider, so those that
+// would need the user's key are left out. Errors are *requestError.
+func (f ProviderFactory) targets(chain ai.FailoverChain, name, model, apiKey string) ([]target, error) {
+	provider, err := f.provider(name, apiKey)
+	if err != nil {
+		return nil, err
+	}
+	targets := []target{{name: name, provider: provider, model: model, apiKey: apiKey}}
+	for _, fb := range chain.For(name, model) {
+		p, err := f.create(fb.Provider)
+		if err != nil || ai.RequiresKey(p) {
+			continue
+		}
+		targets = append(targets, target{name: fb.Provider, provider: p, model: fb.Model})
+	}
+	return targets, nil
+}
+
+// failover calls try with each target in turn until one succeeds, moving on
+// only while the providers are unavailable or time out. When every target
+// fails, the error of the requested provider is returned as a *requestError.
+func failover(ctx context.Context, targets []target, try func(target) error) (target, error) {
+	var first error
+	for i, t := range targets {
+		err := try(t)
+		if err == nil {
+			if i > 0 {
+				log.Printf("Provedor %s indisponível; resposta gerada por %s (%s)", targets[0].name, t.name, t.model)
+			}
+			return t, nil
+		}
+		if i == 0 {
+			first = err
+		} else {
+			log.Printf("Provedor reserva %s falhou: %v", t.name, err)
+		}
+		if !ai.ShouldFailOver(err) || ctx.Err() != nil {
+			break
+		}
+	}
+	var re *requestError
+	if errors.As(first, &re) {
+		return target{}, first
+	}
+	return target{}, aiError(first)
+}
+
+// failoverFrom records in the metadata of a generated text that t answered
+// in place of the provider and model the request asked for.
+func (t target) failoverFrom(provider, model string) store.Failover {
+	if t.name == provider {
+		return store.Failover{}
+	}
+	return store.Failover{RequestedProvider: provider, RequestedModel: model}
+}
+
+// reserve counts a request served at the server's expense against the
+// client's daily quota; requests made with the user's own key are not
+// counted.
+func reserve(ctx context.Context, l *quota.Limiter, client string, provider ai.AIProvider, apiKey string, tokens int64) (*quota.Reservation, error) {
+	if !ai.ServedByServer(provider, apiKey) {
+		return nil, nil
+	}
+	res, err := l.Reserve(ctx, client, tokens)
+	if err != nil {
+		return nil, quotaError(err)
+	}
+	return res, nil
+}
+
+// extend counts the tokens of another round of a request against the quota
+// reserved for it.
+func extend(ctx context.Context, reservation *quota.Reservation, tokens int64) error {
+	if err := reservation.Extend(ctx, tokens); err != nil {
+		return quotaError(err)
+	}
+	return nil
+}
+
+func quotaError(err error) *requestError {
+	if errors.Is(err, quota.ErrExceeded) {
+		detail := strings.TrimPrefix(err.Error(), quota.ErrExceeded.Error()+": ")
+		return &requestError{http.StatusTooManyRequests, "Cota diária de uso do servidor excedida (" + detail + "). Informe sua própria chave de API ou tente novamente amanhã."}
+	}
+	return &requestError{http.StatusServiceUnavailable, "erro ao registrar uso da cota"}
+}
+
+// recordCall accounts for a successful AI call: it settles the quota reserved
+// for it with the tokens the provider reported, or with an estimate based on
+// inputTokens when it reported none, and appends the call to the log. It
+// returns the usage to store with the generated text.
+func recordCall(ctx context.Context, s store.Store, pricing ai.Pricing, reservation *quota.Reservation, call store.AICall, res ai.Result, inputTokens int64) store.TokenUsage {
+	call.At = time.Now()
+	call.Attempts = res.Attempts
+	call.TokenUsage = tokenUsage(pricing, call.Provider, call.Model, res)
+
+	tokens := int64(res.Usage.InputTokens + res.Usage.OutputTokens)
+	if tokens == 0 {
+		tokens = inputTokens + quota.EstimateTokens(res.Text)
+	}
+	reservation.Settle(ctx, tokens)
+
+	if err := s.LogAICall(ctx, call); err != nil {
+		log.Printf("Erro ao registrar chamada de IA: %v", err)
+	}
+	return call.TokenUsage
+}
+
+// tokenUsage converts what a provider reported into the stored usage. The
+// cost is left unset when the provider reported no tokens or the model has
+// no known price; a nil pricing uses ai.DefaultPricing.
+func tokenUsage(pricing ai.Pricing, provider, model string, res ai.Result) store.TokenUsage {
+	u := store.TokenUsage{
+		InputTokens:      res.Usage.InputTokens,
+		OutputTokens:     res.Usage.OutputTokens,
+		CacheReadTokens:  res.Usage.CacheReadTokens,
+		CacheWriteTokens: res.Usage.CacheWriteTokens,
+		FinishReason:     res.FinishReason,
+	}
+	if pricing == nil {
+		pricing = ai.DefaultPricing
+	}
+	if res.Usage != (ai.Usage{}) {
+		if cost, ok := pricing.Cost(provider, model, res.Usage); ok {
+			u.CostUSD = &cost
+		}
+	}
+	return u
+}
+
+// savedUsage is the usage sent back by the browser when it saves a generated
+// text, with the cost recomputed rather than trusted.
+func savedUsage(pricing ai.Pricing, provider, model string, u store.TokenUsage) store.TokenUsage {
+	res := ai.Result{FinishReason: u.FinishReason, Usage: ai.Usage{
+		InputTokens:      u.InputTokens,
+		OutputTokens:     u.OutputTokens,
+		CacheReadTokens:  u.CacheReadTokens,
+		CacheWriteTokens: u.CacheWriteTokens,
+	}}
+	return tokenUsage(pricing, provider, model, res)
+}
+
+// aiErrorResponse maps an error returned by an AIProvider to the HTTP status
+// and user-facing message sent back to the browser.
+func aiErrorResponse(err error) (int, string) {
+	if errors.Is(err, ai.ErrInvalidKey) {
+		return http.StatusUnauthorized, "Chave de API inválida ou sem permissão para este provedor"
+	}
+	if errors.Is(err, ai.ErrTimeout) {
+		return http.StatusGatewayTimeout, "Tempo limite excedido (120s). Tente um modelo menor ou tente novamente."
+	}
+	if errors.Is(err, ai.ErrRateLimited) {
+		detail := strings.TrimPrefix(err.Error(), ai.ErrRateLimited.Error()+": ")
+		return http.StatusTooManyRequests, "Limite de requisições atingido: " + detail
+	}
+	if errors.Is(err, ai.ErrProviderUnavailable) {
+		message := "Provedor de IA indisponível. Tente novamente mais tarde."
+		if n := ai.Attempts(err); n > 1 {
+			message = fmt.Sprintf("Provedor de IA indisponível após %d tentativas. Tente novamente mais tarde.", n)
+		}
+		return http.StatusServiceUnavailable, message
+	}
+	return http.StatusInternalServerError, err.Error()
+}
+
+// aiError is aiErrorResponse as a requestError.
+func aiError(err error) error {
+	status, message := aiErrorResponse(err)
+	return &requestError{status, message}
+}
+
+// promptHash identifies the system prompt a summary or analysis was generated
+// with, so revisions made with different prompt versions can be compared.
+func promptHash(prompt string) string {
+	sum := sha256.Sum256([]byte(prompt))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,297 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/edalcin/smartlattes/internal/ai"
+	"github.com/edalcin/smartlattes/internal/parser"
+	"github.com/edalcin/smartlattes/internal/store"
+)
+
+// lattesXML builds a minimal CV in the format exported by the Lattes platform.
+func lattesXML(lattesID, name string) []byte {
+	return []byte(fmt.Sprintf(`<?xml version="1.0" encoding="ISO-8859-1"?>
+<CURRICULO-VITAE NUMERO-IDENTIFICADOR="%s" DATA-ATUALIZACAO="15032024">
+<DADOS-GERAIS NOME-COMPLETO="%s" NOME-EM-CITACOES-BIBLIOGRAFICAS="%s">
+<AREAS-DE-ATUACAO><AREA-DE-ATUACAO SEQUENCIA-AREA="1" NOME-GRANDE-AREA-DO-CONHECIMENTO="CIENCIAS_BIOLOGICAS" NOME-DA-AREA-DO-CONHECIMENTO="Ecologia"/></AREAS-DE-ATUACAO>
+</DADOS-GERAIS>
+<PRODUCAO-BIBLIOGRAFICA><ARTIGOS-PUBLICADOS><ARTIGO-PUBLICADO SEQUENCIA-PRODUCAO="1">
+<DADOS-BASICOS-DO-ARTIGO TITULO-DO-ARTIGO="Dinamica de florestas tropicais sob fragmentacao" ANO-DO-ARTIGO="2021" DOI="10.1000/%s"/>
+<DETALHAMENTO-DO-ARTIGO TITULO-DO-PERIODICO-OU-REVISTA="Acta Botanica"/>
+<AUTORES NOME-COMPLETO-DO-AUTOR="%s" ORDEM-DE-AUTORIA="1"/>
+</ARTIGO-PUBLICADO></ARTIGOS-PUBLICADOS></PRODUCAO-BIBLIOGRAFICA>
+</CURRICULO-VITAE>`, lattesID, name, strings.ToUpper(name), lattesID, name))
+}
+
+// seedStore returns a MemoryStore holding one CV for each ID, named
+// "Pesquisador <ID>".
+func seedStore(t *testing.T, ids ...string) *store.MemoryStore {
+	t.Helper()
+	s := store.NewMemoryStore()
+	for _, id := range ids {
+		result, err := parser.Parse(lattesXML(id, "Pesquisador "+id))
+		if err != nil {
+			t.Fatalf("parse %s: %v", id, err)
+		}
+		if _, err := s.UpsertCV(context.Background(), result.Document, id, id+".xml", 100); err != nil {
+			t.Fatalf("upsert %s: %v", id, err)
+		}
+	}
+	return s
+}
+
+var errStore = errors.New("banco fora do ar")
+
+// failingStore wraps a store and makes the named operations fail.
+type failingStore struct {
+	store.Store
+	fail map[string]bool
+}
+
+func failing(s store.Store, ops ...string) *failingStore {
+	f := &failingStore{Store: s, fail: map[string]bool{}}
+	for _, op := range ops {
+		f.fail[op] = true
+	}
+	return f
+}
+
+func (f *failingStore) err(op string) error {
+	if f.fail[op] {
+		return errStore
+	}
+	return nil
+}
+
+func (f *failingStore) UpsertCV(ctx context.Context, doc map[string]interface{}, lattesID, originalFilename string, fileSize int64) (*store.UpsertResult, error) {
+	if err := f.err("UpsertCV"); err != nil {
+		return nil, err
+	}
+	return f.Store.UpsertCV(ctx, doc, lattesID, originalFilename, fileSize)
+}
+
+func (f *failingStore) GetCV(ctx context.Context, lattesID string) (map[string]interface{}, error) {
+	if err := f.err("GetCV"); err != nil {
+		return nil, err
+	}
+	return f.Store.GetCV(ctx, lattesID)
+}
+
+func (f *failingStore) CountCVs(ctx context.Context) (int64, error) {
+	if err := f.err("CountCVs"); err != nil {
+		return 0, err
+	}
+	return f.Store.CountCVs(ctx)
+}
+
+func (f *failingStore) GetAllCVSummaries(ctx context.Context, excludeLattesID string) ([]map[string]interface{}, error) {
+	if err := f.err("GetAllCVSummaries"); err != nil {
+		return nil, err
+	}
+	return f.Store.GetAllCVSummaries(ctx, excludeLattesID)
+}
+
+func (f *failingStore) GetAllCVsForChat(ctx context.Context) ([]map[string]interface{}, error) {
+	if err := f.err("GetAllCVsForChat"); err != nil {
+		return nil, err
+	}
+	return f.Store.GetAllCVsForChat(ctx)
+}
+
+func (f *failingStore) GetAllResearchersAdmin(ctx context.Context) ([]store.AdminResearcher, error) {
+	if err := f.err("GetAllResearchersAdmin"); err != nil {
+		return nil, err
+	}
+	return f.Store.GetAllResearchersAdmin(ctx)
+}
+
+func (f *failingStore) GetAllPublications(ctx context.Context) ([]store.ResearcherPublications, error) {
+	if err := f.err("GetAllPublications"); err != nil {
+		return nil, err
+	}
+	return f.Store.GetAllPublications(ctx)
+}
+
+func (f *failingStore) UpsertSummary(ctx context.Context, lattesID, summary string, meta store.GenerationMetadata) error {
+	if err := f.err("UpsertSummary"); err != nil {
+		return err
+	}
+	return f.Store.UpsertSummary(ctx, lattesID, summary, meta)
+}
+
+func (f *failingStore) GetSummary(ctx context.Context, lattesID string) (*store.SummaryDoc, error) {
+	if err := f.err("GetSummary"); err != nil {
+		return nil, err
+	}
+	return f.Store.GetSummary(ctx, lattesID)
+}
+
+func (f *failingStore) UpsertAnalysis(ctx context.Context, lattesID, analysis string, meta store.GenerationMetadata, researchersAnalyzed int) error {
+	if err := f.err("UpsertAnalysis"); err != nil {
+		return err
+	}
+	return f.Store.UpsertAnalysis(ctx, lattesID, analysis, meta, researchersAnalyzed)
+}
+
+// fakeProvider answers every call with Response and Usage, or fails with Err.
+// The last requests are kept so tests can inspect what the handler sent.
+type fakeProvider struct {
+	Response string
+	Usage    ai.Usage
+	Err      error
+	// StreamErr, when set, fails the stream after the first fragment.
+	StreamErr error
+	// NoKey makes the provider accept requests without an API key, like a
+	// self-hosted OpenAI-compatible server.
+	NoKey bool
+
+	generated *ai.GenerateRequest
+	chatted   *ai.ChatRequest
+}
+
+func (p *fakeProvider) ListModels(ctx context.Context, apiKey string) ([]ai.Model, error) {
+	if p.Err != nil {
+		return nil, p.Err
+	}
+	return []ai.Model{{ID: "fake-model", DisplayName: "Fake"}}, nil
+}
+
+func (p *fakeProvider) Generate(ctx context.Context, req ai.GenerateRequest) (ai.Result, error) {
+	p.generated = &req
+	if p.Err != nil {
+		return ai.Result{}, p.Err
+	}
+	return p.result(), nil
+}
+
+func (p *fakeProvider) Chat(ctx context.Context, req ai.ChatRequest) (ai.Result, error) {
+	p.chatted = &req
+	if p.Err != nil {
+		return ai.Result{}, p.Err
+	}
+	return p.result(), nil
+}
+
+func (p *fakeProvider) ChatStream(ctx context.Context, req ai.ChatRequest, onDelta func(string) error) (ai.Result, error) {
+	p.chatted = &req
+	if p.Err != nil {
+		return ai.Result{}, p.Err
+	}
+	half := len(p.Response) / 2
+	if err := onDelta(p.Response[:half]); err != nil {
+		return ai.Result{}, err
+	}
+	if p.StreamErr != nil {
+		return ai.Result{}, p.StreamErr
+	}
+	if err := onDelta(p.Response[half:]); err != nil {
+		return ai.Result{}, err
+	}
+	return p.result(), nil
+}
+
+func (p *fakeProvider) result() ai.Result {
+	return ai.Result{Text: p.Response, Usage: p.Usage, FinishReason: "stop"}
+}
+
+func (p *fakeProvider) KeyOptional() bool {
+	return p.NoKey
+}
+
+// providers returns a factory that hands out p for the "fake" provider and
+// rejects any other name like ai.NewProvider does.
+func providers(p ai.AIProvider) ProviderFactory {
+	return func(name string) (ai.AIProvider, error) {
+		if name != "fake" {
+			return nil, fmt.Errorf("provedor desconhecido: %s", name)
+		}
+		return p, nil
+	}
+}
+
+// namedProviders is providers for several providers, keyed by name.
+func namedProviders(byName map[string]ai.AIProvider) ProviderFactory {
+	return func(name string) (ai.AIProvider, error) {
+		p, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("provedor desconhecido: %s", name)
+		}
+		return p, nil
+	}
+}
+
+// aiErrorCases are the provider failures every AI handler maps to a status.
+var aiErrorCases = []struct {
+	name   string
+	err    error
+	status int
+	want   string
+}{
+	{"invalid key", ai.ErrInvalidKey, http.StatusUnauthorized, "Chave de API inválida"},
+	{"timeout", ai.ErrTimeout, http.StatusGatewayTimeout, "Tempo limite excedido"},
+	{"rate limited", fmt.Errorf("%w: tente em 30s", ai.ErrRateLimited), http.StatusTooManyRequests, "Limite de requisições atingido: tente em 30s"},
+	{"unavailable", ai.ErrProviderUnavailable, http.StatusServiceUnavailable, "Provedor de IA indisponível"},
+	{"other", errors.New("resposta inesperada"), http.StatusInternalServerError, "resposta inesperada"},
+}
+
+func postJSON(t *testing.T, h http.Handler, path string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	var payload string
+	switch b := body.(type) {
+	case string:
+		payload = b
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		payload = string(data)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, strings.NewReader(payload)))
+	return rec
+}
+
+func get(h http.Handler, path string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// decode parses a JSON response body.
+func decode(t *testing.T, rec *httptest.ResponseRecorder) map[string]any {
+	t.Helper()
+	var body map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid JSON response %q: %v", rec.Body.String(), err)
+	}
+	return body
+}
+
+// checkResponse asserts the status and, when want is not empty, that the
+// error message of a JSON response contains it.
+func checkResponse(t *testing.T, rec *httptest.ResponseRecorder, status int, want string) map[string]any {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("status = %d, want %d (body %s)", rec.Code, status, rec.Body.String())
+	}
+	body := decode(t, rec)
+	if want != "" {
+		msg, _ := body["error"].(string)
+		if !strings.Contains(msg, want) {
+			t.Fatalf("error = %q, want it to contain %q", msg, want)
+		}
+	}
+	return body
+}
@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/edalcin/smartlattes/internal/history"
+	"github.com/edalcin/smartlattes/internal/store"
+)
+
+type HistoryHandler struct {
+	Store store.Store
+}
+
+// ServeHTTP lists the versions of a CV at /api/history/{lattesId} and compares
+// two of them at /api/history/{lattesId}/diff?from=N&to=M. Without from/to the
+// current version is compared with the previous one.
+func (h *HistoryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"success": false, "error": "método não permitido"})
+		return
+	}
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/history/"), "/")
+	lattesID, action, _ := strings.Cut(path, "/")
+	if lattesID == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"success": false, "error": "lattesID é obrigatório"})
+		return
+	}
+
+	versions, err := h.Store.ListCVVersions(r.Context(), lattesID)
+	if err != nil {
+		if err.Error() == "CV não encontrado" {
+			writeJSON(w, http.StatusNotFound, map[string]any{"success": false, "error": "CV não encontrado para o ID informado"})
+			return
+		}
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"success": false, "error": "erro ao acessar banco de dados"})
+		return
+	}
+
+	switch action {
+	case "":
+		writeJSON(w, http.StatusOK, map[string]any{"success": true, "lattesId": lattesID, "versions": versions})
+	case "diff":
+		h.handleDiff(w, r, lattesID, versions)
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]any{"success": false, "error": "rota não encontrada"})
+	}
+}
+
+// handleDiff compares two versions of a CV. versions is the list from
+// ListCVVersions, oldest first: the numbers may have gaps when an archived
+// version was lost, so the defaults come from the list.
+func (h *HistoryHandler) handleDiff(w http.ResponseWriter, r *http.Request, lattesID string, versions []store.CVVersion) {
+	current := versions[len(versions)-1].Version
+	to, err := versionParam(r, "to", current)
+	if err != nil || to < 1 || to > current {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"success": false, "error": "versão de destino inválida"})
+		return
+	}
+	if len(versions) == 1 {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"success": false, "error": "o CV possui uma única versão"})
+		return
+	}
+	previous := to - 1
+	for _, v := range versions {
+		if v.Version < to {
+			previous = v.Version
+		}
+	}
+	from, err := versionParam(r, "from", previous)
+	if err != nil || from < 1 || from > current {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"success": false, "error": "versão de origem inválida"})
+		return
+	}
+
+	fromCV, err := h.Store.GetCVVersion(r.Context(), lattesID, from)
+	if err != nil {
+		writeVersionError(w, err)
+		return
+	}
+	toCV, err := h.Store.GetCVVersion(r.Context(), lattesID, to)
+	if err != nil {
+		writeVersionError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"success":  true,
+		"lattesId": lattesID,
+		"from":     from,
+		"to":       to,
+		"changes":  history.Compare(fromCV, toCV),
+	})
+}
+
+func versionParam(r *http.Request, name string, fallback int) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return fallback, nil
+	}
+	return strconv.Atoi(v)
+}
+
+func writeVersionError(w http.ResponseWriter, err error) {
+	if err.Error() == "versão não encontrada" {
+		writeJSON(w, http.StatusNotFound, map[string]any{"success": false, "error": "versão não encontrada"})
+		return
+	}
+	writeJSON(w, http.StatusServiceUnavailable, map[string]any{"success": false, "error": "erro ao acessar banco de dados"})
+}
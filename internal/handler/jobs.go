@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/edalcin/smartlattes/internal/jobs"
+	"github.com/edalcin/smartlattes/internal/quota"
+	"github.com/edalcin/smartlattes/internal/store"
+)
+
+// JobsHandler queues summaries and analyses to be generated in the background
+// (POST /api/jobs) and reports their progress and result
+// (GET /api/jobs/{id}).
+type JobsHandler struct {
+	Store       store.Store
+	Queue       *jobs.Queue
+	NewProvider ProviderFactory
+	Quota       *quota.Limiter
+}
+
+func (h *JobsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/api/jobs":
+		h.handleCreate(w, r)
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/api/jobs/"):
+		h.handleGet(w, r)
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"success": false, "error": "método não permitido"})
+	}
+}
+
+func (h *JobsHandler) handleCreate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Kind string `json:"kind"`
+		generationRequest
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !req.valid() {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"success": false, "error": "kind, lattesId, provider, apiKey e model são obrigatórios"})
+		return
+	}
+	if req.Kind != store.JobSummary && req.Kind != store.JobAnalysis {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"success": false, "error": "kind deve ser summary ou analysis"})
+		return
+	}
+
+	// Recusar de imediato o que a tarefa recusaria ao ser executada
+	if _, ok := h.NewProvider.providerFor(w, req.Provider, req.APIKey); !ok {
+		return
+	}
+	if _, err := h.Store.GetCV(r.Context(), req.LattesID); err != nil {
+		if err.Error() == "CV não encontrado" {
+			writeJSON(w, http.StatusNotFound, map[string]any{"success": false, "error": "CV não encontrado para o ID informado"})
+			return
+		}
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"success": false, "error": "erro ao acessar banco de dados"})
+		return
+	}
+
+	job := store.Job{
+		Kind:     req.Kind,
+		LattesID: req.LattesID,
+		Provider: req.Provider,
+		Model:    req.Model,
+		Client:   h.Quota.Client(r),
+	}
+	queued, err := h.Queue.Enqueue(r.Context(), job, req.APIKey)
+	if errors.Is(err, jobs.ErrFull) {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"success": false, "error": "Há muitas tarefas na fila. Tente novamente em alguns minutos."})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"success": false, "error": "erro ao registrar tarefa"})
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]any{"success": true, "job": queued})
+}
+
+func (h *JobsHandler) handleGet(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/jobs/"), "/")
+	if id == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"success": false, "error": "ID da tarefa é obrigatório"})
+		return
+	}
+
+	job, err := h.Store.GetJob(r.Context(), id)
+	if err != nil {
+		if err.Error() == "tarefa não encontrada" {
+			writeJSON(w, http.StatusNotFound, map[string]any{"success": false, "error": "tarefa não encontrada"})
+			return
+		}
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"success": false, "error": "erro ao acessar banco de dados"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"success": true, "job": job})
+}
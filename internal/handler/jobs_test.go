@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/edalcin/smartlattes/internal/ai"
+	"github.com/edalcin/smartlattes/internal/jobs"
+	"github.com/edalcin/smartlattes/internal/store"
+)
+
+func TestJobs(t *testing.T) {
+	s := seedStore(t, "111", "222")
+	provider := &fakeProvider{Response: "Texto do resumo.", Usage: ai.Usage{InputTokens: 900, OutputTokens: 100}}
+	summary := &SummaryHandler{Store: s, Prompt: "prompt", NewProvider: providers(provider)}
+	analysis := &AnalysisHandler{Store: s, Prompt: "prompt", NewProvider: providers(provider)}
+	queue := &jobs.Queue{Store: s, Run: map[string]jobs.Func{
+		store.JobSummary:  summary.RunJob,
+		store.JobAnalysis: analysis.RunJob,
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := queue.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	h := &JobsHandler{Store: s, Queue: queue, NewProvider: providers(provider)}
+
+	job := map[string]any{"kind": "summary", "lattesId": "111", "provider": "fake", "apiKey": "k", "model": "m"}
+	with := func(key string, value any) map[string]any {
+		req := map[string]any{}
+		for k, v := range job {
+			req[k] = v
+		}
+		req[key] = value
+		return req
+	}
+
+	checkResponse(t, postJSON(t, h, "/api/jobs", with("model", "")), http.StatusBadRequest, "são obrigatórios")
+	checkResponse(t, postJSON(t, h, "/api/jobs", with("kind", "chat")), http.StatusBadRequest, "summary ou analysis")
+	checkResponse(t, postJSON(t, h, "/api/jobs", with("provider", "outro")), http.StatusBadRequest, "provedor desconhecido")
+	checkResponse(t, postJSON(t, h, "/api/jobs", with("lattesId", "999")), http.StatusNotFound, "CV não encontrado")
+	checkResponse(t, get(h, "/api/jobs/nada"), http.StatusNotFound, "tarefa não encontrada")
+
+	// poll returns the job once it has finished.
+	poll := func(body map[string]any) map[string]any {
+		t.Helper()
+		id, _ := body["job"].(map[string]any)["id"].(string)
+		for i := 0; i < 200; i++ {
+			job := checkResponse(t, get(h, "/api/jobs/"+id), http.StatusOK, "")["job"].(map[string]any)
+			if job["status"] == store.JobDone || job["status"] == store.JobFailed {
+				return job
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("job %s did not finish", id)
+		return nil
+	}
+
+	done := poll(checkResponse(t, postJSON(t, h, "/api/jobs", job), http.StatusAccepted, ""))
+	result, _ := done["result"].(map[string]any)
+	if done["status"] != store.JobDone || result["success"] != true || result["summary"] == nil || done["attempts"] != float64(1) {
+		t.Fatalf("summary job = %v", done)
+	}
+	if saved, err := s.GetSummary(context.Background(), "111"); err != nil || saved.Metadata.InputTokens != 900 {
+		t.Errorf("saved summary = %+v, %v", saved, err)
+	}
+
+	analyzed := poll(checkResponse(t, postJSON(t, h, "/api/jobs", with("kind", "analysis")), http.StatusAccepted, ""))
+	if result, _ := analyzed["result"].(map[string]any); analyzed["status"] != store.JobDone || result["analysis"] == nil {
+		t.Fatalf("analysis job = %v", analyzed)
+	}
+
+	provider.Err = ai.ErrInvalidKey
+	failed := poll(checkResponse(t, postJSON(t, h, "/api/jobs", job), http.StatusAccepted, ""))
+	if failed["status"] != store.JobFailed || failed["errorStatus"] != float64(http.StatusUnauthorized) || failed["error"] != "Chave de API inválida ou sem permissão para este provedor" {
+		t.Errorf("failed job = %v", failed)
+	}
+}
@@ -9,7 +9,9 @@ import (
 	"github.com/edalcin/smartlattes/internal/ai"
 )
 
-type ModelsHandler struct{}
+type ModelsHandler struct {
+	NewProvider ProviderFactory
+}
 
 func (h *ModelsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -21,14 +23,13 @@ func (h *ModelsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		Provider string `json:"provider"`
 		APIKey   string `json:"apiKey"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Provider == "" || req.APIKey == "" {
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Provider == "" {
 		writeJSON(w, http.StatusBadRequest, map[string]any{"success": false, "error": "provider e apiKey são obrigatórios"})
 		return
 	}
 
-	provider, err := ai.NewProvider(req.Provider)
-	if err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]any{"success": false, "error": err.Error()})
+	provider, ok := h.NewProvider.providerFor(w, req.Provider, req.APIKey)
+	if !ok {
 		return
 	}
 
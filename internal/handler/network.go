@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/edalcin/smartlattes/internal/dedup"
+	"github.com/edalcin/smartlattes/internal/network"
+	"github.com/edalcin/smartlattes/internal/store"
+)
+
+type NetworkHandler struct {
+	Store store.Store
+}
+
+// ServeHTTP answers /api/network with the co-authorship graph of the whole
+// base and /api/network/{lattesId} with the ego network of one researcher.
+// Passing coauthors=false keeps only the researchers of the base.
+func (h *NetworkHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"success": false, "error": "método não permitido"})
+		return
+	}
+
+	lattesID := strings.TrimPrefix(r.URL.Path, "/api/network")
+	lattesID = strings.Trim(lattesID, "/")
+
+	researchers, err := h.Store.GetAllPublications(r.Context())
+	if err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"success": false, "error": "erro ao acessar banco de dados"})
+		return
+	}
+
+	clusters, err := dedup.Load(r.Context(), h.Store)
+	if err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"success": false, "error": "erro ao acessar banco de dados"})
+		return
+	}
+
+	graph := network.Build(researchers, clusters)
+	if r.URL.Query().Get("coauthors") == "false" {
+		graph = graph.ResearchersOnly()
+	}
+
+	if lattesID != "" {
+		ego, ok := graph.Ego(lattesID)
+		if !ok {
+			writeJSON(w, http.StatusNotFound, map[string]any{"success": false, "error": "CV não encontrado para o ID informado"})
+			return
+		}
+		graph = ego
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"success": true,
+		"nodes":   graph.Nodes,
+		"edges":   graph.Edges,
+	})
+}
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/edalcin/smartlattes/internal/dedup"
+	"github.com/edalcin/smartlattes/internal/export"
+	"github.com/edalcin/smartlattes/internal/network"
+	"github.com/edalcin/smartlattes/internal/store"
+)
+
+type NetworkExportHandler struct {
+	Store store.Store
+}
+
+var networkFormats = map[string]struct {
+	contentType string
+	extension   string
+	serialize   func(*network.Graph) ([]byte, error)
+}{
+	"graphml":   {"application/graphml+xml; charset=utf-8", "graphml", export.ToGraphML},
+	"gexf":      {"application/gexf+xml; charset=utf-8", "gexf", export.ToGEXF},
+	"cytoscape": {"application/json; charset=utf-8", "cyjs", export.ToCytoscapeJSON},
+}
+
+// ServeHTTP downloads the researcher/co-author/area graph of the whole base.
+// Query parameters: format (graphml, gexf or cytoscape), coauthors=false to
+// drop external co-authors and areas=false to drop the area nodes.
+func (h *NetworkExportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"success": false, "error": "método não permitido"})
+		return
+	}
+
+	format, ok := networkFormats[r.URL.Query().Get("format")]
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"success": false, "error": "formato deve ser graphml, gexf ou cytoscape"})
+		return
+	}
+
+	researchers, err := h.Store.GetAllPublications(r.Context())
+	if err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"success": false, "error": "erro ao acessar banco de dados"})
+		return
+	}
+
+	clusters, err := dedup.Load(r.Context(), h.Store)
+	if err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"success": false, "error": "erro ao acessar banco de dados"})
+		return
+	}
+
+	graph := network.Build(researchers, clusters)
+	if r.URL.Query().Get("coauthors") == "false" {
+		graph = graph.ResearchersOnly()
+	}
+	if r.URL.Query().Get("areas") != "false" {
+		graph = graph.WithAreas()
+	}
+
+	body, err := format.serialize(graph)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"success": false, "error": "erro ao exportar rede"})
+		return
+	}
+
+	w.Header().Set("Content-Type", format.contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=rede-smartlattes.%s", format.extension))
+	w.Write(body)
+}
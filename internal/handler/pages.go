@@ -30,7 +30,7 @@ func PageHandler(filename string) http.HandlerFunc {
 func SharePageHandler(indexFile, shareFile string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		filename := indexFile
-		if r.URL.Query().Get("resumo") != "" || r.URL.Query().Get("analise") != "" {
+		if r.URL.Query().Get("resumo") != "" || r.URL.Query().Get("analise") != "" || r.URL.Query().Get("conversa") != "" {
 			filename = shareFile
 		}
 		data, err := staticFS.ReadFile(filename)
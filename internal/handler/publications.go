@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/edalcin/smartlattes/internal/dedup"
+	"github.com/edalcin/smartlattes/internal/store"
+)
+
+type PublicationsHandler struct {
+	Store store.Store
+}
+
+func (h *PublicationsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"success": false, "error": "método não permitido"})
+		return
+	}
+
+	lattesID := strings.TrimPrefix(r.URL.Path, "/api/publications/")
+	lattesID = strings.TrimSuffix(lattesID, "/")
+	if lattesID == "clusters" {
+		h.handleClusters(w, r)
+		return
+	}
+	if lattesID == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"success": false, "error": "lattesID é obrigatório"})
+		return
+	}
+
+	result, err := h.Store.GetPublications(r.Context(), lattesID)
+	if err != nil {
+		if err.Error() == "CV não encontrado" {
+			writeJSON(w, http.StatusNotFound, map[string]any{"success": false, "error": "CV não encontrado para o ID informado"})
+			return
+		}
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"success": false, "error": "erro ao acessar banco de dados"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"success":      true,
+		"lattesId":     result.LattesID,
+		"name":         result.Name,
+		"publications": result.Publications,
+	})
+}
+
+// handleClusters lists the works that appear in more than one CV, or every
+// work of the base with ?all=true, each with its canonical publication ID.
+func (h *PublicationsHandler) handleClusters(w http.ResponseWriter, r *http.Request) {
+	result, err := dedup.Load(r.Context(), h.Store)
+	if err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"success": false, "error": "erro ao acessar banco de dados"})
+		return
+	}
+
+	clusters := result.Duplicated()
+	if r.URL.Query().Get("all") == "true" {
+		clusters = result.Clusters
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"success":  true,
+		"stats":    result.Stats(),
+		"clusters": clusters,
+	})
+}
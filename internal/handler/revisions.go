@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/edalcin/smartlattes/internal/store"
+)
+
+// RevisionsHandler serves the revision history of summaries (Kind
+// store.RevisionSummary) or analyses (store.RevisionAnalysis):
+// .../revisions/{lattesId} lists the revisions and
+// .../revisions/{lattesId}/{revisionId} returns one with its text.
+type RevisionsHandler struct {
+	Store store.Store
+	Kind  string
+}
+
+var revisionPrefixes = map[string]string{
+	store.RevisionSummary:  "/api/summary/revisions/",
+	store.RevisionAnalysis: "/api/analysis/revisions/",
+}
+
+func (h *RevisionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"success": false, "error": "método não permitido"})
+		return
+	}
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, revisionPrefixes[h.Kind]), "/")
+	lattesID, revisionID, _ := strings.Cut(path, "/")
+	if lattesID == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"success": false, "error": "lattesID é obrigatório"})
+		return
+	}
+
+	if revisionID == "" {
+		revisions, err := h.Store.ListRevisions(r.Context(), h.Kind, lattesID)
+		if err != nil {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]any{"success": false, "error": "erro ao acessar banco de dados"})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"success": true, "lattesId": lattesID, "revisions": revisions})
+		return
+	}
+
+	revision, err := h.Store.GetRevision(r.Context(), h.Kind, lattesID, revisionID)
+	if err != nil {
+		if err.Error() == "revisão não encontrada" {
+			writeJSON(w, http.StatusNotFound, map[string]any{"success": false, "error": "revisão não encontrada"})
+			return
+		}
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"success": false, "error": "erro ao acessar banco de dados"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"success": true, "lattesId": lattesID, "revision": revision})
+}
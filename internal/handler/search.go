@@ -7,7 +7,7 @@ import (
 )
 
 type SearchHandler struct {
-	Store *store.MongoDB
+	Store store.Store
 }
 
 func (h *SearchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -3,11 +3,12 @@ package handler
 import (
 	"net/http"
 
+	"github.com/edalcin/smartlattes/internal/dedup"
 	"github.com/edalcin/smartlattes/internal/store"
 )
 
 type StatsHandler struct {
-	Store *store.MongoDB
+	Store store.Store
 }
 
 func (h *StatsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -16,5 +17,13 @@ func (h *StatsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"success": false, "error": "erro ao contar currículos"})
 		return
 	}
-	writeJSON(w, http.StatusOK, map[string]any{"success": true, "count": count})
+
+	// Publicações em coautoria entre pesquisadores da base contam uma única
+	// vez; os agrupamentos são recalculados a cada envio de CV
+	pubStats, err := dedup.LoadStats(r.Context(), h.Store)
+	if err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"success": false, "error": "erro ao contar publicações"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"success": true, "count": count, "publications": pubStats})
 }
@@ -1,20 +1,27 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 
 	"github.com/edalcin/smartlattes/internal/ai"
+	"github.com/edalcin/smartlattes/internal/quota"
 	"github.com/edalcin/smartlattes/internal/store"
 	"go.mongodb.org/mongo-driver/v2/bson"
 )
 
 type SummaryHandler struct {
-	Store  *store.MongoDB
-	Prompt string
+	Store       store.Store
+	Prompt      string
+	NewProvider ProviderFactory
+	Quota       *quota.Limiter
+	Pricing     ai.Pricing
+	// Failover lists the providers tried when the requested one is
+	// unavailable.
+	Failover ai.FailoverChain
 }
 
 func (h *SummaryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -31,110 +38,154 @@ func (h *SummaryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *SummaryHandler) handleGenerate(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		LattesID string `json:"lattesId"`
-		Provider string `json:"provider"`
-		APIKey   string `json:"apiKey"`
-		Model    string `json:"model"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.LattesID == "" || req.Provider == "" || req.APIKey == "" || req.Model == "" {
+	var req generationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !req.valid() {
 		writeJSON(w, http.StatusBadRequest, map[string]any{"success": false, "error": "lattesId, provider, apiKey e model são obrigatórios"})
 		return
 	}
 
-	cvData, err := h.Store.GetCV(r.Context(), req.LattesID)
+	response, err := h.generate(r.Context(), req, h.Quota.Client(r), func(string) {})
 	if err != nil {
-		if err.Error() == "CV não encontrado" {
-			writeJSON(w, http.StatusNotFound, map[string]any{"success": false, "error": "CV não encontrado para o ID informado"})
-			return
-		}
-		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"success": false, "error": "erro ao acessar banco de dados"})
+		writeRequestError(w, err)
 		return
 	}
+	writeJSON(w, http.StatusOK, response)
+}
 
-	cvJSON, err := json.Marshal(cvData)
+// RunJob generates a summary for a background job.
+func (h *SummaryHandler) RunJob(ctx context.Context, job store.Job, apiKey string, progress func(stage string)) (any, error) {
+	req := generationRequest{LattesID: job.LattesID, Provider: job.Provider, APIKey: apiKey, Model: job.Model}
+	return h.generate(ctx, req, job.Client, progress)
+}
+
+// generate produces and saves the summary of a CV and returns the response
+// body. Errors are *requestError.
+func (h *SummaryHandler) generate(ctx context.Context, req generationRequest, client string, progress func(stage string)) (map[string]any, error) {
+	targets, err := h.NewProvider.targets(h.Failover, req.Provider, req.Model, req.APIKey)
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]any{"success": false, "error": "erro ao processar dados do CV"})
-		return
+		return nil, err
 	}
 
-	truncatedData, wasTruncated := ai.TruncateCV(cvData, 20000)
-	userData := string(cvJSON)
-	if wasTruncated {
-		truncatedJSON, _ := json.Marshal(truncatedData)
-		userData = string(truncatedJSON)
+	progress("Preparando os dados do currículo")
+	cvData, err := h.Store.GetCV(ctx, req.LattesID)
+	if err != nil {
+		if err.Error() == "CV não encontrado" {
+			return nil, &requestError{http.StatusNotFound, "CV não encontrado para o ID informado"}
+		}
+		return nil, &requestError{http.StatusServiceUnavailable, "erro ao acessar banco de dados"}
 	}
 
-	provider, err := ai.NewProvider(req.Provider)
+	cvJSON, err := json.Marshal(cvData)
 	if err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]any{"success": false, "error": err.Error()})
-		return
+		return nil, &requestError{http.StatusInternalServerError, "erro ao processar dados do CV"}
 	}
 
-	summary, err := provider.Generate(r.Context(), ai.GenerateRequest{
-		APIKey:       req.APIKey,
-		Model:        req.Model,
-		SystemPrompt: h.Prompt,
-		UserData:     userData,
-		MaxTokens:    4096,
-	})
-	if err != nil {
-		if errors.Is(err, ai.ErrInvalidKey) {
-			writeJSON(w, http.StatusUnauthorized, map[string]any{"success": false, "error": "Chave de API inválida ou sem permissão para este provedor"})
-			return
+	// Cada provedor da cadeia tem sua própria janela de contexto, então o
+	// truncamento e a reserva de cota são refeitos a cada tentativa
+	var (
+		result       ai.Result
+		usage        store.TokenUsage
+		wasTruncated bool
+	)
+	used, err := failover(ctx, targets, func(t target) error {
+		if t.name != req.Provider {
+			progress(fmt.Sprintf("Provedor %s indisponível; tentando %s", req.Provider, t.name))
+		}
+		truncatedData, truncated := ai.TruncateCV(cvData, ai.NewBudget(t.provider, t.model, 4096, h.Prompt))
+		userData := string(cvJSON)
+		if truncated {
+			truncatedJSON, _ := json.Marshal(truncatedData)
+			userData = string(truncatedJSON)
 		}
-		if errors.Is(err, ai.ErrTimeout) {
-			writeJSON(w, http.StatusGatewayTimeout, map[string]any{"success": false, "error": "Tempo limite excedido (120s). Tente um modelo menor ou tente novamente."})
-			return
+
+		inputTokens := quota.EstimateTokens(h.Prompt, userData)
+		reservation, err := reserve(ctx, h.Quota, client, t.provider, t.apiKey, inputTokens+4096)
+		if err != nil {
+			return err
 		}
-		if errors.Is(err, ai.ErrRateLimited) {
-			detail := strings.TrimPrefix(err.Error(), ai.ErrRateLimited.Error()+": ")
-			writeJSON(w, 429, map[string]any{"success": false, "error": "Limite de requisições atingido: " + detail})
-			return
+
+		if t.name == req.Provider {
+			progress("Aguardando a resposta do provedor de IA")
 		}
-		if errors.Is(err, ai.ErrProviderUnavailable) {
-			writeJSON(w, http.StatusServiceUnavailable, map[string]any{"success": false, "error": "Provedor de IA indisponível. Tente novamente mais tarde."})
-			return
+		res, err := t.provider.Generate(ctx, ai.GenerateRequest{
+			APIKey:       t.apiKey,
+			Model:        t.model,
+			SystemPrompt: h.Prompt,
+			UserData:     userData,
+			MaxTokens:    4096,
+		})
+		if err != nil {
+			reservation.Settle(ctx, 0)
+			return err
 		}
-		writeJSON(w, http.StatusInternalServerError, map[string]any{"success": false, "error": err.Error()})
-		return
+
+		call := store.AICall{
+			Kind:      store.CallSummary,
+			LattesID:  req.LattesID,
+			Client:    client,
+			Provider:  t.name,
+			Model:     t.model,
+			ServerKey: ai.ServedByServer(t.provider, t.apiKey),
+		}
+		result, wasTruncated = res, truncated
+		usage = recordCall(ctx, h.Store, h.Pricing, reservation, call, res, inputTokens)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	header := buildSummaryHeader(cvData, req.LattesID, req.Provider, req.Model)
-	summary = header + summary
+	header := buildSummaryHeader(cvData, req.LattesID, used.name, used.model)
+	summary := header + result.Text
 
 	// Salvar automaticamente no banco de dados
-	if err := h.Store.UpsertSummary(r.Context(), req.LattesID, summary, req.Provider, req.Model); err != nil {
-		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"success": false, "error": "resumo gerado mas erro ao salvar no banco de dados"})
-		return
+	progress("Salvando o resultado")
+	meta := store.GenerationMetadata{
+		Provider:   used.name,
+		Model:      used.model,
+		PromptHash: promptHash(h.Prompt),
+		TokenUsage: usage,
+		Failover:   used.failoverFrom(req.Provider, req.Model),
+	}
+	if err := h.Store.UpsertSummary(ctx, req.LattesID, summary, meta); err != nil {
+		return nil, &requestError{http.StatusServiceUnavailable, "resumo gerado mas erro ao salvar no banco de dados"}
 	}
 
 	response := map[string]any{
-		"success":  true,
-		"summary":  summary,
-		"provider": req.Provider,
-		"model":    req.Model,
+		"success":    true,
+		"summary":    summary,
+		"provider":   used.name,
+		"model":      used.model,
+		"usage":      usage,
+		"attempts":   result.Attempts,
+		"promptHash": meta.PromptHash,
+	}
+	if meta.RequestedProvider != "" {
+		response["failover"] = meta.Failover
 	}
 	if wasTruncated {
 		response["truncated"] = true
 		response["truncationWarning"] = "Os dados do CV foram truncados para caber no limite do modelo. Algumas informações podem estar ausentes no resumo."
 	}
-	writeJSON(w, http.StatusOK, response)
+	return response, nil
 }
 
 func (h *SummaryHandler) handleSave(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		LattesID string `json:"lattesId"`
-		Summary  string `json:"summary"`
-		Provider string `json:"provider"`
-		Model    string `json:"model"`
+		LattesID   string           `json:"lattesId"`
+		Summary    string           `json:"summary"`
+		Provider   string           `json:"provider"`
+		Model      string           `json:"model"`
+		PromptHash string           `json:"promptHash"`
+		Usage      store.TokenUsage `json:"usage"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.LattesID == "" || req.Summary == "" || req.Provider == "" || req.Model == "" {
 		writeJSON(w, http.StatusBadRequest, map[string]any{"success": false, "error": "lattesId, summary, provider e model são obrigatórios"})
 		return
 	}
 
-	if err := h.Store.UpsertSummary(r.Context(), req.LattesID, req.Summary, req.Provider, req.Model); err != nil {
+	meta := store.GenerationMetadata{Provider: req.Provider, Model: req.Model, PromptHash: req.PromptHash, TokenUsage: savedUsage(h.Pricing, req.Provider, req.Model, req.Usage)}
+	if err := h.Store.UpsertSummary(r.Context(), req.LattesID, req.Summary, meta); err != nil {
 		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"success": false, "error": "erro ao salvar resumo"})
 		return
 	}
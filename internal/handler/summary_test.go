@@ -0,0 +1,234 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/edalcin/smartlattes/internal/ai"
+	"github.com/edalcin/smartlattes/internal/quota"
+	"github.com/edalcin/smartlattes/internal/store"
+)
+
+func TestSummaryGenerate(t *testing.T) {
+	valid := map[string]any{"lattesId": "111", "provider": "fake", "apiKey": "k", "model": "m"}
+	with := func(key string, value any) map[string]any {
+		req := map[string]any{}
+		for k, v := range valid {
+			req[k] = v
+		}
+		req[key] = value
+		return req
+	}
+
+	type testCase struct {
+		name     string
+		body     any
+		failOps  []string
+		provider *fakeProvider
+		status   int
+		want     string
+	}
+	tests := []testCase{
+		{name: "invalid JSON", body: "{", status: http.StatusBadRequest, want: "são obrigatórios"},
+		{name: "missing lattesId", body: with("lattesId", ""), status: http.StatusBadRequest, want: "são obrigatórios"},
+		{name: "missing apiKey", body: with("apiKey", ""), status: http.StatusBadRequest, want: "apiKey é obrigatória"},
+		{name: "keyless provider", body: with("apiKey", ""), provider: &fakeProvider{Response: "resumo", NoKey: true}, status: http.StatusOK},
+		{name: "unknown CV", body: with("lattesId", "999"), status: http.StatusNotFound, want: "CV não encontrado"},
+		{name: "store error", body: valid, failOps: []string{"GetCV"}, status: http.StatusServiceUnavailable, want: "erro ao acessar banco de dados"},
+		{name: "unknown provider", body: with("provider", "outro"), status: http.StatusBadRequest, want: "provedor desconhecido"},
+		{name: "save error", body: valid, failOps: []string{"UpsertSummary"}, status: http.StatusServiceUnavailable, want: "erro ao salvar"},
+	}
+	for _, tc := range aiErrorCases {
+		tests = append(tests, testCase{name: "provider " + tc.name, body: valid, provider: &fakeProvider{Err: tc.err}, status: tc.status, want: tc.want})
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := tt.provider
+			if provider == nil {
+				provider = &fakeProvider{Response: "resumo"}
+			}
+			h := &SummaryHandler{
+				Store:       failing(seedStore(t, "111"), tt.failOps...),
+				Prompt:      "prompt",
+				NewProvider: providers(provider),
+			}
+			rec := postJSON(t, h, "/api/summary", tt.body)
+			checkResponse(t, rec, tt.status, tt.want)
+		})
+	}
+}
+
+func TestSummaryGenerateSuccess(t *testing.T) {
+	s := seedStore(t, "111")
+	provider := &fakeProvider{Response: "## Perfil\n\nTexto do resumo."}
+	h := &SummaryHandler{Store: s, Prompt: "prompt do resumo", NewProvider: providers(provider)}
+
+	rec := postJSON(t, h, "/api/summary", map[string]any{"lattesId": "111", "provider": "fake", "apiKey": "k", "model": "m"})
+	body := checkResponse(t, rec, http.StatusOK, "")
+
+	summary, _ := body["summary"].(string)
+	if !strings.HasPrefix(summary, "# Pesquisador 111\n") || !strings.HasSuffix(summary, "Texto do resumo.") {
+		t.Errorf("summary = %q, want header followed by the provider's text", summary)
+	}
+	if !strings.Contains(summary, "**Gerado por:** fake / m") {
+		t.Errorf("summary header does not name the provider and model: %q", summary)
+	}
+	if body["promptHash"] != promptHash("prompt do resumo") {
+		t.Errorf("promptHash = %v", body["promptHash"])
+	}
+	if provider.generated.SystemPrompt != "prompt do resumo" || !strings.Contains(provider.generated.UserData, "Pesquisador 111") {
+		t.Errorf("provider got %+v", provider.generated)
+	}
+
+	doc, err := s.GetSummary(context.Background(), "111")
+	if err != nil || doc.Resumo != summary || doc.Metadata.Provider != "fake" {
+		t.Fatalf("stored summary = %+v, %v", doc, err)
+	}
+}
+
+func TestSummaryQuota(t *testing.T) {
+	s := seedStore(t, "111")
+	limiter := &quota.Limiter{Store: s, Limits: quota.Limits{RequestsPerDay: 1}}
+	h := &SummaryHandler{Store: s, Prompt: "prompt", NewProvider: providers(&fakeProvider{Response: "resumo", NoKey: true}), Quota: limiter}
+	managed := map[string]any{"lattesId": "111", "provider": "fake", "model": "m"}
+
+	checkResponse(t, postJSON(t, h, "/api/summary", managed), http.StatusOK, "")
+	checkResponse(t, postJSON(t, h, "/api/summary", managed), http.StatusTooManyRequests, "Cota diária de uso do servidor excedida (limite de 1 requisições por dia)")
+
+	// The user's own key is not counted.
+	managed["apiKey"] = "k"
+	checkResponse(t, postJSON(t, h, "/api/summary", managed), http.StatusOK, "")
+
+	usage, _ := s.ListUsage(context.Background(), limiter.Day())
+	if len(usage) != 1 || usage[0].Client != "192.0.2.1" || usage[0].Requests != 1 || usage[0].Tokens == 0 {
+		t.Errorf("usage = %+v", usage)
+	}
+}
+
+func TestSummaryUsage(t *testing.T) {
+	ctx := context.Background()
+	s := seedStore(t, "111")
+	provider := &fakeProvider{Response: "resumo", Usage: ai.Usage{InputTokens: 3000, OutputTokens: 500}}
+	h := &SummaryHandler{Store: s, Prompt: "prompt", NewProvider: providers(provider), Pricing: ai.Pricing{"m": {Input: 2, Output: 10}}}
+
+	rec := postJSON(t, h, "/api/summary", map[string]any{"lattesId": "111", "provider": "fake", "apiKey": "k", "model": "m"})
+	body := checkResponse(t, rec, http.StatusOK, "")
+	usage, _ := body["usage"].(map[string]any)
+	if usage["inputTokens"] != float64(3000) || usage["outputTokens"] != float64(500) || usage["costUsd"] != 0.011 {
+		t.Errorf("usage = %v", body["usage"])
+	}
+
+	doc, _ := s.GetSummary(ctx, "111")
+	if doc.Metadata.InputTokens != 3000 || doc.Metadata.FinishReason != "stop" || doc.Metadata.CostUSD == nil {
+		t.Errorf("stored metadata = %+v", doc.Metadata)
+	}
+	calls, _ := s.ListAICalls(ctx, 10)
+	if len(calls) != 1 || calls[0].Kind != store.CallSummary || calls[0].LattesID != "111" || calls[0].ServerKey || calls[0].OutputTokens != 500 {
+		t.Errorf("calls = %+v", calls)
+	}
+
+	// Saving sends the usage back; its cost is recomputed, not trusted.
+	postJSON(t, h, "/api/summary/save", map[string]any{"lattesId": "111", "summary": "editado", "provider": "fake", "model": "m",
+		"usage": map[string]any{"inputTokens": 3000, "outputTokens": 500, "costUsd": 99}})
+	doc, _ = s.GetSummary(ctx, "111")
+	if doc.Metadata.CostUSD == nil || *doc.Metadata.CostUSD != 0.011 {
+		t.Errorf("saved metadata = %+v", doc.Metadata)
+	}
+}
+
+func TestSummaryFailover(t *testing.T) {
+	ctx := context.Background()
+	s := seedStore(t, "111")
+	down := &fakeProvider{Err: ai.ErrProviderUnavailable}
+	paid := &fakeProvider{Response: "pago"}
+	backup := &fakeProvider{Response: "Texto da reserva.", NoKey: true}
+	h := &SummaryHandler{
+		Store:       s,
+		Prompt:      "prompt",
+		NewProvider: namedProviders(map[string]ai.AIProvider{"fake": down, "pago": paid, "reserva": backup}),
+		Failover: ai.FailoverChain{
+			{Provider: "fake", Model: "m"},
+			{Provider: "pago", Model: "p"},
+			{Provider: "reserva", Model: "r", Models: map[string]string{"m": "r-grande"}},
+		},
+	}
+	req := map[string]any{"lattesId": "111", "provider": "fake", "apiKey": "k", "model": "m"}
+
+	body := checkResponse(t, postJSON(t, h, "/api/summary", req), http.StatusOK, "")
+	if body["provider"] != "reserva" || body["model"] != "r-grande" || body["failover"] == nil {
+		t.Errorf("response = %v", body)
+	}
+	if summary, _ := body["summary"].(string); !strings.Contains(summary, "**Gerado por:** reserva / r-grande") {
+		t.Errorf("summary header = %q", summary)
+	}
+	// The user's key belongs to the requested provider: fallbacks use the
+	// server's, and those that have none are skipped.
+	if paid.generated != nil || backup.generated == nil || backup.generated.APIKey != "" {
+		t.Errorf("paid got %+v, backup got %+v", paid.generated, backup.generated)
+	}
+	doc, _ := s.GetSummary(ctx, "111")
+	if m := doc.Metadata; m.Provider != "reserva" || m.Model != "r-grande" || m.RequestedProvider != "fake" || m.RequestedModel != "m" {
+		t.Errorf("stored metadata = %+v", m)
+	}
+	calls, _ := s.ListAICalls(ctx, 10)
+	if len(calls) != 1 || calls[0].Provider != "reserva" || !calls[0].ServerKey {
+		t.Errorf("calls = %+v", calls)
+	}
+
+	// Only unavailability and timeouts fail over.
+	backup.generated = nil
+	down.Err = ai.ErrInvalidKey
+	checkResponse(t, postJSON(t, h, "/api/summary", req), http.StatusUnauthorized, "Chave de API inválida")
+	if backup.generated != nil {
+		t.Error("failed over after an invalid key")
+	}
+
+	// When the whole chain fails, the requested provider's error is answered.
+	down.Err, backup.Err = ai.ErrProviderUnavailable, ai.ErrTimeout
+	checkResponse(t, postJSON(t, h, "/api/summary", req), http.StatusServiceUnavailable, "Provedor de IA indisponível")
+}
+
+func TestSummarySave(t *testing.T) {
+	valid := map[string]any{"lattesId": "111", "summary": "texto", "provider": "fake", "model": "m"}
+
+	tests := []struct {
+		name    string
+		method  string
+		body    any
+		failOps []string
+		status  int
+		want    string
+	}{
+		{name: "wrong method", method: http.MethodGet, status: http.StatusMethodNotAllowed, want: "método não permitido"},
+		{name: "invalid JSON", body: "[]", status: http.StatusBadRequest, want: "são obrigatórios"},
+		{name: "missing summary", body: map[string]any{"lattesId": "111", "provider": "fake", "model": "m"}, status: http.StatusBadRequest, want: "são obrigatórios"},
+		{name: "store error", body: valid, failOps: []string{"UpsertSummary"}, status: http.StatusServiceUnavailable, want: "erro ao salvar resumo"},
+		{name: "saved", body: valid, status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := seedStore(t, "111")
+			h := &SummaryHandler{Store: failing(s, tt.failOps...)}
+			if tt.method == http.MethodGet {
+				checkResponse(t, get(h, "/api/summary/save"), tt.status, tt.want)
+				return
+			}
+			checkResponse(t, postJSON(t, h, "/api/summary/save", tt.body), tt.status, tt.want)
+
+			if tt.status == http.StatusOK {
+				doc, err := s.GetSummary(context.Background(), "111")
+				if err != nil || doc.Resumo != "texto" {
+					t.Fatalf("stored summary = %+v, %v", doc, err)
+				}
+				revisions, _ := s.ListRevisions(context.Background(), store.RevisionSummary, "111")
+				if len(revisions) != 1 {
+					t.Fatalf("revisions = %d, want 1", len(revisions))
+				}
+			}
+		})
+	}
+}
@@ -3,17 +3,24 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
+	"log"
+	"mime/multipart"
 	"net/http"
 	"time"
 
+	"github.com/edalcin/smartlattes/internal/dedup"
 	"github.com/edalcin/smartlattes/internal/parser"
 	"github.com/edalcin/smartlattes/internal/store"
 )
 
 type UploadHandler struct {
-	Store         *store.MongoDB
+	Store         store.Store
 	MaxUploadSize int64
+	// MaxBatchSize limits the request body and the decompressed content of a
+	// batch upload; each CV is still limited to MaxUploadSize.
+	MaxBatchSize int64
 }
 
 type uploadResponse struct {
@@ -37,12 +44,45 @@ type productionCount struct {
 	OtherProduction         int `json:"otherProduction"`
 }
 
+// Batch upload statuses.
+const (
+	batchCreated = "created"
+	batchUpdated = "updated"
+	batchFailed  = "failed"
+)
+
+type batchResponse struct {
+	Success bool         `json:"success"`
+	Summary batchSummary `json:"summary"`
+	Results []batchItem  `json:"results"`
+}
+
+type batchSummary struct {
+	Total   int `json:"total"`
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	Failed  int `json:"failed"`
+}
+
+type batchItem struct {
+	File     string `json:"file"`
+	Status   string `json:"status"`
+	LattesID string `json:"lattesId,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
 func (h *UploadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		writeError(w, http.StatusMethodNotAllowed, "Método não permitido")
 		return
 	}
 
+	if r.URL.Path == "/api/upload/batch" {
+		h.handleBatch(w, r)
+		return
+	}
+
 	r.Body = http.MaxBytesReader(w, r.Body, h.MaxUploadSize)
 
 	if err := r.ParseMultipartForm(h.MaxUploadSize); err != nil {
@@ -68,6 +108,19 @@ func (h *UploadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// A Plataforma Lattes entrega o currículo como um .zip com curriculo.xml
+	if isZip(data) {
+		data, err = singleXML(data, h.MaxUploadSize)
+		if err != nil {
+			status := http.StatusBadRequest
+			if err == errMultipleXML {
+				status = http.StatusUnprocessableEntity
+			}
+			writeError(w, status, err.Error())
+			return
+		}
+	}
+
 	result, err := parser.Parse(data)
 	if err != nil {
 		writeError(w, http.StatusBadRequest, err.Error())
@@ -87,6 +140,7 @@ func (h *UploadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusServiceUnavailable, "Erro ao salvar no banco de dados")
 		return
 	}
+	h.regroup(r.Context())
 
 	resp := uploadResponse{
 		Success: true,
@@ -109,6 +163,170 @@ func (h *UploadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(resp)
 }
 
+// handleBatch imports every CV of a multipart request: any number of "files"
+// (or "file") fields, each an XML or a ZIP archive of XMLs. Every CV is parsed
+// and stored on its own, and the response reports created, updated and failed
+// entries with the parser's message.
+func (h *UploadHandler) handleBatch(w http.ResponseWriter, r *http.Request) {
+	maxBatch := h.MaxBatchSize
+	if maxBatch <= 0 {
+		maxBatch = 10 * h.MaxUploadSize
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxBatch)
+
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, "Envio excede o tamanho máximo permitido de "+formatSize(maxBatch))
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	headers := append(r.MultipartForm.File["files"], r.MultipartForm.File["file"]...)
+	if len(headers) == 0 {
+		writeError(w, http.StatusBadRequest, "Nenhum arquivo enviado")
+		return
+	}
+
+	if h.Store == nil {
+		writeError(w, http.StatusServiceUnavailable, "Banco de dados indisponível")
+		return
+	}
+
+	resp := batchResponse{Success: true, Results: []batchItem{}}
+	budget := maxBatch
+	for _, header := range headers {
+		data, err := readUploadedFile(header, maxBatch)
+		if err != nil {
+			resp.add(batchItem{File: header.Filename, Status: batchFailed, Error: err.Error()})
+			continue
+		}
+
+		if !isZip(data) {
+			if int64(len(data)) > h.MaxUploadSize {
+				resp.add(batchItem{File: header.Filename, Status: batchFailed, Error: "Arquivo excede o tamanho máximo permitido de " + formatSize(h.MaxUploadSize)})
+				continue
+			}
+			resp.add(h.importBatchItem(r.Context(), header.Filename, data))
+			continue
+		}
+
+		files, err := extractXML(data, h.MaxUploadSize, budget)
+		if err != nil {
+			resp.add(batchItem{File: header.Filename, Status: batchFailed, Error: err.Error()})
+			continue
+		}
+		if len(files) == 0 {
+			resp.add(batchItem{File: header.Filename, Status: batchFailed, Error: errNoXML.Error()})
+			continue
+		}
+		for _, f := range files {
+			budget -= int64(len(f.Data))
+			name := header.Filename + "/" + f.Name
+			if f.Err != nil {
+				resp.add(batchItem{File: name, Status: batchFailed, Error: f.Err.Error()})
+				continue
+			}
+			resp.add(h.importBatchItem(r.Context(), name, f.Data))
+		}
+	}
+	if resp.Summary.Created+resp.Summary.Updated > 0 {
+		h.regroup(r.Context())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// regroup recomputes the publication clusters after CVs were saved. A failure
+// only leaves the previous clusters in place, so it is logged and the upload
+// still succeeds.
+func (h *UploadHandler) regroup(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Minute)
+	defer cancel()
+
+	if _, err := dedup.Refresh(ctx, h.Store); err != nil {
+		log.Printf("Erro ao agrupar publicações: %v", err)
+	}
+}
+
+func (resp *batchResponse) add(item batchItem) {
+	resp.Results = append(resp.Results, item)
+	resp.Summary.Total++
+	switch item.Status {
+	case batchCreated:
+		resp.Summary.Created++
+	case batchUpdated:
+		resp.Summary.Updated++
+	default:
+		resp.Summary.Failed++
+	}
+}
+
+func (h *UploadHandler) importBatchItem(ctx context.Context, filename string, data []byte) batchItem {
+	item := batchItem{File: filename, Status: batchFailed}
+	if len(data) == 0 {
+		item.Error = "Arquivo vazio"
+		return item
+	}
+
+	result, err := parser.Parse(data)
+	if err != nil {
+		item.Error = err.Error()
+		return item
+	}
+	item.LattesID = result.Summary.LattesID
+	item.Name = result.Summary.Name
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	upsertResult, err := h.Store.UpsertCV(ctx, result.Document, result.Summary.LattesID, filename, int64(len(data)))
+	if err != nil {
+		item.Error = "Erro ao salvar no banco de dados"
+		return item
+	}
+
+	item.Status = batchCreated
+	if upsertResult.Updated {
+		item.Status = batchUpdated
+	}
+	return item
+}
+
+// singleXML extracts the only XML file of a ZIP archive, limiting the
+// decompressed content to maxSize.
+func singleXML(data []byte, maxSize int64) ([]byte, error) {
+	files, err := extractXML(data, maxSize, maxSize)
+	if err != nil {
+		return nil, err
+	}
+	switch len(files) {
+	case 0:
+		return nil, errNoXML
+	case 1:
+		if files[0].Err != nil {
+			return nil, files[0].Err
+		}
+		return files[0].Data, nil
+	default:
+		return nil, errMultipleXML
+	}
+}
+
+func readUploadedFile(header *multipart.FileHeader, limit int64) ([]byte, error) {
+	file, err := header.Open()
+	if err != nil {
+		return nil, errors.New("Erro ao ler o arquivo")
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, limit))
+	if err != nil {
+		return nil, errors.New("Erro ao ler o arquivo")
+	}
+	return data, nil
+}
+
 func writeError(w http.ResponseWriter, status int, message string) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/edalcin/smartlattes/internal/store"
+)
+
+type uploadFile struct {
+	field, name string
+	data        []byte
+}
+
+func multipartRequest(t *testing.T, path string, files ...uploadFile) *http.Request {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for _, f := range files {
+		part, err := mw.CreateFormFile(f.field, f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(f.data)
+	}
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, path, &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+// zipOf builds a ZIP archive from alternating names and contents.
+func zipOf(t *testing.T, entries ...any) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for i := 0; i+1 < len(entries); i += 2 {
+		w, err := zw.Create(entries[i].(string))
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(entries[i+1].([]byte))
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+func newUploadHandler(s store.Store) *UploadHandler {
+	return &UploadHandler{Store: s, MaxUploadSize: 4096, MaxBatchSize: 16384}
+}
+
+func TestUpload(t *testing.T) {
+	cv := lattesXML("111", "Ana Souza")
+
+	tests := []struct {
+		name    string
+		files   []uploadFile
+		store   func(t *testing.T) store.Store
+		status  int
+		want    string
+		updated bool
+	}{
+		{name: "no file", status: http.StatusBadRequest, want: "Nenhum arquivo enviado"},
+		{name: "empty file", files: []uploadFile{{"file", "cv.xml", nil}}, status: http.StatusBadRequest, want: "Arquivo vazio"},
+		{name: "too large", files: []uploadFile{{"file", "cv.xml", bytes.Repeat([]byte("x"), 5000)}}, status: http.StatusRequestEntityTooLarge, want: "tamanho máximo"},
+		{name: "invalid XML", files: []uploadFile{{"file", "cv.xml", []byte("   ")}}, status: http.StatusBadRequest, want: "arquivo XML inválido"},
+		{name: "not a CV", files: []uploadFile{{"file", "cv.xml", []byte("<RAIZ/>")}}, status: http.StatusBadRequest, want: "CURRICULO-VITAE não encontrado"},
+		{name: "missing ID", files: []uploadFile{{"file", "cv.xml", []byte("<CURRICULO-VITAE/>")}}, status: http.StatusBadRequest, want: "NUMERO-IDENTIFICADOR não encontrado"},
+		{name: "invalid ZIP", files: []uploadFile{{"file", "cv.zip", append([]byte("PK\x03\x04"), "lixo"...)}}, status: http.StatusBadRequest, want: "arquivo ZIP inválido"},
+		{name: "ZIP without XML", files: []uploadFile{{"file", "cv.zip", zipOf(t, "leia.txt", []byte("oi"))}}, status: http.StatusBadRequest, want: "não contém arquivos XML"},
+		{name: "ZIP with several CVs", files: []uploadFile{{"file", "cvs.zip", zipOf(t, "a.xml", cv, "b.xml", lattesXML("222", "Beto"))}}, status: http.StatusUnprocessableEntity, want: "use o envio em lote"},
+		{name: "no store", files: []uploadFile{{"file", "cv.xml", cv}}, store: func(t *testing.T) store.Store { return nil }, status: http.StatusServiceUnavailable, want: "Banco de dados indisponível"},
+		{name: "store error", files: []uploadFile{{"file", "cv.xml", cv}}, store: func(t *testing.T) store.Store { return failing(seedStore(t), "UpsertCV") }, status: http.StatusServiceUnavailable, want: "Erro ao salvar"},
+		{name: "created", files: []uploadFile{{"file", "cv.xml", cv}}, status: http.StatusOK},
+		{name: "zipped CV", files: []uploadFile{{"file", "curriculo.zip", zipOf(t, "curriculo.xml", cv)}}, status: http.StatusOK},
+		{name: "updated", files: []uploadFile{{"file", "cv.xml", cv}}, store: func(t *testing.T) store.Store { return seedStore(t, "111") }, status: http.StatusOK, updated: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s store.Store = seedStore(t)
+			if tt.store != nil {
+				s = tt.store(t)
+			}
+			rec := httptest.NewRecorder()
+			newUploadHandler(s).ServeHTTP(rec, multipartRequest(t, "/api/upload", tt.files...))
+			body := checkResponse(t, rec, tt.status, tt.want)
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			data, _ := body["data"].(map[string]any)
+			if data["lattesId"] != "111" || data["name"] != "Ana Souza" || data["lastUpdate"] != "15032024" {
+				t.Errorf("data = %v", data)
+			}
+			if updated, _ := body["updated"].(bool); updated != tt.updated {
+				t.Errorf("updated = %v, want %v", updated, tt.updated)
+			}
+			if _, err := s.GetCV(context.Background(), "111"); err != nil {
+				t.Errorf("CV not stored: %v", err)
+			}
+		})
+	}
+}
+
+func TestUploadMethodNotAllowed(t *testing.T) {
+	checkResponse(t, get(newUploadHandler(seedStore(t)), "/api/upload"), http.StatusMethodNotAllowed, "Método não permitido")
+}
+
+func TestUploadBatch(t *testing.T) {
+	t.Run("no files", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		newUploadHandler(seedStore(t)).ServeHTTP(rec, multipartRequest(t, "/api/upload/batch"))
+		checkResponse(t, rec, http.StatusBadRequest, "Nenhum arquivo enviado")
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		big := uploadFile{"files", "a.xml", bytes.Repeat([]byte("x"), 20000)}
+		newUploadHandler(seedStore(t)).ServeHTTP(rec, multipartRequest(t, "/api/upload/batch", big))
+		checkResponse(t, rec, http.StatusRequestEntityTooLarge, "Envio excede o tamanho máximo permitido")
+	})
+
+	t.Run("no store", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		newUploadHandler(nil).ServeHTTP(rec, multipartRequest(t, "/api/upload/batch", uploadFile{"files", "a.xml", lattesXML("111", "Ana")}))
+		checkResponse(t, rec, http.StatusServiceUnavailable, "Banco de dados indisponível")
+	})
+
+	t.Run("report", func(t *testing.T) {
+		s := seedStore(t, "222")
+		files := []uploadFile{
+			{"files", "ana.xml", lattesXML("111", "Ana")},
+			{"files", "vazio.xml", nil},
+			{"files", "quebrado.xml", []byte("<CURRICULO-VITAE>")},
+			{"files", "grande.xml", bytes.Repeat([]byte("x"), 4097)},
+			{"files", "lote.zip", zipOf(t, "beto.xml", lattesXML("222", "Beto"), "leia.txt", []byte("oi"), "caio.xml", lattesXML("333", "Caio"))},
+			{"file", "leia.zip", zipOf(t, "leia.txt", []byte("oi"))},
+		}
+		rec := httptest.NewRecorder()
+		newUploadHandler(s).ServeHTTP(rec, multipartRequest(t, "/api/upload/batch", files...))
+		body := checkResponse(t, rec, http.StatusOK, "")
+
+		summary := body["summary"].(map[string]any)
+		if summary["total"] != float64(7) || summary["created"] != float64(2) || summary["updated"] != float64(1) || summary["failed"] != float64(4) {
+			t.Errorf("summary = %v", summary)
+		}
+
+		want := []struct{ file, status, error string }{
+			{"ana.xml", batchCreated, ""},
+			{"vazio.xml", batchFailed, "Arquivo vazio"},
+			{"quebrado.xml", batchFailed, "NUMERO-IDENTIFICADOR"},
+			{"grande.xml", batchFailed, "tamanho máximo"},
+			{"lote.zip/beto.xml", batchUpdated, ""},
+			{"lote.zip/caio.xml", batchCreated, ""},
+			{"leia.zip", batchFailed, "não contém arquivos XML"},
+		}
+		results := body["results"].([]any)
+		if len(results) != len(want) {
+			t.Fatalf("got %d results, want %d: %v", len(results), len(want), results)
+		}
+		for i, w := range want {
+			r := results[i].(map[string]any)
+			msg, _ := r["error"].(string)
+			if r["file"] != w.file || r["status"] != w.status || !strings.Contains(msg, w.error) || (w.error == "") != (msg == "") {
+				t.Errorf("result %d = %v, want %+v", i, r, w)
+			}
+		}
+
+		if n, _ := s.CountCVs(context.Background()); n != 3 {
+			t.Errorf("stored %d CVs, want 3", n)
+		}
+	})
+
+	t.Run("store error", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		h := newUploadHandler(failing(seedStore(t), "UpsertCV"))
+		h.ServeHTTP(rec, multipartRequest(t, "/api/upload/batch", uploadFile{"files", "ana.xml", lattesXML("111", "Ana")}))
+		body := checkResponse(t, rec, http.StatusOK, "")
+		r := body["results"].([]any)[0].(map[string]any)
+		if r["status"] != batchFailed || r["error"] != "Erro ao salvar no banco de dados" || r["lattesId"] != "111" {
+			t.Errorf("result = %v", r)
+		}
+	})
+}
@@ -8,7 +8,7 @@ import (
 )
 
 type SummaryViewHandler struct {
-	Store *store.MongoDB
+	Store store.Store
 }
 
 func (h *SummaryViewHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -44,7 +44,7 @@ func (h *SummaryViewHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 type AnalysisViewHandler struct {
-	Store *store.MongoDB
+	Store store.Store
 }
 
 func (h *AnalysisViewHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
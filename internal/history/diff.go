@@ -0,0 +1,80 @@
+// Package history compares two versions of a researcher's CV.
+package history
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/edalcin/smartlattes/internal/dedup"
+	"github.com/edalcin/smartlattes/internal/parser"
+	"github.com/edalcin/smartlattes/internal/textnorm"
+)
+
+type PublicationChanges struct {
+	Added   []parser.Publication `json:"added"`
+	Removed []parser.Publication `json:"removed"`
+}
+
+type DegreeChanges struct {
+	Added   []parser.Degree `json:"added"`
+	Removed []parser.Degree `json:"removed"`
+}
+
+type AreaChanges struct {
+	Added   []parser.Area `json:"added"`
+	Removed []parser.Area `json:"removed"`
+}
+
+// Diff lists what changed from one version of a CV to another.
+type Diff struct {
+	Publications PublicationChanges `json:"publications"`
+	Degrees      DegreeChanges      `json:"degrees"`
+	Areas        AreaChanges        `json:"areas"`
+}
+
+// Compare reports the publications, degrees and areas present in only one of
+// the two curriculo-vitae trees. Publications are matched by dedup.Key, so a
+// work whose DOI or title was edited shows up as removed and added.
+func Compare(from, to map[string]interface{}) Diff {
+	var d Diff
+	d.Publications.Added, d.Publications.Removed = changes(
+		parser.ExtractPublications(from).All(),
+		parser.ExtractPublications(to).All(),
+		dedup.Key,
+	)
+	d.Degrees.Added, d.Degrees.Removed = changes(parser.ExtractDegrees(from), parser.ExtractDegrees(to), degreeKey)
+	d.Areas.Added, d.Areas.Removed = changes(parser.ExtractAreas(from), parser.ExtractAreas(to), areaKey)
+	return d
+}
+
+// changes returns the items of to missing from from (added) and the items of
+// from missing from to (removed), keeping their original order.
+func changes[T any](from, to []T, key func(T) string) (added, removed []T) {
+	added, removed = []T{}, []T{}
+	fromKeys := make(map[string]bool, len(from))
+	for _, item := range from {
+		fromKeys[key(item)] = true
+	}
+	toKeys := make(map[string]bool, len(to))
+	for _, item := range to {
+		k := key(item)
+		toKeys[k] = true
+		if !fromKeys[k] {
+			added = append(added, item)
+		}
+	}
+	for _, item := range from {
+		if !toKeys[key(item)] {
+			removed = append(removed, item)
+		}
+	}
+	return added, removed
+}
+
+func degreeKey(d parser.Degree) string {
+	return strings.Join([]string{d.Level, textnorm.Fold(d.Course), textnorm.Fold(d.Institution), strconv.Itoa(d.StartYear)}, "|")
+}
+
+func areaKey(a parser.Area) string {
+	return strings.Join([]string{textnorm.Fold(a.GrandeArea), textnorm.Fold(a.Area), textnorm.Fold(a.SubArea), textnorm.Fold(a.Especialidade)}, "|")
+}
@@ -0,0 +1,159 @@
+package history
+
+import (
+	"testing"
+
+	"github.com/edalcin/smartlattes/internal/parser"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// cv parses a Lattes export holding the given DADOS-GERAIS children and
+// PRODUCAO-BIBLIOGRAFICA content, encoded in ISO-8859-1 like the files the
+// platform generates, and returns its curriculo-vitae tree.
+func cv(t *testing.T, dadosGerais, producao string) map[string]interface{} {
+	t.Helper()
+	xml := `<CURRICULO-VITAE NUMERO-IDENTIFICADOR="1234567890123456">` +
+		`<DADOS-GERAIS NOME-COMPLETO="Ana Souza">` + dadosGerais + `</DADOS-GERAIS>` +
+		`<PRODUCAO-BIBLIOGRAFICA>` + producao + `</PRODUCAO-BIBLIOGRAFICA>` +
+		`</CURRICULO-VITAE>`
+	latin1, err := charmap.ISO8859_1.NewEncoder().String(xml)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := parser.Parse([]byte(latin1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res.Document["curriculo-vitae"].(map[string]interface{})
+}
+
+func article(seq, title, year, doi string) string {
+	return `<ARTIGOS-PUBLICADOS><ARTIGO-PUBLICADO SEQUENCIA-PRODUCAO="` + seq + `">` +
+		`<DADOS-BASICOS-DO-ARTIGO TITULO-DO-ARTIGO="` + title + `" ANO-DO-ARTIGO="` + year + `" DOI="` + doi + `"/>` +
+		`</ARTIGO-PUBLICADO></ARTIGOS-PUBLICADOS>`
+}
+
+func book(title string) string {
+	return `<LIVROS-E-CAPITULOS><LIVROS-PUBLICADOS-OU-ORGANIZADOS><LIVRO-PUBLICADO-OU-ORGANIZADO SEQUENCIA-PRODUCAO="9">` +
+		`<DADOS-BASICOS-DO-LIVRO TITULO-DO-LIVRO="` + title + `" ANO="2019"/>` +
+		`</LIVRO-PUBLICADO-OU-ORGANIZADO></LIVROS-PUBLICADOS-OU-ORGANIZADOS></LIVROS-E-CAPITULOS>`
+}
+
+func degree(level, course, institution, start string) string {
+	return `<FORMACAO-ACADEMICA-TITULACAO><` + level + ` NOME-CURSO="` + course + `" NOME-INSTITUICAO="` + institution + `" ANO-DE-INICIO="` + start + `"/></FORMACAO-ACADEMICA-TITULACAO>`
+}
+
+func area(seq, name, specialty string) string {
+	return `<AREA-DE-ATUACAO SEQUENCIA-AREA-DE-ATUACAO="` + seq + `" NOME-GRANDE-AREA-DO-CONHECIMENTO="CIENCIAS_BIOLOGICAS" NOME-DA-AREA-DO-CONHECIMENTO="` + name + `" NOME-DA-ESPECIALIDADE="` + specialty + `"/>`
+}
+
+func areas(items ...string) string {
+	s := `<AREAS-DE-ATUACAO>`
+	for _, item := range items {
+		s += item
+	}
+	return s + `</AREAS-DE-ATUACAO>`
+}
+
+func titles(pubs []parser.Publication) []string {
+	out := make([]string, len(pubs))
+	for i, p := range pubs {
+		out[i] = p.Title
+	}
+	return out
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestComparePublications(t *testing.T) {
+	tests := []struct {
+		name           string
+		from, to       string
+		added, removed []string
+	}{
+		{"unchanged", article("1", "Plantas medicinais", "2020", ""), article("1", "Plantas medicinais", "2020", ""), nil, nil},
+		{"added", article("1", "Plantas medicinais", "2020", ""), article("1", "Plantas medicinais", "2020", "") + book("Flora do cerrado"), []string{"Flora do cerrado"}, nil},
+		{"removed", article("1", "Plantas medicinais", "2020", "") + book("Flora do cerrado"), book("Flora do cerrado"), nil, []string{"Plantas medicinais"}},
+		{"same DOI", article("1", "Plantas medicinais", "2020", "10.1000/xyz"), article("3", "Plantas Medicinais do Sul", "2021", "10.1000/XYZ"), nil, nil},
+		{"title edited", article("1", "Plantas medicinais", "2020", ""), article("1", "Plantas aromáticas", "2020", ""), []string{"Plantas aromáticas"}, []string{"Plantas medicinais"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := Compare(cv(t, "", tt.from), cv(t, "", tt.to))
+			if got := titles(d.Publications.Added); !equal(got, tt.added) {
+				t.Errorf("added = %q, want %q", got, tt.added)
+			}
+			if got := titles(d.Publications.Removed); !equal(got, tt.removed) {
+				t.Errorf("removed = %q, want %q", got, tt.removed)
+			}
+		})
+	}
+}
+
+func TestCompareDegreesAndAreas(t *testing.T) {
+	from := cv(t, degree("MESTRADO", "Ecologia", "Universidade de São Paulo", "2010")+
+		areas(area("1", "Ecologia", "Etnobotânica"), area("2", "Botânica", "")), "")
+
+	tests := []struct {
+		name                         string
+		dadosGerais                  string
+		degreesAdded, degreesRemoved int
+		areasAdded, areasRemoved     []string
+	}{
+		{
+			name: "unchanged",
+			dadosGerais: degree("MESTRADO", "Ecologia", "Universidade de São Paulo", "2010") +
+				areas(area("1", "Ecologia", "Etnobotânica"), area("2", "Botânica", "")),
+		},
+		{
+			// Editing case, accents and spacing is not a change.
+			name: "reformatted",
+			dadosGerais: degree("MESTRADO", "ECOLOGIA", "Universidade de Sao  Paulo", "2010") +
+				areas(area("1", "Botanica", ""), area("2", "ecologia", "Etnobotanica")),
+		},
+		{
+			name: "degree added",
+			dadosGerais: `<FORMACAO-ACADEMICA-TITULACAO>` +
+				`<MESTRADO NOME-CURSO="Ecologia" NOME-INSTITUICAO="Universidade de São Paulo" ANO-DE-INICIO="2010"/>` +
+				`<DOUTORADO NOME-CURSO="Ecologia" NOME-INSTITUICAO="Universidade de São Paulo" ANO-DE-INICIO="2013"/>` +
+				`</FORMACAO-ACADEMICA-TITULACAO>` +
+				areas(area("1", "Ecologia", "Etnobotânica"), area("2", "Botânica", "")),
+			degreesAdded: 1,
+		},
+		{
+			name: "degree and area replaced",
+			dadosGerais: degree("MESTRADO", "Ecologia", "Universidade de Brasília", "2010") +
+				areas(area("1", "Ecologia", "Etnobotânica"), area("2", "Zoologia", "")),
+			degreesAdded: 1, degreesRemoved: 1,
+			areasAdded: []string{"Zoologia"}, areasRemoved: []string{"Botânica"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := Compare(from, cv(t, tt.dadosGerais, ""))
+			if len(d.Degrees.Added) != tt.degreesAdded || len(d.Degrees.Removed) != tt.degreesRemoved {
+				t.Errorf("degrees = %+v", d.Degrees)
+			}
+			var added, removed []string
+			for _, a := range d.Areas.Added {
+				added = append(added, a.Area)
+			}
+			for _, a := range d.Areas.Removed {
+				removed = append(removed, a.Area)
+			}
+			if !equal(added, tt.areasAdded) || !equal(removed, tt.areasRemoved) {
+				t.Errorf("areas added %q, removed %q; want %q, %q", added, removed, tt.areasAdded, tt.areasRemoved)
+			}
+		})
+	}
+}
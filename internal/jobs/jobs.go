@@ -0,0 +1,243 @@
+// Package jobs runs summaries and analyses in the background, so a result is
+// not lost when the browser tab is closed, a proxy times out or the server
+// restarts while it is being generated.
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/edalcin/smartlattes/internal/store"
+)
+
+// Func generates the result of a job. apiKey is the key the user sent, if
+// any; progress records a description of the current stage. Errors that
+// implement HTTPStatus() int are stored with that status.
+type Func func(ctx context.Context, job store.Job, apiKey string, progress func(stage string)) (any, error)
+
+// ErrFull is returned by Enqueue when too many jobs are waiting.
+var ErrFull = errors.New("fila de tarefas cheia")
+
+// maxAttempts is how many times a job interrupted by restarts is started
+// before it is given up.
+const maxAttempts = 3
+
+// Queue stores jobs and runs them with a fixed pool of workers.
+type Queue struct {
+	Store store.Store
+	// Run maps each job kind to the function that executes it.
+	Run map[string]Func
+	// Workers is how many jobs run at once; 2 when zero.
+	Workers int
+	// Size is how many jobs may wait to run; 100 when zero.
+	Size int
+
+	Now func() time.Time
+
+	once  sync.Once
+	ready chan string
+	wg    sync.WaitGroup
+
+	mu   sync.Mutex
+	keys map[string]string // job ID -> user's API key
+}
+
+func (q *Queue) now() time.Time {
+	if q.Now != nil {
+		return q.Now()
+	}
+	return time.Now().UTC()
+}
+
+func (q *Queue) init() {
+	q.once.Do(func() {
+		size := q.Size
+		if size <= 0 {
+			size = 100
+		}
+		q.ready = make(chan string, size)
+		q.keys = make(map[string]string)
+	})
+}
+
+// Start resumes the jobs left unfinished by a previous run of the server and
+// starts the workers, which stop when ctx is done. Jobs that need a user's
+// API key cannot be resumed, since keys are not stored, and fail. The workers
+// are started even when the unfinished jobs cannot be listed.
+func (q *Queue) Start(ctx context.Context) error {
+	q.init()
+	workers := q.Workers
+	if workers <= 0 {
+		workers = 2
+	}
+	for i := 0; i < workers; i++ {
+		q.wg.Add(1)
+		go func() {
+			defer q.wg.Done()
+			q.work(ctx)
+		}()
+	}
+
+	pending, err := q.Store.ListJobs(ctx, store.JobQueued, store.JobRunning)
+	if err != nil {
+		return err
+	}
+	var resume []string
+	for _, job := range pending {
+		switch {
+		case job.UserKey:
+			q.fail(ctx, &job, http.StatusServiceUnavailable, "A tarefa foi interrompida pelo reinício do servidor. Como a chave de API não é armazenada, envie o pedido novamente.")
+		case job.Attempts >= maxAttempts:
+			q.fail(ctx, &job, http.StatusInternalServerError, "A tarefa foi interrompida repetidamente e não será retomada.")
+		default:
+			job.Status, job.Stage, job.UpdatedAt = store.JobQueued, "", q.now()
+			q.save(ctx, &job)
+			resume = append(resume, job.ID)
+		}
+	}
+	if len(resume) > 0 {
+		log.Printf("Retomando %d tarefa(s) pendente(s)", len(resume))
+		go func() {
+			for _, id := range resume {
+				select {
+				case q.ready <- id:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	return nil
+}
+
+// Wait blocks until the workers have stopped.
+func (q *Queue) Wait() {
+	q.wg.Wait()
+}
+
+// Enqueue stores a new job made of the kind, researcher, provider, model and
+// client of job and schedules it. apiKey is kept in memory only.
+func (q *Queue) Enqueue(ctx context.Context, job store.Job, apiKey string) (*store.Job, error) {
+	q.init()
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	now := q.now()
+	job.ID = hex.EncodeToString(id)
+	job.Status = store.JobQueued
+	job.UserKey = apiKey != ""
+	job.CreatedAt, job.UpdatedAt = now, now
+	if len(q.ready) == cap(q.ready) {
+		return nil, ErrFull
+	}
+	if err := q.Store.SaveJob(ctx, job); err != nil {
+		return nil, err
+	}
+
+	if apiKey != "" {
+		q.mu.Lock()
+		q.keys[job.ID] = apiKey
+		q.mu.Unlock()
+	}
+	select {
+	case q.ready <- job.ID:
+	default:
+		q.forget(job.ID)
+		q.fail(ctx, &job, http.StatusServiceUnavailable, ErrFull.Error())
+		return nil, ErrFull
+	}
+	return &job, nil
+}
+
+func (q *Queue) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-q.ready:
+			q.run(ctx, id)
+		}
+	}
+}
+
+func (q *Queue) run(ctx context.Context, id string) {
+	job, err := q.Store.GetJob(ctx, id)
+	if err != nil {
+		log.Printf("Erro ao ler tarefa %s: %v", id, err)
+		return
+	}
+	if job.Status != store.JobQueued {
+		return
+	}
+	run, ok := q.Run[job.Kind]
+	if !ok {
+		q.fail(ctx, job, http.StatusBadRequest, "tipo de tarefa desconhecido: "+job.Kind)
+		return
+	}
+
+	q.mu.Lock()
+	apiKey := q.keys[id]
+	q.mu.Unlock()
+
+	job.Status, job.Attempts, job.UpdatedAt = store.JobRunning, job.Attempts+1, q.now()
+	q.save(ctx, job)
+
+	progress := func(stage string) {
+		job.Stage, job.UpdatedAt = stage, q.now()
+		q.save(ctx, job)
+	}
+	result, err := run(ctx, *job, apiKey, progress)
+	if ctx.Err() != nil {
+		// Shutting down: the job stays running and is resumed on the next
+		// start.
+		return
+	}
+	q.forget(id)
+
+	if err != nil {
+		status := http.StatusInternalServerError
+		var withStatus interface{ HTTPStatus() int }
+		if errors.As(err, &withStatus) {
+			status = withStatus.HTTPStatus()
+		}
+		q.fail(ctx, job, status, err.Error())
+		return
+	}
+	raw, err := json.Marshal(result)
+	if err != nil {
+		q.fail(ctx, job, http.StatusInternalServerError, "erro ao gravar o resultado da tarefa")
+		return
+	}
+	now := q.now()
+	job.Status, job.Stage, job.Result = store.JobDone, "", raw
+	job.UpdatedAt, job.FinishedAt = now, &now
+	q.save(ctx, job)
+}
+
+func (q *Queue) fail(ctx context.Context, job *store.Job, status int, message string) {
+	now := q.now()
+	job.Status, job.Stage = store.JobFailed, ""
+	job.Error, job.ErrorStatus = message, status
+	job.UpdatedAt, job.FinishedAt = now, &now
+	q.save(ctx, job)
+}
+
+func (q *Queue) save(ctx context.Context, job *store.Job) {
+	if err := q.Store.SaveJob(ctx, *job); err != nil {
+		log.Printf("Erro ao salvar tarefa %s: %v", job.ID, err)
+	}
+}
+
+func (q *Queue) forget(id string) {
+	q.mu.Lock()
+	delete(q.keys, id)
+	q.mu.Unlock()
+}
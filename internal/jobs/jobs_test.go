@@ -0,0 +1,114 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/edalcin/smartlattes/internal/store"
+)
+
+// wait returns the job once it has finished.
+func wait(t *testing.T, s store.Store, id string) *store.Job {
+	t.Helper()
+	for i := 0; i < 200; i++ {
+		job, err := s.GetJob(context.Background(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status == store.JobDone || job.Status == store.JobFailed {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return nil
+}
+
+type statusError struct{}
+
+func (statusError) Error() string   { return "limite atingido" }
+func (statusError) HTTPStatus() int { return http.StatusTooManyRequests }
+
+func TestQueue(t *testing.T) {
+	s := store.NewMemoryStore()
+	var keys []string
+	q := &Queue{Store: s, Run: map[string]Func{
+		store.JobSummary: func(ctx context.Context, job store.Job, apiKey string, progress func(string)) (any, error) {
+			keys = append(keys, apiKey)
+			progress("gerando")
+			if job.LattesID == "falha" {
+				return nil, statusError{}
+			}
+			if job.LattesID == "erro" {
+				return nil, errors.New("inesperado")
+			}
+			return map[string]any{"success": true, "summary": "resumo de " + job.LattesID}, nil
+		},
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := q.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := q.Enqueue(ctx, store.Job{Kind: store.JobSummary, LattesID: "1"}, "segredo")
+	if err != nil || job.Status != store.JobQueued || !job.UserKey || len(job.ID) != 32 {
+		t.Fatalf("enqueued job = %+v, %v", job, err)
+	}
+	done := wait(t, s, job.ID)
+	if done.Status != store.JobDone || string(done.Result) != `{"success":true,"summary":"resumo de 1"}` || done.FinishedAt == nil {
+		t.Errorf("done job = %+v", done)
+	}
+	if len(keys) != 1 || keys[0] != "segredo" {
+		t.Errorf("keys passed to the job = %q", keys)
+	}
+
+	for id, status := range map[string]int{"falha": http.StatusTooManyRequests, "erro": http.StatusInternalServerError} {
+		job, _ := q.Enqueue(ctx, store.Job{Kind: store.JobSummary, LattesID: id}, "")
+		if failed := wait(t, s, job.ID); failed.Status != store.JobFailed || failed.ErrorStatus != status || failed.Error == "" {
+			t.Errorf("failed job = %+v", failed)
+		}
+	}
+
+	job, _ = q.Enqueue(ctx, store.Job{Kind: "outro", LattesID: "1"}, "")
+	if failed := wait(t, s, job.ID); failed.ErrorStatus != http.StatusBadRequest {
+		t.Errorf("unknown kind = %+v", failed)
+	}
+}
+
+func TestQueueResume(t *testing.T) {
+	s := store.NewMemoryStore()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	created := time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)
+	for _, job := range []store.Job{
+		{ID: "servidor", Kind: store.JobSummary, Status: store.JobRunning, Attempts: 1, CreatedAt: created},
+		{ID: "usuario", Kind: store.JobSummary, Status: store.JobQueued, UserKey: true, CreatedAt: created},
+		{ID: "insistente", Kind: store.JobSummary, Status: store.JobRunning, Attempts: maxAttempts, CreatedAt: created},
+	} {
+		s.SaveJob(ctx, job)
+	}
+
+	q := &Queue{Store: s, Run: map[string]Func{
+		store.JobSummary: func(ctx context.Context, job store.Job, apiKey string, progress func(string)) (any, error) {
+			return "ok", nil
+		},
+	}}
+	if err := q.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if job := wait(t, s, "servidor"); job.Status != store.JobDone || job.Attempts != 2 {
+		t.Errorf("resumed job = %+v", job)
+	}
+	if job := wait(t, s, "usuario"); job.Status != store.JobFailed || job.ErrorStatus != http.StatusServiceUnavailable {
+		t.Errorf("job that needed the user's key = %+v", job)
+	}
+	if job := wait(t, s, "insistente"); job.Status != store.JobFailed {
+		t.Errorf("job interrupted too often = %+v", job)
+	}
+}
@@ -0,0 +1,372 @@
+// Package network builds the co-authorship graph of the researchers stored in
+// the base from the AUTORES lists of their publications.
+package network
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/edalcin/smartlattes/internal/dedup"
+	"github.com/edalcin/smartlattes/internal/parser"
+	"github.com/edalcin/smartlattes/internal/store"
+	"github.com/edalcin/smartlattes/internal/textnorm"
+)
+
+// Node kinds.
+const (
+	KindResearcher = "researcher"
+	KindCoauthor   = "coauthor"
+	KindArea       = "area"
+)
+
+// Edge kinds.
+const (
+	EdgeCoauthorship = "coauthorship"
+	EdgeArea         = "area"
+)
+
+// Node is a researcher of the base (ID is the Lattes ID), an external
+// co-author (ID is "cnpq:<NRO-ID-CNPQ>" or "nome:<normalized name>") or, in
+// graphs returned by WithAreas, an area of knowledge (ID is "area:<name>").
+// The production counts are only filled for researchers of the base.
+type Node struct {
+	ID               string `json:"id"`
+	Label            string `json:"label"`
+	Kind             string `json:"kind"`
+	LattesID         string `json:"lattesId,omitempty"`
+	MainArea         string `json:"mainArea,omitempty"`
+	Publications     int    `json:"publications"`
+	Articles         int    `json:"articles,omitempty"`
+	Books            int    `json:"books,omitempty"`
+	Chapters         int    `json:"chapters,omitempty"`
+	ConferencePapers int    `json:"conferencePapers,omitempty"`
+	Researchers      int    `json:"researchers,omitempty"`
+}
+
+// Edge links two co-authors, with Weight the number of distinct publications
+// they share, or a researcher to one of their areas (Weight 1).
+type Edge struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Kind   string `json:"kind"`
+	Weight int    `json:"weight"`
+}
+
+type Graph struct {
+	Nodes []Node `json:"nodes"`
+	Edges []Edge `json:"edges"`
+
+	areas map[string][]string
+}
+
+// builder accumulates the graph while the publications are walked.
+type builder struct {
+	areas     map[string][]string // researcher ID -> area names
+	nodes     map[string]*Node
+	names     map[string]map[string]int // node ID -> label candidates -> occurrences
+	pubs      map[string]map[string]bool
+	byName    map[string]string // normalized citation/full name -> researcher ID
+	extByCNPq map[string]string // normalized name -> external CNPq node ID
+}
+
+// Build computes the co-authorship graph. Authors are matched to researchers
+// of the base by NRO-ID-CNPQ first and by normalized citation names
+// (nome-em-citacoes-bibliograficas and nome-completo) otherwise. A work listed
+// in several CVs is counted once, as grouped in clusters, the stored grouping
+// returned by dedup.Load. Publications the grouping does not know yet, from a
+// CV sent after it was saved, are identified by dedup.Key.
+func Build(researchers []store.ResearcherPublications, clusters *dedup.Result) *Graph {
+	b := &builder{
+		areas:     make(map[string][]string),
+		nodes:     make(map[string]*Node),
+		names:     make(map[string]map[string]int),
+		pubs:      make(map[string]map[string]bool),
+		byName:    make(map[string]string),
+		extByCNPq: make(map[string]string),
+	}
+
+	ambiguous := make(map[string]bool)
+	for _, r := range researchers {
+		b.nodes[r.LattesID] = &Node{
+			ID:               r.LattesID,
+			Label:            r.Name,
+			Kind:             KindResearcher,
+			LattesID:         r.LattesID,
+			Articles:         len(r.Publications.Articles),
+			Books:            len(r.Publications.Books),
+			Chapters:         len(r.Publications.Chapters),
+			ConferencePapers: len(r.Publications.ConferencePapers),
+		}
+		b.areas[r.LattesID] = areaNames(r.Areas)
+		if len(b.areas[r.LattesID]) > 0 {
+			b.nodes[r.LattesID].MainArea = b.areas[r.LattesID][0]
+		}
+		for _, name := range researcherNames(r) {
+			if other, exists := b.byName[name]; exists && other != r.LattesID {
+				ambiguous[name] = true
+				continue
+			}
+			b.byName[name] = r.LattesID
+		}
+	}
+	for name := range ambiguous {
+		delete(b.byName, name)
+	}
+
+	// First pass: learn which external names carry a CNPq ID, so occurrences of
+	// the same person without the ID resolve to the same node.
+	for _, r := range researchers {
+		for _, p := range r.Publications.All() {
+			for _, a := range p.Authors {
+				if a.CNPqID == "" || b.nodes[a.CNPqID] != nil {
+					continue
+				}
+				for _, name := range []string{textnorm.Fold(a.CitationName), textnorm.Fold(a.Name)} {
+					if name != "" {
+						b.extByCNPq[name] = "cnpq:" + a.CNPqID
+					}
+				}
+			}
+		}
+	}
+
+	for _, r := range researchers {
+		for i, p := range r.Publications.All() {
+			key := clusters.CanonicalID(r.LattesID, i)
+			if key == "" {
+				key = "key:" + dedup.Key(p)
+			}
+			authors := b.pubs[key]
+			if authors == nil {
+				authors = make(map[string]bool)
+				b.pubs[key] = authors
+			}
+			// The CV owner is always an author of their own production, even
+			// when the AUTORES entry cannot be matched.
+			authors[r.LattesID] = true
+			for _, a := range p.Authors {
+				id := b.resolve(a.CNPqID, a.CitationName, a.Name)
+				if id == "" {
+					continue
+				}
+				authors[id] = true
+			}
+		}
+	}
+
+	return b.graph()
+}
+
+// resolve returns the node ID for an author, creating external nodes on demand.
+func (b *builder) resolve(cnpqID, citationName, fullName string) string {
+	citation := textnorm.Fold(citationName)
+	full := textnorm.Fold(fullName)
+
+	var id string
+	switch {
+	case cnpqID != "" && b.nodes[cnpqID] != nil && b.nodes[cnpqID].Kind == KindResearcher:
+		id = cnpqID
+	case b.byName[citation] != "":
+		id = b.byName[citation]
+	case b.byName[full] != "":
+		id = b.byName[full]
+	case cnpqID != "":
+		id = "cnpq:" + cnpqID
+	case b.extByCNPq[citation] != "":
+		id = b.extByCNPq[citation]
+	case b.extByCNPq[full] != "":
+		id = b.extByCNPq[full]
+	case citation != "":
+		id = "nome:" + citation
+	case full != "":
+		id = "nome:" + full
+	default:
+		return ""
+	}
+
+	if b.nodes[id] == nil {
+		b.nodes[id] = &Node{ID: id, Kind: KindCoauthor}
+	}
+	if b.nodes[id].Kind == KindCoauthor {
+		label := strings.TrimSpace(fullName)
+		if label == "" {
+			label = strings.TrimSpace(citationName)
+		}
+		if b.names[id] == nil {
+			b.names[id] = make(map[string]int)
+		}
+		b.names[id][label]++
+	}
+	return id
+}
+
+func (b *builder) graph() *Graph {
+	weights := make(map[[2]string]int)
+	for _, authors := range b.pubs {
+		ids := make([]string, 0, len(authors))
+		for id := range authors {
+			ids = append(ids, id)
+			b.nodes[id].Publications++
+		}
+		sort.Strings(ids)
+		for i := 0; i < len(ids); i++ {
+			for j := i + 1; j < len(ids); j++ {
+				// Only links that involve a researcher of the base are kept;
+				// external co-authors of the same paper are not linked to
+				// each other.
+				if b.nodes[ids[i]].Kind != KindResearcher && b.nodes[ids[j]].Kind != KindResearcher {
+					continue
+				}
+				weights[[2]string{ids[i], ids[j]}]++
+			}
+		}
+	}
+
+	g := &Graph{Nodes: make([]Node, 0, len(b.nodes)), Edges: make([]Edge, 0, len(weights))}
+	for id, n := range b.nodes {
+		if n.Kind == KindCoauthor {
+			n.Label = mostFrequent(b.names[id])
+		}
+		g.Nodes = append(g.Nodes, *n)
+	}
+	for pair, w := range weights {
+		g.Edges = append(g.Edges, Edge{Source: pair[0], Target: pair[1], Kind: EdgeCoauthorship, Weight: w})
+	}
+	g.areas = b.areas
+	g.sort()
+	return g
+}
+
+// WithAreas returns a copy of the graph with one node per area of knowledge
+// and an edge from each researcher of the graph to each of their areas.
+func (g *Graph) WithAreas() *Graph {
+	out := &Graph{
+		Nodes: append([]Node{}, g.Nodes...),
+		Edges: append([]Edge{}, g.Edges...),
+		areas: g.areas,
+	}
+	areaNodes := make(map[string]*Node)
+	for _, n := range g.Nodes {
+		if n.Kind != KindResearcher {
+			continue
+		}
+		for _, name := range g.areas[n.ID] {
+			id := "area:" + textnorm.Fold(name)
+			if areaNodes[id] == nil {
+				areaNodes[id] = &Node{ID: id, Label: name, Kind: KindArea}
+			}
+			areaNodes[id].Researchers++
+			out.Edges = append(out.Edges, Edge{Source: n.ID, Target: id, Kind: EdgeArea, Weight: 1})
+		}
+	}
+	for _, n := range areaNodes {
+		out.Nodes = append(out.Nodes, *n)
+	}
+	out.sort()
+	return out
+}
+
+// Ego returns the subgraph made of a node, its direct co-authors and the
+// edges among them. ok is false when the node is not in the graph.
+func (g *Graph) Ego(id string) (ego *Graph, ok bool) {
+	members := map[string]bool{}
+	for _, n := range g.Nodes {
+		if n.ID == id {
+			members[id] = true
+			break
+		}
+	}
+	if !members[id] {
+		return nil, false
+	}
+	for _, e := range g.Edges {
+		if e.Source == id {
+			members[e.Target] = true
+		}
+		if e.Target == id {
+			members[e.Source] = true
+		}
+	}
+	return g.filter(func(n Node) bool { return members[n.ID] }), true
+}
+
+// ResearchersOnly drops the external co-authors, keeping the links between
+// researchers of the base.
+func (g *Graph) ResearchersOnly() *Graph {
+	return g.filter(func(n Node) bool { return n.Kind == KindResearcher })
+}
+
+func (g *Graph) filter(keep func(Node) bool) *Graph {
+	out := &Graph{Nodes: []Node{}, Edges: []Edge{}, areas: g.areas}
+	kept := make(map[string]bool)
+	for _, n := range g.Nodes {
+		if keep(n) {
+			kept[n.ID] = true
+			out.Nodes = append(out.Nodes, n)
+		}
+	}
+	for _, e := range g.Edges {
+		if kept[e.Source] && kept[e.Target] {
+			out.Edges = append(out.Edges, e)
+		}
+	}
+	return out
+}
+
+func (g *Graph) sort() {
+	sort.Slice(g.Nodes, func(i, j int) bool { return g.Nodes[i].ID < g.Nodes[j].ID })
+	sort.Slice(g.Edges, func(i, j int) bool {
+		if g.Edges[i].Kind != g.Edges[j].Kind {
+			return g.Edges[i].Kind < g.Edges[j].Kind
+		}
+		if g.Edges[i].Source != g.Edges[j].Source {
+			return g.Edges[i].Source < g.Edges[j].Source
+		}
+		return g.Edges[i].Target < g.Edges[j].Target
+	})
+}
+
+// researcherNames lists the normalized names a researcher may appear under in
+// AUTORES: every entry of nome-em-citacoes-bibliograficas plus the full name.
+func researcherNames(r store.ResearcherPublications) []string {
+	var names []string
+	for _, c := range strings.Split(r.CitationNames, ";") {
+		if n := textnorm.Fold(c); n != "" {
+			names = append(names, n)
+		}
+	}
+	if n := textnorm.Fold(r.Name); n != "" {
+		names = append(names, n)
+	}
+	return names
+}
+
+func mostFrequent(counts map[string]int) string {
+	best, bestCount := "", 0
+	for label, c := range counts {
+		if c > bestCount || (c == bestCount && label < best) {
+			best, bestCount = label, c
+		}
+	}
+	return best
+}
+
+// areaNames picks one name per areas-de-atuacao entry (the area of knowledge,
+// or the broader grande area when the area is missing), without repetitions.
+func areaNames(areas []parser.Area) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, a := range areas {
+		name := a.Area
+		if name == "" {
+			name = strings.ReplaceAll(a.GrandeArea, "_", " ")
+		}
+		key := textnorm.Fold(name)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		names = append(names, name)
+	}
+	return names
+}
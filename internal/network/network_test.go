@@ -0,0 +1,118 @@
+package network
+
+import (
+	"testing"
+
+	"github.com/edalcin/smartlattes/internal/dedup"
+	"github.com/edalcin/smartlattes/internal/parser"
+	"github.com/edalcin/smartlattes/internal/store"
+)
+
+func article(title, doi string, authors ...parser.Author) parser.Article {
+	return parser.Article{Publication: parser.Publication{Type: parser.TypeArticle, Title: title, Year: 2020, DOI: doi, Authors: authors}}
+}
+
+func TestBuild(t *testing.T) {
+	ana := store.ResearcherPublications{LattesID: "1111", Name: "Ana Souza", CitationNames: "SOUZA, A.;SOUZA, ANA",
+		Areas: []parser.Area{{GrandeArea: "CIENCIAS_BIOLOGICAS", Area: "Ecologia"}}}
+	ana.Publications.Articles = []parser.Article{
+		// The co-author is matched by CNPq ID despite an unknown citation name.
+		article("Florestas do sul", "10.1000/p1",
+			parser.Author{Name: "Ana Souza", CNPqID: "1111"},
+			parser.Author{CitationName: "B. LIMA", CNPqID: "2222"}),
+		article("Plantas medicinais", "",
+			parser.Author{Name: "Ana Souza", CitationName: "SOUZA, A."},
+			parser.Author{Name: "Carlos Externo", CitationName: "EXTERNO, C.", CNPqID: "9999"}),
+	}
+	bruno := store.ResearcherPublications{LattesID: "2222", Name: "Bruno Lima", CitationNames: "LIMA, B."}
+	bruno.Publications.Articles = []parser.Article{
+		// Listed in both CVs: counted once.
+		article("Florestas do Sul", "10.1000/P1",
+			parser.Author{CitationName: "LIMA, B."},
+			parser.Author{CitationName: "SOUZA, ANA"}),
+		// The external co-author has the CNPq ID in another CV.
+		article("Campos rupestres", "",
+			parser.Author{CitationName: "LIMA, B."},
+			parser.Author{CitationName: "EXTERNO, C."},
+			parser.Author{CitationName: "SILVA, D."}),
+		// Citation names match after folding case and punctuation.
+		article("Cerrado", "",
+			parser.Author{CitationName: "Lima, B"},
+			parser.Author{CitationName: "Souza, A"}),
+	}
+	// Sent after the grouping was saved: identified by dedup.Key.
+	clara := store.ResearcherPublications{LattesID: "3333", Name: "Clara Nova"}
+	clara.Publications.Articles = []parser.Article{
+		article("Polinizadores", "", parser.Author{Name: "Clara Nova"}, parser.Author{Name: "Ana Souza"}),
+	}
+
+	clusters := dedup.Group([]store.ResearcherPublications{ana, bruno})
+	g := Build([]store.ResearcherPublications{ana, bruno, clara}, clusters)
+
+	wantEdges := []Edge{
+		{Source: "1111", Target: "2222", Kind: EdgeCoauthorship, Weight: 2},
+		{Source: "1111", Target: "3333", Kind: EdgeCoauthorship, Weight: 1},
+		{Source: "1111", Target: "cnpq:9999", Kind: EdgeCoauthorship, Weight: 1},
+		{Source: "2222", Target: "cnpq:9999", Kind: EdgeCoauthorship, Weight: 1},
+		{Source: "2222", Target: "nome:silva d", Kind: EdgeCoauthorship, Weight: 1},
+	}
+	if len(g.Edges) != len(wantEdges) {
+		t.Fatalf("edges = %+v", g.Edges)
+	}
+	for i, want := range wantEdges {
+		if g.Edges[i] != want {
+			t.Errorf("edge %d = %+v, want %+v", i, g.Edges[i], want)
+		}
+	}
+
+	nodes := make(map[string]Node)
+	for _, n := range g.Nodes {
+		nodes[n.ID] = n
+	}
+	tests := []struct {
+		id           string
+		kind         string
+		label        string
+		publications int
+	}{
+		{"1111", KindResearcher, "Ana Souza", 4},
+		{"2222", KindResearcher, "Bruno Lima", 3},
+		{"3333", KindResearcher, "Clara Nova", 1},
+		{"cnpq:9999", KindCoauthor, "Carlos Externo", 2},
+		{"nome:silva d", KindCoauthor, "SILVA, D.", 1},
+	}
+	if len(nodes) != len(tests) {
+		t.Errorf("nodes = %+v", g.Nodes)
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			n, ok := nodes[tt.id]
+			if !ok {
+				t.Fatal("missing node")
+			}
+			if n.Kind != tt.kind || n.Label != tt.label || n.Publications != tt.publications {
+				t.Errorf("node = %+v", n)
+			}
+		})
+	}
+	if nodes["1111"].MainArea != "Ecologia" || nodes["1111"].Articles != 2 {
+		t.Errorf("researcher = %+v", nodes["1111"])
+	}
+}
+
+func TestBuildAmbiguousName(t *testing.T) {
+	// Two researchers share a citation name: it identifies neither of them.
+	researchers := []store.ResearcherPublications{
+		{LattesID: "1111", Name: "Ana Souza", CitationNames: "SOUZA, A."},
+		{LattesID: "2222", Name: "Antonio Souza", CitationNames: "SOUZA, A."},
+		{LattesID: "3333", Name: "Bruno Lima"},
+	}
+	researchers[2].Publications.Articles = []parser.Article{
+		article("Florestas", "", parser.Author{Name: "Bruno Lima"}, parser.Author{CitationName: "SOUZA, A."}),
+	}
+
+	g := Build(researchers, dedup.Group(researchers))
+	if len(g.Edges) != 1 || g.Edges[0].Source != "3333" || g.Edges[0].Target != "nome:souza a" {
+		t.Errorf("edges = %+v", g.Edges)
+	}
+}
@@ -0,0 +1,41 @@
+package parser
+
+import (
+	"sort"
+	"strconv"
+)
+
+// Area is one entry of AREAS-DE-ATUACAO, from the broadest level of the CNPq
+// knowledge tree to the most specific one.
+type Area struct {
+	GrandeArea    string `json:"grandeArea,omitempty" bson:"grandeArea,omitempty"`
+	Area          string `json:"area,omitempty" bson:"area,omitempty"`
+	SubArea       string `json:"subArea,omitempty" bson:"subArea,omitempty"`
+	Especialidade string `json:"especialidade,omitempty" bson:"especialidade,omitempty"`
+}
+
+// ExtractAreas returns the researcher's areas-de-atuacao in the order given by
+// SEQUENCIA-AREA-DE-ATUACAO. cv is the curriculo-vitae map produced by Parse.
+func ExtractAreas(cv map[string]interface{}) []Area {
+	dg, ok := cv["dados-gerais"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	items := childItems(dg, "areas-de-atuacao", "area-de-atuacao")
+	sort.SliceStable(items, func(i, j int) bool {
+		a, _ := strconv.Atoi(stringField(items[i], "sequencia-area-de-atuacao"))
+		b, _ := strconv.Atoi(stringField(items[j], "sequencia-area-de-atuacao"))
+		return a < b
+	})
+
+	areas := make([]Area, 0, len(items))
+	for _, item := range items {
+		areas = append(areas, Area{
+			GrandeArea:    stringField(item, "nome-grande-area-do-conhecimento"),
+			Area:          stringField(item, "nome-da-area-do-conhecimento"),
+			SubArea:       stringField(item, "nome-da-sub-area-do-conhecimento"),
+			Especialidade: stringField(item, "nome-da-especialidade"),
+		})
+	}
+	return areas
+}
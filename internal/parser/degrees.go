@@ -0,0 +1,51 @@
+package parser
+
+import "sort"
+
+// Degree is one course of FORMACAO-ACADEMICA-TITULACAO. Level is the lowercased
+// element name (graduacao, mestrado, doutorado, pos-doutorado...).
+type Degree struct {
+	Level       string `json:"level" bson:"level"`
+	Course      string `json:"course,omitempty" bson:"course,omitempty"`
+	Institution string `json:"institution,omitempty" bson:"institution,omitempty"`
+	StartYear   int    `json:"startYear,omitempty" bson:"startYear,omitempty"`
+	EndYear     int    `json:"endYear,omitempty" bson:"endYear,omitempty"`
+	Status      string `json:"status,omitempty" bson:"status,omitempty"`
+	Title       string `json:"title,omitempty" bson:"title,omitempty"`
+}
+
+// ExtractDegrees returns the researcher's academic degrees ordered by start
+// year. cv is the curriculo-vitae map produced by Parse.
+func ExtractDegrees(cv map[string]interface{}) []Degree {
+	formacao := childMap(childMap(cv, "dados-gerais"), "formacao-academica-titulacao")
+
+	var degrees []Degree
+	for level, v := range formacao {
+		for _, item := range asMaps(v) {
+			title := stringField(item, "titulo-da-dissertacao-tese")
+			if title == "" {
+				title = stringField(item, "titulo-do-trabalho-de-conclusao-de-curso")
+			}
+			degrees = append(degrees, Degree{
+				Level:       level,
+				Course:      stringField(item, "nome-curso"),
+				Institution: stringField(item, "nome-instituicao"),
+				StartYear:   yearField(item, "ano-de-inicio"),
+				EndYear:     yearField(item, "ano-de-conclusao"),
+				Status:      stringField(item, "status-do-curso"),
+				Title:       title,
+			})
+		}
+	}
+
+	sort.Slice(degrees, func(i, j int) bool {
+		if degrees[i].StartYear != degrees[j].StartYear {
+			return degrees[i].StartYear < degrees[j].StartYear
+		}
+		if degrees[i].Level != degrees[j].Level {
+			return degrees[i].Level < degrees[j].Level
+		}
+		return degrees[i].Course < degrees[j].Course
+	})
+	return degrees
+}
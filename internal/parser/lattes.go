@@ -24,8 +24,9 @@ type ProductionCounts struct {
 }
 
 type ParseResult struct {
-	Document map[string]interface{}
-	Summary  Summary
+	Document     map[string]interface{}
+	Summary      Summary
+	Publications Publications
 }
 
 func Parse(data []byte) (*ParseResult, error) {
@@ -68,15 +69,19 @@ func Parse(data []byte) (*ParseResult, error) {
 
 	filterDadosGerais(doc)
 
+	publications := ExtractPublications(doc)
+
 	fullDoc := map[string]interface{}{
 		"curriculo-vitae": doc,
+		"publicacoes":     publications,
 	}
 
-	summary := extractSummary(doc, lattesID)
+	summary := extractSummary(doc, lattesID, publications)
 
 	return &ParseResult{
-		Document: fullDoc,
-		Summary:  summary,
+		Document:     fullDoc,
+		Summary:      summary,
+		Publications: publications,
 	}, nil
 }
 
@@ -144,7 +149,7 @@ func filterDadosGerais(cv map[string]interface{}) {
 	}
 }
 
-func extractSummary(cv map[string]interface{}, lattesID string) Summary {
+func extractSummary(cv map[string]interface{}, lattesID string, publications Publications) Summary {
 	s := Summary{
 		LattesID:   lattesID,
 		LastUpdate: stringField(cv, "data-atualizacao"),
@@ -154,13 +159,15 @@ func extractSummary(cv map[string]interface{}, lattesID string) Summary {
 		s.Name = stringField(dg, "nome-completo")
 	}
 
-	s.Counts.BibliographicProduction = countProduction(cv, "producao-bibliografica")
+	s.Counts.BibliographicProduction = publications.Len()
 	s.Counts.TechnicalProduction = countProduction(cv, "producao-tecnica")
 	s.Counts.OtherProduction = countProduction(cv, "outra-producao")
 
 	return s
 }
 
+// countProduction counts the items of a production section that has no typed
+// model yet; bibliographic production is counted from Publications.
 func countProduction(cv map[string]interface{}, sectionKey string) int {
 	section, ok := cv[sectionKey].(map[string]interface{})
 	if !ok {
@@ -174,23 +181,25 @@ func countProduction(cv map[string]interface{}, sectionKey string) int {
 	return count
 }
 
+// countItems counts the production items below v. Every item of a Lattes
+// production section carries SEQUENCIA-PRODUCAO; elements without it group
+// items or describe one.
 func countItems(v interface{}) int {
 	switch val := v.(type) {
 	case []interface{}:
-		return len(val)
-	case map[string]interface{}:
 		count := 0
-		hasChildElements := false
-		for key, child := range val {
-			if key == "#text" {
-				continue
-			}
-			hasChildElements = true
+		for _, child := range val {
 			count += countItems(child)
 		}
-		if !hasChildElements {
+		return count
+	case map[string]interface{}:
+		if _, ok := val["sequencia-producao"]; ok {
 			return 1
 		}
+		count := 0
+		for _, child := range val {
+			count += countItems(child)
+		}
 		return count
 	default:
 		return 0
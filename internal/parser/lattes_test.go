@@ -0,0 +1,176 @@
+package parser
+
+import (
+	"testing"
+)
+
+// sampleCV is a Lattes export with one item of each kind of bibliographic
+// production, in ISO-8859-1 like the files the platform generates.
+const sampleCV = `<?xml version="1.0" encoding="ISO-8859-1" standalone="no"?>
+<CURRICULO-VITAE NUMERO-IDENTIFICADOR="1234567890123456" DATA-ATUALIZACAO="01062024">
+<DADOS-GERAIS NOME-COMPLETO="Ana Souza" NOME-EM-CITACOES-BIBLIOGRAFICAS="SOUZA, A.;SOUZA, ANA" CPF="00000000000"/>
+<PRODUCAO-BIBLIOGRAFICA>
+<TRABALHOS-EM-EVENTOS>
+<TRABALHO-EM-EVENTOS SEQUENCIA-PRODUCAO="1">
+<DADOS-BASICOS-DO-TRABALHO NATUREZA="COMPLETO" TITULO-DO-TRABALHO="Florestas do sul" ANO-DO-TRABALHO="2018" DOI=""/>
+<DETALHAMENTO-DO-TRABALHO NOME-DO-EVENTO="Congresso de Ecologia" TITULO-DOS-ANAIS-OU-PROCEEDINGS="Anais"/>
+<AUTORES NOME-COMPLETO-DO-AUTOR="Ana Souza" NOME-PARA-CITACAO="SOUZA, A." ORDEM-DE-AUTORIA="1" NRO-ID-CNPQ="1234567890123456"/>
+</TRABALHO-EM-EVENTOS>
+</TRABALHOS-EM-EVENTOS>
+<ARTIGOS-PUBLICADOS>
+<ARTIGO-PUBLICADO SEQUENCIA-PRODUCAO="2">
+<DADOS-BASICOS-DO-ARTIGO TITULO-DO-ARTIGO="Plantas medicinais" ANO-DO-ARTIGO="2020" DOI=" 10.1000/xyz "/>
+<DETALHAMENTO-DO-ARTIGO TITULO-DO-PERIODICO-OU-REVISTA="Acta Botanica" ISSN="12345678" VOLUME="3"/>
+<AUTORES NOME-COMPLETO-DO-AUTOR="Bruno Lima" NOME-PARA-CITACAO="LIMA, B." ORDEM-DE-AUTORIA="2" NRO-ID-CNPQ=""/>
+<AUTORES NOME-COMPLETO-DO-AUTOR="Ana Souza" NOME-PARA-CITACAO="SOUZA, A." ORDEM-DE-AUTORIA="1" NRO-ID-CNPQ="1234567890123456"/>
+</ARTIGO-PUBLICADO>
+</ARTIGOS-PUBLICADOS>
+<LIVROS-E-CAPITULOS>
+<LIVROS-PUBLICADOS-OU-ORGANIZADOS>
+<LIVRO-PUBLICADO-OU-ORGANIZADO SEQUENCIA-PRODUCAO="3">
+<DADOS-BASICOS-DO-LIVRO TITULO-DO-LIVRO="Flora do cerrado" ANO="2019"/>
+<DETALHAMENTO-DO-LIVRO NOME-DA-EDITORA="Editora UnB" ISBN="9788500000000"/>
+</LIVRO-PUBLICADO-OU-ORGANIZADO>
+</LIVROS-PUBLICADOS-OU-ORGANIZADOS>
+<CAPITULOS-DE-LIVROS-PUBLICADOS>
+<CAPITULO-DE-LIVRO-PUBLICADO SEQUENCIA-PRODUCAO="4">
+<DADOS-BASICOS-DO-CAPITULO TITULO-DO-CAPITULO-DO-LIVRO="Campos rupestres" ANO="2017"/>
+<DETALHAMENTO-DO-CAPITULO TITULO-DO-LIVRO="Biomas do Brasil" NOME-DA-EDITORA="Editora X"/>
+</CAPITULO-DE-LIVRO-PUBLICADO>
+</CAPITULOS-DE-LIVROS-PUBLICADOS>
+</LIVROS-E-CAPITULOS>
+<TEXTOS-EM-JORNAIS-OU-REVISTAS>
+<TEXTO-EM-JORNAL-OU-REVISTA SEQUENCIA-PRODUCAO="5">
+<DADOS-BASICOS-DO-TEXTO TITULO-DO-TEXTO="O cerrado em perigo" ANO-DO-TEXTO="2021"/>
+<DETALHAMENTO-DO-TEXTO TITULO-DO-JORNAL-OU-REVISTA="Correio"/>
+<AUTORES NOME-COMPLETO-DO-AUTOR="Ana Souza" NOME-PARA-CITACAO="SOUZA, A." ORDEM-DE-AUTORIA="1"/>
+</TEXTO-EM-JORNAL-OU-REVISTA>
+</TEXTOS-EM-JORNAIS-OU-REVISTAS>
+<DEMAIS-TIPOS-DE-PRODUCAO-BIBLIOGRAFICA>
+<TRADUCAO SEQUENCIA-PRODUCAO="6">
+<DADOS-BASICOS-DA-TRADUCAO TITULO="Tradu` + "\xe7\xe3" + `o de ecologia" ANO="2016"/>
+<DETALHAMENTO-DA-TRADUCAO EDITORA-DA-TRADUCAO="Editora Y"/>
+</TRADUCAO>
+<OUTRA-PRODUCAO-BIBLIOGRAFICA SEQUENCIA-PRODUCAO="7">
+<DADOS-BASICOS-DE-OUTRA-PRODUCAO TITULO="Boletim de campo" ANO="2015"/>
+<DETALHAMENTO-DE-OUTRA-PRODUCAO EDITORA="Editora Z"/>
+</OUTRA-PRODUCAO-BIBLIOGRAFICA>
+<PREFACIO-POSFACIO SEQUENCIA-PRODUCAO="8">
+<DADOS-BASICOS-DO-PREFACIO-POSFACIO TITULO="Prefacio" ANO="2014"/>
+<DETALHAMENTO-DO-PREFACIO-POSFACIO TITULO-DA-PUBLICACAO="Guia de campo"/>
+</PREFACIO-POSFACIO>
+</DEMAIS-TIPOS-DE-PRODUCAO-BIBLIOGRAFICA>
+<ARTIGOS-ACEITOS-PARA-PUBLICACAO>
+<ARTIGO-ACEITO-PARA-PUBLICACAO SEQUENCIA-PRODUCAO="9">
+<DADOS-BASICOS-DO-ARTIGO TITULO-DO-ARTIGO="Polinizadores" ANO-DO-ARTIGO="2024"/>
+<DETALHAMENTO-DO-ARTIGO TITULO-DO-PERIODICO-OU-REVISTA="Oecologia"/>
+</ARTIGO-ACEITO-PARA-PUBLICACAO>
+</ARTIGOS-ACEITOS-PARA-PUBLICACAO>
+</PRODUCAO-BIBLIOGRAFICA>
+<PRODUCAO-TECNICA>
+<SOFTWARE SEQUENCIA-PRODUCAO="10"><DADOS-BASICOS-DO-SOFTWARE TITULO-DO-SOFTWARE="Herbario"/></SOFTWARE>
+</PRODUCAO-TECNICA>
+</CURRICULO-VITAE>`
+
+func TestParse(t *testing.T) {
+	res, err := Parse([]byte(sampleCV))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := res.Summary
+	if s.LattesID != "1234567890123456" || s.Name != "Ana Souza" || s.LastUpdate != "01062024" {
+		t.Errorf("summary = %+v", s)
+	}
+	if want := (ProductionCounts{BibliographicProduction: 9, TechnicalProduction: 1}); s.Counts != want {
+		t.Errorf("counts = %+v, want %+v", s.Counts, want)
+	}
+	cv := res.Document["curriculo-vitae"].(map[string]interface{})
+	if _, ok := cv["dados-gerais"].(map[string]interface{})["cpf"]; ok {
+		t.Error("dados-gerais keeps the CPF")
+	}
+
+	tests := []struct {
+		typ   string
+		title string
+		year  int
+		venue string
+	}{
+		{TypeArticle, "Plantas medicinais", 2020, "Acta Botanica"},
+		{TypeBook, "Flora do cerrado", 2019, "Editora UnB"},
+		{TypeChapter, "Campos rupestres", 2017, "Biomas do Brasil"},
+		{TypeConferencePaper, "Florestas do sul", 2018, "Congresso de Ecologia"},
+		{TypeAcceptedArticle, "Polinizadores", 2024, "Oecologia"},
+		{TypeNewspaperText, "O cerrado em perigo", 2021, "Correio"},
+		{TypeTranslation, "Tradução de ecologia", 2016, "Editora Y"},
+		{TypePreface, "Prefacio", 2014, "Guia de campo"},
+		{TypeOther, "Boletim de campo", 2015, "Editora Z"},
+	}
+	all := res.Publications.All()
+	if len(all) != len(tests) || res.Publications.Len() != len(tests) {
+		t.Fatalf("extracted %d publications, want %d: %+v", len(all), len(tests), all)
+	}
+	for _, tt := range tests {
+		t.Run(tt.typ, func(t *testing.T) {
+			for _, p := range all {
+				if p.Type != tt.typ {
+					continue
+				}
+				if p.Title != tt.title || p.Year != tt.year || p.Venue != tt.venue {
+					t.Errorf("publication = %+v", p)
+				}
+				return
+			}
+			t.Errorf("no %s extracted", tt.typ)
+		})
+	}
+
+	article := res.Publications.Articles[0]
+	if article.DOI != "10.1000/xyz" || article.ISSN != "12345678" || article.Volume != "3" {
+		t.Errorf("article = %+v", article)
+	}
+	if a := article.Authors; len(a) != 2 || a[0].Name != "Ana Souza" || a[0].CNPqID != "1234567890123456" || a[1].CitationName != "LIMA, B." {
+		t.Errorf("authors = %+v", a)
+	}
+}
+
+func TestBackfill(t *testing.T) {
+	res, err := Parse([]byte(sampleCV))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cv := res.Document["curriculo-vitae"].(map[string]interface{})
+
+	// Stored before Others was part of the model.
+	stored := res.Publications
+	stored.Others = nil
+	stored.Backfill(cv)
+	if len(stored.Others) != 5 {
+		t.Errorf("backfilled %d publications, want 5", len(stored.Others))
+	}
+
+	// An empty list was extracted and is kept.
+	stored.Others = []Publication{}
+	stored.Backfill(cv)
+	if len(stored.Others) != 0 {
+		t.Errorf("backfill replaced the stored list: %+v", stored.Others)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		xml  string
+	}{
+		{"not XML", "curriculo"},
+		{"other root", `<OUTRO NUMERO-IDENTIFICADOR="1"/>`},
+		{"no ID", `<CURRICULO-VITAE DATA-ATUALIZACAO="01062024"></CURRICULO-VITAE>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse([]byte(tt.xml)); err == nil {
+				t.Error("parsed an invalid CV")
+			}
+		})
+	}
+}
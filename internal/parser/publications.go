@@ -0,0 +1,314 @@
+package parser
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Publication types stored in Publication.Type.
+const (
+	TypeArticle         = "article"
+	TypeBook            = "book"
+	TypeChapter         = "chapter"
+	TypeConferencePaper = "conferencePaper"
+	// The kinds below are kept in Publications.Others.
+	TypeAcceptedArticle = "acceptedArticle"
+	TypeNewspaperText   = "newspaperText"
+	TypeTranslation     = "translation"
+	TypeMusicScore      = "musicScore"
+	TypePreface         = "preface"
+	TypeOther           = "other"
+)
+
+// Author is one entry of a publication's AUTORES list.
+type Author struct {
+	Name         string `json:"name" bson:"name"`
+	CitationName string `json:"citationName,omitempty" bson:"citationName,omitempty"`
+	Order        int    `json:"order,omitempty" bson:"order,omitempty"`
+	CNPqID       string `json:"cnpqId,omitempty" bson:"cnpqId,omitempty"`
+}
+
+// Publication holds the fields shared by every kind of bibliographic
+// production. Venue is the journal for articles, the publisher for books, the
+// book title for chapters and the event name for conference papers.
+type Publication struct {
+	Type     string   `json:"type" bson:"type"`
+	Title    string   `json:"title" bson:"title"`
+	Year     int      `json:"year,omitempty" bson:"year,omitempty"`
+	DOI      string   `json:"doi,omitempty" bson:"doi,omitempty"`
+	Venue    string   `json:"venue,omitempty" bson:"venue,omitempty"`
+	Language string   `json:"language,omitempty" bson:"language,omitempty"`
+	Authors  []Author `json:"authors,omitempty" bson:"authors,omitempty"`
+}
+
+type Article struct {
+	Publication `bson:",inline"`
+	ISSN        string `json:"issn,omitempty" bson:"issn,omitempty"`
+	Volume      string `json:"volume,omitempty" bson:"volume,omitempty"`
+	Issue       string `json:"issue,omitempty" bson:"issue,omitempty"`
+	FirstPage   string `json:"firstPage,omitempty" bson:"firstPage,omitempty"`
+	LastPage    string `json:"lastPage,omitempty" bson:"lastPage,omitempty"`
+}
+
+type Book struct {
+	Publication `bson:",inline"`
+	ISBN        string `json:"isbn,omitempty" bson:"isbn,omitempty"`
+	Pages       string `json:"pages,omitempty" bson:"pages,omitempty"`
+}
+
+type Chapter struct {
+	Publication `bson:",inline"`
+	ISBN        string `json:"isbn,omitempty" bson:"isbn,omitempty"`
+	Publisher   string `json:"publisher,omitempty" bson:"publisher,omitempty"`
+	Editors     string `json:"editors,omitempty" bson:"editors,omitempty"`
+	FirstPage   string `json:"firstPage,omitempty" bson:"firstPage,omitempty"`
+	LastPage    string `json:"lastPage,omitempty" bson:"lastPage,omitempty"`
+}
+
+type ConferencePaper struct {
+	Publication `bson:",inline"`
+	Proceedings string `json:"proceedings,omitempty" bson:"proceedings,omitempty"`
+	ISBN        string `json:"isbn,omitempty" bson:"isbn,omitempty"`
+	Nature      string `json:"nature,omitempty" bson:"nature,omitempty"`
+}
+
+// Publications is the typed view of producao-bibliografica. It is stored in
+// the "publicacoes" field, next to the raw "curriculo-vitae" tree. Others
+// holds the remaining kinds (accepted articles, newspaper texts,
+// translations, music scores, prefaces and other production) with their
+// shared fields only.
+type Publications struct {
+	Articles         []Article         `json:"articles" bson:"articles"`
+	Books            []Book            `json:"books" bson:"books"`
+	Chapters         []Chapter         `json:"chapters" bson:"chapters"`
+	ConferencePapers []ConferencePaper `json:"conferencePapers" bson:"conferencePapers"`
+	Others           []Publication     `json:"others" bson:"others"`
+}
+
+// Backfill extracts from cv the kinds missing in publications stored before
+// they were part of the typed model.
+func (p *Publications) Backfill(cv map[string]interface{}) {
+	if p.Others == nil {
+		p.Others = ExtractPublications(cv).Others
+	}
+}
+
+// All returns the shared fields of every publication, in type order, Others
+// last.
+func (p Publications) All() []Publication {
+	all := make([]Publication, 0, p.Len())
+	for _, a := range p.Articles {
+		all = append(all, a.Publication)
+	}
+	for _, b := range p.Books {
+		all = append(all, b.Publication)
+	}
+	for _, c := range p.Chapters {
+		all = append(all, c.Publication)
+	}
+	for _, c := range p.ConferencePapers {
+		all = append(all, c.Publication)
+	}
+	return append(all, p.Others...)
+}
+
+func (p Publications) Len() int {
+	return len(p.Articles) + len(p.Books) + len(p.Chapters) + len(p.ConferencePapers) + len(p.Others)
+}
+
+// ExtractPublications builds the typed publications from the generic
+// curriculo-vitae map produced by Parse. It also works on documents read back
+// from the database, as long as nested values are plain maps and slices.
+func ExtractPublications(cv map[string]interface{}) Publications {
+	pubs := Publications{
+		Articles:         []Article{},
+		Books:            []Book{},
+		Chapters:         []Chapter{},
+		ConferencePapers: []ConferencePaper{},
+		Others:           []Publication{},
+	}
+
+	pb, ok := cv["producao-bibliografica"].(map[string]interface{})
+	if !ok {
+		return pubs
+	}
+
+	for _, item := range childItems(pb, "artigos-publicados", "artigo-publicado") {
+		basic := childMap(item, "dados-basicos-do-artigo")
+		detail := childMap(item, "detalhamento-do-artigo")
+		pubs.Articles = append(pubs.Articles, Article{
+			Publication: Publication{
+				Type:     TypeArticle,
+				Title:    stringField(basic, "titulo-do-artigo"),
+				Year:     yearField(basic, "ano-do-artigo"),
+				DOI:      strings.TrimSpace(stringField(basic, "doi")),
+				Venue:    stringField(detail, "titulo-do-periodico-ou-revista"),
+				Language: stringField(basic, "idioma"),
+				Authors:  extractAuthors(item),
+			},
+			ISSN:      stringField(detail, "issn"),
+			Volume:    stringField(detail, "volume"),
+			Issue:     stringField(detail, "fasciculo"),
+			FirstPage: stringField(detail, "pagina-inicial"),
+			LastPage:  stringField(detail, "pagina-final"),
+		})
+	}
+
+	livros, _ := pb["livros-e-capitulos"].(map[string]interface{})
+	for _, item := range childItems(livros, "livros-publicados-ou-organizados", "livro-publicado-ou-organizado") {
+		basic := childMap(item, "dados-basicos-do-livro")
+		detail := childMap(item, "detalhamento-do-livro")
+		pubs.Books = append(pubs.Books, Book{
+			Publication: Publication{
+				Type:     TypeBook,
+				Title:    stringField(basic, "titulo-do-livro"),
+				Year:     yearField(basic, "ano"),
+				DOI:      strings.TrimSpace(stringField(basic, "doi")),
+				Venue:    stringField(detail, "nome-da-editora"),
+				Language: stringField(basic, "idioma"),
+				Authors:  extractAuthors(item),
+			},
+			ISBN:  stringField(detail, "isbn"),
+			Pages: stringField(detail, "numero-de-paginas"),
+		})
+	}
+
+	for _, item := range childItems(livros, "capitulos-de-livros-publicados", "capitulo-de-livro-publicado") {
+		basic := childMap(item, "dados-basicos-do-capitulo")
+		detail := childMap(item, "detalhamento-do-capitulo")
+		pubs.Chapters = append(pubs.Chapters, Chapter{
+			Publication: Publication{
+				Type:     TypeChapter,
+				Title:    stringField(basic, "titulo-do-capitulo-do-livro"),
+				Year:     yearField(basic, "ano"),
+				DOI:      strings.TrimSpace(stringField(basic, "doi")),
+				Venue:    stringField(detail, "titulo-do-livro"),
+				Language: stringField(basic, "idioma"),
+				Authors:  extractAuthors(item),
+			},
+			ISBN:      stringField(detail, "isbn"),
+			Publisher: stringField(detail, "nome-da-editora"),
+			Editors:   stringField(detail, "organizadores"),
+			FirstPage: stringField(detail, "pagina-inicial"),
+			LastPage:  stringField(detail, "pagina-final"),
+		})
+	}
+
+	for _, item := range childItems(pb, "trabalhos-em-eventos", "trabalho-em-eventos") {
+		basic := childMap(item, "dados-basicos-do-trabalho")
+		detail := childMap(item, "detalhamento-do-trabalho")
+		pubs.ConferencePapers = append(pubs.ConferencePapers, ConferencePaper{
+			Publication: Publication{
+				Type:     TypeConferencePaper,
+				Title:    stringField(basic, "titulo-do-trabalho"),
+				Year:     yearField(basic, "ano-do-trabalho"),
+				DOI:      strings.TrimSpace(stringField(basic, "doi")),
+				Venue:    stringField(detail, "nome-do-evento"),
+				Language: stringField(basic, "idioma"),
+				Authors:  extractAuthors(item),
+			},
+			Proceedings: stringField(detail, "titulo-dos-anais-ou-proceedings"),
+			ISBN:        stringField(detail, "isbn"),
+			Nature:      stringField(basic, "natureza"),
+		})
+	}
+
+	for _, kind := range otherKinds {
+		for _, item := range childItems(pb, kind.section, kind.element) {
+			basic := childMap(item, kind.basic)
+			pubs.Others = append(pubs.Others, Publication{
+				Type:     kind.typ,
+				Title:    stringField(basic, kind.title),
+				Year:     yearField(basic, kind.year),
+				DOI:      strings.TrimSpace(stringField(basic, "doi")),
+				Venue:    stringField(childMap(item, kind.detail), kind.venue),
+				Language: stringField(basic, "idioma"),
+				Authors:  extractAuthors(item),
+			})
+		}
+	}
+
+	return pubs
+}
+
+// otherKinds describes where the kinds kept in Publications.Others are in
+// producao-bibliografica.
+var otherKinds = []struct {
+	typ, section, element string
+	basic, title, year    string
+	detail, venue         string
+}{
+	{TypeAcceptedArticle, "artigos-aceitos-para-publicacao", "artigo-aceito-para-publicacao",
+		"dados-basicos-do-artigo", "titulo-do-artigo", "ano-do-artigo", "detalhamento-do-artigo", "titulo-do-periodico-ou-revista"},
+	{TypeNewspaperText, "textos-em-jornais-ou-revistas", "texto-em-jornal-ou-revista",
+		"dados-basicos-do-texto", "titulo-do-texto", "ano-do-texto", "detalhamento-do-texto", "titulo-do-jornal-ou-revista"},
+	{TypeTranslation, "demais-tipos-de-producao-bibliografica", "traducao",
+		"dados-basicos-da-traducao", "titulo", "ano", "detalhamento-da-traducao", "editora-da-traducao"},
+	{TypeMusicScore, "demais-tipos-de-producao-bibliografica", "partitura-musical",
+		"dados-basicos-da-partitura", "titulo", "ano", "detalhamento-da-partitura", "editora"},
+	{TypePreface, "demais-tipos-de-producao-bibliografica", "prefacio-posfacio",
+		"dados-basicos-do-prefacio-posfacio", "titulo", "ano", "detalhamento-do-prefacio-posfacio", "titulo-da-publicacao"},
+	{TypeOther, "demais-tipos-de-producao-bibliografica", "outra-producao-bibliografica",
+		"dados-basicos-de-outra-producao", "titulo", "ano", "detalhamento-de-outra-producao", "editora"},
+}
+
+// extractAuthors reads the AUTORES elements of a publication, ordered by
+// ORDEM-DE-AUTORIA.
+func extractAuthors(item map[string]interface{}) []Author {
+	var authors []Author
+	for _, a := range asMaps(item["autores"]) {
+		order, _ := strconv.Atoi(stringField(a, "ordem-de-autoria"))
+		authors = append(authors, Author{
+			Name:         stringField(a, "nome-completo-do-autor"),
+			CitationName: stringField(a, "nome-para-citacao"),
+			Order:        order,
+			CNPqID:       strings.TrimSpace(stringField(a, "nro-id-cnpq")),
+		})
+	}
+	sort.SliceStable(authors, func(i, j int) bool { return authors[i].Order < authors[j].Order })
+	return authors
+}
+
+// childItems returns the repeated elements section/element below parent,
+// whether the XML had one occurrence (map) or several (slice).
+func childItems(parent map[string]interface{}, section, element string) []map[string]interface{} {
+	if parent == nil {
+		return nil
+	}
+	sec, ok := parent[section].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	return asMaps(sec[element])
+}
+
+func childMap(m map[string]interface{}, key string) map[string]interface{} {
+	child, _ := m[key].(map[string]interface{})
+	return child
+}
+
+func asMaps(v interface{}) []map[string]interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		return []map[string]interface{}{val}
+	case []interface{}:
+		out := make([]map[string]interface{}, 0, len(val))
+		for _, item := range val {
+			if m, ok := item.(map[string]interface{}); ok {
+				out = append(out, m)
+			}
+		}
+		return out
+	default:
+		return nil
+	}
+}
+
+func yearField(m map[string]interface{}, key string) int {
+	year, err := strconv.Atoi(strings.TrimSpace(stringField(m, key)))
+	if err != nil {
+		return 0
+	}
+	return year
+}
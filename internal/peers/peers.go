@@ -0,0 +1,193 @@
+// Package peers ranks the researchers of the base by how closely related they
+// are to a target researcher, so relationship analyses can focus on the most
+// promising candidates instead of the whole base.
+package peers
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/edalcin/smartlattes/internal/dedup"
+	"github.com/edalcin/smartlattes/internal/network"
+	"github.com/edalcin/smartlattes/internal/parser"
+	"github.com/edalcin/smartlattes/internal/store"
+	"github.com/edalcin/smartlattes/internal/textnorm"
+)
+
+// Weights of each signal in the final score. Co-authorship is the strongest
+// evidence of a working relationship; shared areas and title vocabulary point
+// to common interests.
+const (
+	coauthorWeight = 0.4
+	areaWeight     = 0.3
+	keywordWeight  = 0.3
+)
+
+// coauthorHalf is the number of shared publications that yields half of the
+// co-authorship signal; more publications approach the full weight.
+const coauthorHalf = 2
+
+// maxSharedTerms caps the title terms reported for each peer.
+const maxSharedTerms = 5
+
+// Peer is a researcher of the base scored against the target. Score is in
+// [0, 1]; the other fields explain it.
+type Peer struct {
+	LattesID     string   `json:"lattesId"`
+	Name         string   `json:"name"`
+	Score        float64  `json:"score"`
+	Coauthored   int      `json:"coauthored,omitempty"`
+	SharedAreas  []string `json:"sharedAreas,omitempty"`
+	SharedTerms  []string `json:"sharedTerms,omitempty"`
+	AreaScore    float64  `json:"areaScore"`
+	KeywordScore float64  `json:"keywordScore"`
+}
+
+// Rank scores every researcher other than target and returns them from the
+// most to the least related. The signals are:
+//
+//   - co-authorship: distinct publications shared with the target, matched as
+//     in the co-authorship graph;
+//   - areas: Jaccard similarity of the areas, sub-areas and specialties of
+//     areas-de-atuacao;
+//   - keywords: TF-IDF cosine similarity of the publication titles, so terms
+//     common to the whole base weigh little.
+//
+// Ties, including researchers with no relation at all, are ordered by name.
+func Rank(researchers []store.ResearcherPublications, clusters *dedup.Result, target string) []Peer {
+	coauthored := make(map[string]int)
+	for _, e := range network.Build(researchers, clusters).Edges {
+		switch target {
+		case e.Source:
+			coauthored[e.Target] = e.Weight
+		case e.Target:
+			coauthored[e.Source] = e.Weight
+		}
+	}
+
+	areas := make(map[string]map[string]string, len(researchers))
+	terms := make(map[string]map[string]float64, len(researchers))
+	docFreq := make(map[string]int)
+	for _, r := range researchers {
+		areas[r.LattesID] = areaKeys(r.Areas)
+		tf := make(map[string]float64)
+		for _, p := range r.Publications.All() {
+			for _, t := range textnorm.Terms(p.Title) {
+				tf[t]++
+			}
+		}
+		for t := range tf {
+			docFreq[t]++
+		}
+		terms[r.LattesID] = tf
+	}
+
+	vectors := make(map[string]map[string]float64, len(terms))
+	for id, tf := range terms {
+		vectors[id] = tfidf(tf, docFreq, len(researchers))
+	}
+
+	var ranked []Peer
+	for _, r := range researchers {
+		if r.LattesID == target {
+			continue
+		}
+		p := Peer{LattesID: r.LattesID, Name: r.Name, Coauthored: coauthored[r.LattesID]}
+		p.AreaScore, p.SharedAreas = areaSimilarity(areas[target], areas[r.LattesID])
+		p.KeywordScore, p.SharedTerms = cosine(vectors[target], vectors[r.LattesID])
+
+		coauthorScore := float64(p.Coauthored) / float64(p.Coauthored+coauthorHalf)
+		p.Score = round(coauthorWeight*coauthorScore + areaWeight*p.AreaScore + keywordWeight*p.KeywordScore)
+		p.AreaScore = round(p.AreaScore)
+		p.KeywordScore = round(p.KeywordScore)
+		ranked = append(ranked, p)
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		return ranked[i].Name < ranked[j].Name
+	})
+	return ranked
+}
+
+// areaKeys returns the researcher's areas, sub-areas and specialties keyed by
+// their normalized name. Grandes áreas are left out: sharing "Ciências
+// Biológicas" says little about common interests.
+func areaKeys(areas []parser.Area) map[string]string {
+	keys := make(map[string]string)
+	for _, a := range areas {
+		for _, name := range []string{a.Area, a.SubArea, a.Especialidade} {
+			if key := textnorm.Fold(name); key != "" {
+				keys[key] = strings.TrimSpace(name)
+			}
+		}
+	}
+	return keys
+}
+
+// areaSimilarity returns the Jaccard similarity of two area sets and the
+// display names of the shared areas, sorted.
+func areaSimilarity(a, b map[string]string) (float64, []string) {
+	if len(a) == 0 || len(b) == 0 {
+		return 0, nil
+	}
+	var shared []string
+	for key, name := range a {
+		if _, ok := b[key]; ok {
+			shared = append(shared, name)
+		}
+	}
+	sort.Strings(shared)
+	return float64(len(shared)) / float64(len(a)+len(b)-len(shared)), shared
+}
+
+func tfidf(tf map[string]float64, docFreq map[string]int, docs int) map[string]float64 {
+	v := make(map[string]float64, len(tf))
+	for t, n := range tf {
+		idf := math.Log(1 + float64(docs)/float64(docFreq[t]))
+		v[t] = (1 + math.Log(n)) * idf
+	}
+	return v
+}
+
+// cosine returns the cosine similarity of two term vectors and the shared
+// terms that contribute the most to it.
+func cosine(a, b map[string]float64) (float64, []string) {
+	var dot, normA, normB float64
+	type contribution struct {
+		term  string
+		value float64
+	}
+	var shared []contribution
+	for t, x := range a {
+		normA += x * x
+		if y, ok := b[t]; ok {
+			dot += x * y
+			shared = append(shared, contribution{t, x * y})
+		}
+	}
+	for _, y := range b {
+		normB += y * y
+	}
+	if dot == 0 {
+		return 0, nil
+	}
+	sort.Slice(shared, func(i, j int) bool {
+		if shared[i].value != shared[j].value {
+			return shared[i].value > shared[j].value
+		}
+		return shared[i].term < shared[j].term
+	})
+	var top []string
+	for _, c := range shared[:min(len(shared), maxSharedTerms)] {
+		top = append(top, c.term)
+	}
+	return dot / math.Sqrt(normA*normB), top
+}
+
+func round(x float64) float64 {
+	return math.Round(x*1000) / 1000
+}
@@ -0,0 +1,66 @@
+package peers
+
+import (
+	"testing"
+
+	"github.com/edalcin/smartlattes/internal/dedup"
+	"github.com/edalcin/smartlattes/internal/parser"
+	"github.com/edalcin/smartlattes/internal/store"
+)
+
+func researcher(id, name, citation string, areas []parser.Area, titles ...string) store.ResearcherPublications {
+	r := store.ResearcherPublications{LattesID: id, Name: name, CitationNames: citation, Areas: areas}
+	for _, title := range titles {
+		r.Publications.Articles = append(r.Publications.Articles, parser.Article{
+			Publication: parser.Publication{Type: "article", Title: title, Year: 2020},
+		})
+	}
+	return r
+}
+
+func TestRank(t *testing.T) {
+	ecology := []parser.Area{{GrandeArea: "CIENCIAS_BIOLOGICAS", Area: "Ecologia", SubArea: "Ecologia de Ecossistemas"}}
+	botany := []parser.Area{{GrandeArea: "CIENCIAS_BIOLOGICAS", Area: "Botânica", SubArea: "Taxonomia Vegetal"}}
+	computing := []parser.Area{{GrandeArea: "CIENCIAS_EXATAS_E_DA_TERRA", Area: "Ciência da Computação"}}
+
+	target := researcher("1", "Ana Alvo", "ALVO, A.", ecology,
+		"Dinâmica de florestas tropicais na Amazônia",
+		"Polinização em florestas tropicais")
+	coauthor := researcher("2", "Bruno Coautor", "COAUTOR, B.", botany,
+		"Flora do cerrado")
+	coauthor.Publications.Articles[0].Authors = []parser.Author{{Name: "Ana Alvo", CitationName: "ALVO, A."}, {Name: "Bruno Coautor"}}
+
+	researchers := []store.ResearcherPublications{
+		target,
+		researcher("3", "Carla Ecóloga", "ECOLOGA, C.", ecology, "Sucessão ecológica em florestas tropicais"),
+		researcher("4", "Davi Distante", "DISTANTE, D.", computing, "Compiladores otimizantes"),
+		coauthor,
+		researcher("5", "Eva Palinóloga", "", botany, "Polinização por abelhas nativas"),
+	}
+
+	ranked := Rank(researchers, dedup.Group(researchers), "1")
+	var order []string
+	for _, p := range ranked {
+		order = append(order, p.LattesID)
+	}
+	if len(order) != 4 || order[0] != "3" || order[3] != "4" {
+		t.Fatalf("ranking = %v", order)
+	}
+
+	byID := make(map[string]Peer)
+	for _, p := range ranked {
+		byID[p.LattesID] = p
+	}
+	if p := byID["3"]; len(p.SharedAreas) != 2 || p.AreaScore != 1 || len(p.SharedTerms) == 0 {
+		t.Errorf("same-area peer = %+v", p)
+	}
+	if p := byID["2"]; p.Coauthored != 1 || p.Score <= byID["5"].Score {
+		t.Errorf("co-author %+v should rank above %+v", p, byID["5"])
+	}
+	if p := byID["5"]; len(p.SharedTerms) != 1 || p.SharedTerms[0] != "polinizacao" {
+		t.Errorf("shared terms = %v", p.SharedTerms)
+	}
+	if p := byID["4"]; p.Score != 0 || p.SharedAreas != nil || p.SharedTerms != nil {
+		t.Errorf("unrelated peer = %+v", p)
+	}
+}
@@ -0,0 +1,155 @@
+// Package quota limits how much each client may use the AI providers at the
+// server's expense, with the keys it manages or its own hardware.
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/edalcin/smartlattes/internal/store"
+)
+
+var ErrExceeded = errors.New("cota diária excedida")
+
+// Limits are the daily allowance of each client. Zero means unlimited.
+type Limits struct {
+	RequestsPerDay int64 `json:"requestsPerDay"`
+	TokensPerDay   int64 `json:"tokensPerDay"`
+}
+
+// Limiter enforces Limits, keeping the usage in the store so it is shared by
+// every instance of the server and survives restarts. A nil Limiter allows
+// everything and records nothing.
+type Limiter struct {
+	Store  store.Store
+	Limits Limits
+	// TrustProxy identifies clients by the X-Forwarded-For header set by a
+	// reverse proxy instead of the connection's address.
+	TrustProxy bool
+	// ProxyHops is how many trusted proxies append to X-Forwarded-For in
+	// front of the server; zero counts as one. The client is the entry that
+	// many positions from the right, as those to its left come from the
+	// client itself and can be forged.
+	ProxyHops int
+	// Now returns the current time; nil uses time.Now.
+	Now func() time.Time
+}
+
+// Day is the key under which usage is counted, in the server's time zone.
+func (l *Limiter) Day() string {
+	now := time.Now
+	if l != nil && l.Now != nil {
+		now = l.Now
+	}
+	return now().Format("2006-01-02")
+}
+
+// Client identifies who made the request: its IP address.
+func (l *Limiter) Client(r *http.Request) string {
+	if l != nil && l.TrustProxy {
+		var hops []string
+		for _, v := range r.Header.Values("X-Forwarded-For") {
+			for _, hop := range strings.Split(v, ",") {
+				if hop = strings.TrimSpace(hop); hop != "" {
+					hops = append(hops, hop)
+				}
+			}
+		}
+		if len(hops) > 0 {
+			i := len(hops) - max(l.ProxyHops, 1)
+			return hops[max(i, 0)]
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Reservation is the usage counted for a request before calling the
+// provider.
+type Reservation struct {
+	l      *Limiter
+	client string
+	day    string
+	tokens int64
+}
+
+// Reserve counts one request and the estimated tokens for client. When that
+// goes over a limit the usage is given back and an error wrapping ErrExceeded
+// is returned.
+func (l *Limiter) Reserve(ctx context.Context, client string, tokens int64) (*Reservation, error) {
+	if l == nil || l.Store == nil {
+		return nil, nil
+	}
+	day := l.Day()
+	rec, err := l.Store.AddUsage(ctx, client, day, 1, tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	var exceeded string
+	switch {
+	case l.Limits.RequestsPerDay > 0 && rec.Requests > l.Limits.RequestsPerDay:
+		exceeded = fmt.Sprintf("limite de %d requisições por dia", l.Limits.RequestsPerDay)
+	case l.Limits.TokensPerDay > 0 && rec.Tokens > l.Limits.TokensPerDay:
+		exceeded = fmt.Sprintf("limite de %d tokens por dia", l.Limits.TokensPerDay)
+	}
+	if exceeded != "" {
+		if _, err := l.Store.AddUsage(context.WithoutCancel(ctx), client, day, -1, -tokens); err != nil {
+			log.Printf("quota: erro ao devolver uso de %s: %v", client, err)
+		}
+		return nil, fmt.Errorf("%w: %s", ErrExceeded, exceeded)
+	}
+	return &Reservation{l: l, client: client, day: day, tokens: tokens}, nil
+}
+
+// Extend counts tokens more for the request, as when a conversation with
+// tools goes for another round. When that goes over the token limit the
+// tokens are given back and an error wrapping ErrExceeded is returned.
+func (r *Reservation) Extend(ctx context.Context, tokens int64) error {
+	if r == nil {
+		return nil
+	}
+	rec, err := r.l.Store.AddUsage(ctx, r.client, r.day, 0, tokens)
+	if err != nil {
+		return err
+	}
+	if limit := r.l.Limits.TokensPerDay; limit > 0 && rec.Tokens > limit {
+		if _, err := r.l.Store.AddUsage(context.WithoutCancel(ctx), r.client, r.day, 0, -tokens); err != nil {
+			log.Printf("quota: erro ao devolver uso de %s: %v", r.client, err)
+		}
+		return fmt.Errorf("%w: limite de %d tokens por dia", ErrExceeded, limit)
+	}
+	r.tokens += tokens
+	return nil
+}
+
+// Settle replaces the estimate counted by Reserve and Extend with the tokens the request
+// actually used. The request itself stays counted, even if it failed.
+func (r *Reservation) Settle(ctx context.Context, tokens int64) {
+	if r == nil || tokens == r.tokens {
+		return
+	}
+	if _, err := r.l.Store.AddUsage(context.WithoutCancel(ctx), r.client, r.day, 0, tokens-r.tokens); err != nil {
+		log.Printf("quota: erro ao registrar uso de %s: %v", r.client, err)
+	}
+}
+
+// EstimateTokens approximates how many tokens the texts take, at four
+// characters per token.
+func EstimateTokens(texts ...string) int64 {
+	var chars int
+	for _, t := range texts {
+		chars += utf8.RuneCountInString(t)
+	}
+	return int64((chars + 3) / 4)
+}
@@ -0,0 +1,114 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/edalcin/smartlattes/internal/store"
+)
+
+func TestLimiter(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemoryStore()
+	now := time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)
+	l := &Limiter{Store: s, Limits: Limits{RequestsPerDay: 3, TokensPerDay: 1000}, Now: func() time.Time { return now }}
+
+	res, err := l.Reserve(ctx, "10.0.0.1", 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Settle(ctx, 200)
+
+	if _, err := l.Reserve(ctx, "10.0.0.1", 900); !errors.Is(err, ErrExceeded) || err.Error() != "cota diária excedida: limite de 1000 tokens por dia" {
+		t.Errorf("token limit error = %v", err)
+	}
+	if _, err := l.Reserve(ctx, "10.0.0.2", 900); err != nil {
+		t.Errorf("another client was limited: %v", err)
+	}
+	l.Reserve(ctx, "10.0.0.1", 10)
+	l.Reserve(ctx, "10.0.0.1", 10)
+	if _, err := l.Reserve(ctx, "10.0.0.1", 10); !errors.Is(err, ErrExceeded) || err.Error() != "cota diária excedida: limite de 3 requisições por dia" {
+		t.Errorf("request limit error = %v", err)
+	}
+
+	records, _ := s.ListUsage(ctx, "2024-03-15")
+	if len(records) != 2 || records[1].Client != "10.0.0.1" || records[1].Requests != 3 || records[1].Tokens != 220 {
+		t.Errorf("usage = %+v", records)
+	}
+
+	now = now.Add(24 * time.Hour)
+	if _, err := l.Reserve(ctx, "10.0.0.1", 10); err != nil {
+		t.Errorf("limit not reset on the next day: %v", err)
+	}
+}
+
+func TestExtend(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemoryStore()
+	l := &Limiter{Store: s, Limits: Limits{TokensPerDay: 1000}}
+
+	res, err := l.Reserve(ctx, "10.0.0.1", 400)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := res.Extend(ctx, 400); err != nil {
+		t.Fatal(err)
+	}
+	if err := res.Extend(ctx, 400); !errors.Is(err, ErrExceeded) {
+		t.Errorf("extending past the limit = %v", err)
+	}
+	res.Settle(ctx, 900)
+
+	records, _ := s.ListUsage(ctx, l.Day())
+	if len(records) != 1 || records[0].Requests != 1 || records[0].Tokens != 900 {
+		t.Errorf("usage = %+v", records)
+	}
+}
+
+func TestNilLimiter(t *testing.T) {
+	var l *Limiter
+	res, err := l.Reserve(context.Background(), "10.0.0.1", 1e9)
+	if res != nil || err != nil {
+		t.Errorf("Reserve = %v, %v", res, err)
+	}
+	res.Settle(context.Background(), 10)
+	if err := res.Extend(context.Background(), 1e9); err != nil {
+		t.Errorf("Extend = %v", err)
+	}
+}
+
+func TestClient(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "192.0.2.1:5123"
+	r.Header.Set("X-Forwarded-For", "203.0.113.7")
+
+	if got := (&Limiter{}).Client(r); got != "192.0.2.1" {
+		t.Errorf("client = %q", got)
+	}
+	if got := (&Limiter{TrustProxy: true}).Client(r); got != "203.0.113.7" {
+		t.Errorf("client behind proxy = %q", got)
+	}
+
+	// The client sent its own X-Forwarded-For; the proxy appended the real
+	// address to it.
+	r.Header.Set("X-Forwarded-For", "198.51.100.9, 203.0.113.7")
+	if got := (&Limiter{TrustProxy: true}).Client(r); got != "203.0.113.7" {
+		t.Errorf("client with forged header = %q", got)
+	}
+	r.Header.Add("X-Forwarded-For", "10.0.0.1")
+	if got := (&Limiter{TrustProxy: true, ProxyHops: 2}).Client(r); got != "203.0.113.7" {
+		t.Errorf("client behind two proxies = %q", got)
+	}
+	if got := (&Limiter{TrustProxy: true, ProxyHops: 5}).Client(r); got != "198.51.100.9" {
+		t.Errorf("client with fewer hops than configured = %q", got)
+	}
+}
+
+func TestEstimateTokens(t *testing.T) {
+	if got := EstimateTokens("abcd", "ação"); got != 2 {
+		t.Errorf("EstimateTokens = %d, want 2", got)
+	}
+}
@@ -9,6 +9,11 @@
     var dataSection = document.getElementById('data-section');
     var researchersBody = document.getElementById('researchers-body');
     var totalCount = document.getElementById('total-count');
+    var usageBody = document.getElementById('usage-body');
+    var usageDay = document.getElementById('usage-day');
+    var usageLimits = document.getElementById('usage-limits');
+    var callsBody = document.getElementById('calls-body');
+    var callsTotal = document.getElementById('calls-total');
 
     function showError(msg) {
         errorMessage.textContent = msg;
@@ -99,6 +104,8 @@
             });
 
             totalCount.textContent = 'Total: ' + researchers.length + ' pesquisador' + (researchers.length !== 1 ? 'es' : '');
+            loadUsage(pin, '');
+            loadCalls(pin);
         })
         .catch(function () {
             setLoading(false);
@@ -106,6 +113,123 @@
         });
     }
 
+    function formatLimit(value, unit) {
+        return value > 0 ? value.toLocaleString('pt-BR') + ' ' + unit + ' por dia' : unit + ' sem limite';
+    }
+
+    function loadUsage(pin, day) {
+        fetch('/api/admin/usage' + (day ? '?day=' + encodeURIComponent(day) : ''), {
+            method: 'GET',
+            headers: { 'X-Admin-PIN': pin }
+        })
+        .then(function (res) { return res.json(); })
+        .then(function (data) {
+            if (!data.success) {
+                showError(data.error || 'Erro ao carregar uso');
+                return;
+            }
+
+            usageDay.value = data.day;
+            usageLimits.textContent = 'Cota por cliente: ' +
+                formatLimit(data.limits.requestsPerDay, 'requisi\u00e7\u00f5es') + ', ' +
+                formatLimit(data.limits.tokensPerDay, 'tokens') + '.';
+
+            usageBody.innerHTML = '';
+            var usage = data.usage || [];
+            if (usage.length === 0) {
+                var empty = document.createElement('tr');
+                var td = document.createElement('td');
+                td.colSpan = 4;
+                td.textContent = 'Nenhum uso registrado neste dia.';
+                td.style.color = 'var(--color-text-muted)';
+                empty.appendChild(td);
+                usageBody.appendChild(empty);
+                return;
+            }
+            usage.forEach(function (u) {
+                var tr = document.createElement('tr');
+                [
+                    u.client,
+                    u.requests.toLocaleString('pt-BR'),
+                    u.tokens.toLocaleString('pt-BR'),
+                    new Date(u.updatedAt).toLocaleTimeString('pt-BR')
+                ].forEach(function (text) {
+                    var td = document.createElement('td');
+                    td.textContent = text;
+                    tr.appendChild(td);
+                });
+                usageBody.appendChild(tr);
+            });
+        })
+        .catch(function () {
+            showError('Erro ao conectar com o servidor');
+        });
+    }
+
+    var callKinds = { resumo: 'Resumo', analise: 'An\u00e1lise', chat: 'Chat' };
+
+    function formatCost(cost) {
+        if (cost === undefined || cost === null) {
+            return '\u2014';
+        }
+        return 'US$ ' + cost.toLocaleString('pt-BR', { minimumFractionDigits: 4, maximumFractionDigits: 4 });
+    }
+
+    function loadCalls(pin) {
+        fetch('/api/admin/calls', {
+            method: 'GET',
+            headers: { 'X-Admin-PIN': pin }
+        })
+        .then(function (res) { return res.json(); })
+        .then(function (data) {
+            if (!data.success) {
+                showError(data.error || 'Erro ao carregar chamadas');
+                return;
+            }
+
+            var calls = data.calls || [];
+            callsTotal.textContent = 'Custo estimado das ' + calls.length + ' chamadas listadas: ' + formatCost(data.totalCostUsd) + '.';
+            callsBody.innerHTML = '';
+            if (calls.length === 0) {
+                var empty = document.createElement('tr');
+                var td = document.createElement('td');
+                td.colSpan = 5;
+                td.textContent = 'Nenhuma chamada registrada.';
+                td.style.color = 'var(--color-text-muted)';
+                empty.appendChild(td);
+                callsBody.appendChild(empty);
+                return;
+            }
+            calls.forEach(function (c) {
+                var tr = document.createElement('tr');
+                var tokens = (c.inputTokens || 0).toLocaleString('pt-BR') + ' / ' + (c.outputTokens || 0).toLocaleString('pt-BR');
+                [
+                    new Date(c.at).toLocaleString('pt-BR'),
+                    (callKinds[c.kind] || c.kind) + (c.serverKey ? ' (chave do servidor)' : ''),
+                    c.provider + ' / ' + c.model,
+                    tokens,
+                    formatCost(c.costUsd)
+                ].forEach(function (text) {
+                    var td = document.createElement('td');
+                    td.textContent = text;
+                    tr.appendChild(td);
+                });
+                callsBody.appendChild(tr);
+            });
+        })
+        .catch(function () {
+            showError('Erro ao conectar com o servidor');
+        });
+    }
+
+    usageDay.addEventListener('change', function () {
+        var pin = sessionStorage.getItem('adminPIN');
+        if (pin && usageDay.value) {
+            hideError();
+            loadUsage(pin, usageDay.value);
+        }
+    });
+
     pinBtn.addEventListener('click', function () {
         var pin = pinInput.value.trim();
         if (!pin) {
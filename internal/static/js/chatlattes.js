@@ -12,15 +12,41 @@
     var sendBtn = document.getElementById('send-btn');
     var newChatBtn = document.getElementById('new-chat-btn');
     var providerInfo = document.getElementById('chat-provider-info');
+    var shareChatBtn = document.getElementById('share-chat-btn');
+    var sessionsSection = document.getElementById('sessions-section');
+    var sessionsList = document.getElementById('sessions-list');
 
     var messages = [];
     var isWaiting = false;
+    // sessionId is the conversation stored on the server; without it the
+    // history lives only in this page and is sent with every question.
+    var sessionId = null;
+
+    loadSessions();
 
     providerSelect.addEventListener('change', checkLoadModels);
     apiKeyInput.addEventListener('input', checkLoadModels);
 
+    var keyOptional = {};
+
+    fetch('/api/config').then(function(r){return r.json()}).then(function(cfg){
+        if (!cfg.providers) return;
+        var selected = providerSelect.value;
+        providerSelect.innerHTML = '<option value="">Selecione o provedor...</option>';
+        cfg.providers.forEach(function(p){
+            var opt = document.createElement('option');
+            opt.value = p.id;
+            opt.textContent = p.name;
+            providerSelect.appendChild(opt);
+            if (!p.keyRequired) keyOptional[p.id] = true;
+        });
+        providerSelect.value = selected;
+        checkLoadModels();
+    }).catch(function(){});
+
     function checkLoadModels() {
-        loadModelsBtn.disabled = !(providerSelect.value && apiKeyInput.value.length >= 10);
+        loadModelsBtn.disabled = !(providerSelect.value && (keyOptional[providerSelect.value] || apiKeyInput.value.length >= 10));
+        apiKeyInput.placeholder = keyOptional[providerSelect.value] ? 'Opcional: o servidor fornece a chave' : 'Digite sua chave de API...';
     }
 
     loadModelsBtn.addEventListener('click', function () {
@@ -68,25 +94,169 @@
 
     modelSelect.addEventListener('change', function () {
         startChatBtn.disabled = !modelSelect.value;
+        updateResumeBtns();
     });
 
     startChatBtn.addEventListener('click', function () {
-        settingsPanel.style.display = 'none';
-        chatArea.style.display = 'flex';
-        var providerName = providerSelect.options[providerSelect.selectedIndex].text;
-        var modelName = modelSelect.options[modelSelect.selectedIndex].text;
-        providerInfo.textContent = providerName + ' / ' + modelName;
-        chatInput.focus();
-        updateSendBtn();
+        createSession();
+        openChat();
     });
 
     newChatBtn.addEventListener('click', function () {
         messages = [];
         chatMessages.innerHTML = '';
         showWelcome();
+        createSession();
         chatInput.focus();
     });
 
+    shareChatBtn.addEventListener('click', function () {
+        if (!sessionId) return;
+        var id = sessionId;
+        fetch('/api/chat/sessions/' + id + '/share', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ shared: true })
+        })
+        .then(function (r) { return r.json(); })
+        .then(function (data) {
+            if (!data.success) {
+                showChatError(data.error || 'Erro ao compartilhar conversa');
+                return;
+            }
+            return fetch('/api/config').then(function (r) { return r.json(); }).then(function (cfg) {
+                copyToClipboard(cfg.shareBaseUrl + '?conversa=' + id, shareChatBtn);
+            });
+        })
+        .catch(function () {
+            showChatError('Erro de conex\u00e3o ao compartilhar conversa.');
+        });
+    });
+
+    function openChat() {
+        settingsPanel.style.display = 'none';
+        chatArea.style.display = 'flex';
+        var providerName = providerSelect.options[providerSelect.selectedIndex].text;
+        var modelName = modelSelect.options[modelSelect.selectedIndex].text;
+        providerInfo.textContent = providerName + ' / ' + modelName;
+        chatInput.focus();
+        updateSendBtn();
+    }
+
+    // createSession starts a conversation stored on the server. When it
+    // cannot be created the chat still works, keeping the history in the page.
+    function createSession() {
+        sessionId = null;
+        shareChatBtn.style.display = 'none';
+        fetch('/api/chat/sessions', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ provider: providerSelect.value, model: modelSelect.value })
+        })
+        .then(function (r) { return r.json(); })
+        .then(function (data) {
+            if (data.success && messages.length === 0) {
+                sessionId = data.session.id;
+            }
+        })
+        .catch(function () {});
+    }
+
+    function loadSessions() {
+        fetch('/api/chat/sessions')
+            .then(function (r) { return r.json(); })
+            .then(function (data) {
+                if (!data.success || !data.sessions.length) {
+                    sessionsSection.style.display = 'none';
+                    return;
+                }
+                sessionsList.innerHTML = '';
+                data.sessions.forEach(function (s) {
+                    if (!s.title) return;
+                    var li = document.createElement('li');
+
+                    var title = document.createElement('span');
+                    title.className = 'chat-session-title';
+                    title.textContent = s.title;
+                    title.title = s.title;
+
+                    var date = document.createElement('span');
+                    date.className = 'chat-session-date';
+                    date.textContent = new Date(s.updatedAt).toLocaleDateString('pt-BR');
+
+                    var resume = document.createElement('button');
+                    resume.type = 'button';
+                    resume.className = 'btn btn-primary btn-sm resume-session-btn';
+                    resume.textContent = 'Retomar';
+                    resume.disabled = !modelSelect.value;
+                    resume.addEventListener('click', function () { resumeSession(s.id); });
+
+                    var remove = document.createElement('button');
+                    remove.type = 'button';
+                    remove.className = 'btn btn-secondary btn-sm';
+                    remove.textContent = 'Excluir';
+                    remove.addEventListener('click', function () { deleteSession(s.id); });
+
+                    li.appendChild(title);
+                    li.appendChild(date);
+                    li.appendChild(resume);
+                    li.appendChild(remove);
+                    sessionsList.appendChild(li);
+                });
+                sessionsSection.style.display = sessionsList.children.length ? '' : 'none';
+            })
+            .catch(function () {});
+    }
+
+    function updateResumeBtns() {
+        var btns = sessionsList.querySelectorAll('.resume-session-btn');
+        for (var i = 0; i < btns.length; i++) {
+            btns[i].disabled = !modelSelect.value;
+        }
+    }
+
+    function resumeSession(id) {
+        hideSettingsError();
+        fetch('/api/chat/sessions/' + id)
+            .then(function (r) { return r.json(); })
+            .then(function (data) {
+                if (!data.success) {
+                    showSettingsError(data.error || 'Erro ao carregar conversa');
+                    return;
+                }
+                sessionId = data.session.id;
+                messages = [];
+                chatMessages.innerHTML = '';
+                data.session.messages.forEach(function (m) {
+                    messages.push({ role: m.role, content: m.content });
+                    appendMessage(m.role, m.content);
+                });
+                if (!messages.length) showWelcome();
+                shareChatBtn.style.display = messages.length ? '' : 'none';
+                openChat();
+                scrollToBottom();
+            })
+            .catch(function () {
+                showSettingsError('Erro de conex\u00e3o ao carregar conversa');
+            });
+    }
+
+    function deleteSession(id) {
+        if (!window.confirm('Excluir esta conversa?')) return;
+        fetch('/api/chat/sessions/' + id, { method: 'DELETE' })
+            .then(function (r) { return r.json(); })
+            .then(function (data) {
+                if (!data.success) {
+                    showSettingsError(data.error || 'Erro ao excluir conversa');
+                    return;
+                }
+                loadSessions();
+            })
+            .catch(function () {
+                showSettingsError('Erro de conex\u00e3o ao excluir conversa');
+            });
+    }
+
     chatInput.addEventListener('input', function () {
         this.style.height = 'auto';
         this.style.height = Math.min(this.scrollHeight, 150) + 'px';
@@ -131,15 +301,116 @@
         showTyping();
         scrollToBottom();
 
+        // A stored conversation already has the history on the server
+        var payload = JSON.stringify({
+            provider: providerSelect.value,
+            apiKey: apiKeyInput.value,
+            model: modelSelect.value,
+            sessionId: sessionId || '',
+            messages: sessionId ? messages.slice(-1) : messages
+        });
+
+        if (!window.ReadableStream || !window.TextDecoder) {
+            sendMessageJSON(payload);
+            return;
+        }
+
+        var bubble = null;
+        var answer = '';
+
+        fetch('/api/chat/stream', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: payload
+        })
+        .then(function (r) {
+            var contentType = r.headers.get('Content-Type') || '';
+            if (contentType.indexOf('text/event-stream') === -1 || !r.body) {
+                return r.json().then(function (data) {
+                    finishWithError(data.error || 'Erro ao obter resposta');
+                });
+            }
+
+            var reader = r.body.getReader();
+            var decoder = new TextDecoder();
+            var buffer = '';
+            var finished = false;
+
+            function handleEvent(name, data) {
+                if (name === 'delta') {
+                    if (!bubble) {
+                        removeTyping();
+                        bubble = appendMessage('assistant', '');
+                    }
+                    answer += data.text;
+                    bubble.innerHTML = renderMarkdown(answer);
+                    scrollToBottom();
+                } else if (name === 'tool') {
+                    showToolActivity(data.name);
+                    scrollToBottom();
+                } else if (name === 'done') {
+                    finished = true;
+                    removeTyping();
+                    if (!bubble) {
+                        bubble = appendMessage('assistant', '');
+                    }
+                    answer = data.response;
+                    bubble.innerHTML = renderMarkdown(answer);
+                    appendTruncationNote(bubble, data.truncation);
+                    messages.push({ role: 'assistant', content: answer });
+                    sessionSaved(data);
+                    isWaiting = false;
+                    updateSendBtn();
+                    scrollToBottom();
+                } else if (name === 'error') {
+                    finished = true;
+                    finishWithError(data.error || 'Erro ao obter resposta');
+                }
+            }
+
+            function pump() {
+                return reader.read().then(function (chunk) {
+                    if (chunk.done) {
+                        if (!finished) {
+                            finishWithError('A conex\u00e3o foi interrompida antes do fim da resposta.');
+                        }
+                        return;
+                    }
+                    buffer += decoder.decode(chunk.value, { stream: true });
+                    var parts = buffer.split('\n\n');
+                    buffer = parts.pop();
+                    for (var i = 0; i < parts.length; i++) {
+                        var event = parseSSE(parts[i]);
+                        if (event) handleEvent(event.name, event.data);
+                    }
+                    return pump();
+                });
+            }
+
+            return pump();
+        })
+        .catch(function () {
+            finishWithError('Erro de conex\u00e3o. Verifique sua rede e tente novamente.');
+        });
+
+        function finishWithError(msg) {
+            removeTyping();
+            if (bubble) {
+                bubble.parentNode.remove();
+                bubble = null;
+            }
+            isWaiting = false;
+            updateSendBtn();
+            showChatError(msg);
+            messages.pop();
+        }
+    }
+
+    function sendMessageJSON(payload) {
         fetch('/api/chat', {
             method: 'POST',
             headers: { 'Content-Type': 'application/json' },
-            body: JSON.stringify({
-                provider: providerSelect.value,
-                apiKey: apiKeyInput.value,
-                model: modelSelect.value,
-                messages: messages
-            })
+            body: payload
         })
         .then(function (r) {
             return r.json().then(function (data) {
@@ -158,18 +429,103 @@
             }
 
             messages.push({ role: 'assistant', content: result.body.response });
-            appendMessage('assistant', result.body.response);
+            appendTruncationNote(appendMessage('assistant', result.body.response), result.body.truncation);
+            sessionSaved(result.body);
             scrollToBottom();
         })
         .catch(function () {
             removeTyping();
             isWaiting = false;
             updateSendBtn();
-            showChatError('Erro de conexão. Verifique sua rede e tente novamente.');
+            showChatError('Erro de conex\u00e3o. Verifique sua rede e tente novamente.');
             messages.pop();
         });
     }
 
+    function sessionSaved(data) {
+        if (data.sessionWarning) {
+            showChatError(data.sessionWarning);
+        }
+        if (data.sessionId) {
+            shareChatBtn.style.display = '';
+        }
+    }
+
+    function copyToClipboard(text, btn) {
+        if (navigator.clipboard && navigator.clipboard.writeText) {
+            navigator.clipboard.writeText(text).then(function () {
+                showShareFeedback(btn);
+            }).catch(function () {
+                fallbackCopy(text, btn);
+            });
+        } else {
+            fallbackCopy(text, btn);
+        }
+    }
+
+    function fallbackCopy(text, btn) {
+        var ta = document.createElement('textarea');
+        ta.value = text;
+        ta.style.position = 'fixed';
+        ta.style.left = '-9999px';
+        document.body.appendChild(ta);
+        ta.select();
+        document.execCommand('copy');
+        document.body.removeChild(ta);
+        showShareFeedback(btn);
+    }
+
+    function showShareFeedback(btn) {
+        var original = btn.textContent;
+        btn.textContent = 'Link copiado!';
+        btn.disabled = true;
+        setTimeout(function () { btn.textContent = original; btn.disabled = false; }, 2000);
+    }
+
+    // truncationNote describes what was left out of the data sent to the
+    // model, from the report the server returns when it had to cut.
+    function truncationNote(report) {
+        var parts = [];
+        if (report.steps && report.steps.length) {
+            parts.push('Para caber no limite do modelo: ' + report.steps.join('; ') + '.');
+        }
+        if (report.publicationsTrimmed) {
+            parts.push(report.publicationsTrimmed + ' publica\u00e7\u00f5es omitidas.');
+        }
+        if (report.droppedResearchers && report.droppedResearchers.length) {
+            parts.push('Pesquisadores n\u00e3o consultados: ' + report.droppedResearchers.join(', ') + '.');
+        }
+        return parts.join(' ');
+    }
+
+    function appendTruncationNote(bubble, report) {
+        if (!report || !report.truncated) return;
+        var note = document.createElement('p');
+        note.className = 'chat-truncation-note';
+        note.textContent = truncationNote(report);
+        bubble.appendChild(note);
+    }
+
+    function parseSSE(block) {
+        var name = 'message';
+        var data = [];
+        var lines = block.split('\n');
+        for (var i = 0; i < lines.length; i++) {
+            var line = lines[i];
+            if (line.indexOf('event:') === 0) {
+                name = line.slice(6).trim();
+            } else if (line.indexOf('data:') === 0) {
+                data.push(line.slice(5).replace(/^ /, ''));
+            }
+        }
+        if (data.length === 0) return null;
+        try {
+            return { name: name, data: JSON.parse(data.join('\n')) };
+        } catch (e) {
+            return null;
+        }
+    }
+
     function appendMessage(role, content) {
         var div = document.createElement('div');
         div.className = 'chat-message chat-message-' + role;
@@ -190,6 +546,7 @@
         div.appendChild(avatar);
         div.appendChild(bubble);
         chatMessages.appendChild(div);
+        return bubble;
     }
 
     function showTyping() {
@@ -212,6 +569,28 @@
         chatMessages.appendChild(div);
     }
 
+    var toolLabels = {
+        buscar_pesquisadores: 'Buscando pesquisadores',
+        obter_curriculo: 'Lendo curr\u00edculo',
+        listar_publicacoes: 'Listando publica\u00e7\u00f5es',
+        contar_producao: 'Contando a produ\u00e7\u00e3o',
+        obter_resumo: 'Lendo resumo'
+    };
+
+    // showToolActivity tells, next to the typing dots, which query to the
+    // base the model is making.
+    function showToolActivity(name) {
+        var el = document.getElementById('typing-indicator');
+        if (!el) return;
+        var label = el.querySelector('.typing-label');
+        if (!label) {
+            label = document.createElement('span');
+            label.className = 'typing-label';
+            el.appendChild(label);
+        }
+        label.textContent = (toolLabels[name] || 'Consultando a base') + '...';
+    }
+
     function removeTyping() {
         var el = document.getElementById('typing-indicator');
         if (el) el.remove();
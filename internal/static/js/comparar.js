@@ -0,0 +1,233 @@
+(function () {
+    var searchInput = document.getElementById('search-input');
+    var searchResults = document.getElementById('search-results');
+    var selectedCv = document.getElementById('selected-cv');
+    var selectedName = document.getElementById('selected-name');
+    var selectedLattesId = document.getElementById('selected-lattes-id');
+    var kindSelect = document.getElementById('kind-select');
+    var spinner = document.getElementById('spinner');
+    var errorMsg = document.getElementById('error-message');
+    var infoMsg = document.getElementById('info-message');
+    var compareSection = document.getElementById('compare-section');
+    var sides = {
+        left: {
+            select: document.getElementById('left-select'),
+            metadata: document.getElementById('left-metadata'),
+            content: document.getElementById('left-content')
+        },
+        right: {
+            select: document.getElementById('right-select'),
+            metadata: document.getElementById('right-metadata'),
+            content: document.getElementById('right-content')
+        }
+    };
+
+    var currentLattesId = '';
+    var searchTimeout = null;
+
+    // Permite abrir a comparação diretamente: /comparar?id=<lattesId>&tipo=resumo|analise
+    var params = new URLSearchParams(window.location.search);
+    if (params.get('tipo') === 'analise') {
+        kindSelect.value = 'analysis';
+    }
+    if (params.get('id')) {
+        selectCV(params.get('id'), params.get('id'));
+    }
+
+    searchInput.addEventListener('input', function () {
+        var query = searchInput.value.trim();
+        if (searchTimeout) clearTimeout(searchTimeout);
+
+        if (query.length < 3) {
+            searchResults.innerHTML = '';
+            return;
+        }
+
+        searchTimeout = setTimeout(function () {
+            fetch('/api/search?q=' + encodeURIComponent(query))
+                .then(function (r) { return r.json(); })
+                .then(function (data) {
+                    if (!data.success || !data.results || data.results.length === 0) {
+                        searchResults.innerHTML = '<p class="search-empty">Nenhum resultado encontrado</p>';
+                        return;
+                    }
+                    var html = '';
+                    for (var i = 0; i < data.results.length; i++) {
+                        var cv = data.results[i];
+                        html += '<div class="search-result-card" data-lattes-id="' + cv.lattesId + '" data-name="' + escapeHtml(cv.name) + '">';
+                        html += '<strong>' + escapeHtml(cv.name) + '</strong>';
+                        html += '<span class="search-result-id">' + cv.lattesId + '</span>';
+                        html += '</div>';
+                    }
+                    searchResults.innerHTML = html;
+
+                    var cards = searchResults.querySelectorAll('.search-result-card');
+                    for (var j = 0; j < cards.length; j++) {
+                        cards[j].addEventListener('click', function () {
+                            selectCV(this.getAttribute('data-lattes-id'), this.getAttribute('data-name'));
+                        });
+                    }
+                })
+                .catch(function () {
+                    searchResults.innerHTML = '<p class="search-empty">Erro ao buscar</p>';
+                });
+        }, 300);
+    });
+
+    function selectCV(lattesId, name) {
+        currentLattesId = lattesId;
+        selectedName.textContent = name;
+        selectedLattesId.textContent = lattesId;
+        selectedCv.style.display = 'block';
+        searchResults.innerHTML = '';
+        loadRevisions();
+    }
+
+    kindSelect.addEventListener('change', function () {
+        if (currentLattesId) loadRevisions();
+    });
+
+    sides.left.select.addEventListener('change', function () { loadRevision(sides.left); });
+    sides.right.select.addEventListener('change', function () { loadRevision(sides.right); });
+
+    function loadRevisions() {
+        hideMessages();
+        compareSection.style.display = 'none';
+        spinner.classList.add('visible');
+
+        fetch('/api/' + kindSelect.value + '/revisions/' + currentLattesId)
+            .then(function (r) { return r.json(); })
+            .then(function (data) {
+                spinner.classList.remove('visible');
+
+                if (!data.success) {
+                    showError(data.error || 'Erro ao carregar versões');
+                    return;
+                }
+                if (data.revisions.length < 2) {
+                    showInfo('Este pesquisador ainda não tem duas versões para comparar. Gere um novo ' +
+                        (kindSelect.value === 'summary' ? 'resumo' : 'análise') + ' com outro provedor ou modelo.');
+                    return;
+                }
+
+                fillSelect(sides.left.select, data.revisions, 1);
+                fillSelect(sides.right.select, data.revisions, 0);
+                compareSection.style.display = 'grid';
+                loadRevision(sides.left);
+                loadRevision(sides.right);
+            })
+            .catch(function () {
+                spinner.classList.remove('visible');
+                showError('Erro de conexão ao carregar versões');
+            });
+    }
+
+    function fillSelect(select, revisions, selectedIndex) {
+        select.innerHTML = '';
+        revisions.forEach(function (rev, i) {
+            var option = document.createElement('option');
+            option.value = rev.id;
+            option.textContent = formatDate(rev.generatedAt) + ' — ' + rev.provider + ' / ' + rev.model;
+            if (i === selectedIndex) option.selected = true;
+            select.appendChild(option);
+        });
+    }
+
+    function loadRevision(side) {
+        side.content.innerHTML = '';
+        side.metadata.innerHTML = '';
+
+        fetch('/api/' + kindSelect.value + '/revisions/' + currentLattesId + '/' + side.select.value)
+            .then(function (r) { return r.json(); })
+            .then(function (data) {
+                if (!data.success) {
+                    showError(data.error || 'Erro ao carregar versão');
+                    return;
+                }
+                var rev = data.revision;
+                var metaHtml = '<p class="metadata-text">Gerado por <strong>' + escapeHtml(rev.provider) +
+                    '</strong> / <strong>' + escapeHtml(rev.model) + '</strong> em ' + formatDate(rev.generatedAt);
+                if (rev.promptHash) {
+                    metaHtml += '<br>Prompt: <code>' + escapeHtml(rev.promptHash.substring(0, 12)) + '</code>';
+                }
+                if (rev.researchersAnalyzed) {
+                    metaHtml += '<br>Pesquisadores analisados: ' + rev.researchersAnalyzed;
+                }
+                if (rev.inputTokens || rev.outputTokens) {
+                    metaHtml += '<br>Tokens: ' + (rev.inputTokens || 0).toLocaleString('pt-BR') + ' de entrada, ' +
+                        (rev.outputTokens || 0).toLocaleString('pt-BR') + ' de saída';
+                    if (rev.costUsd !== undefined) {
+                        metaHtml += ' (custo estimado: US$ ' + rev.costUsd.toLocaleString('pt-BR', { minimumFractionDigits: 4, maximumFractionDigits: 4 }) + ')';
+                    }
+                }
+                metaHtml += '</p>';
+                side.metadata.innerHTML = metaHtml;
+                side.content.innerHTML = renderMarkdown(rev.text);
+            })
+            .catch(function () {
+                showError('Erro de conexão ao carregar versão');
+            });
+    }
+
+    function formatDate(value) {
+        var date = new Date(value);
+        return date.toLocaleDateString('pt-BR') + ' ' + date.toLocaleTimeString('pt-BR');
+    }
+
+    function showError(message) {
+        errorMsg.textContent = message;
+        errorMsg.classList.add('visible');
+    }
+
+    function showInfo(message) {
+        infoMsg.textContent = message;
+        infoMsg.classList.add('visible');
+    }
+
+    function hideMessages() {
+        errorMsg.classList.remove('visible');
+        infoMsg.classList.remove('visible');
+    }
+
+    function escapeHtml(text) {
+        var div = document.createElement('div');
+        div.textContent = text;
+        return div.innerHTML;
+    }
+
+    function renderMarkdown(md) {
+        var html = md
+            .replace(/&/g, '&amp;')
+            .replace(/</g, '&lt;')
+            .replace(/>/g, '&gt;');
+
+        html = html.replace(/^### (.+)$/gm, '<h4>$1</h4>');
+        html = html.replace(/^## (.+)$/gm, '<h3>$1</h3>');
+        html = html.replace(/^# (.+)$/gm, '<h2>$1</h2>');
+
+        html = html.replace(/^---$/gm, '<hr>');
+
+        html = html.replace(/\*\*(.+?)\*\*/g, '<strong>$1</strong>');
+        html = html.replace(/\*(.+?)\*/g, '<em>$1</em>');
+
+        html = html.replace(/\[([^\]]+)\]\((https?:\/\/[^)]+)\)/g, '<a href="$2" target="_blank">$2</a>');
+
+        html = html.replace(/^\|(.+)\|$/gm, function (match, content) {
+            var cells = content.split('|').map(function (c) { return c.trim(); });
+            return '<tr>' + cells.map(function (c) {
+                if (/^[-:]+$/.test(c)) return '';
+                return '<td>' + c + '</td>';
+            }).join('') + '</tr>';
+        });
+        html = html.replace(/((?:<tr>.*?<\/tr>\n?)+)/g, '<table class="summary-table">$1</table>');
+        html = html.replace(/<tr><\/tr>/g, '');
+
+        html = html.replace(/^- (.+)$/gm, '<li>$1</li>');
+        html = html.replace(/((?:<li>.*?<\/li>\n?)+)/g, '<ul>$1</ul>');
+
+        html = html.replace(/^(?!<[hultd])(.+)$/gm, '<p>$1</p>');
+        html = html.replace(/<p>\s*<\/p>/g, '');
+
+        return html;
+    }
+})();
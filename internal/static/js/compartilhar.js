@@ -15,6 +15,7 @@
     var params = new URLSearchParams(window.location.search);
     var resumoId = params.get('resumo');
     var analiseId = params.get('analise');
+    var conversaId = params.get('conversa');
 
     if (resumoId) {
         currentId = resumoId;
@@ -26,6 +27,11 @@
         currentType = 'analise';
         document.title = 'An\u00e1lise de Rela\u00e7\u00f5es - smartLattes';
         loadContent('/api/analysis/view/' + analiseId, 'An\u00e1lise de Rela\u00e7\u00f5es');
+    } else if (conversaId) {
+        currentId = conversaId;
+        currentType = 'conversa';
+        document.title = 'Conversa chatLattes - smartLattes';
+        loadContent('/api/chat/view/' + conversaId, 'Conversa no chatLattes');
     } else {
         showError('Link inv\u00e1lido. Nenhum resumo ou an\u00e1lise especificado.');
     }
@@ -52,10 +58,10 @@
                     return;
                 }
 
-                var text = result.body.summary || result.body.analysis || '';
+                var text = result.body.summary || result.body.analysis || transcript(result.body.messages);
                 currentContent = text;
 
-                contentTitle.textContent = title;
+                contentTitle.textContent = result.body.title || title;
 
                 var metaHtml = '<p class="metadata-text">Gerado por <strong>' +
                     escapeHtml(result.body.provider) + '</strong> / <strong>' +
@@ -79,8 +85,18 @@
             });
     }
 
+    // transcript writes a shared conversation as markdown, each question
+    // followed by its answer.
+    function transcript(messages) {
+        if (!messages) return '';
+        return messages.map(function (m) {
+            var heading = m.role === 'user' ? '## Pergunta' : '## Resposta';
+            return heading + '\n\n' + m.content;
+        }).join('\n\n---\n\n');
+    }
+
     downloadMd.addEventListener('click', function () {
-        var prefix = currentType === 'resumo' ? 'resumo-' : 'analise-';
+        var prefix = currentType === 'resumo' ? 'resumo-' : currentType === 'conversa' ? 'conversa-' : 'analise-';
         downloadBlob(currentContent, prefix + currentId + '.md', 'text/markdown');
     });
     downloadPdf.addEventListener('click', function () {
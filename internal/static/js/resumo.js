@@ -39,6 +39,8 @@
     var analysisSaveBtn = document.getElementById('analysis-save-btn');
     var currentAnalysis = '';
     var currentResearchersAnalyzed = 0;
+    var loadingText = loadingMessage.textContent;
+    var analysisLoadingText = analysisLoadingMsg ? analysisLoadingMsg.textContent : '';
 
     var shareBtn = document.getElementById('share-btn');
     var analysisShareBtn = document.getElementById('analysis-share-btn');
@@ -108,8 +110,26 @@
     providerSelect.addEventListener('change', checkLoadModels);
     apiKeyInput.addEventListener('input', checkLoadModels);
 
+    var keyOptional = {};
+
+    fetch('/api/config').then(function(r){return r.json()}).then(function(cfg){
+        if (!cfg.providers) return;
+        var selected = providerSelect.value;
+        providerSelect.innerHTML = '<option value="">Selecione o provedor...</option>';
+        cfg.providers.forEach(function(p){
+            var opt = document.createElement('option');
+            opt.value = p.id;
+            opt.textContent = p.name;
+            providerSelect.appendChild(opt);
+            if (!p.keyRequired) keyOptional[p.id] = true;
+        });
+        providerSelect.value = selected;
+        checkLoadModels();
+    }).catch(function(){});
+
     function checkLoadModels() {
-        loadModelsBtn.disabled = !(providerSelect.value && apiKeyInput.value.length >= 10);
+        loadModelsBtn.disabled = !(providerSelect.value && (keyOptional[providerSelect.value] || apiKeyInput.value.length >= 10));
+        apiKeyInput.placeholder = keyOptional[providerSelect.value] ? 'Opcional: o servidor fornece a chave' : 'Digite sua chave de API...';
     }
 
     // Load models
@@ -168,26 +188,20 @@
         hideError();
         generateBtn.disabled = true;
         spinner.classList.add('visible');
+        loadingMessage.textContent = loadingText;
         loadingMessage.style.display = 'block';
         summarySection.style.display = 'none';
 
         currentProvider = providerSelect.value;
         currentModel = modelSelect.value;
 
-        fetch('/api/summary', {
-            method: 'POST',
-            headers: { 'Content-Type': 'application/json' },
-            body: JSON.stringify({
-                lattesId: currentLattesId,
-                provider: currentProvider,
-                apiKey: apiKeyInput.value,
-                model: currentModel
-            })
-        })
-        .then(function (r) {
-            return r.json().then(function (data) {
-                return { status: r.status, body: data };
-            });
+        runJob('summary', {
+            lattesId: currentLattesId,
+            provider: currentProvider,
+            apiKey: apiKeyInput.value,
+            model: currentModel
+        }, function (stage) {
+            loadingMessage.textContent = stage + '...';
         })
         .then(function (result) {
             spinner.classList.remove('visible');
@@ -264,25 +278,19 @@
             analysisPromptSection.style.display = 'none';
             analysisSection.style.display = 'block';
             analysisSpinner.classList.add('visible');
+            analysisLoadingMsg.textContent = analysisLoadingText;
             analysisLoadingMsg.style.display = 'block';
             analysisError.classList.remove('visible');
             analysisInfo.classList.remove('visible');
             analysisResult.style.display = 'none';
 
-            fetch('/api/analysis', {
-                method: 'POST',
-                headers: { 'Content-Type': 'application/json' },
-                body: JSON.stringify({
-                    lattesId: currentLattesId,
-                    provider: currentProvider,
-                    apiKey: apiKeyInput.value,
-                    model: currentModel
-                })
-            })
-            .then(function (r) {
-                return r.json().then(function (data) {
-                    return { status: r.status, body: data };
-                });
+            runJob('analysis', {
+                lattesId: currentLattesId,
+                provider: currentProvider,
+                apiKey: apiKeyInput.value,
+                model: currentModel
+            }, function (stage) {
+                analysisLoadingMsg.textContent = stage + '...';
             })
             .then(function (result) {
                 analysisSpinner.classList.remove('visible');
@@ -304,7 +312,7 @@
                 currentResearchersAnalyzed = result.body.researchersAnalyzed || 0;
 
                 if (result.body.truncated) {
-                    analysisTruncationWarning.textContent = result.body.truncationWarning;
+                    analysisTruncationWarning.textContent = truncationText(result.body.truncationWarning, result.body.truncation);
                     analysisTruncationWarning.style.display = 'block';
                 } else {
                     analysisTruncationWarning.style.display = 'none';
@@ -348,6 +356,78 @@
     }
 
     // Helpers
+    // truncationText adds to the warning what was left out of the data sent
+    // to the model, from the report the server returns when it had to cut.
+    function truncationText(warning, report) {
+        var parts = [warning];
+        if (report && report.steps && report.steps.length) {
+            parts.push('Redu\u00e7\u00f5es aplicadas: ' + report.steps.join('; ') + '.');
+        }
+        if (report && report.publicationsTrimmed) {
+            parts.push(report.publicationsTrimmed + ' publica\u00e7\u00f5es omitidas.');
+        }
+        if (report && report.droppedResearchers && report.droppedResearchers.length) {
+            parts.push('Pesquisadores n\u00e3o inclu\u00eddos: ' + report.droppedResearchers.join(', ') + '.');
+        }
+        return parts.join(' ');
+    }
+
+    // runJob queues a summary or analysis on the server and polls it until it
+    // finishes, so the result is saved even if this page is closed. It
+    // resolves like the synchronous endpoints, with the HTTP status and the
+    // response body; onStage receives the progress reported by the server.
+    function runJob(kind, request, onStage) {
+        request.kind = kind;
+        return fetch('/api/jobs', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(request)
+        })
+        .then(function (r) {
+            return r.json().then(function (data) {
+                if (!data.success) {
+                    return { status: r.status, body: data };
+                }
+                return pollJob(data.job.id, onStage, 0);
+            });
+        });
+    }
+
+    function pollJob(id, onStage, failures) {
+        return new Promise(function (resolve) {
+            setTimeout(resolve, 2000);
+        })
+        .then(function () {
+            return fetch('/api/jobs/' + encodeURIComponent(id)).then(function (r) {
+                return r.json().then(function (data) {
+                    return { status: r.status, body: data };
+                });
+            });
+        })
+        .then(function (result) {
+            var job = result.body.job;
+            if (!result.body.success) {
+                return result;
+            }
+            if (job.status === 'done') {
+                return { status: 200, body: job.result };
+            }
+            if (job.status === 'failed') {
+                return { status: job.errorStatus || 500, body: { success: false, error: job.error } };
+            }
+            if (onStage && job.stage) {
+                onStage(job.stage);
+            }
+            return pollJob(id, onStage, 0);
+        }, function (err) {
+            // Falhas de rede passageiras não interrompem a tarefa no servidor
+            if (failures >= 5) {
+                throw err;
+            }
+            return pollJob(id, onStage, failures + 1);
+        });
+    }
+
     function showError(message) {
         errorMsg.textContent = message;
         errorMsg.classList.add('visible');
@@ -8,6 +8,8 @@
     var errorMsg = document.getElementById('error-message');
     var successMsg = document.getElementById('success-message');
     var resultCard = document.getElementById('result-card');
+    var batchCard = document.getElementById('batch-card');
+    var selectedFiles = [];
 
     // AI elements
     var aiSection = document.getElementById('ai-section');
@@ -41,6 +43,8 @@
     var analysisDownloadMd = document.getElementById('analysis-download-md');
     var analysisDownloadPdf = document.getElementById('analysis-download-pdf');
     var analysisSaveBtn = document.getElementById('analysis-save-btn');
+    var aiLoadingText = aiLoadingMsg ? aiLoadingMsg.textContent : '';
+    var analysisLoadingText = analysisLoadingMsg ? analysisLoadingMsg.textContent : '';
     var shareBtn = document.getElementById('share-btn');
     var analysisShareBtn = document.getElementById('analysis-share-btn');
     var currentAnalysis = '';
@@ -50,6 +54,10 @@
     var currentSummary = '';
     var currentProvider = '';
     var currentModel = '';
+    var currentPromptHash = '';
+    var currentAnalysisPromptHash = '';
+    var currentUsage = null;
+    var currentAnalysisUsage = null;
 
     dropZone.addEventListener('click', function () {
         fileInput.click();
@@ -70,34 +78,46 @@
 
         var files = e.dataTransfer.files;
         if (files.length > 0) {
-            handleFile(files[0]);
+            handleFiles(files);
         }
     });
 
     fileInput.addEventListener('change', function () {
         if (fileInput.files.length > 0) {
-            handleFile(fileInput.files[0]);
+            handleFiles(fileInput.files);
         }
     });
 
-    function handleFile(file) {
-        if (!file.name.toLowerCase().endsWith('.xml')) {
-            showError('Por favor, selecione um arquivo .xml');
-            submitBtn.disabled = true;
-            fileNameDisplay.textContent = '';
-            return;
+    function handleFiles(files) {
+        selectedFiles = [];
+        for (var i = 0; i < files.length; i++) {
+            var name = files[i].name.toLowerCase();
+            if (!name.endsWith('.xml') && !name.endsWith('.zip')) {
+                showError('Por favor, selecione arquivos .xml ou .zip');
+                submitBtn.disabled = true;
+                fileNameDisplay.textContent = '';
+                return;
+            }
+            selectedFiles.push(files[i]);
         }
 
-        fileNameDisplay.textContent = file.name;
+        fileNameDisplay.textContent = selectedFiles.length === 1
+            ? selectedFiles[0].name
+            : selectedFiles.length + ' arquivos selecionados';
         submitBtn.disabled = false;
         hideMessages();
     }
 
+    // Um único arquivo (XML ou o .zip baixado do Lattes) segue o fluxo com
+    // resumo por IA; vários arquivos vão para o envio em lote.
+    function isBatch() {
+        return selectedFiles.length > 1;
+    }
+
     form.addEventListener('submit', function (e) {
         e.preventDefault();
 
-        var file = fileInput.files[0];
-        if (!file) {
+        if (selectedFiles.length === 0) {
             showError('Selecione um arquivo para enviar');
             return;
         }
@@ -106,10 +126,20 @@
         spinner.classList.add('visible');
         submitBtn.disabled = true;
 
+        upload(isBatch());
+    });
+
+    function upload(batch) {
         var formData = new FormData();
-        formData.append('file', file);
+        if (batch) {
+            selectedFiles.forEach(function (file) {
+                formData.append('files', file);
+            });
+        } else {
+            formData.append('file', selectedFiles[0]);
+        }
 
-        fetch('/api/upload', {
+        fetch(batch ? '/api/upload/batch' : '/api/upload', {
             method: 'POST',
             body: formData,
         })
@@ -119,9 +149,17 @@
                 });
             })
             .then(function (result) {
+                // Um .zip com vários currículos é reenviado como lote
+                if (!batch && result.status === 422) {
+                    upload(true);
+                    return;
+                }
+
                 spinner.classList.remove('visible');
 
-                if (result.body.success) {
+                if (result.body.success && batch) {
+                    showBatchReport(result.body);
+                } else if (result.body.success) {
                     showSuccess(result.body);
                 } else {
                     showError(result.body.error || 'Erro desconhecido ao processar o arquivo');
@@ -134,7 +172,113 @@
                 showError('Erro de conexão. Verifique se o servidor está disponível.');
                 submitBtn.disabled = false;
             });
-    });
+    }
+
+    function showBatchReport(data) {
+        document.getElementById('batch-created').textContent = data.summary.created;
+        document.getElementById('batch-updated').textContent = data.summary.updated;
+        document.getElementById('batch-failed').textContent = data.summary.failed;
+
+        var labels = { created: 'Importado', updated: 'Atualizado', failed: 'Erro' };
+        var tbody = document.getElementById('batch-results');
+        tbody.innerHTML = '';
+        var header = document.createElement('tr');
+        ['Arquivo', 'Pesquisador', 'Situação'].forEach(function (text) {
+            var td = document.createElement('td');
+            td.textContent = text;
+            header.appendChild(td);
+        });
+        tbody.appendChild(header);
+
+        data.results.forEach(function (item) {
+            var tr = document.createElement('tr');
+            var file = document.createElement('td');
+            file.textContent = item.file;
+            var name = document.createElement('td');
+            name.textContent = item.name ? item.name + ' (' + item.lattesId + ')' : '-';
+            var status = document.createElement('td');
+            status.textContent = labels[item.status] + (item.error ? ': ' + item.error : '');
+            status.className = item.status === 'failed' ? 'batch-status-failed' : 'batch-status-ok';
+            tr.appendChild(file);
+            tr.appendChild(name);
+            tr.appendChild(status);
+            tbody.appendChild(tr);
+        });
+
+        batchCard.classList.add('visible');
+    }
+
+    // truncationText adds to the warning what was left out of the data sent
+    // to the model, from the report the server returns when it had to cut.
+    function truncationText(warning, report) {
+        var parts = [warning];
+        if (report && report.steps && report.steps.length) {
+            parts.push('Redu\u00e7\u00f5es aplicadas: ' + report.steps.join('; ') + '.');
+        }
+        if (report && report.publicationsTrimmed) {
+            parts.push(report.publicationsTrimmed + ' publica\u00e7\u00f5es omitidas.');
+        }
+        if (report && report.droppedResearchers && report.droppedResearchers.length) {
+            parts.push('Pesquisadores n\u00e3o inclu\u00eddos: ' + report.droppedResearchers.join(', ') + '.');
+        }
+        return parts.join(' ');
+    }
+
+    // runJob queues a summary or analysis on the server and polls it until it
+    // finishes, so the result is saved even if this page is closed. It
+    // resolves like the synchronous endpoints, with the HTTP status and the
+    // response body; onStage receives the progress reported by the server.
+    function runJob(kind, request, onStage) {
+        request.kind = kind;
+        return fetch('/api/jobs', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(request)
+        })
+        .then(function (r) {
+            return r.json().then(function (data) {
+                if (!data.success) {
+                    return { status: r.status, body: data };
+                }
+                return pollJob(data.job.id, onStage, 0);
+            });
+        });
+    }
+
+    function pollJob(id, onStage, failures) {
+        return new Promise(function (resolve) {
+            setTimeout(resolve, 2000);
+        })
+        .then(function () {
+            return fetch('/api/jobs/' + encodeURIComponent(id)).then(function (r) {
+                return r.json().then(function (data) {
+                    return { status: r.status, body: data };
+                });
+            });
+        })
+        .then(function (result) {
+            var job = result.body.job;
+            if (!result.body.success) {
+                return result;
+            }
+            if (job.status === 'done') {
+                return { status: 200, body: job.result };
+            }
+            if (job.status === 'failed') {
+                return { status: job.errorStatus || 500, body: { success: false, error: job.error } };
+            }
+            if (onStage && job.stage) {
+                onStage(job.stage);
+            }
+            return pollJob(id, onStage, 0);
+        }, function (err) {
+            // Falhas de rede passageiras não interrompem a tarefa no servidor
+            if (failures >= 5) {
+                throw err;
+            }
+            return pollJob(id, onStage, failures + 1);
+        });
+    }
 
     function showError(message) {
         hideMessages();
@@ -174,6 +318,7 @@
         errorMsg.classList.remove('visible');
         successMsg.classList.remove('visible');
         resultCard.classList.remove('visible');
+        batchCard.classList.remove('visible');
         if (aiSection) aiSection.style.display = 'none';
         if (summarySection) summarySection.style.display = 'none';
         if (analysisPromptSection) analysisPromptSection.style.display = 'none';
@@ -195,8 +340,26 @@
         providerSelect.addEventListener('change', checkLoadModels);
         apiKeyInput.addEventListener('input', checkLoadModels);
 
+        var keyOptional = {};
+
+        fetch('/api/config').then(function(r){return r.json()}).then(function(cfg){
+            if (!cfg.providers) return;
+            var selected = providerSelect.value;
+            providerSelect.innerHTML = '<option value="">Selecione o provedor...</option>';
+            cfg.providers.forEach(function(p){
+                var opt = document.createElement('option');
+                opt.value = p.id;
+                opt.textContent = p.name;
+                providerSelect.appendChild(opt);
+                if (!p.keyRequired) keyOptional[p.id] = true;
+            });
+            providerSelect.value = selected;
+            checkLoadModels();
+        }).catch(function(){});
+
         function checkLoadModels() {
-            loadModelsBtn.disabled = !(providerSelect.value && apiKeyInput.value.length >= 10);
+            loadModelsBtn.disabled = !(providerSelect.value && (keyOptional[providerSelect.value] || apiKeyInput.value.length >= 10));
+            apiKeyInput.placeholder = keyOptional[providerSelect.value] ? 'Opcional: o servidor fornece a chave' : 'Digite sua chave de API...';
         }
 
         loadModelsBtn.addEventListener('click', function () {
@@ -246,24 +409,23 @@
             hideAiError();
             generateBtn.disabled = true;
             aiSpinner.classList.add('visible');
+            aiLoadingMsg.textContent = aiLoadingText;
             aiLoadingMsg.style.display = 'block';
             summarySection.style.display = 'none';
 
             currentProvider = providerSelect.value;
             currentModel = modelSelect.value;
 
-            fetch('/api/summary', {
-                method: 'POST',
-                headers: { 'Content-Type': 'application/json' },
-                body: JSON.stringify({
-                    lattesId: currentLattesId,
-                    provider: currentProvider,
-                    apiKey: apiKeyInput.value,
-                    model: currentModel
-                })
+            runJob('summary', {
+                lattesId: currentLattesId,
+                provider: currentProvider,
+                apiKey: apiKeyInput.value,
+                model: currentModel
+            }, function (stage) {
+                aiLoadingMsg.textContent = stage + '...';
             })
-            .then(function (r) { return r.json(); })
-            .then(function (data) {
+            .then(function (result) {
+                var data = result.body;
                 aiSpinner.classList.remove('visible');
                 aiLoadingMsg.style.display = 'none';
                 generateBtn.disabled = false;
@@ -274,6 +436,8 @@
                 }
 
                 currentSummary = data.summary;
+                currentPromptHash = data.promptHash || '';
+                currentUsage = data.usage || null;
 
                 if (data.truncated) {
                     truncationWarning.textContent = data.truncationWarning;
@@ -318,7 +482,9 @@
                 lattesId: currentLattesId,
                 summary: currentSummary,
                 provider: currentProvider,
-                model: currentModel
+                model: currentModel,
+                promptHash: currentPromptHash,
+                usage: currentUsage
             })
         })
         .then(function (r) { return r.json(); })
@@ -337,25 +503,19 @@
             analysisPromptSection.style.display = 'none';
             analysisSection.style.display = 'block';
             analysisSpinner.classList.add('visible');
+            analysisLoadingMsg.textContent = analysisLoadingText;
             analysisLoadingMsg.style.display = 'block';
             analysisError.classList.remove('visible');
             analysisInfo.classList.remove('visible');
             analysisResult.style.display = 'none';
 
-            fetch('/api/analysis', {
-                method: 'POST',
-                headers: { 'Content-Type': 'application/json' },
-                body: JSON.stringify({
-                    lattesId: currentLattesId,
-                    provider: currentProvider,
-                    apiKey: apiKeyInput.value,
-                    model: currentModel
-                })
-            })
-            .then(function (r) {
-                return r.json().then(function (data) {
-                    return { status: r.status, body: data };
-                });
+            runJob('analysis', {
+                lattesId: currentLattesId,
+                provider: currentProvider,
+                apiKey: apiKeyInput.value,
+                model: currentModel
+            }, function (stage) {
+                analysisLoadingMsg.textContent = stage + '...';
             })
             .then(function (result) {
                 analysisSpinner.classList.remove('visible');
@@ -374,10 +534,12 @@
                 }
 
                 currentAnalysis = result.body.analysis;
+                currentAnalysisPromptHash = result.body.promptHash || '';
+                currentAnalysisUsage = result.body.usage || null;
                 currentResearchersAnalyzed = result.body.researchersAnalyzed || 0;
 
                 if (result.body.truncated) {
-                    analysisTruncationWarning.textContent = result.body.truncationWarning;
+                    analysisTruncationWarning.textContent = truncationText(result.body.truncationWarning, result.body.truncation);
                     analysisTruncationWarning.style.display = 'block';
                 } else {
                     analysisTruncationWarning.style.display = 'none';
@@ -430,7 +592,9 @@
                 analysis: currentAnalysis,
                 provider: currentProvider,
                 model: currentModel,
-                researchersAnalyzed: currentResearchersAnalyzed
+                promptHash: currentAnalysisPromptHash,
+                researchersAnalyzed: currentResearchersAnalyzed,
+                usage: currentAnalysisUsage
             })
         })
         .then(function (r) { return r.json(); })
@@ -14,6 +14,7 @@
     var downloadPdf = document.getElementById('download-pdf');
 
     var shareBtn = document.getElementById('share-btn');
+    var compareLink = document.getElementById('compare-link');
 
     var currentLattesId = '';
     var currentAnalysis = '';
@@ -113,6 +114,10 @@
                 analysisSection.style.display = 'block';
 
                 if (shareBtn) shareBtn.style.display = '';
+                if (compareLink) {
+                    compareLink.href = '/comparar?id=' + encodeURIComponent(currentLattesId) + '&tipo=analise';
+                    compareLink.style.display = '';
+                }
             })
             .catch(function () {
                 spinner.classList.remove('visible');
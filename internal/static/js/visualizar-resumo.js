@@ -14,6 +14,7 @@
     var downloadPdf = document.getElementById('download-pdf');
 
     var shareBtn = document.getElementById('share-btn');
+    var compareLink = document.getElementById('compare-link');
 
     var currentLattesId = '';
     var currentSummary = '';
@@ -110,6 +111,10 @@
                 summarySection.style.display = 'block';
 
                 if (shareBtn) shareBtn.style.display = '';
+                if (compareLink) {
+                    compareLink.href = '/comparar?id=' + encodeURIComponent(currentLattesId) + '&tipo=resumo';
+                    compareLink.style.display = '';
+                }
             })
             .catch(function () {
                 spinner.classList.remove('visible');
@@ -0,0 +1,103 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// ChatSession is a chatLattes conversation kept on the server, so it can be
+// resumed later and shared as a read-only transcript.
+type ChatSession struct {
+	ID    string `bson:"_id" json:"id"`
+	Title string `bson:"titulo" json:"title"`
+	// Owner is a hash of the browser token of whoever created the session;
+	// only it may read, continue or delete the session.
+	Owner    string `bson:"dono" json:"owner,omitempty"`
+	Provider string `bson:"provider" json:"provider"`
+	Model    string `bson:"model" json:"model"`
+	// Shared makes the transcript readable by anyone with its link.
+	Shared    bool         `bson:"compartilhada" json:"shared"`
+	Messages  []ChatRecord `bson:"mensagens" json:"messages"`
+	CreatedAt time.Time    `bson:"criadaEm" json:"createdAt"`
+	UpdatedAt time.Time    `bson:"atualizadaEm" json:"updatedAt"`
+}
+
+// ChatRecord is a message of a ChatSession. Answers record the provider and
+// model that wrote them, which may differ from the session's after a
+// failover, and their token usage.
+type ChatRecord struct {
+	Role     string      `bson:"role" json:"role"`
+	Content  string      `bson:"content" json:"content"`
+	At       time.Time   `bson:"em" json:"at"`
+	Provider string      `bson:"provider,omitempty" json:"provider,omitempty"`
+	Model    string      `bson:"model,omitempty" json:"model,omitempty"`
+	Usage    *TokenUsage `bson:"uso,omitempty" json:"usage,omitempty"`
+}
+
+// ownedSessions returns the sessions of owner, most recently updated first.
+func ownedSessions(sessions []ChatSession, owner string) []ChatSession {
+	out := []ChatSession{}
+	for _, s := range sessions {
+		if s.Owner == owner {
+			out = append(out, s)
+		}
+	}
+	sort.Slice(out, func(i, k int) bool { return out[i].UpdatedAt.After(out[k].UpdatedAt) })
+	return out
+}
+
+// SaveChatSession creates or replaces session in the conversas collection.
+func (m *MongoDB) SaveChatSession(ctx context.Context, session ChatSession) error {
+	_, err := m.database.Collection("conversas").ReplaceOne(ctx, bson.M{"_id": session.ID}, session, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (m *MongoDB) GetChatSession(ctx context.Context, id string) (*ChatSession, error) {
+	var session ChatSession
+	err := m.database.Collection("conversas").FindOne(ctx, bson.M{"_id": id}).Decode(&session)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("conversa não encontrada")
+		}
+		return nil, err
+	}
+	return &session, nil
+}
+
+// ListChatSessions returns the sessions of owner, most recently updated
+// first, without their messages.
+func (m *MongoDB) ListChatSessions(ctx context.Context, owner string) ([]ChatSession, error) {
+	collection := m.database.Collection("conversas")
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "atualizadaEm", Value: -1}}).
+		SetProjection(bson.M{"mensagens": 0})
+	cursor, err := collection.Find(ctx, bson.M{"dono": owner}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	sessions := []ChatSession{}
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (m *MongoDB) DeleteChatSession(ctx context.Context, id string) error {
+	res, err := m.database.Collection("conversas").DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return fmt.Errorf("conversa não encontrada")
+	}
+	return nil
+}
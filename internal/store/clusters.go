@@ -0,0 +1,115 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// PublicationOccurrence is one publication as listed in one CV. Index is its
+// position in the researcher's Publications.All().
+type PublicationOccurrence struct {
+	LattesID string `json:"lattesId" bson:"lattesId"`
+	Name     string `json:"name" bson:"name"`
+	Index    int    `json:"index" bson:"index"`
+	Type     string `json:"type" bson:"type"`
+	Title    string `json:"title" bson:"title"`
+	Year     int    `json:"year,omitempty" bson:"year,omitempty"`
+	DOI      string `json:"doi,omitempty" bson:"doi,omitempty"`
+}
+
+// PublicationCluster is one distinct work of the base, as grouped by the
+// dedup package, stored under its canonical ID.
+type PublicationCluster struct {
+	ID          string                  `json:"id" bson:"_id"`
+	Type        string                  `json:"type" bson:"type"`
+	Title       string                  `json:"title" bson:"title"`
+	Year        int                     `json:"year,omitempty" bson:"year,omitempty"`
+	DOI         string                  `json:"doi,omitempty" bson:"doi,omitempty"`
+	MatchedBy   string                  `json:"matchedBy,omitempty" bson:"matchedBy,omitempty"`
+	Researchers int                     `json:"researchers" bson:"researchers"`
+	Occurrences []PublicationOccurrence `json:"occurrences" bson:"occurrences"`
+}
+
+// PublicationStats counts the publications of the base with and without
+// duplicates.
+type PublicationStats struct {
+	Total        int            `json:"total" bson:"total"`
+	Unique       int            `json:"unique" bson:"unique"`
+	Duplicates   int            `json:"duplicates" bson:"duplicates"`
+	UniqueByType map[string]int `json:"uniqueByType" bson:"uniqueByType"`
+}
+
+// publicationGroups is the document kept with the stats of the last grouping.
+type publicationGroups struct {
+	ID        string           `json:"-" bson:"_id"`
+	Stats     PublicationStats `json:"estatisticas" bson:"estatisticas"`
+	UpdatedAt time.Time        `json:"atualizadoEm" bson:"atualizadoEm"`
+}
+
+const publicationGroupsID = "publicacoes"
+
+type storedCluster struct {
+	PublicationCluster `bson:",inline"`
+	Generation         time.Time `bson:"geracao"`
+}
+
+// SavePublicationClusters replaces the clusters of the base. Each cluster is
+// upserted in agrupamentos tagged with the time of the grouping, then the
+// clusters of previous groupings are removed and the stats saved in
+// estatisticas; readers may briefly see both generations, never neither.
+func (m *MongoDB) SavePublicationClusters(ctx context.Context, clusters []PublicationCluster, stats PublicationStats) error {
+	collection := m.database.Collection("agrupamentos")
+	// Truncated to what a BSON date keeps, so the filter below matches it.
+	generation := time.Now().UTC().Truncate(time.Millisecond)
+
+	if len(clusters) > 0 {
+		models := make([]mongo.WriteModel, 0, len(clusters))
+		for _, c := range clusters {
+			doc := storedCluster{PublicationCluster: c, Generation: generation}
+			models = append(models, mongo.NewReplaceOneModel().SetFilter(bson.M{"_id": c.ID}).SetReplacement(doc).SetUpsert(true))
+		}
+		if _, err := collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false)); err != nil {
+			return err
+		}
+	}
+	if _, err := collection.DeleteMany(ctx, bson.M{"geracao": bson.M{"$ne": generation}}); err != nil {
+		return err
+	}
+
+	doc := publicationGroups{ID: publicationGroupsID, Stats: stats, UpdatedAt: generation}
+	_, err := m.database.Collection("estatisticas").ReplaceOne(ctx, bson.M{"_id": publicationGroupsID}, doc, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (m *MongoDB) GetPublicationStats(ctx context.Context) (*PublicationStats, error) {
+	var doc publicationGroups
+	err := m.database.Collection("estatisticas").FindOne(ctx, bson.M{"_id": publicationGroupsID}).Decode(&doc)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("estatísticas de publicações não encontradas")
+		}
+		return nil, err
+	}
+	return &doc.Stats, nil
+}
+
+// GetPublicationClusters returns the stored clusters ordered by canonical ID.
+func (m *MongoDB) GetPublicationClusters(ctx context.Context) ([]PublicationCluster, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+	cursor, err := m.database.Collection("agrupamentos").Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	clusters := []PublicationCluster{}
+	if err := cursor.All(ctx, &clusters); err != nil {
+		return nil, err
+	}
+	return clusters, nil
+}
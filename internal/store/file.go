@@ -0,0 +1,969 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/edalcin/smartlattes/internal/parser"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// FileStore keeps the same collections as MongoDB as JSON files under a
+// directory, one file per document:
+//
+//	curriculos/{lattesId}.json
+//	curriculos_historico/{lattesId}/{version}.json
+//	resumos/{lattesId}.json and relacoes/{lattesId}.json
+//	resumos_historico/{lattesId}.json and relacoes_historico/{lattesId}.json
+//	uso/{day}.json
+//	chamadas_ia.jsonl, one call per line
+//	tarefas/{id}.json
+//	conversas/{id}.json
+//	agrupamentos.json, the publication clusters and their stats
+//
+// The current CVs, summaries and analyses are loaded in memory on open; the
+// history is read from disk when requested. It is meant for a single process
+// and a base of a few hundred researchers.
+type FileStore struct {
+	dir string
+
+	mu      sync.RWMutex
+	cvs     map[string]map[string]interface{}
+	current map[string]map[string]Revision
+}
+
+// OpenFileStore opens, creating it if needed, the file store in dir.
+func OpenFileStore(dir string) (*FileStore, error) {
+	s := &FileStore{
+		dir: dir,
+		cvs: make(map[string]map[string]interface{}),
+		current: map[string]map[string]Revision{
+			RevisionSummary:  {},
+			RevisionAnalysis: {},
+		},
+	}
+
+	for _, sub := range []string{"curriculos", "curriculos_historico", RevisionSummary, RevisionSummary + "_historico", RevisionAnalysis, RevisionAnalysis + "_historico", "uso", "tarefas", "conversas"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, err
+		}
+	}
+
+	err := eachJSON(filepath.Join(dir, "curriculos"), func(id string, data []byte) error {
+		var doc map[string]interface{}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return err
+		}
+		s.cvs[id] = doc
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for kind, docs := range s.current {
+		err := eachJSON(filepath.Join(dir, kind), func(id string, data []byte) error {
+			var rev Revision
+			if err := json.Unmarshal(data, &rev); err != nil {
+				return err
+			}
+			docs[id] = rev
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// eachJSON calls fn with the name (without extension) and content of every
+// .json file directly in dir.
+func eachJSON(dir string, fn func(name string, data []byte) error) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".json")
+		if e.IsDir() || !ok {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return err
+		}
+		if err := fn(name, data); err != nil {
+			return fmt.Errorf("%s: %w", filepath.Join(dir, e.Name()), err)
+		}
+	}
+	return nil
+}
+
+// writeJSONFile writes v to path through a temporary file, so a crash never
+// leaves a half-written document behind.
+func writeJSONFile(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// validID rejects IDs that could escape the data directory.
+func validID(id string) bool {
+	return id != "" && id != "." && id != ".." && !strings.ContainsAny(id, `/\`)
+}
+
+func (s *FileStore) Ping(ctx context.Context) error {
+	_, err := os.Stat(s.dir)
+	return err
+}
+
+func (s *FileStore) Disconnect(ctx context.Context) error {
+	return nil
+}
+
+func (s *FileStore) UpsertCV(ctx context.Context, doc map[string]interface{}, lattesID, originalFilename string, fileSize int64) (*UpsertResult, error) {
+	if !validID(lattesID) {
+		return nil, fmt.Errorf("ID Lattes inválido")
+	}
+
+	doc["_id"] = lattesID
+	doc["_metadata"] = map[string]interface{}{
+		"uploadedAt":       time.Now().UTC(),
+		"originalFilename": originalFilename,
+		"fileSize":         fileSize,
+	}
+
+	// Round-trip through JSON so the cached copy has the same shape as one
+	// read back from disk.
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var stored map[string]interface{}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev, updated := s.cvs[lattesID]
+	var archived string
+	if updated {
+		if archived, err = s.archiveCV(lattesID, prev); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writeJSONFile(filepath.Join(s.dir, "curriculos", lattesID+".json"), stored); err != nil {
+		// The previous CV is still the current one: drop its copy so it is
+		// not listed twice.
+		if archived != "" {
+			os.Remove(archived)
+		}
+		return nil, err
+	}
+	s.cvs[lattesID] = stored
+
+	return &UpsertResult{Updated: updated}, nil
+}
+
+// archiveCV copies prev to curriculos_historico as the next version and
+// returns the path of the copy.
+func (s *FileStore) archiveCV(lattesID string, prev map[string]interface{}) (string, error) {
+	archived, err := s.countVersions(lattesID)
+	if err != nil {
+		return "", err
+	}
+
+	doc := make(map[string]interface{}, len(prev)+3)
+	for k, v := range prev {
+		doc[k] = v
+	}
+	delete(doc, "_id")
+	doc["lattesId"] = lattesID
+	doc["version"] = archived + 1
+	doc["archivedAt"] = time.Now().UTC()
+
+	path := filepath.Join(s.dir, "curriculos_historico", lattesID, strconv.Itoa(archived+1)+".json")
+	return path, writeJSONFile(path, doc)
+}
+
+func (s *FileStore) countVersions(lattesID string) (int, error) {
+	entries, err := os.ReadDir(filepath.Join(s.dir, "curriculos_historico", lattesID))
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".json") && !strings.HasPrefix(e.Name(), ".") {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *FileStore) GetCV(ctx context.Context, lattesID string) (map[string]interface{}, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	doc, ok := s.cvs[lattesID]
+	if !ok {
+		return nil, fmt.Errorf("CV não encontrado")
+	}
+
+	out := make(map[string]interface{}, len(doc))
+	for k, v := range doc {
+		if k != "publicacoes" {
+			out[k] = cloneValue(v)
+		}
+	}
+	return out, nil
+}
+
+func (s *FileStore) SearchCVs(ctx context.Context, query string) ([]CVSummary, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	digits := isAllDigits(query)
+	lower := strings.ToLower(query)
+
+	var results []CVSummary
+	for _, id := range sortedKeys(s.cvs) {
+		name := cvName(s.cvs[id])
+		if digits && strings.HasPrefix(id, query) || !digits && strings.Contains(strings.ToLower(name), lower) {
+			results = append(results, CVSummary{LattesID: id, Name: name})
+			if len(results) == 20 {
+				break
+			}
+		}
+	}
+	return results, nil
+}
+
+func (s *FileStore) CountCVs(ctx context.Context) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return int64(len(s.cvs)), nil
+}
+
+// profileFields are the parts of a CV sent to the AI when comparing
+// researchers, the same projection MongoDB uses.
+var profileFields = [][]string{
+	{"curriculo-vitae", "dados-gerais", "nome-completo"},
+	{"curriculo-vitae", "dados-gerais", "areas-de-atuacao"},
+	{"curriculo-vitae", "dados-gerais", "formacao-academica-titulacao"},
+	{"curriculo-vitae", "dados-gerais", "atuacoes-profissionais"},
+	{"curriculo-vitae", "producao-bibliografica"},
+}
+
+func (s *FileStore) GetAllCVSummaries(ctx context.Context, excludeLattesID string) ([]map[string]interface{}, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var results []map[string]interface{}
+	for _, id := range sortedKeys(s.cvs) {
+		if id != excludeLattesID {
+			results = append(results, project(s.cvs[id], profileFields))
+		}
+	}
+	return results, nil
+}
+
+func (s *FileStore) GetAllCVsForChat(ctx context.Context) ([]map[string]interface{}, error) {
+	return s.GetAllCVSummaries(ctx, "")
+}
+
+func (s *FileStore) GetAllResearchersAdmin(ctx context.Context) ([]AdminResearcher, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	results := make([]AdminResearcher, 0, len(s.cvs))
+	for id, doc := range s.cvs {
+		_, hasResumo := s.current[RevisionSummary][id]
+		_, hasAnalise := s.current[RevisionAnalysis][id]
+		results = append(results, AdminResearcher{
+			LattesID:   id,
+			Name:       cvName(doc),
+			HasResumo:  hasResumo,
+			HasAnalise: hasAnalise,
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return strings.ToLower(results[i].Name) < strings.ToLower(results[j].Name)
+	})
+	return results, nil
+}
+
+func (s *FileStore) ListCVVersions(ctx context.Context, lattesID string) ([]CVVersion, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	current, ok := s.cvs[lattesID]
+	if !ok {
+		return nil, fmt.Errorf("CV não encontrado")
+	}
+
+	archived, err := s.countVersions(lattesID)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []CVVersion
+	for v := 1; v <= archived; v++ {
+		var doc fileVersionDoc
+		data, err := os.ReadFile(filepath.Join(s.dir, "curriculos_historico", lattesID, strconv.Itoa(v)+".json"))
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		versions = append(versions, doc.toCVVersion())
+	}
+
+	var latest fileVersionDoc
+	if err := remarshal(current, &latest); err != nil {
+		return nil, err
+	}
+	latest.Version = archived + 1
+	v := latest.toCVVersion()
+	v.Current = true
+	return append(versions, v), nil
+}
+
+type fileVersionDoc struct {
+	Version    int        `json:"version"`
+	ArchivedAt *time.Time `json:"archivedAt"`
+	Metadata   struct {
+		UploadedAt       time.Time `json:"uploadedAt"`
+		OriginalFilename string    `json:"originalFilename"`
+		FileSize         int64     `json:"fileSize"`
+	} `json:"_metadata"`
+	CV struct {
+		LastUpdate string `json:"data-atualizacao"`
+	} `json:"curriculo-vitae"`
+}
+
+func (d fileVersionDoc) toCVVersion() CVVersion {
+	return CVVersion{
+		Version:          d.Version,
+		UploadedAt:       d.Metadata.UploadedAt,
+		ArchivedAt:       d.ArchivedAt,
+		OriginalFilename: d.Metadata.OriginalFilename,
+		FileSize:         d.Metadata.FileSize,
+		LastUpdate:       d.CV.LastUpdate,
+	}
+}
+
+func (s *FileStore) GetCVVersion(ctx context.Context, lattesID string, version int) (map[string]interface{}, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if !validID(lattesID) || version < 1 {
+		return nil, fmt.Errorf("versão não encontrada")
+	}
+
+	archived, err := s.countVersions(lattesID)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc map[string]interface{}
+	switch {
+	case version <= archived:
+		data, err := os.ReadFile(filepath.Join(s.dir, "curriculos_historico", lattesID, strconv.Itoa(version)+".json"))
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+	case version == archived+1 && s.cvs[lattesID] != nil:
+		doc = s.cvs[lattesID]
+	default:
+		return nil, fmt.Errorf("versão não encontrada")
+	}
+
+	cv, _ := cloneValue(doc["curriculo-vitae"]).(map[string]interface{})
+	if cv == nil {
+		cv = map[string]interface{}{}
+	}
+	return cv, nil
+}
+
+func (s *FileStore) GetPublications(ctx context.Context, lattesID string) (*ResearcherPublications, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	doc, ok := s.cvs[lattesID]
+	if !ok {
+		return nil, fmt.Errorf("CV não encontrado")
+	}
+	rp, err := researcherPublications(lattesID, doc)
+	if err != nil {
+		return nil, err
+	}
+	return &rp, nil
+}
+
+func (s *FileStore) GetAllPublications(ctx context.Context) ([]ResearcherPublications, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var results []ResearcherPublications
+	for _, id := range sortedKeys(s.cvs) {
+		rp, err := researcherPublications(id, s.cvs[id])
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, rp)
+	}
+	return results, nil
+}
+
+func researcherPublications(lattesID string, doc map[string]interface{}) (ResearcherPublications, error) {
+	rp := ResearcherPublications{LattesID: lattesID}
+
+	cv, _ := doc["curriculo-vitae"].(map[string]interface{})
+	if dg, ok := cv["dados-gerais"].(map[string]interface{}); ok {
+		rp.Name, _ = dg["nome-completo"].(string)
+		rp.CitationNames, _ = dg["nome-em-citacoes-bibliograficas"].(string)
+	}
+	rp.Areas = parser.ExtractAreas(cv)
+
+	if pubs, ok := doc["publicacoes"]; ok {
+		if err := remarshal(pubs, &rp.Publications); err != nil {
+			return ResearcherPublications{}, err
+		}
+		rp.Publications.Backfill(cv)
+	} else {
+		rp.Publications = parser.ExtractPublications(cv)
+	}
+	return rp, nil
+}
+
+func (s *FileStore) UpsertSummary(ctx context.Context, lattesID, summary string, meta GenerationMetadata) error {
+	return s.upsertText(RevisionSummary, lattesID, Revision{
+		Text:        summary,
+		GeneratedAt: time.Now().UTC(),
+		Provider:    meta.Provider,
+		Model:       meta.Model,
+		PromptHash:  meta.PromptHash,
+		TokenUsage:  meta.TokenUsage,
+		Failover:    meta.Failover,
+	})
+}
+
+func (s *FileStore) GetSummary(ctx context.Context, lattesID string) (*SummaryDoc, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rev, ok := s.current[RevisionSummary][lattesID]
+	if !ok {
+		return nil, fmt.Errorf("resumo não encontrado")
+	}
+	return rev.summaryDoc(lattesID), nil
+}
+
+func (s *FileStore) UpsertAnalysis(ctx context.Context, lattesID, analysis string, meta GenerationMetadata, researchersAnalyzed int) error {
+	return s.upsertText(RevisionAnalysis, lattesID, Revision{
+		Text:                analysis,
+		GeneratedAt:         time.Now().UTC(),
+		Provider:            meta.Provider,
+		Model:               meta.Model,
+		PromptHash:          meta.PromptHash,
+		ResearchersAnalyzed: researchersAnalyzed,
+		TokenUsage:          meta.TokenUsage,
+		Failover:            meta.Failover,
+	})
+}
+
+func (s *FileStore) GetAnalysis(ctx context.Context, lattesID string) (*AnalysisDoc, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rev, ok := s.current[RevisionAnalysis][lattesID]
+	if !ok {
+		return nil, fmt.Errorf("análise não encontrada")
+	}
+	return rev.analysisDoc(lattesID), nil
+}
+
+// upsertText stores the current summary or analysis of a researcher and, as
+// MongoDB.addRevision does, appends it to the revision history unless it
+// repeats the text of the latest revision.
+func (s *FileStore) upsertText(kind, lattesID string, rev Revision) error {
+	if !validID(lattesID) {
+		return fmt.Errorf("ID Lattes inválido")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	revisions, err := s.readRevisions(kind, lattesID)
+	if err != nil {
+		return err
+	}
+	if len(revisions) == 0 {
+		if prev, ok := s.current[kind][lattesID]; ok && prev.Text != rev.Text {
+			prev.ID = bson.NewObjectID().Hex()
+			revisions = append(revisions, prev)
+		}
+	}
+	if len(revisions) == 0 || revisions[len(revisions)-1].Text != rev.Text {
+		added := rev
+		added.ID = bson.NewObjectID().Hex()
+		revisions = append(revisions, added)
+		if err := writeJSONFile(filepath.Join(s.dir, kind+"_historico", lattesID+".json"), revisions); err != nil {
+			return err
+		}
+	}
+
+	if err := writeJSONFile(filepath.Join(s.dir, kind, lattesID+".json"), rev); err != nil {
+		return err
+	}
+	s.current[kind][lattesID] = rev
+	return nil
+}
+
+// readRevisions returns the revisions of kind for a researcher, oldest first.
+func (s *FileStore) readRevisions(kind, lattesID string) ([]Revision, error) {
+	if !validID(lattesID) {
+		return nil, nil
+	}
+	data, err := os.ReadFile(filepath.Join(s.dir, kind+"_historico", lattesID+".json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var revisions []Revision
+	if err := json.Unmarshal(data, &revisions); err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+func (s *FileStore) ListRevisions(ctx context.Context, kind, lattesID string) ([]Revision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, err := s.readRevisions(kind, lattesID)
+	if err != nil {
+		return nil, err
+	}
+
+	revisions := make([]Revision, 0, len(stored))
+	for i := len(stored) - 1; i >= 0; i-- {
+		rev := stored[i]
+		rev.Text = ""
+		revisions = append(revisions, rev)
+	}
+	return revisions, nil
+}
+
+func (s *FileStore) GetRevision(ctx context.Context, kind, lattesID, revisionID string) (*Revision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	revisions, err := s.readRevisions(kind, lattesID)
+	if err != nil {
+		return nil, err
+	}
+	for _, rev := range revisions {
+		if rev.ID == revisionID {
+			return &rev, nil
+		}
+	}
+	return nil, fmt.Errorf("revisão não encontrada")
+}
+
+func (s *FileStore) AddUsage(ctx context.Context, client, day string, requests, tokens int64) (*UsageRecord, error) {
+	if !validID(day) {
+		return nil, fmt.Errorf("dia inválido: %q", day)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records, err := s.readUsage(day)
+	if err != nil {
+		return nil, err
+	}
+	i := 0
+	for i < len(records) && records[i].Client != client {
+		i++
+	}
+	if i == len(records) {
+		records = append(records, UsageRecord{Client: client, Day: day})
+	}
+	records[i].Requests += requests
+	records[i].Tokens += tokens
+	records[i].UpdatedAt = time.Now().UTC()
+
+	if err := writeJSONFile(filepath.Join(s.dir, "uso", day+".json"), records); err != nil {
+		return nil, err
+	}
+	rec := records[i]
+	return &rec, nil
+}
+
+func (s *FileStore) ListUsage(ctx context.Context, day string) ([]UsageRecord, error) {
+	if !validID(day) {
+		return nil, fmt.Errorf("dia inválido: %q", day)
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	records, err := s.readUsage(day)
+	if err != nil {
+		return nil, err
+	}
+	sortUsage(records)
+	return records, nil
+}
+
+func (s *FileStore) LogAICall(ctx context.Context, call AICall) error {
+	line, err := json.Marshal(call)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(filepath.Join(s.dir, "chamadas_ia.jsonl"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (s *FileStore) ListAICalls(ctx context.Context, limit int) ([]AICall, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, err := os.ReadFile(filepath.Join(s.dir, "chamadas_ia.jsonl"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return []AICall{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var calls []AICall
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if line == "" {
+			continue
+		}
+		var call AICall
+		if err := json.Unmarshal([]byte(line), &call); err != nil {
+			return nil, fmt.Errorf("chamadas_ia.jsonl: %w", err)
+		}
+		calls = append(calls, call)
+	}
+	return latestCalls(calls, limit), nil
+}
+
+func (s *FileStore) SaveJob(ctx context.Context, job Job) error {
+	if !validID(job.ID) {
+		return fmt.Errorf("ID de tarefa inválido: %q", job.ID)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return writeJSONFile(filepath.Join(s.dir, "tarefas", job.ID+".json"), job)
+}
+
+func (s *FileStore) GetJob(ctx context.Context, id string) (*Job, error) {
+	if !validID(id) {
+		return nil, fmt.Errorf("tarefa não encontrada")
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, err := os.ReadFile(filepath.Join(s.dir, "tarefas", id+".json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("tarefa não encontrada")
+	}
+	if err != nil {
+		return nil, err
+	}
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (s *FileStore) ListJobs(ctx context.Context, statuses ...string) ([]Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var jobs []Job
+	err := eachJSON(filepath.Join(s.dir, "tarefas"), func(id string, data []byte) error {
+		var job Job
+		if err := json.Unmarshal(data, &job); err != nil {
+			return err
+		}
+		jobs = append(jobs, job)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return filterJobs(jobs, statuses), nil
+}
+
+func (s *FileStore) SaveChatSession(ctx context.Context, session ChatSession) error {
+	if !validID(session.ID) {
+		return fmt.Errorf("ID de conversa inválido: %q", session.ID)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return writeJSONFile(filepath.Join(s.dir, "conversas", session.ID+".json"), session)
+}
+
+func (s *FileStore) GetChatSession(ctx context.Context, id string) (*ChatSession, error) {
+	if !validID(id) {
+		return nil, fmt.Errorf("conversa não encontrada")
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, err := os.ReadFile(filepath.Join(s.dir, "conversas", id+".json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("conversa não encontrada")
+	}
+	if err != nil {
+		return nil, err
+	}
+	var session ChatSession
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (s *FileStore) ListChatSessions(ctx context.Context, owner string) ([]ChatSession, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var sessions []ChatSession
+	err := eachJSON(filepath.Join(s.dir, "conversas"), func(id string, data []byte) error {
+		var session ChatSession
+		if err := json.Unmarshal(data, &session); err != nil {
+			return err
+		}
+		session.Messages = nil
+		sessions = append(sessions, session)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ownedSessions(sessions, owner), nil
+}
+
+func (s *FileStore) DeleteChatSession(ctx context.Context, id string) error {
+	if !validID(id) {
+		return fmt.Errorf("conversa não encontrada")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := os.Remove(filepath.Join(s.dir, "conversas", id+".json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("conversa não encontrada")
+	}
+	return err
+}
+
+// fileClusters is the content of agrupamentos.json.
+type fileClusters struct {
+	publicationGroups
+	Clusters []PublicationCluster `json:"agrupamentos"`
+}
+
+func (s *FileStore) SavePublicationClusters(ctx context.Context, clusters []PublicationCluster, stats PublicationStats) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc := fileClusters{
+		publicationGroups: publicationGroups{Stats: stats, UpdatedAt: time.Now().UTC()},
+		Clusters:          append([]PublicationCluster{}, clusters...),
+	}
+	return writeJSONFile(filepath.Join(s.dir, "agrupamentos.json"), doc)
+}
+
+// readClusters returns nil when no grouping has been saved yet.
+func (s *FileStore) readClusters() (*fileClusters, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, "agrupamentos.json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var doc fileClusters
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+func (s *FileStore) GetPublicationStats(ctx context.Context) (*PublicationStats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	doc, err := s.readClusters()
+	if err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		return nil, fmt.Errorf("estatísticas de publicações não encontradas")
+	}
+	return &doc.Stats, nil
+}
+
+func (s *FileStore) GetPublicationClusters(ctx context.Context) ([]PublicationCluster, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	doc, err := s.readClusters()
+	if err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		return []PublicationCluster{}, nil
+	}
+	return doc.Clusters, nil
+}
+
+func (s *FileStore) readUsage(day string) ([]UsageRecord, error) {
+	records := []UsageRecord{}
+	data, err := os.ReadFile(filepath.Join(s.dir, "uso", day+".json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return records, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func cvName(doc map[string]interface{}) string {
+	cv, _ := doc["curriculo-vitae"].(map[string]interface{})
+	dg, _ := cv["dados-gerais"].(map[string]interface{})
+	name, _ := dg["nome-completo"].(string)
+	return name
+}
+
+// project copies the given paths of doc, plus its _id, into a new document,
+// like a MongoDB projection.
+func project(doc map[string]interface{}, paths [][]string) map[string]interface{} {
+	out := map[string]interface{}{"_id": doc["_id"]}
+	for _, path := range paths {
+		src, dst := doc, out
+		for i, key := range path {
+			v, ok := src[key]
+			if !ok {
+				break
+			}
+			if i == len(path)-1 {
+				dst[key] = cloneValue(v)
+				break
+			}
+			next, ok := v.(map[string]interface{})
+			if !ok {
+				break
+			}
+			child, _ := dst[key].(map[string]interface{})
+			if child == nil {
+				child = map[string]interface{}{}
+				dst[key] = child
+			}
+			src, dst = next, child
+		}
+	}
+	return out
+}
+
+// cloneValue deep-copies a decoded JSON value so callers can modify what the
+// store returns without touching its cache.
+func cloneValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			out[k] = cloneValue(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			out[i] = cloneValue(item)
+		}
+		return out
+	default:
+		return val
+	}
+}
+
+func remarshal(src, dst interface{}) error {
+	data, err := json.Marshal(src)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dst)
+}
@@ -0,0 +1,194 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// CVVersion describes one upload of a CV. Versions are numbered from 1 in
+// upload order; the highest number is the document in "curriculos" and the
+// previous ones live in "curriculos_historico".
+type CVVersion struct {
+	Version          int        `json:"version"`
+	Current          bool       `json:"current"`
+	UploadedAt       time.Time  `json:"uploadedAt"`
+	ArchivedAt       *time.Time `json:"archivedAt,omitempty"`
+	OriginalFilename string     `json:"originalFilename"`
+	FileSize         int64      `json:"fileSize"`
+	LastUpdate       string     `json:"lastUpdate"`
+}
+
+type cvMetadata struct {
+	UploadedAt       time.Time `bson:"uploadedAt"`
+	OriginalFilename string    `bson:"originalFilename"`
+	FileSize         int64     `bson:"fileSize"`
+	Version          int       `bson:"version"`
+}
+
+type versionDoc struct {
+	Version    int        `bson:"version"`
+	ArchivedAt *time.Time `bson:"archivedAt"`
+	Metadata   cvMetadata `bson:"_metadata"`
+	CV         struct {
+		LastUpdate string `bson:"data-atualizacao"`
+	} `bson:"curriculo-vitae"`
+}
+
+var versionProjection = bson.M{
+	"version":                          1,
+	"archivedAt":                       1,
+	"_metadata":                        1,
+	"curriculo-vitae.data-atualizacao": 1,
+}
+
+// archiveCV copies raw, the CV a new upload is about to replace, to
+// curriculos_historico as the given version. Versions are unique per CV, so
+// a retry or a concurrent upload that archives the same version again is a
+// no-op.
+func (m *MongoDB) archiveCV(ctx context.Context, lattesID string, raw bson.Raw, version int64) error {
+	if err := m.ensureHistoryIndex(ctx); err != nil {
+		return err
+	}
+
+	var prev bson.M
+	if err := bson.Unmarshal(raw, &prev); err != nil {
+		return err
+	}
+
+	delete(prev, "_id")
+	prev["lattesId"] = lattesID
+	prev["version"] = version
+	prev["archivedAt"] = time.Now().UTC()
+
+	_, err := m.database.Collection("curriculos_historico").InsertOne(ctx, prev)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil
+	}
+	return err
+}
+
+// ensureHistoryIndex creates the unique (lattesId, version) index of
+// curriculos_historico. It runs on the first archive instead of in Connect
+// because the database may not be reachable at startup; a failed attempt is
+// retried by the next upload.
+func (m *MongoDB) ensureHistoryIndex(ctx context.Context) error {
+	m.historyMu.Lock()
+	defer m.historyMu.Unlock()
+	if m.historyIndexed {
+		return nil
+	}
+
+	_, err := m.database.Collection("curriculos_historico").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "lattesId", Value: 1}, {Key: "version", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+	m.historyIndexed = true
+	return nil
+}
+
+// ListCVVersions returns every version of a CV, oldest first.
+func (m *MongoDB) ListCVVersions(ctx context.Context, lattesID string) ([]CVVersion, error) {
+	var current versionDoc
+	err := m.database.Collection("curriculos").FindOne(ctx, bson.M{"_id": lattesID},
+		options.FindOne().SetProjection(versionProjection)).Decode(&current)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("CV não encontrado")
+		}
+		return nil, err
+	}
+
+	// An upload that failed after archiving leaves a copy of the current
+	// version behind.
+	filter := bson.M{"lattesId": lattesID}
+	if current.Metadata.Version > 0 {
+		filter["version"] = bson.M{"$lt": current.Metadata.Version}
+	}
+	opts := options.Find().SetProjection(versionProjection).SetSort(bson.D{{Key: "version", Value: 1}})
+	cursor, err := m.database.Collection("curriculos_historico").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var versions []CVVersion
+	for cursor.Next(ctx) {
+		var doc versionDoc
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		versions = append(versions, doc.toCVVersion())
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	current.Version = current.Metadata.Version
+	if current.Version == 0 {
+		current.Version = len(versions) + 1
+	}
+	latest := current.toCVVersion()
+	latest.Current = true
+	return append(versions, latest), nil
+}
+
+// GetCVVersion returns the curriculo-vitae tree of one version of a CV.
+func (m *MongoDB) GetCVVersion(ctx context.Context, lattesID string, version int) (map[string]interface{}, error) {
+	var doc struct {
+		CV bson.Raw `bson:"curriculo-vitae"`
+	}
+	opts := options.FindOne().SetProjection(bson.M{"curriculo-vitae": 1})
+
+	err := m.database.Collection("curriculos_historico").FindOne(ctx,
+		bson.M{"lattesId": lattesID, "version": version}, opts).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		// Not archived: it may be the current version.
+		var current struct {
+			CV       bson.Raw   `bson:"curriculo-vitae"`
+			Metadata cvMetadata `bson:"_metadata"`
+		}
+		err = m.database.Collection("curriculos").FindOne(ctx, bson.M{"_id": lattesID},
+			options.FindOne().SetProjection(bson.M{"curriculo-vitae": 1, "_metadata": 1})).Decode(&current)
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("versão não encontrada")
+		}
+		if err != nil {
+			return nil, err
+		}
+		currentVersion := current.Metadata.Version
+		if currentVersion == 0 {
+			archived, err := m.database.Collection("curriculos_historico").CountDocuments(ctx, bson.M{"lattesId": lattesID})
+			if err != nil {
+				return nil, err
+			}
+			currentVersion = int(archived) + 1
+		}
+		if version != currentVersion {
+			return nil, fmt.Errorf("versão não encontrada")
+		}
+		doc.CV = current.CV
+	} else if err != nil {
+		return nil, err
+	}
+
+	return plainMap(doc.CV)
+}
+
+func (d versionDoc) toCVVersion() CVVersion {
+	return CVVersion{
+		Version:          d.Version,
+		UploadedAt:       d.Metadata.UploadedAt,
+		ArchivedAt:       d.ArchivedAt,
+		OriginalFilename: d.Metadata.OriginalFilename,
+		FileSize:         d.Metadata.FileSize,
+		LastUpdate:       d.CV.LastUpdate,
+	}
+}
@@ -0,0 +1,102 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Job is a summary or analysis generated in the background. The user's API
+// key is never stored: the queue keeps it in memory while the job is pending.
+type Job struct {
+	ID       string `bson:"_id" json:"id"`
+	Kind     string `bson:"tipo" json:"kind"`
+	LattesID string `bson:"lattesId" json:"lattesId"`
+	Provider string `bson:"provider" json:"provider"`
+	Model    string `bson:"model" json:"model"`
+	Client   string `bson:"cliente" json:"-"`
+	// UserKey is set when the request brought the user's own API key, which
+	// is lost if the server restarts before the job runs.
+	UserKey  bool   `bson:"chaveUsuario" json:"-"`
+	Status   string `bson:"status" json:"status"`
+	Stage    string `bson:"etapa,omitempty" json:"stage,omitempty"`
+	Attempts int    `bson:"tentativas" json:"attempts"`
+	// Result is the body the synchronous endpoint would have answered.
+	Result      json.RawMessage `bson:"resultado,omitempty" json:"result,omitempty"`
+	Error       string          `bson:"erro,omitempty" json:"error,omitempty"`
+	ErrorStatus int             `bson:"statusErro,omitempty" json:"errorStatus,omitempty"`
+	CreatedAt   time.Time       `bson:"criadoEm" json:"createdAt"`
+	UpdatedAt   time.Time       `bson:"atualizadoEm" json:"updatedAt"`
+	FinishedAt  *time.Time      `bson:"concluidoEm,omitempty" json:"finishedAt,omitempty"`
+}
+
+// Kinds of Job.
+const (
+	JobSummary  = "summary"
+	JobAnalysis = "analysis"
+)
+
+// Job statuses.
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// filterJobs returns the jobs with one of statuses, oldest first.
+func filterJobs(jobs []Job, statuses []string) []Job {
+	out := []Job{}
+	for _, j := range jobs {
+		for _, s := range statuses {
+			if j.Status == s {
+				out = append(out, j)
+				break
+			}
+		}
+	}
+	sort.Slice(out, func(i, k int) bool { return out[i].CreatedAt.Before(out[k].CreatedAt) })
+	return out
+}
+
+// SaveJob creates or replaces job in the tarefas collection.
+func (m *MongoDB) SaveJob(ctx context.Context, job Job) error {
+	_, err := m.database.Collection("tarefas").ReplaceOne(ctx, bson.M{"_id": job.ID}, job, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (m *MongoDB) GetJob(ctx context.Context, id string) (*Job, error) {
+	var job Job
+	err := m.database.Collection("tarefas").FindOne(ctx, bson.M{"_id": id}).Decode(&job)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("tarefa não encontrada")
+		}
+		return nil, err
+	}
+	return &job, nil
+}
+
+// ListJobs returns the jobs with one of statuses, oldest first.
+func (m *MongoDB) ListJobs(ctx context.Context, statuses ...string) ([]Job, error) {
+	collection := m.database.Collection("tarefas")
+
+	opts := options.Find().SetSort(bson.D{{Key: "criadoEm", Value: 1}})
+	cursor, err := collection.Find(ctx, bson.M{"status": bson.M{"$in": statuses}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	jobs := []Job{}
+	if err := cursor.All(ctx, &jobs); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
@@ -0,0 +1,482 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// MemoryStore keeps everything in memory. Nothing survives a restart; it
+// exists for tests and for trying the handlers without a database.
+type MemoryStore struct {
+	mu        sync.RWMutex
+	cvs       map[string]map[string]interface{}
+	versions  map[string][]map[string]interface{}
+	current   map[string]map[string]Revision
+	revisions map[string]map[string][]Revision
+	usage     map[string]map[string]UsageRecord
+	calls     []AICall
+	jobs      map[string]Job
+	chats     map[string]ChatSession
+	stats     *PublicationStats
+	clusters  []PublicationCluster
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		cvs:      make(map[string]map[string]interface{}),
+		versions: make(map[string][]map[string]interface{}),
+		current: map[string]map[string]Revision{
+			RevisionSummary:  {},
+			RevisionAnalysis: {},
+		},
+		revisions: map[string]map[string][]Revision{
+			RevisionSummary:  {},
+			RevisionAnalysis: {},
+		},
+		usage: make(map[string]map[string]UsageRecord),
+		jobs:  make(map[string]Job),
+		chats: make(map[string]ChatSession),
+	}
+}
+
+func (s *MemoryStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (s *MemoryStore) Disconnect(ctx context.Context) error {
+	return nil
+}
+
+func (s *MemoryStore) UpsertCV(ctx context.Context, doc map[string]interface{}, lattesID, originalFilename string, fileSize int64) (*UpsertResult, error) {
+	doc["_id"] = lattesID
+	doc["_metadata"] = map[string]interface{}{
+		"uploadedAt":       time.Now().UTC(),
+		"originalFilename": originalFilename,
+		"fileSize":         fileSize,
+	}
+
+	// Stored as decoded JSON, so callers get plain maps and slices back and
+	// cannot modify the stored copy through doc.
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var stored map[string]interface{}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev, updated := s.cvs[lattesID]
+	if updated {
+		archived := make(map[string]interface{}, len(prev)+1)
+		for k, v := range prev {
+			archived[k] = v
+		}
+		archived["archivedAt"] = time.Now().UTC().Format(time.RFC3339Nano)
+		s.versions[lattesID] = append(s.versions[lattesID], archived)
+	}
+	s.cvs[lattesID] = stored
+
+	return &UpsertResult{Updated: updated}, nil
+}
+
+func (s *MemoryStore) GetCV(ctx context.Context, lattesID string) (map[string]interface{}, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	doc, ok := s.cvs[lattesID]
+	if !ok {
+		return nil, fmt.Errorf("CV não encontrado")
+	}
+
+	out := make(map[string]interface{}, len(doc))
+	for k, v := range doc {
+		if k != "publicacoes" {
+			out[k] = cloneValue(v)
+		}
+	}
+	return out, nil
+}
+
+func (s *MemoryStore) SearchCVs(ctx context.Context, query string) ([]CVSummary, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	digits := isAllDigits(query)
+	lower := strings.ToLower(query)
+
+	var results []CVSummary
+	for _, id := range sortedKeys(s.cvs) {
+		name := cvName(s.cvs[id])
+		if digits && strings.HasPrefix(id, query) || !digits && strings.Contains(strings.ToLower(name), lower) {
+			results = append(results, CVSummary{LattesID: id, Name: name})
+			if len(results) == 20 {
+				break
+			}
+		}
+	}
+	return results, nil
+}
+
+func (s *MemoryStore) CountCVs(ctx context.Context) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return int64(len(s.cvs)), nil
+}
+
+func (s *MemoryStore) GetAllCVSummaries(ctx context.Context, excludeLattesID string) ([]map[string]interface{}, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var results []map[string]interface{}
+	for _, id := range sortedKeys(s.cvs) {
+		if id != excludeLattesID {
+			results = append(results, project(s.cvs[id], profileFields))
+		}
+	}
+	return results, nil
+}
+
+func (s *MemoryStore) GetAllCVsForChat(ctx context.Context) ([]map[string]interface{}, error) {
+	return s.GetAllCVSummaries(ctx, "")
+}
+
+func (s *MemoryStore) GetAllResearchersAdmin(ctx context.Context) ([]AdminResearcher, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	results := make([]AdminResearcher, 0, len(s.cvs))
+	for id, doc := range s.cvs {
+		_, hasResumo := s.current[RevisionSummary][id]
+		_, hasAnalise := s.current[RevisionAnalysis][id]
+		results = append(results, AdminResearcher{
+			LattesID:   id,
+			Name:       cvName(doc),
+			HasResumo:  hasResumo,
+			HasAnalise: hasAnalise,
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return strings.ToLower(results[i].Name) < strings.ToLower(results[j].Name)
+	})
+	return results, nil
+}
+
+func (s *MemoryStore) ListCVVersions(ctx context.Context, lattesID string) ([]CVVersion, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	current, ok := s.cvs[lattesID]
+	if !ok {
+		return nil, fmt.Errorf("CV não encontrado")
+	}
+
+	docs := append(append([]map[string]interface{}{}, s.versions[lattesID]...), current)
+	versions := make([]CVVersion, 0, len(docs))
+	for i, d := range docs {
+		var doc fileVersionDoc
+		if err := remarshal(d, &doc); err != nil {
+			return nil, err
+		}
+		doc.Version = i + 1
+		v := doc.toCVVersion()
+		v.Current = i == len(docs)-1
+		versions = append(versions, v)
+	}
+	return versions, nil
+}
+
+func (s *MemoryStore) GetCVVersion(ctx context.Context, lattesID string, version int) (map[string]interface{}, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	archived := s.versions[lattesID]
+	var doc map[string]interface{}
+	switch {
+	case version >= 1 && version <= len(archived):
+		doc = archived[version-1]
+	case version == len(archived)+1 && s.cvs[lattesID] != nil:
+		doc = s.cvs[lattesID]
+	default:
+		return nil, fmt.Errorf("versão não encontrada")
+	}
+
+	cv, _ := cloneValue(doc["curriculo-vitae"]).(map[string]interface{})
+	if cv == nil {
+		cv = map[string]interface{}{}
+	}
+	return cv, nil
+}
+
+func (s *MemoryStore) GetPublications(ctx context.Context, lattesID string) (*ResearcherPublications, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	doc, ok := s.cvs[lattesID]
+	if !ok {
+		return nil, fmt.Errorf("CV não encontrado")
+	}
+	rp, err := researcherPublications(lattesID, doc)
+	if err != nil {
+		return nil, err
+	}
+	return &rp, nil
+}
+
+func (s *MemoryStore) GetAllPublications(ctx context.Context) ([]ResearcherPublications, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var results []ResearcherPublications
+	for _, id := range sortedKeys(s.cvs) {
+		rp, err := researcherPublications(id, s.cvs[id])
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, rp)
+	}
+	return results, nil
+}
+
+func (s *MemoryStore) UpsertSummary(ctx context.Context, lattesID, summary string, meta GenerationMetadata) error {
+	s.upsertText(RevisionSummary, lattesID, Revision{
+		Text:        summary,
+		GeneratedAt: time.Now().UTC(),
+		Provider:    meta.Provider,
+		Model:       meta.Model,
+		PromptHash:  meta.PromptHash,
+		TokenUsage:  meta.TokenUsage,
+		Failover:    meta.Failover,
+	})
+	return nil
+}
+
+func (s *MemoryStore) GetSummary(ctx context.Context, lattesID string) (*SummaryDoc, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rev, ok := s.current[RevisionSummary][lattesID]
+	if !ok {
+		return nil, fmt.Errorf("resumo não encontrado")
+	}
+	return rev.summaryDoc(lattesID), nil
+}
+
+func (s *MemoryStore) UpsertAnalysis(ctx context.Context, lattesID, analysis string, meta GenerationMetadata, researchersAnalyzed int) error {
+	s.upsertText(RevisionAnalysis, lattesID, Revision{
+		Text:                analysis,
+		GeneratedAt:         time.Now().UTC(),
+		Provider:            meta.Provider,
+		Model:               meta.Model,
+		PromptHash:          meta.PromptHash,
+		ResearchersAnalyzed: researchersAnalyzed,
+		TokenUsage:          meta.TokenUsage,
+		Failover:            meta.Failover,
+	})
+	return nil
+}
+
+func (s *MemoryStore) GetAnalysis(ctx context.Context, lattesID string) (*AnalysisDoc, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rev, ok := s.current[RevisionAnalysis][lattesID]
+	if !ok {
+		return nil, fmt.Errorf("análise não encontrada")
+	}
+	return rev.analysisDoc(lattesID), nil
+}
+
+func (s *MemoryStore) upsertText(kind, lattesID string, rev Revision) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	revisions := s.revisions[kind][lattesID]
+	if len(revisions) == 0 || revisions[len(revisions)-1].Text != rev.Text {
+		added := rev
+		added.ID = bson.NewObjectID().Hex()
+		s.revisions[kind][lattesID] = append(revisions, added)
+	}
+	s.current[kind][lattesID] = rev
+}
+
+func (s *MemoryStore) ListRevisions(ctx context.Context, kind, lattesID string) ([]Revision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored := s.revisions[kind][lattesID]
+	revisions := make([]Revision, 0, len(stored))
+	for i := len(stored) - 1; i >= 0; i-- {
+		rev := stored[i]
+		rev.Text = ""
+		revisions = append(revisions, rev)
+	}
+	return revisions, nil
+}
+
+func (s *MemoryStore) GetRevision(ctx context.Context, kind, lattesID, revisionID string) (*Revision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, rev := range s.revisions[kind][lattesID] {
+		if rev.ID == revisionID {
+			return &rev, nil
+		}
+	}
+	return nil, fmt.Errorf("revisão não encontrada")
+}
+
+func (s *MemoryStore) AddUsage(ctx context.Context, client, day string, requests, tokens int64) (*UsageRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.usage[day] == nil {
+		s.usage[day] = make(map[string]UsageRecord)
+	}
+	rec := s.usage[day][client]
+	rec.Client, rec.Day = client, day
+	rec.Requests += requests
+	rec.Tokens += tokens
+	rec.UpdatedAt = time.Now().UTC()
+	s.usage[day][client] = rec
+	return &rec, nil
+}
+
+func (s *MemoryStore) ListUsage(ctx context.Context, day string) ([]UsageRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	records := make([]UsageRecord, 0, len(s.usage[day]))
+	for _, rec := range s.usage[day] {
+		records = append(records, rec)
+	}
+	sortUsage(records)
+	return records, nil
+}
+
+func (s *MemoryStore) LogAICall(ctx context.Context, call AICall) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls = append(s.calls, call)
+	return nil
+}
+
+func (s *MemoryStore) ListAICalls(ctx context.Context, limit int) ([]AICall, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return latestCalls(s.calls, limit), nil
+}
+
+func (s *MemoryStore) SaveJob(ctx context.Context, job Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.jobs[job.ID] = job
+	return nil
+}
+
+func (s *MemoryStore) GetJob(ctx context.Context, id string) (*Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, fmt.Errorf("tarefa não encontrada")
+	}
+	return &job, nil
+}
+
+func (s *MemoryStore) ListJobs(ctx context.Context, statuses ...string) ([]Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	jobs := make([]Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job)
+	}
+	return filterJobs(jobs, statuses), nil
+}
+
+func (s *MemoryStore) SaveChatSession(ctx context.Context, session ChatSession) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session.Messages = append([]ChatRecord(nil), session.Messages...)
+	s.chats[session.ID] = session
+	return nil
+}
+
+func (s *MemoryStore) GetChatSession(ctx context.Context, id string) (*ChatSession, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, ok := s.chats[id]
+	if !ok {
+		return nil, fmt.Errorf("conversa não encontrada")
+	}
+	session.Messages = append([]ChatRecord(nil), session.Messages...)
+	return &session, nil
+}
+
+func (s *MemoryStore) ListChatSessions(ctx context.Context, owner string) ([]ChatSession, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sessions := make([]ChatSession, 0, len(s.chats))
+	for _, session := range s.chats {
+		session.Messages = nil
+		sessions = append(sessions, session)
+	}
+	return ownedSessions(sessions, owner), nil
+}
+
+func (s *MemoryStore) DeleteChatSession(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.chats[id]; !ok {
+		return fmt.Errorf("conversa não encontrada")
+	}
+	delete(s.chats, id)
+	return nil
+}
+
+func (s *MemoryStore) SavePublicationClusters(ctx context.Context, clusters []PublicationCluster, stats PublicationStats) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.clusters = append([]PublicationCluster{}, clusters...)
+	s.stats = &stats
+	return nil
+}
+
+func (s *MemoryStore) GetPublicationStats(ctx context.Context) (*PublicationStats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.stats == nil {
+		return nil, fmt.Errorf("estatísticas de publicações não encontradas")
+	}
+	stats := *s.stats
+	return &stats, nil
+}
+
+func (s *MemoryStore) GetPublicationClusters(ctx context.Context) ([]PublicationCluster, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]PublicationCluster{}, s.clusters...), nil
+}
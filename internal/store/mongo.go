@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 	"unicode"
 
@@ -17,6 +18,9 @@ import (
 type MongoDB struct {
 	client   *mongo.Client
 	database *mongo.Database
+
+	historyMu      sync.Mutex
+	historyIndexed bool
 }
 
 func Connect(uri, databaseName string) (*MongoDB, error) {
@@ -39,25 +43,83 @@ type UpsertResult struct {
 	Updated bool
 }
 
+// maxUpsertAttempts bounds how many times UpsertCV retries when concurrent
+// uploads of the same CV keep replacing it first.
+const maxUpsertAttempts = 5
+
+// UpsertCV stores a CV, keeping the version it replaces in
+// curriculos_historico. The version number travels in _metadata.version and
+// the replacement only applies to the version it was computed from, so two
+// concurrent uploads never get the same number: the one that loses the race
+// reads the CV again and retries. The previous version is archived before it
+// is replaced, so a failed upload never loses it.
 func (m *MongoDB) UpsertCV(ctx context.Context, doc map[string]interface{}, lattesID, originalFilename string, fileSize int64) (*UpsertResult, error) {
+	doc["_id"] = lattesID
+	for attempt := 1; ; attempt++ {
+		res, err := m.replaceCV(ctx, doc, lattesID, originalFilename, fileSize)
+		if err == errCVChanged && attempt < maxUpsertAttempts {
+			continue
+		}
+		return res, err
+	}
+}
+
+var errCVChanged = fmt.Errorf("CV alterado por outro envio simultâneo")
+
+func (m *MongoDB) replaceCV(ctx context.Context, doc map[string]interface{}, lattesID, originalFilename string, fileSize int64) (*UpsertResult, error) {
 	collection := m.database.Collection("curriculos")
 
-	doc["_id"] = lattesID
+	prev, err := collection.FindOne(ctx, bson.M{"_id": lattesID}).Raw()
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+	updated := err == nil
+
+	filter := bson.M{"_id": lattesID, "_metadata.version": bson.M{"$exists": false}}
+	version := int64(1)
+	if updated {
+		prevVersion, ok := prev.Lookup("_metadata", "version").AsInt64OK()
+		if ok {
+			filter["_metadata.version"] = prevVersion
+		} else {
+			// Uploaded before versions were stored in the CV. A failed
+			// attempt may have archived it already; that copy is not counted.
+			count := bson.M{"lattesId": lattesID}
+			if uploadedAt, err := prev.LookupErr("_metadata", "uploadedAt"); err == nil {
+				count["_metadata.uploadedAt"] = bson.M{"$ne": uploadedAt}
+			}
+			archived, err := m.database.Collection("curriculos_historico").CountDocuments(ctx, count)
+			if err != nil {
+				return nil, err
+			}
+			prevVersion = archived + 1
+		}
+		version = prevVersion + 1
+	}
+
 	doc["_metadata"] = map[string]interface{}{
 		"uploadedAt":       time.Now().UTC(),
 		"originalFilename": originalFilename,
 		"fileSize":         fileSize,
+		"version":          version,
 	}
 
-	filter := map[string]interface{}{"_id": lattesID}
-	opts := options.Replace().SetUpsert(true)
+	if updated {
+		if err := m.archiveCV(ctx, lattesID, prev, version-1); err != nil {
+			return nil, err
+		}
+	}
 
-	result, err := collection.ReplaceOne(ctx, filter, doc, opts)
+	// Without a match the upsert tries to insert a second document with the
+	// same _id, which fails when another upload got there first.
+	_, err = collection.ReplaceOne(ctx, filter, doc, options.Replace().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, errCVChanged
+	}
 	if err != nil {
 		return nil, err
 	}
-
-	return &UpsertResult{Updated: result.MatchedCount > 0}, nil
+	return &UpsertResult{Updated: updated}, nil
 }
 
 func (m *MongoDB) Ping(ctx context.Context) error {
@@ -136,8 +198,12 @@ func (m *MongoDB) SearchCVs(ctx context.Context, query string) ([]CVSummary, err
 func (m *MongoDB) GetCV(ctx context.Context, lattesID string) (map[string]interface{}, error) {
 	collection := m.database.Collection("curriculos")
 
+	// The typed "publicacoes" copy is left out: callers send this document to
+	// the AI providers and it would only duplicate producao-bibliografica.
+	opts := options.FindOne().SetProjection(bson.M{"publicacoes": 0})
+
 	var doc map[string]interface{}
-	err := collection.FindOne(ctx, bson.M{"_id": lattesID}).Decode(&doc)
+	err := collection.FindOne(ctx, bson.M{"_id": lattesID}, opts).Decode(&doc)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return nil, fmt.Errorf("CV não encontrado")
@@ -148,17 +214,19 @@ func (m *MongoDB) GetCV(ctx context.Context, lattesID string) (map[string]interf
 	return doc, nil
 }
 
-func (m *MongoDB) UpsertSummary(ctx context.Context, lattesID, summary, provider, model string) error {
+// UpsertSummary stores the researcher's current summary and keeps it as a
+// revision in resumos_historico.
+func (m *MongoDB) UpsertSummary(ctx context.Context, lattesID, summary string, meta GenerationMetadata) error {
 	collection := m.database.Collection("resumos")
 
 	doc := bson.M{
-		"_id":    lattesID,
-		"resumo": summary,
-		"_metadata": bson.M{
-			"generatedAt": time.Now().UTC(),
-			"provider":    provider,
-			"model":       model,
-		},
+		"_id":       lattesID,
+		"resumo":    summary,
+		"_metadata": meta.toBSON(time.Now().UTC()),
+	}
+
+	if err := m.addRevision(ctx, RevisionSummary, lattesID, doc); err != nil {
+		return err
 	}
 
 	filter := bson.M{"_id": lattesID}
@@ -172,6 +240,9 @@ type SummaryMetadata struct {
 	GeneratedAt time.Time `bson:"generatedAt"`
 	Provider    string    `bson:"provider"`
 	Model       string    `bson:"model"`
+	PromptHash  string    `bson:"promptHash,omitempty"`
+	TokenUsage  `bson:",inline"`
+	Failover    `bson:",inline"`
 }
 
 type SummaryDoc struct {
@@ -199,7 +270,10 @@ type AnalysisMetadata struct {
 	GeneratedAt         time.Time `bson:"generatedAt"`
 	Provider            string    `bson:"provider"`
 	Model               string    `bson:"model"`
+	PromptHash          string    `bson:"promptHash,omitempty"`
 	ResearchersAnalyzed int       `bson:"researchersAnalyzed"`
+	TokenUsage          `bson:",inline"`
+	Failover            `bson:",inline"`
 }
 
 type AnalysisDoc struct {
@@ -249,18 +323,21 @@ func (m *MongoDB) GetAllCVSummaries(ctx context.Context, excludeLattesID string)
 	return results, nil
 }
 
-func (m *MongoDB) UpsertAnalysis(ctx context.Context, lattesID, analysis, provider, model string, researchersAnalyzed int) error {
+// UpsertAnalysis stores the researcher's current analysis and keeps it as a
+// revision in relacoes_historico.
+func (m *MongoDB) UpsertAnalysis(ctx context.Context, lattesID, analysis string, meta GenerationMetadata, researchersAnalyzed int) error {
 	collection := m.database.Collection("relacoes")
 
+	metadata := meta.toBSON(time.Now().UTC())
+	metadata["researchersAnalyzed"] = researchersAnalyzed
 	doc := bson.M{
-		"_id":     lattesID,
-		"analise": analysis,
-		"_metadata": bson.M{
-			"generatedAt":         time.Now().UTC(),
-			"provider":            provider,
-			"model":               model,
-			"researchersAnalyzed": researchersAnalyzed,
-		},
+		"_id":       lattesID,
+		"analise":   analysis,
+		"_metadata": metadata,
+	}
+
+	if err := m.addRevision(ctx, RevisionAnalysis, lattesID, doc); err != nil {
+		return err
 	}
 
 	filter := bson.M{"_id": lattesID}
@@ -281,7 +358,8 @@ func (m *MongoDB) GetAllCVsForChat(ctx context.Context) ([]map[string]interface{
 		"curriculo-vitae.dados-gerais.atuacoes-profissionais":       1,
 		"curriculo-vitae.producao-bibliografica":                     1,
 	}
-	opts := options.Find().SetProjection(projection)
+	// Ordem fixa, para que o mesmo conteúdo gere o mesmo prompt
+	opts := options.Find().SetProjection(projection).SetSort(bson.D{{Key: "_id", Value: 1}})
 
 	cursor, err := collection.Find(ctx, bson.M{}, opts)
 	if err != nil {
@@ -0,0 +1,133 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/edalcin/smartlattes/internal/parser"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// ResearcherPublications is the typed production of one researcher.
+type ResearcherPublications struct {
+	LattesID      string              `json:"lattesId"`
+	Name          string              `json:"name"`
+	CitationNames string              `json:"citationNames,omitempty"`
+	Areas         []parser.Area       `json:"areas,omitempty"`
+	Publications  parser.Publications `json:"publications"`
+}
+
+// publicationsDoc is the projection read by the publication queries. CVs
+// uploaded before the typed model existed have no "publicacoes" field; for
+// those the publications are extracted from the raw tree on the fly.
+type publicationsDoc struct {
+	ID          string               `bson:"_id"`
+	CV          bson.Raw             `bson:"curriculo-vitae"`
+	Publicacoes *parser.Publications `bson:"publicacoes"`
+}
+
+var publicationsProjection = bson.M{
+	"_id": 1,
+	"curriculo-vitae.dados-gerais.nome-completo":                   1,
+	"curriculo-vitae.dados-gerais.nome-em-citacoes-bibliograficas": 1,
+	"curriculo-vitae.dados-gerais.areas-de-atuacao":                1,
+	"curriculo-vitae.producao-bibliografica":                       1,
+	"publicacoes":                                                  1,
+}
+
+func (d publicationsDoc) toResearcherPublications() (ResearcherPublications, error) {
+	cv, err := plainMap(d.CV)
+	if err != nil {
+		return ResearcherPublications{}, err
+	}
+
+	rp := ResearcherPublications{LattesID: d.ID}
+	if dg, ok := cv["dados-gerais"].(map[string]interface{}); ok {
+		rp.Name, _ = dg["nome-completo"].(string)
+		rp.CitationNames, _ = dg["nome-em-citacoes-bibliograficas"].(string)
+	}
+	rp.Areas = parser.ExtractAreas(cv)
+	if d.Publicacoes != nil {
+		rp.Publications = *d.Publicacoes
+		rp.Publications.Backfill(cv)
+	} else {
+		rp.Publications = parser.ExtractPublications(cv)
+	}
+	return rp, nil
+}
+
+func (m *MongoDB) GetPublications(ctx context.Context, lattesID string) (*ResearcherPublications, error) {
+	collection := m.database.Collection("curriculos")
+
+	opts := options.FindOne().SetProjection(publicationsProjection)
+
+	var doc publicationsDoc
+	err := collection.FindOne(ctx, bson.M{"_id": lattesID}, opts).Decode(&doc)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("CV não encontrado")
+		}
+		return nil, err
+	}
+
+	rp, err := doc.toResearcherPublications()
+	if err != nil {
+		return nil, err
+	}
+	return &rp, nil
+}
+
+func (m *MongoDB) GetAllPublications(ctx context.Context) ([]ResearcherPublications, error) {
+	collection := m.database.Collection("curriculos")
+
+	opts := options.Find().SetProjection(publicationsProjection).SetSort(bson.D{{Key: "_id", Value: 1}})
+
+	cursor, err := collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []ResearcherPublications
+	for cursor.Next(ctx) {
+		var doc publicationsDoc
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		rp, err := doc.toResearcherPublications()
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, rp)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// plainMap converts a BSON document into nested map[string]interface{} and
+// []interface{} values, the shape produced by parser.Parse.
+func plainMap(raw bson.Raw) (map[string]interface{}, error) {
+	if len(raw) == 0 {
+		return map[string]interface{}{}, nil
+	}
+	var doc bson.D
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var out map[string]interface{}
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,249 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Revision kinds: the collection holding the current text of each researcher.
+// Revisions live in the collection of the same name suffixed "_historico".
+const (
+	RevisionSummary  = "resumos"
+	RevisionAnalysis = "relacoes"
+)
+
+// revisionTextField is the field holding the generated text of each kind.
+var revisionTextField = map[string]string{
+	RevisionSummary:  "resumo",
+	RevisionAnalysis: "analise",
+}
+
+// GenerationMetadata describes how a summary or analysis was generated.
+// PromptHash is the SHA-256 of the system prompt, so revisions produced with
+// different prompt versions can be told apart.
+type GenerationMetadata struct {
+	Provider   string
+	Model      string
+	PromptHash string
+	TokenUsage
+	Failover
+}
+
+// Failover records the provider and model a request asked for when they were
+// unavailable and the text was produced by a fallback, named by Provider and
+// Model. It is empty when the requested provider answered.
+type Failover struct {
+	RequestedProvider string `bson:"requestedProvider,omitempty" json:"requestedProvider,omitempty"`
+	RequestedModel    string `bson:"requestedModel,omitempty" json:"requestedModel,omitempty"`
+}
+
+// TokenUsage is what generating a text consumed, as reported by the
+// provider. CostUSD is the estimated cost in US dollars, nil when the model
+// has no known price.
+type TokenUsage struct {
+	InputTokens  int      `bson:"inputTokens,omitempty" json:"inputTokens,omitempty"`
+	OutputTokens int      `bson:"outputTokens,omitempty" json:"outputTokens,omitempty"`
+	FinishReason string   `bson:"finishReason,omitempty" json:"finishReason,omitempty"`
+	CostUSD      *float64 `bson:"costUsd,omitempty" json:"costUsd,omitempty"`
+	// CacheReadTokens and CacheWriteTokens are the part of InputTokens read
+	// from and written to the provider's prompt cache.
+	CacheReadTokens  int `bson:"cacheReadTokens,omitempty" json:"cacheReadTokens,omitempty"`
+	CacheWriteTokens int `bson:"cacheWriteTokens,omitempty" json:"cacheWriteTokens,omitempty"`
+}
+
+func (g GenerationMetadata) toBSON(generatedAt time.Time) bson.M {
+	meta := bson.M{
+		"generatedAt": generatedAt,
+		"provider":    g.Provider,
+		"model":       g.Model,
+	}
+	if g.PromptHash != "" {
+		meta["promptHash"] = g.PromptHash
+	}
+	if g.InputTokens != 0 || g.OutputTokens != 0 {
+		meta["inputTokens"] = g.InputTokens
+		meta["outputTokens"] = g.OutputTokens
+	}
+	if g.CacheReadTokens != 0 || g.CacheWriteTokens != 0 {
+		meta["cacheReadTokens"] = g.CacheReadTokens
+		meta["cacheWriteTokens"] = g.CacheWriteTokens
+	}
+	if g.FinishReason != "" {
+		meta["finishReason"] = g.FinishReason
+	}
+	if g.CostUSD != nil {
+		meta["costUsd"] = *g.CostUSD
+	}
+	if g.RequestedProvider != "" {
+		meta["requestedProvider"] = g.RequestedProvider
+		meta["requestedModel"] = g.RequestedModel
+	}
+	return meta
+}
+
+// Revision is one generated summary or analysis. Text is only filled by
+// GetRevision.
+type Revision struct {
+	ID                  string    `json:"id"`
+	Text                string    `json:"text,omitempty"`
+	GeneratedAt         time.Time `json:"generatedAt"`
+	Provider            string    `json:"provider"`
+	Model               string    `json:"model"`
+	PromptHash          string    `json:"promptHash,omitempty"`
+	ResearchersAnalyzed int       `json:"researchersAnalyzed,omitempty"`
+	TokenUsage
+	Failover
+}
+
+type revisionDoc struct {
+	ID       bson.ObjectID    `bson:"_id"`
+	Resumo   string           `bson:"resumo"`
+	Analise  string           `bson:"analise"`
+	Metadata AnalysisMetadata `bson:"_metadata"`
+}
+
+func (d revisionDoc) toRevision() Revision {
+	text := d.Resumo
+	if text == "" {
+		text = d.Analise
+	}
+	return Revision{
+		ID:                  d.ID.Hex(),
+		Text:                text,
+		GeneratedAt:         d.Metadata.GeneratedAt,
+		Provider:            d.Metadata.Provider,
+		Model:               d.Metadata.Model,
+		PromptHash:          d.Metadata.PromptHash,
+		ResearchersAnalyzed: d.Metadata.ResearchersAnalyzed,
+		TokenUsage:          d.Metadata.TokenUsage,
+		Failover:            d.Metadata.Failover,
+	}
+}
+
+func (r Revision) summaryDoc(lattesID string) *SummaryDoc {
+	return &SummaryDoc{
+		ID:     lattesID,
+		Resumo: r.Text,
+		Metadata: SummaryMetadata{
+			GeneratedAt: r.GeneratedAt,
+			Provider:    r.Provider,
+			Model:       r.Model,
+			PromptHash:  r.PromptHash,
+			TokenUsage:  r.TokenUsage,
+			Failover:    r.Failover,
+		},
+	}
+}
+
+func (r Revision) analysisDoc(lattesID string) *AnalysisDoc {
+	return &AnalysisDoc{
+		ID:      lattesID,
+		Analise: r.Text,
+		Metadata: AnalysisMetadata{
+			GeneratedAt:         r.GeneratedAt,
+			Provider:            r.Provider,
+			Model:               r.Model,
+			PromptHash:          r.PromptHash,
+			ResearchersAnalyzed: r.ResearchersAnalyzed,
+			TokenUsage:          r.TokenUsage,
+			Failover:            r.Failover,
+		},
+	}
+}
+
+// addRevision records doc, the new current document of kind, in the revision
+// history. Saving again the text of the latest revision (the save button after
+// a generation that was already stored) does not add a new one. The first
+// time a researcher gets a revision, the document generated before the history
+// existed is kept as well.
+func (m *MongoDB) addRevision(ctx context.Context, kind, lattesID string, doc bson.M) error {
+	textField := revisionTextField[kind]
+	history := m.database.Collection(kind + "_historico")
+
+	var latest bson.M
+	opts := options.FindOne().SetSort(bson.D{{Key: "_metadata.generatedAt", Value: -1}})
+	err := history.FindOne(ctx, bson.M{"lattesId": lattesID}, opts).Decode(&latest)
+	switch {
+	case err == nil:
+		if latest[textField] == doc[textField] {
+			return nil
+		}
+	case err == mongo.ErrNoDocuments:
+		var previous bson.M
+		err := m.database.Collection(kind).FindOne(ctx, bson.M{"_id": lattesID}).Decode(&previous)
+		if err == nil && previous[textField] != doc[textField] {
+			delete(previous, "_id")
+			previous["lattesId"] = lattesID
+			if _, err := history.InsertOne(ctx, previous); err != nil {
+				return err
+			}
+		} else if err != nil && err != mongo.ErrNoDocuments {
+			return err
+		}
+	default:
+		return err
+	}
+
+	revision := bson.M{
+		"lattesId":  lattesID,
+		textField:   doc[textField],
+		"_metadata": doc["_metadata"],
+	}
+	_, err = history.InsertOne(ctx, revision)
+	return err
+}
+
+// ListRevisions returns the revisions of a researcher's summary or analysis,
+// newest first, without their text.
+func (m *MongoDB) ListRevisions(ctx context.Context, kind, lattesID string) ([]Revision, error) {
+	history := m.database.Collection(kind + "_historico")
+
+	opts := options.Find().
+		SetProjection(bson.M{revisionTextField[kind]: 0}).
+		SetSort(bson.D{{Key: "_metadata.generatedAt", Value: -1}})
+
+	cursor, err := history.Find(ctx, bson.M{"lattesId": lattesID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	revisions := []Revision{}
+	for cursor.Next(ctx) {
+		var doc revisionDoc
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, doc.toRevision())
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+func (m *MongoDB) GetRevision(ctx context.Context, kind, lattesID, revisionID string) (*Revision, error) {
+	id, err := bson.ObjectIDFromHex(revisionID)
+	if err != nil {
+		return nil, fmt.Errorf("revisão não encontrada")
+	}
+
+	var doc revisionDoc
+	err = m.database.Collection(kind+"_historico").FindOne(ctx, bson.M{"_id": id, "lattesId": lattesID}).Decode(&doc)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("revisão não encontrada")
+		}
+		return nil, err
+	}
+
+	rev := doc.toRevision()
+	return &rev, nil
+}
@@ -0,0 +1,63 @@
+package store
+
+import "context"
+
+// Store is the persistence used by the handlers. MongoDB is the default
+// implementation; FileStore keeps the same data as JSON files in a local
+// directory so the application can run without a database server, and
+// MemoryStore keeps it in memory for tests.
+//
+// Lookups of a missing document return an error whose message is the one
+// shown to the user ("CV não encontrado", "resumo não encontrado", ...), as the
+// handlers compare it to pick the HTTP status.
+type Store interface {
+	Ping(ctx context.Context) error
+	Disconnect(ctx context.Context) error
+
+	UpsertCV(ctx context.Context, doc map[string]interface{}, lattesID, originalFilename string, fileSize int64) (*UpsertResult, error)
+	GetCV(ctx context.Context, lattesID string) (map[string]interface{}, error)
+	SearchCVs(ctx context.Context, query string) ([]CVSummary, error)
+	CountCVs(ctx context.Context) (int64, error)
+	GetAllCVSummaries(ctx context.Context, excludeLattesID string) ([]map[string]interface{}, error)
+	GetAllCVsForChat(ctx context.Context) ([]map[string]interface{}, error)
+	GetAllResearchersAdmin(ctx context.Context) ([]AdminResearcher, error)
+
+	ListCVVersions(ctx context.Context, lattesID string) ([]CVVersion, error)
+	GetCVVersion(ctx context.Context, lattesID string, version int) (map[string]interface{}, error)
+
+	GetPublications(ctx context.Context, lattesID string) (*ResearcherPublications, error)
+	GetAllPublications(ctx context.Context) ([]ResearcherPublications, error)
+
+	SavePublicationClusters(ctx context.Context, clusters []PublicationCluster, stats PublicationStats) error
+	GetPublicationStats(ctx context.Context) (*PublicationStats, error)
+	GetPublicationClusters(ctx context.Context) ([]PublicationCluster, error)
+
+	UpsertSummary(ctx context.Context, lattesID, summary string, meta GenerationMetadata) error
+	GetSummary(ctx context.Context, lattesID string) (*SummaryDoc, error)
+	UpsertAnalysis(ctx context.Context, lattesID, analysis string, meta GenerationMetadata, researchersAnalyzed int) error
+	GetAnalysis(ctx context.Context, lattesID string) (*AnalysisDoc, error)
+
+	ListRevisions(ctx context.Context, kind, lattesID string) ([]Revision, error)
+	GetRevision(ctx context.Context, kind, lattesID, revisionID string) (*Revision, error)
+
+	AddUsage(ctx context.Context, client, day string, requests, tokens int64) (*UsageRecord, error)
+	ListUsage(ctx context.Context, day string) ([]UsageRecord, error)
+
+	LogAICall(ctx context.Context, call AICall) error
+	ListAICalls(ctx context.Context, limit int) ([]AICall, error)
+
+	SaveJob(ctx context.Context, job Job) error
+	GetJob(ctx context.Context, id string) (*Job, error)
+	ListJobs(ctx context.Context, statuses ...string) ([]Job, error)
+
+	SaveChatSession(ctx context.Context, session ChatSession) error
+	GetChatSession(ctx context.Context, id string) (*ChatSession, error)
+	ListChatSessions(ctx context.Context, owner string) ([]ChatSession, error)
+	DeleteChatSession(ctx context.Context, id string) error
+}
+
+var (
+	_ Store = (*MongoDB)(nil)
+	_ Store = (*FileStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
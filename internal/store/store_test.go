@@ -0,0 +1,389 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/edalcin/smartlattes/internal/parser"
+)
+
+func testCV(lattesID, name, lastUpdate string) map[string]interface{} {
+	cv := map[string]interface{}{
+		"numero-identificador": lattesID,
+		"data-atualizacao":     lastUpdate,
+		"dados-gerais": map[string]interface{}{
+			"nome-completo": name,
+		},
+		"producao-bibliografica": map[string]interface{}{
+			"artigos-publicados": map[string]interface{}{
+				"artigo-publicado": map[string]interface{}{
+					"dados-basicos-do-artigo": map[string]interface{}{
+						"titulo-do-artigo": "Artigo de " + name,
+						"ano-do-artigo":    "2020",
+					},
+				},
+			},
+		},
+	}
+	return map[string]interface{}{
+		"curriculo-vitae": cv,
+		"publicacoes":     parser.ExtractPublications(cv),
+	}
+}
+
+// backends returns a fresh instance of every store that runs without a
+// server.
+func backends(t *testing.T) map[string]func() Store {
+	dir := t.TempDir()
+	return map[string]func() Store{
+		"memory": func() Store { return NewMemoryStore() },
+		"file": func() Store {
+			s, err := OpenFileStore(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return s
+		},
+	}
+}
+
+func TestStoreCVs(t *testing.T) {
+	for name, open := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			s := open()
+
+			res, err := s.UpsertCV(ctx, testCV("1234", "Ana Souza", "01012023"), "1234", "ana.xml", 10)
+			if err != nil || res.Updated {
+				t.Fatalf("first upsert = %+v, %v", res, err)
+			}
+			s.UpsertCV(ctx, testCV("5678", "Bruno Lima", "01012023"), "5678", "bruno.xml", 10)
+			res, err = s.UpsertCV(ctx, testCV("1234", "Ana Souza", "01062024"), "1234", "ana2.xml", 20)
+			if err != nil || !res.Updated {
+				t.Fatalf("second upsert = %+v, %v", res, err)
+			}
+
+			cv, err := s.GetCV(ctx, "1234")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := cv["publicacoes"]; ok {
+				t.Error("GetCV returned the typed publications")
+			}
+			if _, err := s.GetCV(ctx, "0000"); err == nil || err.Error() != "CV não encontrado" {
+				t.Errorf("missing CV error = %v", err)
+			}
+
+			if n, _ := s.CountCVs(ctx); n != 2 {
+				t.Errorf("CountCVs = %d, want 2", n)
+			}
+			if found, _ := s.SearchCVs(ctx, "12"); len(found) != 1 || found[0].Name != "Ana Souza" {
+				t.Errorf("search by ID = %+v", found)
+			}
+			if found, _ := s.SearchCVs(ctx, "lima"); len(found) != 1 || found[0].LattesID != "5678" {
+				t.Errorf("search by name = %+v", found)
+			}
+
+			others, _ := s.GetAllCVSummaries(ctx, "1234")
+			if len(others) != 1 || others[0]["_id"] != "5678" {
+				t.Errorf("GetAllCVSummaries = %v", others)
+			}
+
+			versions, err := s.ListCVVersions(ctx, "1234")
+			if err != nil || len(versions) != 2 {
+				t.Fatalf("versions = %+v, %v", versions, err)
+			}
+			if versions[0].LastUpdate != "01012023" || versions[0].Current || versions[0].ArchivedAt == nil {
+				t.Errorf("first version = %+v", versions[0])
+			}
+			if versions[1].Version != 2 || !versions[1].Current || versions[1].OriginalFilename != "ana2.xml" {
+				t.Errorf("current version = %+v", versions[1])
+			}
+			old, err := s.GetCVVersion(ctx, "1234", 1)
+			if err != nil || old["data-atualizacao"] != "01012023" {
+				t.Errorf("version 1 = %v, %v", old, err)
+			}
+			if _, err := s.GetCVVersion(ctx, "1234", 3); err == nil || err.Error() != "versão não encontrada" {
+				t.Errorf("missing version error = %v", err)
+			}
+
+			pubs, err := s.GetPublications(ctx, "5678")
+			if err != nil || pubs.Name != "Bruno Lima" || len(pubs.Publications.Articles) != 1 {
+				t.Errorf("publications = %+v, %v", pubs, err)
+			}
+		})
+	}
+}
+
+func TestStoreRevisions(t *testing.T) {
+	for name, open := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			s := open()
+			meta := GenerationMetadata{Provider: "openai", Model: "gpt", PromptHash: "abc"}
+
+			if _, err := s.GetSummary(ctx, "1234"); err == nil || err.Error() != "resumo não encontrado" {
+				t.Errorf("missing summary error = %v", err)
+			}
+			s.UpsertSummary(ctx, "1234", "primeiro", meta)
+			s.UpsertSummary(ctx, "1234", "primeiro", meta)
+			s.UpsertSummary(ctx, "1234", "segundo", GenerationMetadata{Provider: "anthropic", Model: "claude"})
+
+			doc, err := s.GetSummary(ctx, "1234")
+			if err != nil || doc.Resumo != "segundo" || doc.Metadata.Provider != "anthropic" {
+				t.Errorf("summary = %+v, %v", doc, err)
+			}
+
+			revisions, _ := s.ListRevisions(ctx, RevisionSummary, "1234")
+			if len(revisions) != 2 || revisions[0].Provider != "anthropic" || revisions[0].Text != "" {
+				t.Fatalf("revisions = %+v", revisions)
+			}
+			rev, err := s.GetRevision(ctx, RevisionSummary, "1234", revisions[1].ID)
+			if err != nil || rev.Text != "primeiro" || rev.PromptHash != "abc" {
+				t.Errorf("revision = %+v, %v", rev, err)
+			}
+			if _, err := s.GetRevision(ctx, RevisionAnalysis, "1234", revisions[1].ID); err == nil {
+				t.Error("summary revision found among the analyses")
+			}
+
+			s.UpsertAnalysis(ctx, "1234", "análise", meta, 3)
+			analysis, err := s.GetAnalysis(ctx, "1234")
+			if err != nil || analysis.Metadata.ResearchersAnalyzed != 3 {
+				t.Errorf("analysis = %+v, %v", analysis, err)
+			}
+		})
+	}
+}
+
+func TestStoreUsage(t *testing.T) {
+	for name, open := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			s := open()
+
+			s.AddUsage(ctx, "10.0.0.1", "2024-03-15", 1, 500)
+			s.AddUsage(ctx, "10.0.0.2", "2024-03-15", 1, 100)
+			rec, err := s.AddUsage(ctx, "10.0.0.1", "2024-03-15", 1, 800)
+			if err != nil || rec.Requests != 2 || rec.Tokens != 1300 {
+				t.Fatalf("usage = %+v, %v", rec, err)
+			}
+			if rec, _ = s.AddUsage(ctx, "10.0.0.1", "2024-03-15", -1, -800); rec.Requests != 1 || rec.Tokens != 500 {
+				t.Errorf("usage after refund = %+v", rec)
+			}
+			s.AddUsage(ctx, "10.0.0.1", "2024-03-16", 1, 50)
+
+			records, err := s.ListUsage(ctx, "2024-03-15")
+			if err != nil || len(records) != 2 || records[0].Client != "10.0.0.1" || records[1].Tokens != 100 {
+				t.Errorf("records = %+v, %v", records, err)
+			}
+			if records, _ := s.ListUsage(ctx, "2024-01-01"); records == nil || len(records) != 0 {
+				t.Errorf("records of an empty day = %#v", records)
+			}
+		})
+	}
+}
+
+func TestStoreAICalls(t *testing.T) {
+	for name, open := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			s := open()
+
+			if calls, err := s.ListAICalls(ctx, 10); err != nil || calls == nil || len(calls) != 0 {
+				t.Fatalf("calls of an empty log = %#v, %v", calls, err)
+			}
+			cost := 0.5
+			start := time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)
+			for i, kind := range []string{CallSummary, CallAnalysis, CallChat} {
+				call := AICall{At: start.Add(time.Duration(i) * time.Minute), Kind: kind, Provider: "openai", Model: "gpt-4o",
+					TokenUsage: TokenUsage{InputTokens: 100 * (i + 1), OutputTokens: 10, CostUSD: &cost}}
+				if err := s.LogAICall(ctx, call); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			calls, err := s.ListAICalls(ctx, 2)
+			if err != nil || len(calls) != 2 || calls[0].Kind != CallChat || calls[1].InputTokens != 200 {
+				t.Fatalf("calls = %+v, %v", calls, err)
+			}
+			if calls[0].CostUSD == nil || *calls[0].CostUSD != 0.5 || !calls[0].At.Equal(start.Add(2*time.Minute)) {
+				t.Errorf("latest call = %+v", calls[0])
+			}
+		})
+	}
+}
+
+func TestStoreJobs(t *testing.T) {
+	for name, open := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			s := open()
+
+			if _, err := s.GetJob(ctx, "nada"); err == nil || err.Error() != "tarefa não encontrada" {
+				t.Errorf("missing job error = %v", err)
+			}
+			start := time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)
+			for i, status := range []string{JobRunning, JobDone, JobQueued} {
+				job := Job{ID: fmt.Sprintf("t%d", i), Kind: JobSummary, LattesID: "1234", Status: status, CreatedAt: start.Add(time.Duration(i) * time.Minute)}
+				if err := s.SaveJob(ctx, job); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			done, _ := s.GetJob(ctx, "t1")
+			done.Result = json.RawMessage(`{"success":true,"summary":"texto"}`)
+			if err := s.SaveJob(ctx, *done); err != nil {
+				t.Fatal(err)
+			}
+			if got, err := s.GetJob(ctx, "t1"); err != nil || string(got.Result) != `{"success":true,"summary":"texto"}` {
+				t.Errorf("job = %+v, %v", got, err)
+			}
+
+			pending, err := s.ListJobs(ctx, JobQueued, JobRunning)
+			if err != nil || len(pending) != 2 || pending[0].ID != "t0" || pending[1].ID != "t2" {
+				t.Errorf("pending jobs = %+v, %v", pending, err)
+			}
+		})
+	}
+}
+
+func TestStoreChatSessions(t *testing.T) {
+	for name, open := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			s := open()
+
+			if _, err := s.GetChatSession(ctx, "nada"); err == nil || err.Error() != "conversa não encontrada" {
+				t.Errorf("missing session error = %v", err)
+			}
+			start := time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)
+			for i, owner := range []string{"ana", "bruno", "ana"} {
+				session := ChatSession{ID: fmt.Sprintf("c%d", i), Owner: owner, Provider: "openai", Model: "gpt-4o", CreatedAt: start, UpdatedAt: start.Add(time.Duration(i) * time.Minute)}
+				if err := s.SaveChatSession(ctx, session); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			first, _ := s.GetChatSession(ctx, "c0")
+			first.Messages = append(first.Messages, ChatRecord{Role: "user", Content: "oi"}, ChatRecord{Role: "assistant", Content: "olá", Model: "gpt-4o"})
+			first.UpdatedAt = start.Add(time.Hour)
+			if err := s.SaveChatSession(ctx, *first); err != nil {
+				t.Fatal(err)
+			}
+			if got, err := s.GetChatSession(ctx, "c0"); err != nil || len(got.Messages) != 2 || got.Messages[1].Content != "olá" {
+				t.Errorf("session = %+v, %v", got, err)
+			}
+
+			owned, err := s.ListChatSessions(ctx, "ana")
+			if err != nil || len(owned) != 2 || owned[0].ID != "c0" || owned[1].ID != "c2" || owned[0].Messages != nil {
+				t.Errorf("sessions = %+v, %v", owned, err)
+			}
+
+			if err := s.DeleteChatSession(ctx, "c0"); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.DeleteChatSession(ctx, "c0"); err == nil || err.Error() != "conversa não encontrada" {
+				t.Errorf("deleting twice = %v", err)
+			}
+			if owned, _ := s.ListChatSessions(ctx, "ana"); len(owned) != 1 {
+				t.Errorf("sessions after delete = %+v", owned)
+			}
+		})
+	}
+}
+
+func TestStorePublicationClusters(t *testing.T) {
+	for name, open := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			s := open()
+
+			if _, err := s.GetPublicationStats(ctx); err == nil || err.Error() != "estatísticas de publicações não encontradas" {
+				t.Errorf("missing stats error = %v", err)
+			}
+			if clusters, err := s.GetPublicationClusters(ctx); err != nil || len(clusters) != 0 {
+				t.Errorf("clusters before saving = %+v, %v", clusters, err)
+			}
+
+			occ := PublicationOccurrence{LattesID: "1234", Name: "Ana Souza", Type: parser.TypeArticle, Title: "Artigo", Year: 2020}
+			first := []PublicationCluster{{ID: "pub-a", Type: parser.TypeArticle, Title: "Artigo", Year: 2020, Researchers: 1, Occurrences: []PublicationOccurrence{occ}}}
+			if err := s.SavePublicationClusters(ctx, first, PublicationStats{Total: 1, Unique: 1, UniqueByType: map[string]int{parser.TypeArticle: 1}}); err != nil {
+				t.Fatal(err)
+			}
+			second := []PublicationCluster{{ID: "pub-b", Type: parser.TypeBook, Title: "Livro", Researchers: 1, Occurrences: []PublicationOccurrence{occ, occ}}}
+			if err := s.SavePublicationClusters(ctx, second, PublicationStats{Total: 2, Unique: 1, Duplicates: 1, UniqueByType: map[string]int{parser.TypeBook: 1}}); err != nil {
+				t.Fatal(err)
+			}
+
+			stats, err := s.GetPublicationStats(ctx)
+			if err != nil || stats.Total != 2 || stats.Duplicates != 1 || stats.UniqueByType[parser.TypeBook] != 1 {
+				t.Errorf("stats = %+v, %v", stats, err)
+			}
+			clusters, err := s.GetPublicationClusters(ctx)
+			if err != nil || len(clusters) != 1 || clusters[0].ID != "pub-b" || len(clusters[0].Occurrences) != 2 {
+				t.Errorf("clusters = %+v, %v", clusters, err)
+			}
+		})
+	}
+}
+
+func TestFileStoreReopen(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s, err := OpenFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.UpsertCV(ctx, testCV("1234", "Ana Souza", "01012023"), "1234", "ana.xml", 10)
+	s.UpsertCV(ctx, testCV("1234", "Ana Souza", "01062024"), "1234", "ana.xml", 10)
+	s.UpsertSummary(ctx, "1234", "resumo", GenerationMetadata{Provider: "openai", Model: "gpt"})
+
+	s, err = OpenFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin, _ := s.GetAllResearchersAdmin(ctx)
+	if len(admin) != 1 || admin[0].Name != "Ana Souza" || !admin[0].HasResumo || admin[0].HasAnalise {
+		t.Errorf("researchers = %+v", admin)
+	}
+	if versions, _ := s.ListCVVersions(ctx, "1234"); len(versions) != 2 {
+		t.Errorf("versions after reopening = %+v", versions)
+	}
+	if _, err := s.UpsertCV(ctx, testCV("x", "X", ""), "../x", "x.xml", 1); err == nil {
+		t.Error("accepted an ID outside the data directory")
+	}
+}
+
+func TestFileStoreFailedUpsert(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s, err := OpenFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.UpsertCV(ctx, testCV("1234", "Ana Souza", "01012023"), "1234", "ana.xml", 10)
+	s.UpsertCV(ctx, testCV("1234", "Ana Souza", "01062024"), "1234", "ana.xml", 10)
+
+	// A directory in place of the CV file makes writing it fail.
+	path := filepath.Join(dir, "curriculos", "1234.json")
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(path, "x"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.UpsertCV(ctx, testCV("1234", "Ana Souza", "01012025"), "1234", "ana.xml", 10); err == nil {
+		t.Fatal("upsert succeeded without writing the CV")
+	}
+	versions, _ := s.ListCVVersions(ctx, "1234")
+	if len(versions) != 2 || versions[1].LastUpdate != "01062024" {
+		t.Errorf("versions after a failed upsert = %+v", versions)
+	}
+}
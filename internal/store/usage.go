@@ -0,0 +1,123 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// AICall is one entry of the log of AI calls: what was generated, for whom
+// and what it consumed.
+type AICall struct {
+	At       time.Time `bson:"at" json:"at"`
+	Kind     string    `bson:"tipo" json:"kind"`
+	LattesID string    `bson:"lattesId,omitempty" json:"lattesId,omitempty"`
+	Client   string    `bson:"cliente" json:"client"`
+	Provider string    `bson:"provider" json:"provider"`
+	Model    string    `bson:"model" json:"model"`
+	// ServerKey is set when the call was made at the server's expense.
+	ServerKey bool `bson:"chaveServidor" json:"serverKey"`
+	// Attempts is how many requests the call took, retries included.
+	Attempts   int `bson:"tentativas,omitempty" json:"attempts,omitempty"`
+	TokenUsage `bson:",inline"`
+}
+
+// Kinds of AICall.
+const (
+	CallSummary  = "resumo"
+	CallAnalysis = "analise"
+	CallChat     = "chat"
+)
+
+// UsageRecord counts the AI requests a client made on one day with the keys
+// managed by the server, and the tokens they were estimated to use.
+type UsageRecord struct {
+	Client    string    `bson:"cliente" json:"client"`
+	Day       string    `bson:"dia" json:"day"`
+	Requests  int64     `bson:"requisicoes" json:"requests"`
+	Tokens    int64     `bson:"tokens" json:"tokens"`
+	UpdatedAt time.Time `bson:"atualizadoEm" json:"updatedAt"`
+}
+
+// latestCalls returns up to limit of calls, stored oldest first, newest first.
+func latestCalls(calls []AICall, limit int) []AICall {
+	latest := make([]AICall, 0, min(limit, len(calls)))
+	for i := len(calls) - 1; i >= 0 && len(latest) < limit; i-- {
+		latest = append(latest, calls[i])
+	}
+	return latest
+}
+
+// sortUsage orders records from the heaviest user down.
+func sortUsage(records []UsageRecord) {
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Tokens != records[j].Tokens {
+			return records[i].Tokens > records[j].Tokens
+		}
+		return records[i].Client < records[j].Client
+	})
+}
+
+// AddUsage adds to the client's counters for day, which may be negative to
+// give back a reservation, and returns the updated totals.
+func (m *MongoDB) AddUsage(ctx context.Context, client, day string, requests, tokens int64) (*UsageRecord, error) {
+	collection := m.database.Collection("uso")
+
+	filter := bson.M{"_id": day + "/" + client}
+	update := bson.M{
+		"$inc": bson.M{"requisicoes": requests, "tokens": tokens},
+		"$set": bson.M{"cliente": client, "dia": day, "atualizadoEm": time.Now().UTC()},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var rec UsageRecord
+	if err := collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&rec); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// ListUsage returns every client's usage on day.
+func (m *MongoDB) ListUsage(ctx context.Context, day string) ([]UsageRecord, error) {
+	collection := m.database.Collection("uso")
+
+	cursor, err := collection.Find(ctx, bson.M{"dia": day})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	records := []UsageRecord{}
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	sortUsage(records)
+	return records, nil
+}
+
+// LogAICall appends call to the chamadas_ia collection.
+func (m *MongoDB) LogAICall(ctx context.Context, call AICall) error {
+	_, err := m.database.Collection("chamadas_ia").InsertOne(ctx, call)
+	return err
+}
+
+// ListAICalls returns the latest limit calls, newest first.
+func (m *MongoDB) ListAICalls(ctx context.Context, limit int) ([]AICall, error) {
+	collection := m.database.Collection("chamadas_ia")
+
+	opts := options.Find().SetSort(bson.D{{Key: "at", Value: -1}}).SetLimit(int64(limit))
+	cursor, err := collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	calls := []AICall{}
+	if err := cursor.All(ctx, &calls); err != nil {
+		return nil, err
+	}
+	return calls, nil
+}
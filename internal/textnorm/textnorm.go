@@ -0,0 +1,84 @@
+// Package textnorm folds text for comparison, so that names, titles and
+// queries match regardless of case, accents and punctuation.
+package textnorm
+
+import (
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// removers holds accent-removing transformers. A transform.Chain keeps
+// internal buffers, so each goroutine needs its own.
+var removers = sync.Pool{
+	New: func() any {
+		return transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	},
+}
+
+// Unaccent lowercases s and strips its diacritics, so "Etnobotânica" and
+// "etnobotanica" compare equal.
+func Unaccent(s string) string {
+	t := removers.Get().(transform.Transformer)
+	defer removers.Put(t)
+	out, _, err := transform.String(t, strings.ToLower(s))
+	if err != nil {
+		return strings.ToLower(s)
+	}
+	return out
+}
+
+// Fold is Unaccent keeping only words of letters and digits, separated by
+// single spaces: "SILVA, M." and "Silva, M" both become "silva m".
+func Fold(s string) string {
+	return strings.Join(strings.FieldsFunc(Unaccent(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// stopwords are function words of Portuguese, English and Spanish titles and
+// questions. Words shorter than three letters are never terms, so they are
+// listed only when a caller keeps short tokens.
+var stopwords = map[string]bool{
+	"a": true, "ao": true, "aos": true, "as": true, "com": true, "como": true, "da": true, "das": true,
+	"de": true, "do": true, "dos": true, "e": true, "em": true, "entre": true, "essa": true, "esse": true,
+	"esta": true, "este": true, "eu": true, "foi": true, "ha": true, "isso": true, "mais": true, "me": true,
+	"na": true, "nas": true, "no": true, "nos": true, "o": true, "os": true, "ou": true, "para": true,
+	"pela": true, "pelas": true, "pelo": true, "pelos": true, "por": true, "qual": true, "quais": true,
+	"quando": true, "que": true, "quem": true, "se": true, "sem": true, "ser": true, "sobre": true,
+	"sao": true, "tem": true, "um": true, "uma": true, "umas": true, "uns": true,
+	"the": true, "and": true, "of": true, "in": true, "on": true, "for": true, "to": true, "with": true,
+	"an": true, "by": true, "from": true, "its": true, "del": true, "los": true, "las": true,
+}
+
+// IsStopword reports whether w, a folded word, is a function word that never
+// identifies a subject.
+func IsStopword(w string) bool {
+	return stopwords[w]
+}
+
+// Singular is a light plural folding of a folded word, so "plantas" and
+// "planta" share a term. Short words are kept as they are.
+func Singular(w string) string {
+	if len(w) > 4 && strings.HasSuffix(w, "s") {
+		return w[:len(w)-1]
+	}
+	return w
+}
+
+// Terms splits s into the words that describe its subject: folded, without
+// stopwords, numbers or words shorter than three letters, and in singular.
+func Terms(s string) []string {
+	var terms []string
+	for _, f := range strings.Fields(Fold(s)) {
+		if len(f) < 3 || stopwords[f] || strings.IndexFunc(f, unicode.IsLetter) < 0 {
+			continue
+		}
+		terms = append(terms, Singular(f))
+	}
+	return terms
+}
@@ -0,0 +1,67 @@
+package textnorm
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestFold(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"Etnobotânica", "etnobotanica"},
+		{"SILVA, M.", "silva m"},
+		{"  Conceição   do Araguaia-PA ", "conceicao do araguaia pa"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := Fold(tt.in); got != tt.want {
+			t.Errorf("Fold(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+	if got := Unaccent("Ação, Já"); got != "acao, ja" {
+		t.Errorf("Unaccent = %q", got)
+	}
+}
+
+func TestTerms(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"Plantas medicinais do Cerrado", []string{"planta", "medicinai", "cerrado"}},
+		{"The ecology of tropical forests, 2020", []string{"ecology", "tropical", "forest"}},
+		{"Uso de DNA em aves", []string{"uso", "dna", "aves"}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		got := Terms(tt.in)
+		if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("Terms(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+	if !IsStopword("para") || IsStopword("planta") {
+		t.Error("IsStopword")
+	}
+}
+
+// TestFoldConcurrent is meant for go test -race: concurrent requests fold
+// queries and titles at the same time.
+func TestFoldConcurrent(t *testing.T) {
+	inputs := []string{"Etnobotânica", "Conceição", "Ecologia de populações", "São João"}
+	want := []string{"etnobotanica", "conceicao", "ecologia de populacoes", "sao joao"}
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				k := (g + i) % len(inputs)
+				if got := Fold(inputs[k]); got != want[k] {
+					t.Errorf("Fold(%q) = %q, want %q", inputs[k], got, want[k])
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}